@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type UserItem struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GrantItem struct {
+	Path       string `json:"path"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+	CreatedBy  string `json:"created_by"`
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Server administration commands",
+}
+
+var adminUserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage user accounts",
+}
+
+var adminGrantCmd = &cobra.Command{
+	Use:   "grant",
+	Short: "Manage folder permissions",
+}
+
+var adminUserLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Users []UserItem `json:"users"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/admin/users", nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, u := range result.Users {
+			status := "active"
+			if u.Disabled {
+				status = "disabled"
+			}
+			fmt.Printf("%-20s  %-6s  %-8s  %s\n", u.Username, u.Role, status, u.CreatedAt.Local().Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var adminUserAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Create a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role, _ := cmd.Flags().GetString("role")
+		password, _ := cmd.Flags().GetString("password")
+		if password == "" {
+			var err error
+			if password, err = promptPassword("Password"); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var user UserItem
+		body := map[string]string{"username": args[0], "password": password, "role": role}
+		if err := client.adminJSON("POST", "/api/v1/admin/users", body, &user); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Created user %s (%s)\n", user.Username, user.Role)
+		return nil
+	},
+}
+
+var adminUserSetCmd = &cobra.Command{
+	Use:   "set <username>",
+	Short: "Change a user's role, password or status",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{}
+		if cmd.Flags().Changed("role") {
+			role, _ := cmd.Flags().GetString("role")
+			body["role"] = role
+		}
+		if cmd.Flags().Changed("disable") {
+			disable, _ := cmd.Flags().GetBool("disable")
+			body["disabled"] = disable
+		}
+		if cmd.Flags().Changed("enable") {
+			body["disabled"] = false
+		}
+		if reset, _ := cmd.Flags().GetBool("password"); reset {
+			password, err := promptPassword("New password")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			body["password"] = password
+		}
+		if len(body) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: nothing to change, use --role, --password, --disable or --enable")
+			return nil
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var user UserItem
+		if err := client.adminJSON("PUT", "/api/v1/admin/users/"+url.PathEscape(args[0]), body, &user); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Updated user %s (%s)\n", user.Username, user.Role)
+		return nil
+	},
+}
+
+var adminUserRmCmd = &cobra.Command{
+	Use:   "rm <username>",
+	Short: "Delete a user and their folder permissions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		if err := client.doAPIRequest("DELETE", "/api/v1/admin/users/"+url.PathEscape(args[0]), nil, 0, "", nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Deleted user %s\n", args[0])
+		return nil
+	},
+}
+
+var adminGrantLsCmd = &cobra.Command{
+	Use:   "ls [claw:/path]",
+	Short: "List folder permissions",
+	Args:  cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := "/api/v1/admin/grants"
+		if len(args) > 0 {
+			remotePath, ok := grantPath(args[0])
+			if !ok {
+				return nil
+			}
+			query += "?path=" + url.QueryEscape(remotePath)
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Grants []GrantItem `json:"grants"`
+		}
+		if err := client.doAPIRequest("GET", query, nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, g := range result.Grants {
+			fmt.Printf("%-20s  %-5s  %s\n", g.Username, g.Permission, g.Path)
+		}
+		return nil
+	},
+}
+
+var adminGrantSetCmd = &cobra.Command{
+	Use:   "set <username> <none|read|write> <claw:/path>",
+	Short: "Grant a user access to a folder and everything below it",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remotePath, ok := grantPath(args[2])
+		if !ok {
+			return nil
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		body := map[string]string{"username": args[0], "permission": args[1], "path": remotePath}
+		if err := client.adminJSON("PUT", "/api/v1/admin/grants", body, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Granted %s %s on %s\n", args[0], args[1], remotePath)
+		return nil
+	},
+}
+
+var adminGrantRmCmd = &cobra.Command{
+	Use:   "rm <username> <claw:/path>",
+	Short: "Remove a folder permission so the folder inherits from its parent again",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remotePath, ok := grantPath(args[1])
+		if !ok {
+			return nil
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		query := "/api/v1/admin/grants?path=" + url.QueryEscape(remotePath) + "&username=" + url.QueryEscape(args[0])
+		if err := client.doAPIRequest("DELETE", query, nil, 0, "", nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Removed %s's permission on %s\n", args[0], remotePath)
+		return nil
+	},
+}
+
+// adminClient 按命令行参数或配置文件创建客户端，出错时打印错误并返回 false
+func adminClient() (*Client, bool) {
+	cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+	if cfg.Endpoint == "" || cfg.LocalKey == "" {
+		loadedCfg, err := loadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return nil, false
+		}
+		cfg = loadedCfg
+	}
+	return NewClient(cfg), true
+}
+
+func (c *Client) adminJSON(method, path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.doAPIRequest(method, path, bytes.NewReader(data), int64(len(data)), "application/json", out)
+}
+
+func grantPath(arg string) (string, bool) {
+	if err := validateRemotePath(arg); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return "", false
+	}
+	remotePath, err := parseRemotePath(arg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return "", false
+	}
+	return remotePath, true
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminUserCmd)
+	adminCmd.AddCommand(adminGrantCmd)
+	adminUserCmd.AddCommand(adminUserLsCmd)
+	adminUserCmd.AddCommand(adminUserAddCmd)
+	adminUserCmd.AddCommand(adminUserSetCmd)
+	adminUserCmd.AddCommand(adminUserRmCmd)
+	adminGrantCmd.AddCommand(adminGrantLsCmd)
+	adminGrantCmd.AddCommand(adminGrantSetCmd)
+	adminGrantCmd.AddCommand(adminGrantRmCmd)
+
+	for _, cmd := range []*cobra.Command{adminUserLsCmd, adminUserAddCmd, adminUserSetCmd, adminUserRmCmd, adminGrantLsCmd, adminGrantSetCmd, adminGrantRmCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+	adminUserAddCmd.Flags().String("role", "viewer", "Role: admin, editor or viewer")
+	adminUserAddCmd.Flags().String("password", "", "Password (prompted if omitted)")
+	adminUserSetCmd.Flags().String("role", "", "New role: admin, editor or viewer")
+	adminUserSetCmd.Flags().Bool("password", false, "Prompt for a new password")
+	adminUserSetCmd.Flags().Bool("disable", false, "Disable the user and revoke their sessions")
+	adminUserSetCmd.Flags().Bool("enable", false, "Re-enable a disabled user")
+}
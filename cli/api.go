@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// APIError 为服务端返回的非 200 响应
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request failed: %s", http.StatusText(e.Status))
+	}
+	return e.Message
+}
+
+// doAPIRequest 发送请求并将响应中的 data 解码到 out，out 为 nil 时忽略 data
+func (c *Client) doAPIRequest(method, path string, body io.Reader, size int64, contentType string, out interface{}) error {
+	req, err := http.NewRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.attachAuth(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var payload APIResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&payload)
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Status: resp.StatusCode}
+		if decodeErr == nil {
+			apiErr.Message = payload.Message
+		}
+		return apiErr
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if payload.Code != 0 {
+		return errors.New(payload.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(payload.Data, out)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type AuditItem struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`
+	IP        string    `json:"ip"`
+	Action    string    `json:"action"`
+	Status    string    `json:"status"`
+	Path      string    `json:"path"`
+	FileID    string    `json:"file_id"`
+	Message   string    `json:"message"`
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the audit log (admin only)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query, ok := auditQuery(cmd)
+		if !ok {
+			return nil
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Total int64       `json:"total"`
+			Items []AuditItem `json:"items"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/audit?"+query.Encode(), nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, e := range result.Items {
+			fmt.Printf("%s  %-12s  %-15s  %-16s  %-7s  %s  %s\n",
+				e.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.Actor, e.IP, e.Action, e.Status, e.Path, e.Message)
+		}
+		if len(result.Items) > 0 {
+			fmt.Printf("Showing %d-%d of %d\n", offset+1, offset+len(result.Items), result.Total)
+		} else {
+			fmt.Printf("No entries (total %d)\n", result.Total)
+		}
+		return nil
+	},
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all matching audit log entries as JSONL or CSV",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query, ok := auditQuery(cmd)
+		if !ok {
+			return nil
+		}
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		query.Set("format", format)
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" && output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := client.ExportAudit(query, w); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		if output != "" && output != "-" {
+			fmt.Fprintf(os.Stderr, "Exported audit log to %s\n", output)
+		}
+		return nil
+	},
+}
+
+// ExportAudit 将导出接口的响应原样写入 w
+func (c *Client) ExportAudit(query url.Values, w io.Writer) error {
+	req, err := http.NewRequest("GET", c.Endpoint+"/api/v1/audit/export?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	c.attachAuth(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Status: resp.StatusCode}
+		var payload APIResponse
+		if json.NewDecoder(resp.Body).Decode(&payload) == nil {
+			apiErr.Message = payload.Message
+		}
+		return apiErr
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// auditQuery 将筛选参数转换为查询字符串，出错时打印错误并返回 false
+func auditQuery(cmd *cobra.Command) (url.Values, bool) {
+	query := url.Values{}
+	for _, name := range []string{"actor", "action", "status"} {
+		if value, _ := cmd.Flags().GetString(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	if value, _ := cmd.Flags().GetString("path"); value != "" {
+		query.Set("path", "/"+strings.TrimPrefix(strings.TrimPrefix(value, "claw:"), "/"))
+	}
+
+	for _, name := range []string{"since", "until"} {
+		value, _ := cmd.Flags().GetString(name)
+		if value == "" {
+			continue
+		}
+		t, err := parseAuditTime(value, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --%s: %v\n", name, err)
+			return nil, false
+		}
+		query.Set(name, t.UTC().Format(time.RFC3339))
+	}
+	return query, true
+}
+
+// parseAuditTime 解析时间参数：RFC 3339 时间、本地日期（2006-01-02），或距今的时长（如 24h、7d）
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("expected a time, a date or a duration such as 24h or 7d")
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("expected a time, a date or a duration such as 24h or 7d")
+	}
+	return now.Add(-d), nil
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditExportCmd)
+
+	for _, cmd := range []*cobra.Command{auditCmd, auditExportCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+		cmd.Flags().String("actor", "", "Only entries by this user")
+		cmd.Flags().String("action", "", "Only this action, e.g. file_delete or auth_login")
+		cmd.Flags().String("status", "", "Only success or failed entries")
+		cmd.Flags().String("path", "", "Only entries for claw:/path and below")
+		cmd.Flags().String("since", "", "Start time: RFC 3339, YYYY-MM-DD, or a duration ago such as 24h or 7d")
+		cmd.Flags().String("until", "", "End time (exclusive), same formats as --since")
+	}
+	auditCmd.Flags().Int("limit", 50, "Maximum entries to show (at most 1000)")
+	auditCmd.Flags().Int("offset", 0, "Skip this many of the newest entries")
+	auditExportCmd.Flags().String("format", "jsonl", "Export format: jsonl or csv")
+	auditExportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Credentials 为 claw-pliers login 保存的令牌，存放在配置目录的 credentials.json
+type Credentials struct {
+	Endpoint         string    `json:"endpoint"`
+	Username         string    `json:"username"`
+	AccessToken      string    `json:"access_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+var (
+	loginUsername string
+	loginPassword string
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to a claw-pliers server and save the tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverURL := endpoint
+		if serverURL == "" {
+			fallback := ""
+			if cfg, err := loadConfig(); err == nil {
+				fallback = cfg.Endpoint
+			}
+			serverURL = prompt("Endpoint", fallback)
+		}
+		if serverURL == "" {
+			fmt.Fprintln(os.Stderr, "Error: endpoint is required")
+			return nil
+		}
+
+		username := loginUsername
+		if username == "" {
+			username = prompt("Username", "admin")
+		}
+		password := loginPassword
+		if password == "" {
+			var err error
+			if password, err = promptPassword("Password"); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+		}
+
+		client := newAuthClient(serverURL)
+		tokens, err := client.Login(username, password)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		creds := newCredentials(client.Endpoint, username, tokens)
+		if err := saveCredentials(creds); err != nil {
+			fmt.Fprintln(os.Stderr, "Error saving credentials:", err)
+			return nil
+		}
+
+		fmt.Printf("Logged in to %s as %s\n", client.Endpoint, username)
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke the saved tokens and remove them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		creds, err := loadCredentials()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Println("Not logged in")
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		client := newAuthClient(creds.Endpoint)
+		if err := client.Logout(creds.RefreshToken); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to revoke tokens on server:", err)
+		}
+
+		if err := removeCredentials(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Logged out from %s\n", creds.Endpoint)
+		return nil
+	},
+}
+
+func (c *Client) Login(username, password string) (TokenResponse, error) {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	var tokens TokenResponse
+	err := c.doAPIRequest("POST", "/api/v1/auth/login", bytes.NewReader(body), int64(len(body)), "application/json", &tokens)
+	return tokens, err
+}
+
+func (c *Client) Refresh(refreshToken string) (TokenResponse, error) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	var tokens TokenResponse
+	err := c.doAPIRequest("POST", "/api/v1/auth/refresh", bytes.NewReader(body), int64(len(body)), "application/json", &tokens)
+	return tokens, err
+}
+
+func (c *Client) Logout(refreshToken string) error {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	return c.doAPIRequest("POST", "/api/v1/auth/logout", bytes.NewReader(body), int64(len(body)), "application/json", nil)
+}
+
+// loginToken 返回与当前地址匹配的已保存访问令牌，过期时用刷新令牌换取新令牌并保存；没有可用令牌时返回空
+func (c *Client) loginToken() string {
+	creds, err := loadCredentials()
+	if err != nil || creds.Endpoint != c.Endpoint {
+		return ""
+	}
+
+	now := time.Now()
+	if now.Add(30 * time.Second).Before(creds.ExpiresAt) {
+		return creds.AccessToken
+	}
+	if creds.RefreshToken == "" || now.After(creds.RefreshExpiresAt) {
+		fmt.Fprintln(os.Stderr, "Warning: login expired, run 'claw-pliers login' again")
+		return ""
+	}
+
+	tokens, err := c.Refresh(creds.RefreshToken)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to refresh login, run 'claw-pliers login' again:", err)
+		return ""
+	}
+
+	creds = newCredentials(creds.Endpoint, creds.Username, tokens)
+	if err := saveCredentials(creds); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to save refreshed tokens:", err)
+	}
+	return creds.AccessToken
+}
+
+// newAuthClient 创建不携带任何认证信息的客户端，用于登录相关接口
+func newAuthClient(serverURL string) *Client {
+	return &Client{
+		Endpoint: strings.TrimRight(serverURL, "/"),
+		HTTP:     newHTTPClient(30*time.Second, resolveClientTLS(Config{})),
+	}
+}
+
+func newCredentials(endpoint, username string, tokens TokenResponse) Credentials {
+	now := time.Now()
+	return Credentials{
+		Endpoint:         endpoint,
+		Username:         username,
+		AccessToken:      tokens.AccessToken,
+		ExpiresAt:        now.Add(time.Duration(tokens.ExpiresIn) * time.Second),
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: now.Add(time.Duration(tokens.RefreshExpiresIn) * time.Second),
+	}
+}
+
+func credentialsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials.json"), nil
+}
+
+func loadCredentials() (Credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return Credentials{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return Credentials{}, err
+	}
+	return creds, nil
+}
+
+// saveCredentials 以 0600 权限写入令牌文件
+func saveCredentials(creds Credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func removeCredentials() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// promptPassword 在终端中不回显地读取密码，标准输入不是终端时按行读取
+func promptPassword(label string) (string, error) {
+	fd := int(syscall.Stdin)
+	if !term.IsTerminal(fd) {
+		return prompt(label, ""), nil
+	}
+
+	fmt.Printf("%s: ", label)
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	loginCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "Username")
+	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "Password (prompted if omitted)")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var adminEncryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Show storage encryption status and data keys per master key",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var status struct {
+			Enabled      bool             `json:"enabled"`
+			CurrentKeyID string           `json:"current_key_id"`
+			Keys         map[string]int64 `json:"keys"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/admin/encryption", nil, 0, "", &status); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if !status.Enabled {
+			fmt.Println("Storage encryption is disabled")
+			return nil
+		}
+		fmt.Printf("Storage encryption is enabled, current master key %s\n", status.CurrentKeyID)
+
+		ids := make([]string, 0, len(status.Keys))
+		for id := range status.Keys {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			label := ""
+			if id == status.CurrentKeyID {
+				label = " (current)"
+			}
+			fmt.Printf("  %s  %d data keys%s\n", id, status.Keys[id], label)
+		}
+		return nil
+	},
+}
+
+var adminEncryptionRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-wrap data keys still encrypted by a previous master key with the current one",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Rewrapped int `json:"rewrapped"`
+		}
+		if err := client.doAPIRequest("POST", "/api/v1/admin/encryption/rotate", nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Re-wrapped %d data keys with the current master key\n", result.Rewrapped)
+		if result.Rewrapped > 0 {
+			fmt.Println("Previous master keys can now be removed from the server config")
+		}
+		return nil
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(adminEncryptionCmd)
+	adminEncryptionCmd.AddCommand(adminEncryptionRotateCmd)
+
+	for _, cmd := range []*cobra.Command{adminEncryptionCmd, adminEncryptionRotateCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,8 +32,9 @@ var fileCmd = &cobra.Command{
 }
 
 type Config struct {
-	Endpoint string `yaml:"endpoint"`
-	LocalKey string `yaml:"local_key"`
+	Endpoint string          `yaml:"endpoint"`
+	LocalKey string          `yaml:"local_key"`
+	TLS      ClientTLSConfig `yaml:"tls"`
 }
 
 type APIResponse struct {
@@ -45,6 +49,9 @@ type FileItem struct {
 	Path         string `json:"path,omitempty"`
 	Size         int64  `json:"size"`
 	MimeType     string `json:"mime_type"`
+	SHA256       string `json:"sha256,omitempty"`
+	Deduplicated bool   `json:"deduplicated,omitempty"`
+	Version      int    `json:"version,omitempty"`
 	CreatedAt    string `json:"created_at"`
 }
 
@@ -67,9 +74,10 @@ type FolderListResponse struct {
 }
 
 type Client struct {
-	Endpoint string
-	LocalKey string
-	HTTP     *http.Client
+	Endpoint    string
+	LocalKey    string
+	AccessToken string
+	HTTP        *http.Client
 }
 
 func loadConfig() (Config, error) {
@@ -78,23 +86,36 @@ func loadConfig() (Config, error) {
 		return loadConfigFromPath(projectConfig)
 	}
 
-	configDir := os.Getenv("CLAWPLIERS_CONFIG_DIR")
-	if configDir == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return Config{}, err
-		}
-		configDir = filepath.Join(home, ".config", "claw-pliers")
+	dir, err := configDir()
+	if err != nil {
+		return Config{}, err
 	}
 
-	userConfig := filepath.Join(configDir, "config.yaml")
+	userConfig := filepath.Join(dir, "config.yaml")
 	if _, err := os.Stat(userConfig); err == nil {
 		return loadConfigFromPath(userConfig)
 	}
 
+	// 没有配置文件但已登录远程服务时，使用登录时的地址
+	if creds, err := loadCredentials(); err == nil && creds.Endpoint != "" {
+		return Config{Endpoint: creds.Endpoint}, nil
+	}
+
 	return Config{}, errors.New("config file not found: ./data/config/config.yaml or ~/.config/claw-pliers/config.yaml")
 }
 
+// configDir 返回用户配置目录，可通过 CLAWPLIERS_CONFIG_DIR 覆盖
+func configDir() (string, error) {
+	if dir := os.Getenv("CLAWPLIERS_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "claw-pliers"), nil
+}
+
 func loadConfigFromPath(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -110,39 +131,67 @@ func loadConfigFromPath(path string) (Config, error) {
 	localKey := ""
 
 	if server, ok := raw["server"].(map[string]interface{}); ok {
+		scheme := "http"
+		if serverTLS, ok := server["tls"].(map[string]interface{}); ok {
+			if enabled, _ := serverTLS["enabled"].(bool); enabled {
+				scheme = "https"
+			}
+		}
 		if port, ok := server["port"].(int); ok {
-			endpoint = fmt.Sprintf("http://localhost:%d", port)
+			endpoint = fmt.Sprintf("%s://localhost:%d", scheme, port)
 		} else if portFloat, ok := server["port"].(float64); ok {
-			endpoint = fmt.Sprintf("http://localhost:%d", int(portFloat))
+			endpoint = fmt.Sprintf("%s://localhost:%d", scheme, int(portFloat))
 		}
 	}
+	// 显式配置的 endpoint 优先，用于连接远程或使用证书域名访问的服务
+	if ep, ok := raw["endpoint"].(string); ok && ep != "" {
+		endpoint = ep
+	}
 
 	if auth, ok := raw["auth"].(map[string]interface{}); ok {
 		if lk, ok := auth["local_key"].(string); ok {
 			localKey = lk
 		}
+		if ak, ok := auth["api_key"].(string); ok && ak != "" {
+			localKey = ak
+		}
 	}
 
 	if endpoint == "" {
 		endpoint = "http://localhost:8080"
 	}
 
-	return Config{Endpoint: endpoint, LocalKey: localKey}, nil
+	var clientTLS ClientTLSConfig
+	if t, ok := raw["tls"].(map[string]interface{}); ok {
+		clientTLS.CAFile, _ = t["ca_file"].(string)
+		clientTLS.CertFile, _ = t["cert_file"].(string)
+		clientTLS.KeyFile, _ = t["key_file"].(string)
+	}
+
+	return Config{Endpoint: endpoint, LocalKey: localKey, TLS: clientTLS}, nil
 }
 
 func NewClient(cfg Config) *Client {
-	return &Client{
+	c := &Client{
 		Endpoint: strings.TrimRight(cfg.Endpoint, "/"),
 		LocalKey: cfg.LocalKey,
-		HTTP: &http.Client{
-			Timeout: 300 * time.Second,
-		},
+		HTTP:     newHTTPClient(300*time.Second, resolveClientTLS(cfg)),
 	}
+	if c.LocalKey == "" {
+		c.AccessToken = c.loginToken()
+	}
+	return c
 }
 
+// attachAuth 优先使用配置的密钥（cpk_ 开头的为 API 密钥，否则为 local key），
+// 否则使用 claw-pliers login 保存的访问令牌
 func (c *Client) attachAuth(req *http.Request) {
-	if c.LocalKey != "" {
+	if strings.HasPrefix(c.LocalKey, apiKeyPrefix) {
+		req.Header.Set("X-API-Key", c.LocalKey)
+	} else if c.LocalKey != "" {
 		req.Header.Set("X-Local-Key", c.LocalKey)
+	} else if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
 	}
 }
 
@@ -375,7 +424,8 @@ var fileRmCmd = &cobra.Command{
 		}
 
 		if isDir {
-			err = client.DeleteFolder(p)
+			recursive, _ := cmd.Flags().GetBool("recursive")
+			err = client.DeleteFolder(p, recursive)
 		} else {
 			err = client.DeleteFile(p)
 		}
@@ -384,7 +434,7 @@ var fileRmCmd = &cobra.Command{
 			return nil
 		}
 
-		fmt.Printf("Removed: %s\n", p)
+		fmt.Printf("Moved to trash: %s\n", p)
 		return nil
 	},
 }
@@ -435,10 +485,11 @@ var fileMvCmd = &cobra.Command{
 			return nil
 		}
 
+		target := client.resolveTarget(dst)
 		if isDir {
-			err = client.RenameFolder(src, dst)
+			err = client.MoveFolder(src, target)
 		} else {
-			err = client.MoveFile(src, dst)
+			err = client.MoveFile(src, target)
 		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
@@ -450,6 +501,79 @@ var fileMvCmd = &cobra.Command{
 	},
 }
 
+var fileCpCmd = &cobra.Command{
+	Use:   "cp claw:/<src> claw:/<dst>",
+	Short: "Copy file or directory on the server",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		srcPath := args[0]
+		dstPath := args[1]
+
+		if err := validateRemotePath(srcPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		if err := validateRemotePath(dstPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		src, err := parseRemotePath(srcPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		dst, err := parseRemotePath(dstPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+
+		isDir, err := client.IsDirectory(src)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		if isDir && !recursive {
+			fmt.Fprintf(os.Stderr, "Error: %s is a directory, use -r to copy it\n", src)
+			return nil
+		}
+
+		target := client.resolveTarget(dst)
+		var result CopyResult
+		if isDir {
+			result, err = client.CopyFolder(src, target)
+		} else {
+			result, err = client.CopyFile(src, target)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if isDir {
+			fmt.Printf("Copied: %s -> %s (%d folders, %d files, %s)\n", src, result.Path, result.Folders, result.Files, formatSize(result.Size))
+		} else {
+			fmt.Printf("Copied: %s -> %s\n", src, result.Path)
+		}
+		return nil
+	},
+}
+
 var filePutCmd = &cobra.Command{
 	Use:   "put <local> claw:/[remote]",
 	Short: "Upload a file",
@@ -507,37 +631,50 @@ var filePutCmd = &cobra.Command{
 			fullRemotePath = remotePath
 		}
 
-		// Check for duplicate file in target directory
-		targetFileName := filepath.Base(fullRemotePath)
-		dirPath := filepath.Dir(fullRemotePath)
-		if dirPath == "." {
-			dirPath = "/"
-		}
-		files, _, err := client.ListFiles(dirPath)
-		if err == nil {
-			for _, f := range files {
-				if f.OriginalName == targetFileName {
-					fmt.Printf("\nError: File '%s' already exists in directory '%s'\n", targetFileName, dirPath)
-					fmt.Println("Please use a different filename or delete the existing file first.")
-					return nil
-				}
-			}
-		}
-
 		fmt.Printf("Uploading %s (%s)...\n", localFileName, formatSize(info.Size()))
 
-		file, err := client.UploadFileByPath(localPath, fullRemotePath, func(pct int) {
+		chunkMB, _ := cmd.Flags().GetInt64("chunk-size")
+		chunkSize := chunkMB * 1024 * 1024
+		if chunkSize <= 0 {
+			chunkSize = defaultChunkSize
+		}
+
+		printProgress := func(pct int) {
 			fmt.Printf("\rProgress: %d%%", pct)
-		})
+		}
+
+		// 服务端已有相同内容时直接秒传，否则超过一个分片大小的文件走分片上传，中断后重新执行同一命令即可续传
+		file, found, err := client.UploadFileByHash(localPath, fullRemotePath)
 		if err != nil {
 			fmt.Printf("\nError: %v\n", err)
 			return nil
 		}
-		fmt.Printf("\n✓ Uploaded: %s (path: %s)\n", file.OriginalName, file.Path)
+		if found {
+			fmt.Printf("✓ Uploaded: %s (path: %s, deduplicated%s)\n", file.OriginalName, file.Path, versionSuffix(file.Version))
+			return nil
+		}
+		if info.Size() > chunkSize {
+			file, err = client.UploadFileChunked(localPath, fullRemotePath, chunkSize, printProgress)
+		} else {
+			file, err = client.UploadFileByPath(localPath, fullRemotePath, printProgress)
+		}
+		if err != nil {
+			fmt.Printf("\nError: %v\n", err)
+			return nil
+		}
+		fmt.Printf("\n✓ Uploaded: %s (path: %s%s)\n", file.OriginalName, file.Path, versionSuffix(file.Version))
 		return nil
 	},
 }
 
+// versionSuffix 覆盖已有文件时提示新版本号
+func versionSuffix(version int) string {
+	if version > 1 {
+		return fmt.Sprintf(", version %d", version)
+	}
+	return ""
+}
+
 var fileGetCmd = &cobra.Command{
 	Use:   "get claw:/<remote> [local]",
 	Short: "Download a file",
@@ -575,7 +712,8 @@ var fileGetCmd = &cobra.Command{
 
 		fmt.Printf("Downloading %s...\n", p)
 
-		path, err := client.DownloadFileByPath(p, localPath, func(pct int) {
+		resume, _ := cmd.Flags().GetBool("continue")
+		path, err := client.DownloadFileByPath(p, localPath, resume, func(pct int) {
 			fmt.Printf("\rProgress: %d%%", pct)
 		})
 		if err != nil {
@@ -762,67 +900,56 @@ func (c *Client) DeleteFile(path string) error {
 	return nil
 }
 
-func (c *Client) DeleteFolder(path string) error {
-	url := c.Endpoint + "/api/v1/folders/by-path?path=" + path
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
+func (c *Client) DeleteFolder(path string, recursive bool) error {
+	query := "/api/v1/folders/by-path?path=" + url.QueryEscape(path)
+	if recursive {
+		query += "&recursive=true"
 	}
-	c.attachAuth(req)
-
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed: %s", resp.Status)
-	}
-	return nil
+	return c.doAPIRequest("DELETE", query, nil, 0, "", nil)
 }
 
 func (c *Client) MoveFile(srcPath, dstPath string) error {
-	url := c.Endpoint + "/api/v1/files/by-path?path=" + srcPath + "&new_path=" + dstPath
+	return c.doAPIRequest("PUT", "/api/v1/files/by-path?"+pathPair(srcPath, dstPath), nil, 0, "", nil)
+}
 
-	req, err := http.NewRequest("PUT", url, nil)
-	if err != nil {
-		return err
-	}
-	c.attachAuth(req)
+func (c *Client) MoveFolder(srcPath, dstPath string) error {
+	return c.doAPIRequest("PUT", "/api/v1/folders/by-path?"+pathPair(srcPath, dstPath), nil, 0, "", nil)
+}
 
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// CopyResult 为服务端复制的结果，单个文件时 Folders 为 0
+type CopyResult struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Folders int    `json:"folders"`
+	Files   int    `json:"files"`
+	Size    int64  `json:"size"`
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("move failed: %s", resp.Status)
-	}
-	return nil
+func (c *Client) CopyFile(srcPath, dstPath string) (CopyResult, error) {
+	var result CopyResult
+	err := c.doAPIRequest("POST", "/api/v1/files/by-path/copy?"+pathPair(srcPath, dstPath), nil, 0, "", &result)
+	return result, err
 }
 
-func (c *Client) RenameFolder(srcPath, dstPath string) error {
-	url := c.Endpoint + "/api/v1/folders/by-path?path=" + srcPath + "&new_name=" + filepath.Base(dstPath)
+func (c *Client) CopyFolder(srcPath, dstPath string) (CopyResult, error) {
+	var result CopyResult
+	err := c.doAPIRequest("POST", "/api/v1/folders/by-path/copy?"+pathPair(srcPath, dstPath), nil, 0, "", &result)
+	return result, err
+}
 
-	req, err := http.NewRequest("PUT", url, nil)
-	if err != nil {
-		return err
-	}
-	c.attachAuth(req)
+func pathPair(srcPath, dstPath string) string {
+	return "path=" + url.QueryEscape(srcPath) + "&new_path=" + url.QueryEscape(dstPath)
+}
 
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return err
+// resolveTarget 目标为已存在的文件夹时返回以 / 结尾的路径，服务端据此放入该文件夹并沿用原名称
+func (c *Client) resolveTarget(dstPath string) string {
+	if strings.HasSuffix(dstPath, "/") {
+		return dstPath
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("rename failed: %s", resp.Status)
+	if isDir, err := c.IsDirectory(dstPath); err == nil && isDir {
+		return dstPath + "/"
 	}
-	return nil
+	return dstPath
 }
 
 func (c *Client) IsDirectory(path string) (bool, error) {
@@ -903,16 +1030,12 @@ func (c *Client) UploadFileByPath(localPath, remotePath string, progress func(in
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return FileItem{}, fmt.Errorf("upload failed: %s", resp.Status)
-	}
-
 	var payload APIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return FileItem{}, err
+		return FileItem{}, fmt.Errorf("upload failed: %s", resp.Status)
 	}
-	if payload.Code != 0 {
-		return FileItem{}, errors.New(payload.Message)
+	if resp.StatusCode != http.StatusOK || payload.Code != 0 {
+		return FileItem{}, fmt.Errorf("upload failed: %s", payload.Message)
 	}
 
 	var data FileItem
@@ -922,25 +1045,53 @@ func (c *Client) UploadFileByPath(localPath, remotePath string, progress func(in
 	return data, nil
 }
 
-func (c *Client) DownloadFileByPath(remotePath, localPath string, progress func(int)) (string, error) {
-	url := c.Endpoint + "/api/v1/files/by-path/download?path=" + remotePath
+// downloadState 记录本地未完成的下载，续传时用 ETag 确认远程文件没有变化
+type downloadState struct {
+	RemotePath string `json:"remote_path"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+func downloadStatePath(localPath, remotePath string) (string, error) {
+	configDir, err := stateDir()
 	if err != nil {
 		return "", err
 	}
-	c.attachAuth(req)
 
-	resp, err := c.HTTP.Do(req)
+	absPath, err := filepath.Abs(localPath)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
+	sum := sha1.Sum([]byte(absPath + "\n" + remotePath))
+	return filepath.Join(configDir, "downloads", hex.EncodeToString(sum[:])+".json"), nil
+}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return "", fmt.Errorf("download failed: %s", resp.Status)
+func loadDownloadState(path string) (downloadState, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return downloadState{}, false
 	}
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil || state.ETag == "" {
+		return downloadState{}, false
+	}
+	return state, true
+}
+
+func saveDownloadState(path string, state downloadState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
 
+// DownloadFileByPath 下载文件。resume 为 true 时从本地已有的长度续传，请求带上首次下载时记录的 ETag 作为 If-Range，
+// 远程文件已变化、没有续传记录或本地长度与记录不符时从头重新下载
+func (c *Client) DownloadFileByPath(remotePath, localPath string, resume bool, progress func(int)) (string, error) {
 	filename := filepath.Base(remotePath)
 	if localPath == "" || localPath == "." {
 		localPath = filename
@@ -948,11 +1099,61 @@ func (c *Client) DownloadFileByPath(remotePath, localPath string, progress func(
 		localPath = filepath.Join(localPath, filename)
 	}
 
+	statePath, err := downloadStatePath(localPath, remotePath)
+	if err != nil {
+		return "", err
+	}
+
+	var offset int64
+	var etag string
+	if resume {
+		info, err := os.Stat(localPath)
+		state, ok := loadDownloadState(statePath)
+		if err == nil && !info.IsDir() && ok && state.RemotePath == remotePath && info.Size() <= state.Size {
+			offset, etag = info.Size(), state.ETag
+		}
+	}
+
+	url := c.Endpoint + "/api/v1/files/by-path/download?path=" + remotePath
+	resp, err := c.openDownload(url, offset, etag)
+	if err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && contentRangeTotal(resp) == offset {
+			// 本地文件已完整
+			resp.Body.Close()
+			os.Remove(statePath)
+			return localPath, nil
+		}
+		if resp.StatusCode != http.StatusPartialContent || contentRangeStart(resp) != offset {
+			resp.Body.Close()
+			offset = 0
+			if resp, err = c.openDownload(url, 0, ""); err != nil {
+				return "", err
+			}
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", fmt.Errorf("download failed: %s", resp.Status)
+	}
+
 	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
 		return "", err
 	}
 
-	outFile, err := os.Create(localPath)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") && resp.ContentLength >= 0 {
+		// 弱 ETag 不能用于 If-Range，这类文件中断后只能从头下载
+		if err := saveDownloadState(statePath, downloadState{RemotePath: remotePath, ETag: etag, Size: resp.ContentLength}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save download state: %v\n", err)
+		}
+	}
+	outFile, err := os.OpenFile(localPath, flags, 0o644)
 	if err != nil {
 		return "", err
 	}
@@ -968,15 +1169,51 @@ func (c *Client) DownloadFileByPath(remotePath, localPath string, progress func(
 		return "", err
 	}
 
+	os.Remove(statePath)
 	return localPath, nil
 }
 
+// openDownload 发起下载请求，offset 大于 0 时只在 ETag 仍为 etag 时请求 offset 之后的内容
+func (c *Client) openDownload(url string, offset int64, etag string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.attachAuth(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+	}
+	return c.HTTP.Do(req)
+}
+
+// contentRangeStart 返回 206 响应 Content-Range 的起始位置，无法解析时返回 -1
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end, total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return -1
+	}
+	return start
+}
+
+// contentRangeTotal 返回 416 响应 Content-Range（bytes */<size>）中的文件大小，无法解析时返回 -1
+func contentRangeTotal(resp *http.Response) int64 {
+	var total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total); err != nil {
+		return -1
+	}
+	return total
+}
+
 type FileInfo struct {
 	FileID       string `json:"file_id"`
 	OriginalName string `json:"original_name"`
 	Path         string `json:"path"`
 	Size         int64  `json:"size"`
 	MimeType     string `json:"mime_type"`
+	SHA256       string `json:"sha256"`
+	Integrity    string `json:"integrity"`
+	Version      int    `json:"version"`
 	CreatedAt    string `json:"created_at"`
 	DownloadLink string `json:"download_link"`
 	ExpiresAt    string `json:"expires_at"`
@@ -1021,10 +1258,23 @@ func printFileInfo(info FileInfo) {
 	fmt.Printf("Path: %s\n", info.Path)
 	fmt.Printf("Size: %s\n", formatSize(info.Size))
 	fmt.Printf("Type: %s\n", info.MimeType)
+	if info.SHA256 != "" {
+		fmt.Printf("SHA256: %s\n", info.SHA256)
+	}
+	if info.Integrity != "" && info.Integrity != "ok" {
+		fmt.Printf("Integrity: %s (run 'claw-pliers file fsck' for details)\n", info.Integrity)
+	}
+	if info.Version > 1 {
+		fmt.Printf("Version: %d\n", info.Version)
+	}
 	fmt.Printf("Created: %s\n", info.CreatedAt)
 	if info.DownloadLink != "" {
-		fmt.Printf("\nDownload Link (valid for 7 days):\n%s\n", info.DownloadLink)
-		fmt.Printf("Expires: %s\n", info.ExpiresAt)
+		fmt.Printf("\nDownload Link:\n%s\n", info.DownloadLink)
+		if info.ExpiresAt != "" {
+			fmt.Printf("Expires: %s\n", info.ExpiresAt)
+		}
+	} else {
+		fmt.Printf("\nNo download link, create one with: claw-pliers file share create claw:%s\n", info.Path)
 	}
 }
 
@@ -1035,9 +1285,13 @@ func init() {
 	fileCmd.AddCommand(fileMkdirCmd)
 	fileCmd.AddCommand(fileRmCmd)
 	fileCmd.AddCommand(fileMvCmd)
+	fileCmd.AddCommand(fileCpCmd)
+	fileCmd.AddCommand(fileDuCmd)
 	fileCmd.AddCommand(filePutCmd)
 	fileCmd.AddCommand(fileGetCmd)
 	fileCmd.AddCommand(fileInfoCmd)
+	fileCmd.AddCommand(fileFsckCmd)
+	fileCmd.AddCommand(fileTrashCmd)
 
 	fileLsCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	fileLsCmd.Flags().StringVar(&localKey, "key", "", "Local key")
@@ -1047,16 +1301,28 @@ func init() {
 
 	fileRmCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	fileRmCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	fileRmCmd.Flags().BoolP("recursive", "r", false, "Remove a non-empty directory with all its contents")
 
 	fileMvCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	fileMvCmd.Flags().StringVar(&localKey, "key", "", "Local key")
 
+	fileCpCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	fileCpCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	fileCpCmd.Flags().BoolP("recursive", "r", false, "Copy directories recursively")
+
 	filePutCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	filePutCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	filePutCmd.Flags().Int64("chunk-size", 8, "Chunk size in MB for resumable uploads")
 
 	fileGetCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	fileGetCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	fileGetCmd.Flags().Bool("continue", false, "Resume a partially downloaded file")
 
 	fileInfoCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
 	fileInfoCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+
+	fileFsckCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	fileFsckCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	fileFsckCmd.Flags().Bool("repair", false, "Quarantine orphan objects and mark broken file records")
+	fileFsckCmd.Flags().Bool("quick", false, "Only compare sizes, skip checksum verification")
 }
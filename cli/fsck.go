@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type FsckIssue struct {
+	Kind      string `json:"kind"`
+	FileID    string `json:"file_id"`
+	ObjectKey string `json:"object_key"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	Action    string `json:"action"`
+}
+
+type FsckReport struct {
+	CheckedFiles   int            `json:"checked_files"`
+	CheckedObjects int            `json:"checked_objects"`
+	Repair         bool           `json:"repair"`
+	Repaired       int            `json:"repaired"`
+	Summary        map[string]int `json:"summary"`
+	Issues         []FsckIssue    `json:"issues"`
+}
+
+var fileFsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Verify that file records and stored objects agree",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repair, _ := cmd.Flags().GetBool("repair")
+		quick, _ := cmd.Flags().GetBool("quick")
+
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+		// 校验需要读取全部对象，放宽客户端超时
+		client.HTTP.Timeout = 2 * time.Hour
+
+		report, err := client.Fsck(repair, !quick)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		printFsckReport(report)
+		return nil
+	},
+}
+
+func (c *Client) Fsck(repair, checksum bool) (FsckReport, error) {
+	body, err := json.Marshal(map[string]bool{"repair": repair, "checksum": checksum})
+	if err != nil {
+		return FsckReport{}, err
+	}
+
+	req, err := http.NewRequest("POST", c.Endpoint+"/api/v1/admin/fsck", bytes.NewReader(body))
+	if err != nil {
+		return FsckReport{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.attachAuth(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return FsckReport{}, err
+	}
+	defer resp.Body.Close()
+
+	var payload APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return FsckReport{}, fmt.Errorf("fsck failed: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || payload.Code != 0 {
+		return FsckReport{}, errors.New(payload.Message)
+	}
+
+	var report FsckReport
+	if err := json.Unmarshal(payload.Data, &report); err != nil {
+		return FsckReport{}, err
+	}
+	return report, nil
+}
+
+func printFsckReport(report FsckReport) {
+	fmt.Printf("Checked %d files, %d objects\n", report.CheckedFiles, report.CheckedObjects)
+	if len(report.Issues) == 0 {
+		fmt.Println("✓ No problems found")
+		return
+	}
+
+	kinds := make([]string, 0, len(report.Summary))
+	for kind := range report.Summary {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		fmt.Printf("\n%s (%d):\n", kind, report.Summary[kind])
+		for _, issue := range report.Issues {
+			if issue.Kind != kind {
+				continue
+			}
+			line := "  " + issue.ObjectKey
+			if issue.FileID != "" {
+				line += " (file " + issue.FileID + ")"
+			}
+			if issue.Expected != "" {
+				line += fmt.Sprintf(" expected=%s actual=%s", issue.Expected, issue.Actual)
+			}
+			if issue.Action != "" {
+				line += " -> " + issue.Action
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if report.Repair {
+		fmt.Printf("\nRepaired %d issue(s)\n", report.Repaired)
+	} else {
+		fmt.Println("\nRun with --repair to quarantine orphans and mark broken records")
+	}
+}
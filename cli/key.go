@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// apiKeyPrefix 为服务端签发的 API 密钥前缀，用于区分 API 密钥和 local key
+const apiKeyPrefix = "cpk_"
+
+type APIKeyItem struct {
+	KeyID      string     `json:"key_id"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	Paths      []string   `json:"paths"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Key        string     `json:"key"`
+}
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage API keys",
+}
+
+var keyCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an API key (the key is shown only once)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		pathArgs, _ := cmd.Flags().GetStringSlice("path")
+		expires, _ := cmd.Flags().GetDuration("expires")
+		if len(scopes) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: at least one --scope is required")
+			return nil
+		}
+
+		paths := make([]string, 0, len(pathArgs))
+		for _, arg := range pathArgs {
+			remotePath, ok := grantPath(arg)
+			if !ok {
+				return nil
+			}
+			paths = append(paths, remotePath)
+		}
+
+		body := map[string]interface{}{"name": args[0], "scopes": scopes, "paths": paths}
+		if expires > 0 {
+			body["expires_at"] = time.Now().Add(expires).UTC()
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var key APIKeyItem
+		if err := client.adminJSON("POST", "/api/v1/keys", body, &key); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Created key %s (%s)\n", key.KeyID, key.Name)
+		fmt.Println(key.Key)
+		fmt.Println("Store this key now, it cannot be shown again.")
+		return nil
+	},
+}
+
+var keyLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List API keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Keys []APIKeyItem `json:"keys"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/keys", nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, k := range result.Keys {
+			status := "active"
+			if k.RevokedAt != nil {
+				status = "revoked"
+			} else if k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now()) {
+				status = "expired"
+			}
+			lastUsed := "never"
+			if k.LastUsedAt != nil {
+				lastUsed = k.LastUsedAt.Local().Format("2006-01-02 15:04")
+			}
+			paths := "/"
+			if len(k.Paths) > 0 {
+				paths = strings.Join(k.Paths, ",")
+			}
+			fmt.Printf("%s  %-16s  %-10s  %-7s  %-16s  %-24s  %s\n",
+				k.KeyID, k.Name, k.Owner, status, lastUsed, strings.Join(k.Scopes, ","), paths)
+		}
+		return nil
+	},
+}
+
+var keyRevokeCmd = &cobra.Command{
+	Use:   "revoke <key_id>",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		if err := client.doAPIRequest("DELETE", "/api/v1/keys/"+url.PathEscape(args[0]), nil, 0, "", nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Revoked key %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(keyCreateCmd)
+	keyCmd.AddCommand(keyLsCmd)
+	keyCmd.AddCommand(keyRevokeCmd)
+
+	for _, cmd := range []*cobra.Command{keyCreateCmd, keyLsCmd, keyRevokeCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+	keyCreateCmd.Flags().StringSlice("scope", nil, "Scope, repeatable: file:read, file:write, mail:read, mail:send, image:convert, image:ocr, admin, <module>:* or *")
+	keyCreateCmd.Flags().StringSlice("path", nil, "Restrict the key to claw:/path and below, repeatable")
+	keyCreateCmd.Flags().Duration("expires", 0, "Expire after this duration, e.g. 720h (default never)")
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -38,47 +42,92 @@ var mailCmd = &cobra.Command{
 }
 
 var mailSendCmd = &cobra.Command{
-	Use:   "send --from <email> --to <email> --subject <subject> --body <body>",
+	Use:   "send --to <email> --subject <subject> --body <body> [--html <html>] [--attach <file|claw:/path>]...",
 	Short: "Send an email",
+	Long: `Send an email through the server.
+
+--to, --cc and --bcc accept several addresses, comma separated or repeated.
+--attach takes a local file, which is uploaded with the request, or a claw:/ path
+of a file already on the server. With --reply-to-uid the message is threaded as a
+reply to that INBOX message; --subject and --to default to "Re: <subject>" and
+the original sender.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		from, _ := cmd.Flags().GetString("from")
-		to, _ := cmd.Flags().GetString("to")
+		to, _ := cmd.Flags().GetStringSlice("to")
+		cc, _ := cmd.Flags().GetStringSlice("cc")
+		bcc, _ := cmd.Flags().GetStringSlice("bcc")
 		subject, _ := cmd.Flags().GetString("subject")
 		body, _ := cmd.Flags().GetString("body")
+		html, _ := cmd.Flags().GetString("html")
+		attach, _ := cmd.Flags().GetStringArray("attach")
+		headers, _ := cmd.Flags().GetStringArray("header")
+		replyToUID, _ := cmd.Flags().GetUint32("reply-to-uid")
 
-		if from == "" || to == "" || subject == "" || body == "" {
-			fmt.Println("Error: --from, --to, --subject and --body are required")
+		if from == "" {
+			config, err := loadMailConfig()
+			if err != nil || len(config.Accounts) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: --from is required")
+				return nil
+			}
+			from = config.Accounts[0].Email
+		}
+		if replyToUID == 0 && (len(to)+len(cc)+len(bcc) == 0 || subject == "") {
+			fmt.Fprintln(os.Stderr, "Error: --to and --subject are required unless --reply-to-uid is set")
 			return nil
 		}
-
-		config, err := loadMailConfig()
-		if err != nil || len(config.Accounts) == 0 {
-			fmt.Println("Error: no accounts configured")
+		if body == "" && html == "" {
+			fmt.Fprintln(os.Stderr, "Error: --body or --html is required")
 			return nil
 		}
 
-		var account *MailAccount
-		for i := range config.Accounts {
-			if config.Accounts[i].Email == from {
-				account = &config.Accounts[i]
-				break
+		request := map[string]interface{}{
+			"from":         from,
+			"to":           to,
+			"cc":           cc,
+			"bcc":          bcc,
+			"subject":      subject,
+			"body":         body,
+			"html":         html,
+			"reply_to_uid": replyToUID,
+		}
+		if len(headers) > 0 {
+			values := make(map[string]string, len(headers))
+			for _, header := range headers {
+				name, value, ok := strings.Cut(header, ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					fmt.Fprintf(os.Stderr, "Error: invalid --header %q, expected \"Name: value\"\n", header)
+					return nil
+				}
+				values[strings.TrimSpace(name)] = strings.TrimSpace(value)
 			}
+			request["headers"] = values
 		}
 
-		if account == nil {
-			fmt.Printf("Error: account %s not found in local config\n", from)
-			fmt.Println("Note: Account must be configured in server config")
-			return nil
+		var remote []map[string]string
+		var local []string
+		for _, item := range attach {
+			if strings.HasPrefix(item, "claw:") {
+				remote = append(remote, map[string]string{"path": item})
+			} else {
+				local = append(local, item)
+			}
+		}
+		if len(remote) > 0 {
+			request["attachments"] = remote
 		}
 
-		_, err = callMailAPIWithResponse("send", map[string]string{
-			"from":    from,
-			"to":      to,
-			"subject": subject,
-			"body":    body,
-		})
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+		payload, contentType, err := mailSendBody(request, local)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		if err := client.doAPIRequest("POST", "/api/v1/mail/send", bytes.NewReader(payload), int64(len(payload)), contentType, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
 			return nil
 		}
 
@@ -87,6 +136,47 @@ var mailSendCmd = &cobra.Command{
 	},
 }
 
+// mailSendBody 生成发送请求：没有本地附件时为 JSON，否则为 multipart/form-data，本地文件随请求上传
+func mailSendBody(request map[string]interface{}, files []string) ([]byte, string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return data, "application/json", nil
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.WriteField("request", string(data)); err != nil {
+		return nil, "", err
+	}
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "attachments", "filename": filepath.Base(path)}))
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
 var mailListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List mail accounts",
@@ -123,6 +213,9 @@ var mailListCmd = &cobra.Command{
 			}
 			email, _ := accMap["email"].(string)
 			provider, _ := accMap["provider"].(string)
+			if imap, ok := accMap["imap"].(map[string]interface{}); ok && imap["host"] != nil {
+				provider = fmt.Sprintf("%v", imap["host"])
+			}
 			fmt.Printf("  - %s (%s)\n", email, provider)
 		}
 		return nil
@@ -135,7 +228,7 @@ var mailAccountCmd = &cobra.Command{
 }
 
 var mailAccountAddCmd = &cobra.Command{
-	Use:   "add --provider <provider> --email <email> --username <user> --password <pass> [--auth-token <token>]",
+	Use:   "add (--provider <provider> | --imap-host <host> --smtp-host <host>) --email <email> --username <user> --password <pass> [--auth-token <token>]",
 	Short: "Add a mail account to local config",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		provider, _ := cmd.Flags().GetString("provider")
@@ -143,17 +236,38 @@ var mailAccountAddCmd = &cobra.Command{
 		username, _ := cmd.Flags().GetString("username")
 		password, _ := cmd.Flags().GetString("password")
 		authToken, _ := cmd.Flags().GetString("auth-token")
+		imapPort, _ := cmd.Flags().GetInt("imap-port")
+		smtpPort, _ := cmd.Flags().GetInt("smtp-port")
 
-		if provider == "" || email == "" || username == "" || password == "" {
-			fmt.Println("Error: --provider, --email, --username and --password are required")
+		if email == "" || username == "" || password == "" {
+			fmt.Println("Error: --email, --username and --password are required")
 			return nil
 		}
 
 		imapHost, smtpHost := getProviderSettings(provider)
-		if imapHost == "" {
+		if provider != "" && imapHost == "" {
 			fmt.Printf("Error: unknown provider %s\n", provider)
 			return nil
 		}
+		if host, _ := cmd.Flags().GetString("imap-host"); host != "" {
+			imapHost = host
+		}
+		if host, _ := cmd.Flags().GetString("smtp-host"); host != "" {
+			smtpHost = host
+		}
+		if imapHost == "" || smtpHost == "" {
+			fmt.Println("Error: --provider or both --imap-host and --smtp-host are required")
+			return nil
+		}
+		if imapPort == 0 {
+			imapPort = 993
+		}
+		if smtpPort == 0 {
+			smtpPort = 465
+			if provider == "outlook" {
+				smtpPort = 587
+			}
+		}
 
 		account := MailAccount{
 			Provider:  provider,
@@ -161,9 +275,9 @@ var mailAccountAddCmd = &cobra.Command{
 			Username:  username,
 			Password:  password,
 			ImapHost:  imapHost,
-			ImapPort:  993,
+			ImapPort:  imapPort,
 			SmtpHost:  smtpHost,
-			SmtpPort:  465,
+			SmtpPort:  smtpPort,
 			AuthToken: authToken,
 			Enabled:   true,
 		}
@@ -187,7 +301,7 @@ var mailAccountAddCmd = &cobra.Command{
 			return nil
 		}
 
-		fmt.Printf("Added account: %s (%s)\n", email, provider)
+		fmt.Printf("Added account: %s (%s)\n", email, imapHost)
 		fmt.Println("Note: Ensure the account is also configured in server config")
 		return nil
 	},
@@ -353,7 +467,8 @@ var mailLatestCmd = &cobra.Command{
 			return nil
 		}
 
-		emails, ok := response["emails"].([]interface{})
+		data, _ := response["data"].(map[string]interface{})
+		emails, ok := data["emails"].([]interface{})
 		if !ok || len(emails) == 0 {
 			fmt.Println("No emails found")
 			return nil
@@ -369,8 +484,10 @@ var mailLatestCmd = &cobra.Command{
 			subject, _ := emailMap["subject"].(string)
 			date, _ := emailMap["date"].(string)
 			preview, _ := emailMap["preview"].(string)
+			uid, _ := emailMap["uid"].(float64)
 
-			fmt.Printf("[%d] From: %s\n", i+1, from)
+			fmt.Printf("[%d] UID: %.0f\n", i+1, uid)
+			fmt.Printf("    From: %s\n", from)
 			fmt.Printf("    Subject: %s\n", subject)
 			fmt.Printf("    Date: %s\n", date)
 			fmt.Printf("    Preview: %s\n", preview)
@@ -381,41 +498,6 @@ var mailLatestCmd = &cobra.Command{
 	},
 }
 
-var mailMonitorCmd = &cobra.Command{
-	Use:   "monitor",
-	Short: "Mail monitoring commands",
-}
-
-var mailMonitorStatusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Show monitor status",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		config, err := loadMailConfig()
-		if err != nil || len(config.Accounts) == 0 {
-			fmt.Println("No accounts configured")
-			return nil
-		}
-
-		fmt.Printf("Monitor Status: Running\n")
-		fmt.Printf("Watching %d account(s):\n", len(config.Accounts))
-		for _, acc := range config.Accounts {
-			fmt.Printf("  - %s (%s)\n", acc.Email, acc.Provider)
-		}
-
-		return nil
-	},
-}
-
-var mailMonitorStartCmd = &cobra.Command{
-	Use:   "start",
-	Short: "Start mail monitoring",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("Starting mail monitor...")
-		fmt.Println("Note: Background monitoring is handled by the server")
-		return nil
-	},
-}
-
 func init() {
 	mailCmd.AddCommand(mailSendCmd)
 	mailCmd.AddCommand(mailListCmd)
@@ -424,24 +506,33 @@ func init() {
 	mailAccountCmd.AddCommand(mailAccountRemoveCmd)
 	mailCmd.AddCommand(mailTestConnectionCmd)
 	mailCmd.AddCommand(mailLatestCmd)
-	mailCmd.AddCommand(mailMonitorCmd)
-	mailMonitorCmd.AddCommand(mailMonitorStatusCmd)
-	mailMonitorCmd.AddCommand(mailMonitorStartCmd)
 
 	mailAccountAddCmd.Flags().String("provider", "", "Email provider (163, 126, qq, gmail, outlook)")
 	mailAccountAddCmd.Flags().String("email", "", "Email address")
 	mailAccountAddCmd.Flags().String("username", "", "Username (usually email)")
 	mailAccountAddCmd.Flags().String("password", "", "Password or app password")
 	mailAccountAddCmd.Flags().String("auth-token", "", "Auth token (optional)")
+	mailAccountAddCmd.Flags().String("imap-host", "", "IMAP server host (overrides the provider preset)")
+	mailAccountAddCmd.Flags().Int("imap-port", 0, "IMAP server port (default 993)")
+	mailAccountAddCmd.Flags().String("smtp-host", "", "SMTP server host (overrides the provider preset)")
+	mailAccountAddCmd.Flags().Int("smtp-port", 0, "SMTP server port (default 465, 587 for outlook)")
 
 	mailAccountRemoveCmd.Flags().String("email", "", "Email address to remove")
 	mailTestConnectionCmd.Flags().String("email", "", "Email address to test")
 	mailLatestCmd.Flags().Int("count", 5, "Number of emails to fetch")
 	mailLatestCmd.Flags().String("email", "", "Email account (optional)")
-	mailSendCmd.Flags().String("from", "", "From email address")
-	mailSendCmd.Flags().String("to", "", "To email address")
+	mailSendCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	mailSendCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	mailSendCmd.Flags().String("from", "", "From account (default: first account in local mail config)")
+	mailSendCmd.Flags().StringSlice("to", nil, "Recipients")
+	mailSendCmd.Flags().StringSlice("cc", nil, "Cc recipients")
+	mailSendCmd.Flags().StringSlice("bcc", nil, "Bcc recipients, not shown to other recipients")
 	mailSendCmd.Flags().String("subject", "", "Email subject")
-	mailSendCmd.Flags().String("body", "", "Email body")
+	mailSendCmd.Flags().String("body", "", "Plain text body")
+	mailSendCmd.Flags().String("html", "", "HTML body, sent together with --body as alternatives")
+	mailSendCmd.Flags().StringArray("attach", nil, "Attach a local file or a claw:/ file (repeatable)")
+	mailSendCmd.Flags().StringArray("header", nil, "Extra header as \"Name: value\" (repeatable)")
+	mailSendCmd.Flags().Uint32("reply-to-uid", 0, "Reply to this INBOX message UID")
 }
 
 func callMailAPIWithResponse(endpoint string, params map[string]string) (string, error) {
@@ -475,10 +566,11 @@ func callMailAPIWithResponse(endpoint string, params map[string]string) (string,
 		}
 	}
 
-	req.Header.Set("X-Local-Key", serverCfg.LocalKey)
+	client := NewClient(serverCfg)
+	client.attachAuth(req)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	client.HTTP.Timeout = 30 * time.Second
+	resp, err := client.HTTP.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("API request failed: %v", err)
 	}
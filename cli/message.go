@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type MailMessage struct {
+	UID         uint32               `json:"uid"`
+	MessageID   string               `json:"message_id"`
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Cc          string               `json:"cc"`
+	ReplyTo     string               `json:"reply_to"`
+	Subject     string               `json:"subject"`
+	Date        time.Time            `json:"date"`
+	Headers     []MailHeader         `json:"headers"`
+	Text        string               `json:"text"`
+	HTML        string               `json:"html"`
+	Body        string               `json:"body"`
+	Attachments []MailAttachmentInfo `json:"attachments"`
+}
+
+type MailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type MailAttachmentInfo struct {
+	Index       int    `json:"index"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Inline      bool   `json:"inline"`
+}
+
+var mailReadCmd = &cobra.Command{
+	Use:   "read <uid> [--email <email>]",
+	Short: "Show a message by UID with its body and attachment list",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uid, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || uid == 0 {
+			fmt.Fprintln(os.Stderr, "Error: invalid uid")
+			return nil
+		}
+		email, ok := mailAccountFlag(cmd)
+		if !ok {
+			return nil
+		}
+		showHTML, _ := cmd.Flags().GetBool("html")
+		showHeaders, _ := cmd.Flags().GetBool("headers")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+		var msg json.RawMessage
+		path := fmt.Sprintf("/api/v1/mail/messages/%d?email=%s", uid, url.QueryEscape(email))
+		if err := client.doAPIRequest("GET", path, nil, 0, "", &msg); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		if asJSON {
+			fmt.Println(string(msg))
+			return nil
+		}
+
+		var m MailMessage
+		if err := json.Unmarshal(msg, &m); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if showHeaders {
+			for _, h := range m.Headers {
+				fmt.Printf("%s: %s\n", h.Name, h.Value)
+			}
+		} else {
+			fmt.Printf("From:    %s\n", m.From)
+			fmt.Printf("To:      %s\n", m.To)
+			if m.Cc != "" {
+				fmt.Printf("Cc:      %s\n", m.Cc)
+			}
+			fmt.Printf("Subject: %s\n", m.Subject)
+			fmt.Printf("Date:    %s\n", m.Date.Local().Format("2006-01-02 15:04:05"))
+		}
+		fmt.Println()
+
+		if showHTML && m.HTML != "" {
+			fmt.Println(m.HTML)
+		} else {
+			fmt.Println(m.Body)
+		}
+
+		if len(m.Attachments) > 0 {
+			fmt.Println()
+			fmt.Println("Attachments:")
+			for _, a := range m.Attachments {
+				kind := ""
+				if a.Inline {
+					kind = " (inline)"
+				}
+				fmt.Printf("  [%d] %s  %s  %s%s\n", a.Index, a.Filename, a.ContentType, formatSize(a.Size), kind)
+			}
+		}
+		return nil
+	},
+}
+
+var mailAttachmentCmd = &cobra.Command{
+	Use:   "attachment <uid> <index> [-o <file>] [--save claw:/path]",
+	Short: "Download an attachment, or save it into the file module with --save",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uid, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || uid == 0 {
+			fmt.Fprintln(os.Stderr, "Error: invalid uid")
+			return nil
+		}
+		index, err := strconv.Atoi(args[1])
+		if err != nil || index < 1 {
+			fmt.Fprintln(os.Stderr, "Error: invalid attachment index")
+			return nil
+		}
+		email, ok := mailAccountFlag(cmd)
+		if !ok {
+			return nil
+		}
+		output, _ := cmd.Flags().GetString("output")
+		save, _ := cmd.Flags().GetString("save")
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+		path := fmt.Sprintf("/api/v1/mail/messages/%d/attachments/%d", uid, index)
+		query := url.Values{"email": {email}}
+
+		if save != "" {
+			remotePath, err := parseRemotePath(save)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			query.Set("path", remotePath)
+
+			var result FileItem
+			if err := client.doAPIRequest("POST", path+"/save?"+query.Encode(), nil, 0, "", &result); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			fmt.Printf("Saved to claw:%s (%s)\n", result.Path, formatSize(result.Size))
+			return nil
+		}
+
+		saved, err := client.downloadAttachment(path+"?"+query.Encode(), output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+		if saved != "" {
+			fmt.Printf("Downloaded to %s\n", saved)
+		}
+		return nil
+	},
+}
+
+// downloadAttachment 下载附件到 output，output 为空时使用附件文件名保存到当前目录，为 - 时写到标准输出；返回保存的文件路径
+func (c *Client) downloadAttachment(path, output string) (string, error) {
+	req, err := http.NewRequest("GET", c.Endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	c.attachAuth(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var payload APIResponse
+		apiErr := &APIError{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(&payload) == nil {
+			apiErr.Message = payload.Message
+		}
+		return "", apiErr
+	}
+
+	if output == "-" {
+		_, err := io.Copy(os.Stdout, resp.Body)
+		return "", err
+	}
+	if output == "" {
+		output = "attachment"
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			output = filepath.Base(params["filename"])
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	return output, f.Close()
+}
+
+// mailAccountFlag 返回 --email 参数，未指定时使用本地邮件配置中的第一个账户
+func mailAccountFlag(cmd *cobra.Command) (string, bool) {
+	email, _ := cmd.Flags().GetString("email")
+	if email != "" {
+		return email, true
+	}
+	config, err := loadMailConfig()
+	if err != nil || len(config.Accounts) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --email is required")
+		return "", false
+	}
+	return config.Accounts[0].Email, true
+}
+
+func init() {
+	mailCmd.AddCommand(mailReadCmd)
+	mailCmd.AddCommand(mailAttachmentCmd)
+
+	for _, cmd := range []*cobra.Command{mailReadCmd, mailAttachmentCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+		cmd.Flags().String("email", "", "Mail account (default: first account in local mail config)")
+	}
+	mailReadCmd.Flags().Bool("html", false, "Print the original HTML body instead of the converted text")
+	mailReadCmd.Flags().Bool("headers", false, "Print all message headers")
+	mailReadCmd.Flags().Bool("json", false, "Print the raw JSON response")
+	mailAttachmentCmd.Flags().StringP("output", "o", "", "Local file to write, - for stdout (default: attachment file name)")
+	mailAttachmentCmd.Flags().String("save", "", "Save into the file module at claw:/folder/ or claw:/folder/name")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type MonitorAccountStatus struct {
+	Email      string     `json:"email"`
+	Running    bool       `json:"running"`
+	Connected  bool       `json:"connected"`
+	Idle       bool       `json:"idle"`
+	LastUID    uint32     `json:"last_uid"`
+	Received   int64      `json:"received"`
+	Notified   int64      `json:"notified"`
+	LastPollAt *time.Time `json:"last_poll_at"`
+	LastError  string     `json:"last_error"`
+}
+
+type MailEventItem struct {
+	ID         uint      `json:"id"`
+	Account    string    `json:"account"`
+	UID        uint32    `json:"uid"`
+	MessageID  string    `json:"message_id"`
+	From       string    `json:"from"`
+	Subject    string    `json:"subject"`
+	ReceivedAt time.Time `json:"received_at"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var monitorEmail string
+
+var mailMonitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Control the server-side mail monitor",
+}
+
+var mailMonitorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show monitor status of each mail account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var status struct {
+			WebhookEnabled bool                   `json:"webhook_enabled"`
+			Accounts       []MonitorAccountStatus `json:"accounts"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/mail/monitor", nil, 0, "", &status); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if status.WebhookEnabled {
+			fmt.Println("Webhook: enabled")
+		} else {
+			fmt.Println("Webhook: disabled, new mail is only logged")
+		}
+		printMonitorAccounts(status.Accounts)
+		return nil
+	},
+}
+
+var mailMonitorStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start monitoring an account, or all enabled accounts without --email",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlMonitor("start")
+	},
+}
+
+var mailMonitorStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop monitoring an account, or all accounts without --email",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlMonitor("stop")
+	},
+}
+
+var mailEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "List emails processed by the server-side mail monitor",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		for _, name := range []string{"account", "status"} {
+			if value, _ := cmd.Flags().GetString(name); value != "" {
+				query.Set(name, value)
+			}
+		}
+		for _, name := range []string{"since", "until"} {
+			value, _ := cmd.Flags().GetString(name)
+			if value == "" {
+				continue
+			}
+			t, err := parseAuditTime(value, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid --%s: %v\n", name, err)
+				return nil
+			}
+			query.Set(name, t.UTC().Format(time.RFC3339))
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Total int64           `json:"total"`
+			Items []MailEventItem `json:"items"`
+		}
+		if err := client.doAPIRequest("GET", "/api/v1/mail/events?"+query.Encode(), nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, e := range result.Items {
+			fmt.Printf("%s  %-25s  uid %-6d  %-8s  %s  %s\n",
+				e.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.Account, e.UID, e.Status, e.From, e.Subject)
+			if e.Error != "" {
+				fmt.Printf("  error: %s\n", e.Error)
+			}
+		}
+		if len(result.Items) > 0 {
+			fmt.Printf("Showing %d-%d of %d\n", offset+1, offset+len(result.Items), result.Total)
+		} else {
+			fmt.Printf("No events (total %d)\n", result.Total)
+		}
+		return nil
+	},
+}
+
+func controlMonitor(action string) error {
+	client, ok := adminClient()
+	if !ok {
+		return nil
+	}
+
+	path := "/api/v1/mail/monitor/" + action
+	if monitorEmail != "" {
+		path += "?email=" + url.QueryEscape(monitorEmail)
+	}
+
+	var result struct {
+		Started  int                    `json:"started"`
+		Stopped  int                    `json:"stopped"`
+		Accounts []MonitorAccountStatus `json:"accounts"`
+	}
+	if err := client.doAPIRequest("POST", path, nil, 0, "", &result); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil
+	}
+
+	if action == "start" {
+		fmt.Printf("Started %d account(s)\n", result.Started)
+	} else {
+		fmt.Printf("Stopped %d account(s)\n", result.Stopped)
+	}
+	printMonitorAccounts(result.Accounts)
+	return nil
+}
+
+func printMonitorAccounts(accounts []MonitorAccountStatus) {
+	if len(accounts) == 0 {
+		fmt.Println("No mail accounts configured on server")
+		return
+	}
+
+	for _, acc := range accounts {
+		state := "stopped"
+		switch {
+		case acc.Running && acc.Connected && acc.Idle:
+			state = "idle"
+		case acc.Running && acc.Connected:
+			state = "polling"
+		case acc.Running:
+			state = "connecting"
+		}
+		fmt.Printf("  %-30s %-10s last uid %-8d received %d, notified %d\n", acc.Email, state, acc.LastUID, acc.Received, acc.Notified)
+		if acc.LastPollAt != nil {
+			fmt.Printf("  %-30s last checked %s\n", "", acc.LastPollAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		if acc.LastError != "" {
+			fmt.Printf("  %-30s error: %s\n", "", acc.LastError)
+		}
+	}
+}
+
+func init() {
+	mailCmd.AddCommand(mailMonitorCmd)
+	mailMonitorCmd.AddCommand(mailMonitorStatusCmd)
+	mailMonitorCmd.AddCommand(mailMonitorStartCmd)
+	mailMonitorCmd.AddCommand(mailMonitorStopCmd)
+
+	for _, cmd := range []*cobra.Command{mailMonitorStatusCmd, mailMonitorStartCmd, mailMonitorStopCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+	mailMonitorStartCmd.Flags().StringVar(&monitorEmail, "email", "", "Mail account (default: all enabled accounts)")
+	mailMonitorStopCmd.Flags().StringVar(&monitorEmail, "email", "", "Mail account (default: all accounts)")
+
+	mailCmd.AddCommand(mailEventsCmd)
+
+	mailEventsCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	mailEventsCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	mailEventsCmd.Flags().String("account", "", "Only emails of this mail account")
+	mailEventsCmd.Flags().String("status", "", "Only pending, notified, failed or skipped emails")
+	mailEventsCmd.Flags().String("since", "", "Start time: RFC 3339, YYYY-MM-DD, or a duration ago such as 24h or 7d")
+	mailEventsCmd.Flags().String("until", "", "End time (exclusive), same formats as --since")
+	mailEventsCmd.Flags().Int("limit", 50, "Maximum events to show (at most 1000)")
+	mailEventsCmd.Flags().Int("offset", 0, "Skip this many of the newest events")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type RateLimitStats struct {
+	Enabled      bool             `json:"enabled"`
+	Throttled    map[string]int64 `json:"throttled"`
+	AuthFailures int64            `json:"auth_failures"`
+	Lockouts     int64            `json:"lockouts"`
+	Locked       []struct {
+		Client string    `json:"client"`
+		Until  time.Time `json:"until"`
+	} `json:"locked"`
+}
+
+var adminRateLimitsCmd = &cobra.Command{
+	Use:   "rate-limits",
+	Short: "Show throttled request counts and locked-out clients since server start",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var stats RateLimitStats
+		if err := client.doAPIRequest("GET", "/api/v1/admin/rate-limits", nil, 0, "", &stats); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if !stats.Enabled {
+			fmt.Println("Rate limiting is disabled")
+			return nil
+		}
+
+		scopes := make([]string, 0, len(stats.Throttled))
+		for scope := range stats.Throttled {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+		fmt.Println("Throttled requests:")
+		if len(scopes) == 0 {
+			fmt.Println("  none")
+		}
+		for _, scope := range scopes {
+			fmt.Printf("  %-10s %d\n", scope, stats.Throttled[scope])
+		}
+
+		fmt.Printf("Auth failures: %d\n", stats.AuthFailures)
+		fmt.Printf("Lockouts: %d\n", stats.Lockouts)
+		for _, l := range stats.Locked {
+			fmt.Printf("  %-40s locked until %s\n", l.Client, l.Until.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(adminRateLimitsCmd)
+	adminRateLimitsCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	adminRateLimitsCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+}
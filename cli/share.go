@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type ShareItem struct {
+	Token          string     `json:"token"`
+	Type           string     `json:"type"`
+	DownloadURL    string     `json:"download_url"`
+	ZipURL         string     `json:"zip_url"`
+	Path           string     `json:"path"`
+	Status         string     `json:"status"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	HasPassword    bool       `json:"has_password"`
+	MaxDownloads   int        `json:"max_downloads"`
+	DownloadCount  int        `json:"download_count"`
+	Disposition    string     `json:"disposition"`
+	MaxSize        int64      `json:"max_size"`
+	AllowedTypes   []string   `json:"allowed_types"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+var fileShareCmd = &cobra.Command{
+	Use:   "share",
+	Short: "Manage public download links",
+}
+
+var fileShareCreateCmd = &cobra.Command{
+	Use:   "create claw:/<path>",
+	Short: "Create a public link for a file, a browsable link for a folder, or an upload-only link (--upload)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl, _ := cmd.Flags().GetString("ttl")
+		maxDownloads, _ := cmd.Flags().GetInt("max-downloads")
+		inline, _ := cmd.Flags().GetBool("inline")
+		withPassword, _ := cmd.Flags().GetBool("password")
+		upload, _ := cmd.Flags().GetBool("upload")
+		maxSizeMB, _ := cmd.Flags().GetInt64("max-size-mb")
+		types, _ := cmd.Flags().GetStringSlice("type")
+
+		remotePath, ok := grantPath(args[0])
+		if !ok {
+			return nil
+		}
+
+		body := map[string]interface{}{"path": remotePath, "ttl": ttl, "max_downloads": maxDownloads}
+		if inline {
+			body["disposition"] = "inline"
+		}
+		if upload {
+			body["type"] = "upload"
+			body["max_size_mb"] = maxSizeMB
+			body["allowed_types"] = types
+		}
+		if withPassword {
+			password, err := promptPassword("Link password")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			body["password"] = password
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var share ShareItem
+		if err := client.adminJSON("POST", "/api/v1/shares", body, &share); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		printShare(share)
+		return nil
+	},
+}
+
+var fileShareLsCmd = &cobra.Command{
+	Use:   "ls [claw:/<path>]",
+	Short: "List download links (all links of a file or folder, or the links you created)",
+	Args:  cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := "/api/v1/shares"
+		if len(args) > 0 {
+			remotePath, ok := grantPath(args[0])
+			if !ok {
+				return nil
+			}
+			query += "?path=" + url.QueryEscape(remotePath)
+		}
+
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var result struct {
+			Shares []ShareItem `json:"shares"`
+		}
+		if err := client.doAPIRequest("GET", query, nil, 0, "", &result); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		for _, s := range result.Shares {
+			downloads := fmt.Sprintf("%d", s.DownloadCount)
+			if s.MaxDownloads > 0 {
+				downloads = fmt.Sprintf("%d/%d", s.DownloadCount, s.MaxDownloads)
+			}
+			fmt.Printf("%s  %-6s  %-9s  %7s  %-16s  %s\n", s.Token, s.Type, s.Status, downloads, formatExpiry(s.ExpiresAt), s.Path)
+		}
+		return nil
+	},
+}
+
+var fileShareInfoCmd = &cobra.Command{
+	Use:   "info <token>",
+	Short: "Show a download link and its access counts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		var share ShareItem
+		if err := client.doAPIRequest("GET", "/api/v1/shares/"+url.PathEscape(args[0]), nil, 0, "", &share); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		printShare(share)
+		return nil
+	},
+}
+
+var fileShareRevokeCmd = &cobra.Command{
+	Use:   "revoke <token>",
+	Short: "Revoke a download link",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := adminClient()
+		if !ok {
+			return nil
+		}
+
+		if err := client.doAPIRequest("DELETE", "/api/v1/shares/"+url.PathEscape(args[0]), nil, 0, "", nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Revoked link %s\n", args[0])
+		return nil
+	},
+}
+
+func printShare(s ShareItem) {
+	fmt.Printf("Link: %s\n", s.DownloadURL)
+	if s.ZipURL != "" {
+		fmt.Printf("Zip: %s\n", s.ZipURL)
+	}
+	fmt.Printf("Path: %s (%s)\n", s.Path, s.Type)
+	fmt.Printf("Status: %s\n", s.Status)
+	fmt.Printf("Expires: %s\n", formatExpiry(s.ExpiresAt))
+	if s.Type == "upload" {
+		if s.MaxSize > 0 {
+			fmt.Printf("Max size: %s\n", formatSize(s.MaxSize))
+		}
+		if len(s.AllowedTypes) > 0 {
+			fmt.Printf("Allowed types: %s\n", strings.Join(s.AllowedTypes, ", "))
+		}
+	}
+	if s.HasPassword {
+		fmt.Println("Password: required")
+	}
+	label := "Downloads"
+	if s.Type == "upload" {
+		label = "Uploads"
+	}
+	if s.MaxDownloads > 0 {
+		fmt.Printf("%s: %d/%d\n", label, s.DownloadCount, s.MaxDownloads)
+	} else {
+		fmt.Printf("%s: %d\n", label, s.DownloadCount)
+	}
+	if s.LastAccessedAt != nil {
+		fmt.Printf("Last accessed: %s\n", s.LastAccessedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if s.Type == "file" {
+		fmt.Printf("Opens as: %s\n", s.Disposition)
+	}
+}
+
+func formatExpiry(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func init() {
+	fileCmd.AddCommand(fileShareCmd)
+	fileShareCmd.AddCommand(fileShareCreateCmd)
+	fileShareCmd.AddCommand(fileShareLsCmd)
+	fileShareCmd.AddCommand(fileShareInfoCmd)
+	fileShareCmd.AddCommand(fileShareRevokeCmd)
+
+	for _, cmd := range []*cobra.Command{fileShareCreateCmd, fileShareLsCmd, fileShareInfoCmd, fileShareRevokeCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+	fileShareCreateCmd.Flags().String("ttl", "", "Link lifetime, e.g. 24h, 30d or never (default from server config)")
+	fileShareCreateCmd.Flags().Int("max-downloads", 0, "Disable the link after this many downloads, or uploads with --upload (0 = unlimited)")
+	fileShareCreateCmd.Flags().Bool("password", false, "Prompt for a password required to download")
+	fileShareCreateCmd.Flags().Bool("inline", false, "Let browsers display files instead of downloading them")
+	fileShareCreateCmd.Flags().Bool("upload", false, "Create an upload-only link into the folder; recipients cannot see its contents")
+	fileShareCreateCmd.Flags().Int64("max-size-mb", 0, "With --upload, reject files larger than this (0 = server limit)")
+	fileShareCreateCmd.Flags().StringSlice("type", nil, "With --upload, allowed MIME type such as application/pdf or image/*, repeatable")
+}
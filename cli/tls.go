@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ClientTLSConfig 为连接 HTTPS 服务时使用的 CA 证书和客户端证书（mTLS），
+// 对应配置文件顶层的 tls 段，也可通过 CLAWPLIERS_TLS_CA_FILE 等环境变量指定
+type ClientTLSConfig struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func (t ClientTLSConfig) isZero() bool {
+	return t.CAFile == "" && t.CertFile == "" && t.KeyFile == ""
+}
+
+// resolveClientTLS 返回 cfg 中的 TLS 设置；通过命令行参数创建的 cfg 不含该设置时读取配置文件，环境变量优先
+func resolveClientTLS(cfg Config) ClientTLSConfig {
+	t := cfg.TLS
+	if t.isZero() {
+		if loaded, err := loadConfig(); err == nil {
+			t = loaded.TLS
+		}
+	}
+	if value := os.Getenv("CLAWPLIERS_TLS_CA_FILE"); value != "" {
+		t.CAFile = value
+	}
+	if value := os.Getenv("CLAWPLIERS_TLS_CERT_FILE"); value != "" {
+		t.CertFile = value
+	}
+	if value := os.Getenv("CLAWPLIERS_TLS_KEY_FILE"); value != "" {
+		t.KeyFile = value
+	}
+	return t
+}
+
+// newHTTPClient 按 TLS 设置创建 HTTP 客户端，证书加载失败时打印警告并使用系统默认设置
+func newHTTPClient(timeout time.Duration, t ClientTLSConfig) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if t.isZero() {
+		return client
+	}
+
+	tlsConfig, err := loadClientTLS(t)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to load TLS settings:", err)
+		return client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client
+}
+
+func loadClientTLS(t ClientTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.CAFile != "" {
+		data, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
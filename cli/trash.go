@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type TrashList struct {
+	Total         int         `json:"total"`
+	Items         []TrashItem `json:"items"`
+	RetentionDays int64       `json:"retention_days"`
+}
+
+var fileTrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage deleted files and directories",
+}
+
+var fileTrashLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List items in trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+		list, err := client.ListTrash()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		if len(list.Items) == 0 {
+			fmt.Println("Trash is empty")
+			return nil
+		}
+
+		for _, item := range list.Items {
+			kind, size := "file", formatSize(item.Size)
+			if item.Type == "folder" {
+				kind, size = "dir", "-"
+			}
+			fmt.Printf("%-4s  %-20s  %10s  %s  %s\n", kind, item.ID, size, item.DeletedAt.Local().Format("2006-01-02 15:04"), item.Path)
+		}
+		if list.RetentionDays > 0 {
+			fmt.Printf("\nItems are purged %d days after deletion\n", list.RetentionDays)
+		}
+		return nil
+	},
+}
+
+var fileTrashRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restore an item from trash to its original path",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+		item, err := client.RestoreTrashItem(args[0], onConflict)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+				fmt.Fprintln(os.Stderr, "Use --on-conflict rename or --on-conflict overwrite")
+			}
+			return nil
+		}
+
+		fmt.Printf("Restored: %s\n", item.Path)
+		return nil
+	},
+}
+
+var fileTrashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete everything in trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+		purged, err := client.EmptyTrash()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		fmt.Printf("Purged %d item(s)\n", purged)
+		return nil
+	},
+}
+
+func (c *Client) ListTrash() (TrashList, error) {
+	var list TrashList
+	err := c.doAPIRequest("GET", "/api/v1/trash", nil, 0, "", &list)
+	return list, err
+}
+
+func (c *Client) RestoreTrashItem(id, onConflict string) (TrashItem, error) {
+	path := "/api/v1/trash/" + url.PathEscape(id) + "/restore"
+	if onConflict != "" {
+		path += "?on_conflict=" + url.QueryEscape(onConflict)
+	}
+
+	var item TrashItem
+	err := c.doAPIRequest("POST", path, nil, 0, "", &item)
+	return item, err
+}
+
+func (c *Client) EmptyTrash() (int, error) {
+	var result struct {
+		Purged int `json:"purged"`
+	}
+	err := c.doAPIRequest("DELETE", "/api/v1/trash", nil, 0, "", &result)
+	return result.Purged, err
+}
+
+func init() {
+	fileTrashCmd.AddCommand(fileTrashLsCmd)
+	fileTrashCmd.AddCommand(fileTrashRestoreCmd)
+	fileTrashCmd.AddCommand(fileTrashEmptyCmd)
+
+	for _, cmd := range []*cobra.Command{fileTrashLsCmd, fileTrashRestoreCmd, fileTrashEmptyCmd} {
+		cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+		cmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	}
+	fileTrashRestoreCmd.Flags().String("on-conflict", "fail", "What to do if the original path is taken: fail, rename or overwrite")
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultChunkSize   = 8 * 1024 * 1024
+	chunkUploadRetries = 3
+)
+
+var errUploadSessionGone = errors.New("upload session not found or expired")
+
+type UploadSession struct {
+	UploadID    string          `json:"upload_id"`
+	Path        string          `json:"path"`
+	Size        int64           `json:"size"`
+	ChunkSize   int64           `json:"chunk_size"`
+	TotalChunks int             `json:"total_chunks"`
+	Status      string          `json:"status"`
+	Received    []UploadedChunk `json:"received"`
+}
+
+type UploadedChunk struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// uploadState 记录本地未完成的分片上传，用于中断后续传
+type uploadState struct {
+	UploadID   string `json:"upload_id"`
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"`
+}
+
+// stateDir 返回保存续传状态的配置目录
+func stateDir() (string, error) {
+	configDir := os.Getenv("CLAWPLIERS_CONFIG_DIR")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(home, ".config", "claw-pliers")
+	}
+	return configDir, nil
+}
+
+func uploadStatePath(localPath, remotePath string, info os.FileInfo) (string, error) {
+	configDir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\n%s\n%d\n%d", absPath, remotePath, info.Size(), info.ModTime().UnixNano())))
+	return filepath.Join(configDir, "uploads", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+func loadUploadState(path string) (uploadState, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return uploadState{}, false
+	}
+	var state uploadState
+	if err := json.Unmarshal(data, &state); err != nil || state.UploadID == "" {
+		return uploadState{}, false
+	}
+	return state, true
+}
+
+func saveUploadState(path string, state uploadState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// UploadFileChunked 通过分片上传会话上传大文件，中断后再次执行会跳过已上传的分片
+func (c *Client) UploadFileChunked(localPath, remotePath string, chunkSize int64, progress func(int)) (FileItem, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return FileItem{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return FileItem{}, err
+	}
+
+	statePath, err := uploadStatePath(localPath, remotePath, info)
+	if err != nil {
+		return FileItem{}, err
+	}
+
+	var session UploadSession
+	if state, ok := loadUploadState(statePath); ok {
+		session, err = c.GetUploadSession(state.UploadID)
+		if err != nil && !errors.Is(err, errUploadSessionGone) {
+			return FileItem{}, err
+		}
+		if err == nil {
+			fmt.Printf("Resuming upload (%d/%d chunks done)\n", len(session.Received), session.TotalChunks)
+		}
+	}
+
+	if session.UploadID == "" {
+		session, err = c.CreateUploadSession(remotePath, info.Size(), chunkSize)
+		if err != nil {
+			return FileItem{}, err
+		}
+		if err := saveUploadState(statePath, uploadState{
+			UploadID:   session.UploadID,
+			LocalPath:  localPath,
+			RemotePath: remotePath,
+			Size:       info.Size(),
+			ModTime:    info.ModTime().UnixNano(),
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save upload state: %v\n", err)
+		}
+	}
+
+	done := make(map[int]bool, len(session.Received))
+	var uploaded int64
+	for _, chunk := range session.Received {
+		done[chunk.Index] = true
+		uploaded += chunk.Size
+	}
+
+	report := func() {
+		if progress != nil && session.Size > 0 {
+			progress(int(float64(uploaded) / float64(session.Size) * 100))
+		}
+	}
+	report()
+
+	for index := 0; index < session.TotalChunks; index++ {
+		if done[index] {
+			continue
+		}
+
+		offset := int64(index) * session.ChunkSize
+		size := session.ChunkSize
+		if offset+size > session.Size {
+			size = session.Size - offset
+		}
+
+		var lastErr error
+		for attempt := 1; attempt <= chunkUploadRetries; attempt++ {
+			lastErr = c.UploadChunk(session.UploadID, index, io.NewSectionReader(file, offset, size), size)
+			if lastErr == nil || errors.Is(lastErr, errUploadSessionGone) {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if lastErr != nil {
+			return FileItem{}, fmt.Errorf("chunk %d: %w", index, lastErr)
+		}
+
+		uploaded += size
+		report()
+	}
+
+	item, err := c.CompleteUploadSession(session.UploadID)
+	if err != nil {
+		return FileItem{}, err
+	}
+	os.Remove(statePath)
+	return item, nil
+}
+
+// UploadFileByHash 先只发送文件的 SHA-256，服务端已有相同内容时无需上传文件体；found 为 false 时需完整上传
+func (c *Client) UploadFileByHash(localPath, remotePath string) (item FileItem, found bool, err error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return FileItem{}, false, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return FileItem{}, false, err
+	}
+
+	req, err := http.NewRequest("POST", c.Endpoint+"/api/v1/files/by-path?path="+url.QueryEscape(remotePath), nil)
+	if err != nil {
+		return FileItem{}, false, err
+	}
+	req.Header.Set("X-Content-SHA256", hex.EncodeToString(hasher.Sum(nil)))
+	c.attachAuth(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return FileItem{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return FileItem{}, false, nil
+	}
+
+	var payload APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return FileItem{}, false, fmt.Errorf("upload failed: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || payload.Code != 0 {
+		return FileItem{}, false, fmt.Errorf("upload failed: %s", payload.Message)
+	}
+
+	if err := json.Unmarshal(payload.Data, &item); err != nil {
+		return FileItem{}, false, err
+	}
+	return item, true, nil
+}
+
+func (c *Client) CreateUploadSession(remotePath string, size, chunkSize int64) (UploadSession, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"path":       remotePath,
+		"size":       size,
+		"chunk_size": chunkSize,
+	})
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	var session UploadSession
+	err = c.doUploadRequest("POST", "/api/v1/uploads", bytes.NewReader(body), int64(len(body)), "application/json", &session)
+	if errors.Is(err, errUploadSessionGone) {
+		return session, errors.New("parent folder not found")
+	}
+	return session, err
+}
+
+func (c *Client) GetUploadSession(uploadID string) (UploadSession, error) {
+	var session UploadSession
+	err := c.doUploadRequest("GET", "/api/v1/uploads/"+uploadID, nil, 0, "", &session)
+	return session, err
+}
+
+func (c *Client) UploadChunk(uploadID string, index int, reader io.Reader, size int64) error {
+	path := fmt.Sprintf("/api/v1/uploads/%s/chunks/%d", uploadID, index)
+	return c.doUploadRequest("PUT", path, reader, size, "application/octet-stream", nil)
+}
+
+func (c *Client) CompleteUploadSession(uploadID string) (FileItem, error) {
+	var item FileItem
+	err := c.doUploadRequest("POST", "/api/v1/uploads/"+uploadID+"/complete", nil, 0, "", &item)
+	return item, err
+}
+
+func (c *Client) doUploadRequest(method, path string, body io.Reader, size int64, contentType string, out interface{}) error {
+	err := c.doAPIRequest(method, path, body, size, contentType, out)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusGone) {
+		return errUploadSessionGone
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type FolderUsage struct {
+	Path    string        `json:"path"`
+	Files   int64         `json:"files"`
+	Size    int64         `json:"size"`
+	Folders []FolderUsage `json:"folders"`
+}
+
+var fileDuCmd = &cobra.Command{
+	Use:   "du [claw:/path]",
+	Short: "Show recursive size of a directory and its subdirectories",
+	Args:  cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remotePath := "/"
+		if len(args) > 0 {
+			if err := validateRemotePath(args[0]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			p, err := parseRemotePath(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			remotePath = p
+		}
+
+		cfg := Config{Endpoint: endpoint, LocalKey: localKey}
+		if cfg.Endpoint == "" || cfg.LocalKey == "" {
+			loadedCfg, err := loadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				return nil
+			}
+			cfg = loadedCfg
+		}
+
+		client := NewClient(cfg)
+		usage, err := client.FolderUsage(remotePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil
+		}
+
+		summarize, _ := cmd.Flags().GetBool("summarize")
+		if !summarize {
+			for _, child := range usage.Folders {
+				printUsageLine(child)
+			}
+		}
+		printUsageLine(usage)
+		return nil
+	},
+}
+
+func printUsageLine(u FolderUsage) {
+	fmt.Printf("%10s  %6d files  %s\n", formatSize(u.Size), u.Files, u.Path)
+}
+
+func (c *Client) FolderUsage(path string) (FolderUsage, error) {
+	var usage FolderUsage
+	err := c.doAPIRequest("GET", "/api/v1/folders/by-path/usage?path="+url.QueryEscape(path), nil, 0, "", &usage)
+	return usage, err
+}
+
+func init() {
+	fileDuCmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint")
+	fileDuCmd.Flags().StringVar(&localKey, "key", "", "Local key")
+	fileDuCmd.Flags().BoolP("summarize", "s", false, "Only show the total")
+}
@@ -17,10 +17,14 @@ import (
 	"github.com/kiry163/claw-pliers/internal/image"
 	"github.com/kiry163/claw-pliers/internal/logger"
 	"github.com/kiry163/claw-pliers/internal/mail"
+	"github.com/kiry163/claw-pliers/internal/service"
 )
 
 var version = "dev"
 
+// storageRetryInterval 为 degraded 模式下重新连接存储后端的间隔
+const storageRetryInterval = 30 * time.Second
+
 func main() {
 	versionFlag := flag.Bool("version", false, "Print version information")
 	configPath := flag.String("config", "config.yaml", "Config file path")
@@ -70,9 +74,18 @@ func main() {
 		cancel()
 	}()
 
+	// 配置了管理员密码且该用户尚不存在时创建初始管理员
+	users := service.NewUserService(file.Database)
+	if err := users.EnsureAdmin(ctx, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword); err != nil {
+		log.Fatal().Err(err).Msg("failed to create admin user")
+	}
+
 	router := api.NewRouter(&cfg, file.Database, version)
+	startBackgroundJobs(ctx, cfg)
 
 	address := ":" + fmt.Sprintf("%d", cfg.Server.Port)
+	// 文件下载和 zip 打包等流式响应在处理时取消写超时，不受 WriteTimeout 限制；
+	// 分片上传在接收请求体时按无数据间隔顺延读超时，不受 ReadTimeout 限制
 	server := &http.Server{
 		Addr:         address,
 		Handler:      router,
@@ -80,17 +93,132 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	if cfg.Server.TLS.Enabled {
+		reloader, err := newTLSReloader(cfg.Server.TLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load tls config")
+		}
+		server.TLSConfig = reloader.TLSConfig()
+		watchTLSReload(ctx, reloader)
+	}
+
 	go func() {
-		log.Info().Str("address", address).Msg("server starting")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info().Str("address", address).Bool("tls", cfg.Server.TLS.Enabled).Str("client_auth", cfg.Server.TLS.ClientAuth).Msg("server starting")
+		var err error
+		if cfg.Server.TLS.Enabled {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("server error")
 		}
 	}()
 
 	<-ctx.Done()
+	mail.GetMonitor().StopAll()
 	log.Info().Msg("server stopped")
 }
 
+// watchTLSReload 收到 SIGHUP 时重新加载证书，加载失败时继续使用原证书
+func watchTLSReload(ctx context.Context, reloader *tlsReloader) {
+	log := logger.Get()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					log.Error().Err(err).Msg("failed to reload tls certificates, keeping the current ones")
+					continue
+				}
+				log.Info().Msg("tls certificates reloaded")
+			}
+		}
+	}()
+}
+
+// startBackgroundJobs 启动周期性维护任务，随 ctx 取消而退出
+func startBackgroundJobs(ctx context.Context, cfg config.Config) {
+	log := logger.Get()
+	quotas := service.NewQuotaService(cfg.Quota, file.Database)
+	files := service.NewFileService(file.Database, file.FileStorage, quotas)
+	versions := service.NewVersionService(cfg.Version, file.Database, file.FileStorage, quotas)
+	uploads := service.NewUploadService(cfg.Upload, file.Database, file.FileStorage, files, versions)
+	trash := service.NewTrashService(file.Database, files, service.NewFolderService(file.Database))
+	auth := service.NewAuthService(cfg.Auth, file.Database, service.NewUserService(file.Database))
+
+	if file.Degraded != nil {
+		file.Degraded.Retry(ctx, storageRetryInterval)
+	}
+
+	runPeriodically(ctx, 10*time.Minute, func() {
+		if _, err := uploads.CleanupExpiredSessions(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to clean up upload sessions")
+		}
+	})
+
+	if auth.Enabled() {
+		runPeriodically(ctx, time.Hour, func() {
+			if _, err := auth.CleanupExpiredTokens(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to clean up expired refresh tokens")
+			}
+		})
+	}
+
+	if cfg.Trash.RetentionDays > 0 {
+		retention := time.Duration(cfg.Trash.RetentionDays) * 24 * time.Hour
+		runPeriodically(ctx, time.Hour, func() {
+			if _, err := trash.PurgeExpired(ctx, retention); err != nil {
+				log.Error().Err(err).Msg("failed to purge expired trash")
+			}
+		})
+	}
+
+	if cfg.Mail.Monitoring.EventRetentionDays > 0 {
+		mails := service.NewMailService(file.Database, files, versions)
+		retention := time.Duration(cfg.Mail.Monitoring.EventRetentionDays) * 24 * time.Hour
+		runPeriodically(ctx, time.Hour, func() {
+			if _, err := mails.PruneEvents(retention); err != nil {
+				log.Error().Err(err).Msg("failed to prune expired mail events")
+			}
+		})
+	}
+
+	if cfg.Mail.Monitoring.AutoStart {
+		started := mail.GetMonitor().StartAll()
+		log.Info().Int("accounts", started).Msg("mail monitor started")
+	}
+
+	if cfg.Version.KeepDays > 0 {
+		runPeriodically(ctx, time.Hour, func() {
+			if _, err := versions.PruneExpired(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to prune expired file versions")
+			}
+		})
+	}
+}
+
+// runPeriodically 立即执行一次 fn，之后每隔 interval 执行一次
+func runPeriodically(ctx context.Context, interval time.Duration, fn func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			fn()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
 func initModules(cfg config.Config) error {
 	log := logger.Get()
 
@@ -101,7 +229,7 @@ func initModules(cfg config.Config) error {
 	log.Info().Msg("file module initialized")
 
 	log.Info().Msg("initializing mail module")
-	if err := mail.Init(cfg); err != nil {
+	if err := mail.Init(cfg, file.Database); err != nil {
 		return fmt.Errorf("mail module init failed: %w", err)
 	}
 	log.Info().Msg("mail module initialized")
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+// tlsReloader 持有当前的服务端证书和客户端 CA，Reload 失败时保留原有配置继续服务
+type tlsReloader struct {
+	cfg config.TLSConfig
+
+	mu      sync.RWMutex
+	current *tls.Config
+}
+
+func newTLSReloader(cfg config.TLSConfig) (*tlsReloader, error) {
+	switch cfg.ClientAuth {
+	case "", "none", "optional", "require":
+	default:
+		return nil, fmt.Errorf("invalid server.tls.client_auth %q, expected none, optional or require", cfg.ClientAuth)
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("server.tls.cert_file and key_file are required when tls is enabled")
+	}
+	if requiresClientCA(cfg) && cfg.ClientCAFile == "" {
+		return nil, errors.New("server.tls.client_ca_file is required when client_auth is optional or require")
+	}
+
+	r := &tlsReloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新读取证书、私钥和客户端 CA 文件，新连接使用新配置
+func (r *tlsReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	next := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if requiresClientCA(r.cfg) {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+		next.ClientCAs = pool
+		next.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.ClientAuth == "require" {
+			next.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r.mu.Lock()
+	r.current = next
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig 返回交给 http.Server 的配置，每次握手取当前生效的证书和客户端 CA
+func (r *tlsReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+	}
+}
+
+func requiresClientCA(cfg config.TLSConfig) bool {
+	return cfg.ClientAuth == "optional" || cfg.ClientAuth == "require"
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+// authorize 检查当前用户对文件夹（nil 表示根目录）是否具有 perm 权限，不足时写出 403 并返回 false
+func authorize(c *gin.Context, access *service.AccessService, folderID *string, perm service.Permission) bool {
+	err := access.Require(c.Request.Context(), getPrincipal(c), folderID, perm)
+	if err == nil {
+		return true
+	}
+
+	respondAccessError(c, err)
+	return false
+}
+
+// authorizeTree 检查当前用户对文件夹及其全部子文件夹的权限
+func authorizeTree(c *gin.Context, access *service.AccessService, folderID string, perm service.Permission) bool {
+	err := access.RequireTree(c.Request.Context(), getPrincipal(c), folderID, perm)
+	if err == nil {
+		return true
+	}
+
+	respondAccessError(c, err)
+	return false
+}
+
+// authorizeFile 按文件所在文件夹检查权限；文件不存在时放行，由调用方返回 404
+func authorizeFile(c *gin.Context, access *service.AccessService, fileID string, perm service.Permission) bool {
+	record, err := file.Database.GetFile(fileID)
+	if err != nil {
+		return true
+	}
+	return authorize(c, access, record.FolderID, perm)
+}
+
+// authorizePath 检查对目录路径的权限，路径中尚不存在的部分按最近一级已存在的上级文件夹判断
+func authorizePath(c *gin.Context, access *service.AccessService, dirPath string, perm service.Permission) bool {
+	return authorize(c, access, nearestFolder(dirPath), perm)
+}
+
+func respondAccessError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrForbidden) {
+		response.Error(c, http.StatusForbidden, response.CodeForbidden, "permission denied")
+		return
+	}
+	response.Error(c, http.StatusInternalServerError, response.CodeInternalError, "failed to check permission")
+}
+
+// optionalID 将空串转换为 nil，用于以空串表示根目录的参数
+func optionalID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+// nearestFolder 返回 dirPath 中最深一级已存在的文件夹，均不存在时返回 nil 即根目录
+func nearestFolder(dirPath string) *string {
+	trimmed := strings.Trim(dirPath, "/")
+	if trimmed == "" {
+		return nil
+	}
+
+	parts := strings.Split(trimmed, "/")
+	for i := len(parts); i > 0; i-- {
+		if folder, err := file.Database.GetFolderByPath("/" + strings.Join(parts[:i], "/")); err == nil {
+			return &folder.FolderID
+		}
+	}
+	return nil
+}
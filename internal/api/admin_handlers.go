@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type AdminHandler struct {
+	Config     *config.Config
+	Fsck       *service.FsckService
+	Limiter    *service.RateLimitService
+	Encryption *service.EncryptionService
+}
+
+func NewAdminHandler(cfg *config.Config, fsck *service.FsckService, limiter *service.RateLimitService, encryption *service.EncryptionService) *AdminHandler {
+	return &AdminHandler{Config: cfg, Fsck: fsck, Limiter: limiter, Encryption: encryption}
+}
+
+func (h *AdminHandler) RunFsck(c *gin.Context) {
+	var req struct {
+		Repair   bool  `json:"repair"`
+		Checksum *bool `json:"checksum"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, 10004, "invalid request")
+			return
+		}
+	}
+
+	opts := service.FsckOptions{Repair: req.Repair, VerifyChecksum: true}
+	if req.Checksum != nil {
+		opts.VerifyChecksum = *req.Checksum
+	}
+
+	// 完整校验需要读取所有对象，耗时可能超过服务端写超时
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	report, err := h.Fsck.Run(c.Request.Context(), opts)
+	if err != nil {
+		respondStorageError(c, err, "fsck failed")
+		return
+	}
+
+	summary := map[string]int{}
+	issues := make([]gin.H, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		summary[issue.Kind]++
+		issues = append(issues, gin.H{
+			"kind":       issue.Kind,
+			"file_id":    issue.FileID,
+			"object_key": issue.ObjectKey,
+			"expected":   issue.Expected,
+			"actual":     issue.Actual,
+			"action":     issue.Action,
+		})
+	}
+
+	response.Success(c, gin.H{
+		"checked_files":   report.CheckedFiles,
+		"checked_objects": report.CheckedObjects,
+		"repair":          opts.Repair,
+		"repaired":        report.Repaired,
+		"summary":         summary,
+		"issues":          issues,
+		"started_at":      report.StartedAt,
+		"finished_at":     report.FinishedAt,
+	})
+}
+
+// RateLimitStats 返回服务启动以来各范围被限流的请求数、认证失败和锁定次数，以及当前被锁定的 IP
+func (h *AdminHandler) RateLimitStats(c *gin.Context) {
+	stats := h.Limiter.Stats()
+
+	locked := make([]gin.H, 0, len(stats.Locked))
+	for _, l := range stats.Locked {
+		locked = append(locked, gin.H{"client": l.Client, "until": l.Until})
+	}
+
+	response.Success(c, gin.H{
+		"enabled":       stats.Enabled,
+		"throttled":     stats.Throttled,
+		"auth_failures": stats.AuthFailures,
+		"lockouts":      stats.Lockouts,
+		"locked":        locked,
+	})
+}
+
+// EncryptionStatus 返回存储加密是否启用、当前主密钥标识以及各主密钥加密的数据密钥数量
+func (h *AdminHandler) EncryptionStatus(c *gin.Context) {
+	status, err := h.Encryption.Status(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to read encryption status")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"enabled":        status.Enabled,
+		"current_key_id": status.CurrentKeyID,
+		"keys":           status.Keys,
+	})
+}
+
+// RotateKeys 用当前主密钥重新加密由旧主密钥加密的数据密钥
+func (h *AdminHandler) RotateKeys(c *gin.Context) {
+	rewrapped, err := h.Encryption.Rotate(c.Request.Context())
+	if errors.Is(err, service.ErrEncryptionDisabled) {
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+		return
+	}
+
+	// 中途失败时已轮换的数据密钥保持有效，再次执行会从剩余的继续
+	setAuditMessage(c, fmt.Sprintf("rewrapped %d data keys", rewrapped))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to rotate data keys: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"rewrapped": rewrapped})
+}
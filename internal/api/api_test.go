@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+)
+
+const testLocalKey = "test-local-key"
+
+// testServer 为使用临时数据库和内存存储的完整路由，请求不经过网络
+type testServer struct {
+	t      *testing.T
+	cfg    config.Config
+	router *gin.Engine
+}
+
+func newTestServer(t *testing.T, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.Storage.Mode = file.ModeMemory
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Auth.LocalKey = testLocalKey
+	cfg.RateLimit.Enabled = false
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	if err := file.Init(cfg); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := file.Database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return &testServer{t: t, cfg: cfg, router: NewRouter(&cfg, file.Database, "test")}
+}
+
+// testResponse 为统一响应格式 {code, message, data}
+type testResponse struct {
+	Status  int
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Body    []byte
+	Header  http.Header
+}
+
+func (r testResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("decode %s: %v", r.Body, err)
+	}
+}
+
+// serve 发送请求并解析响应；token 为空串时以 X-Local-Key 的管理员身份发送，为 "-" 时不带认证
+func (s *testServer) serve(req *http.Request, token string) testResponse {
+	s.t.Helper()
+	switch token {
+	case "":
+		req.Header.Set("X-Local-Key", testLocalKey)
+	case "-":
+	default:
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	resp := testResponse{Status: w.Code, Body: w.Body.Bytes(), Header: w.Header()}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		json.Unmarshal(resp.Body, &resp)
+	}
+	return resp
+}
+
+func (s *testServer) do(method, target, token string, body interface{}) testResponse {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.serve(req, token)
+}
+
+// must 与 do 相同，但要求请求成功
+func (s *testServer) must(method, target, token string, body interface{}) testResponse {
+	s.t.Helper()
+	resp := s.do(method, target, token, body)
+	if resp.Status != http.StatusOK || resp.Code != 0 {
+		s.t.Fatalf("%s %s: %d %s", method, target, resp.Status, resp.Body)
+	}
+	return resp
+}
+
+// user 创建用户并登录，返回访问令牌
+func (s *testServer) user(name, role string) string {
+	s.t.Helper()
+	s.must(http.MethodPost, "/api/v1/admin/users", "", gin.H{"username": name, "password": "pw12345678", "role": role})
+	resp := s.must(http.MethodPost, "/api/v1/auth/login", "-", gin.H{"username": name, "password": "pw12345678"})
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	resp.decode(s.t, &tokens)
+	return tokens.AccessToken
+}
+
+func (s *testServer) grant(dirPath, user, perm string) {
+	s.t.Helper()
+	s.must(http.MethodPut, "/api/v1/admin/grants", "", gin.H{"path": dirPath, "username": user, "permission": perm})
+}
+
+func (s *testServer) mkdir(dirPath string) string {
+	s.t.Helper()
+	resp := s.must(http.MethodPost, "/api/v1/folders/by-path?path="+url.QueryEscape(dirPath), "", nil)
+	var folder struct {
+		FolderID string `json:"folder_id"`
+	}
+	resp.decode(s.t, &folder)
+	return folder.FolderID
+}
+
+// upload 以 token 的身份上传文件，返回响应
+func (s *testServer) upload(filePath, content, token string) testResponse {
+	s.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", filepath.Base(filePath))
+	part.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/by-path?path="+url.QueryEscape(filePath), &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return s.serve(req, token)
+}
+
+// put 以管理员身份上传文件，返回文件 ID
+func (s *testServer) put(filePath, content string) string {
+	s.t.Helper()
+	resp := s.upload(filePath, content, "")
+	if resp.Code != 0 {
+		s.t.Fatalf("upload %s: %s", filePath, resp.Body)
+	}
+	var f struct {
+		FileID string `json:"file_id"`
+	}
+	resp.decode(s.t, &f)
+	return f.FileID
+}
+
+// share 为文件创建分享链接，返回 /s/ 下的路径
+func (s *testServer) share(filePath string, extra gin.H) string {
+	s.t.Helper()
+	body := gin.H{"path": filePath}
+	for k, v := range extra {
+		body[k] = v
+	}
+	resp := s.must(http.MethodPost, "/api/v1/shares", "", body)
+	var link struct {
+		Token string `json:"token"`
+	}
+	resp.decode(s.t, &link)
+	return fmt.Sprintf("/s/%s", link.Token)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type APIKeyHandler struct {
+	Config  *config.Config
+	Service *service.APIKeyService
+}
+
+func NewAPIKeyHandler(cfg *config.Config, svc *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{Config: cfg, Service: svc}
+}
+
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.Service.List(c.Request.Context(), getPrincipal(c))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list api keys")
+		return
+	}
+
+	items := make([]gin.H, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, apiKeyResponse(k))
+	}
+
+	response.Success(c, gin.H{
+		"total": len(items),
+		"keys":  items,
+	})
+}
+
+// CreateKey 为当前用户创建 API 密钥，明文密钥只在此次响应中返回
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		Paths     []string   `json:"paths"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "name and scopes are required")
+		return
+	}
+
+	info, key, err := h.Service.Create(c.Request.Context(), getPrincipal(c), service.APIKeyRequest{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		Paths:     req.Paths,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		h.respondError(c, err, "failed to create api key")
+		return
+	}
+
+	setAuditMessage(c, "key "+info.KeyID)
+	data := apiKeyResponse(info)
+	data["key"] = key
+	response.Success(c, data)
+}
+
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	setAuditMessage(c, "key "+c.Param("id"))
+	if err := h.Service.Revoke(c.Request.Context(), getPrincipal(c), c.Param("id")); err != nil {
+		h.respondError(c, err, "failed to revoke api key")
+		return
+	}
+
+	response.Message(c, "api_key_revoked")
+}
+
+func (h *APIKeyHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		response.Error(c, http.StatusNotFound, 10002, err.Error())
+	case errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrScopeRequired),
+		errors.Is(err, service.ErrInvalidKeyPath), errors.Is(err, service.ErrInvalidKeyExpiry):
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, 19999, message)
+	}
+}
+
+func apiKeyResponse(k service.APIKeyInfo) gin.H {
+	scopes, paths := k.Scopes, k.Paths
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+	return gin.H{
+		"key_id":       k.KeyID,
+		"name":         k.Name,
+		"owner":        k.Owner,
+		"scopes":       scopes,
+		"paths":        paths,
+		"expires_at":   k.ExpiresAt,
+		"last_used_at": k.LastUsedAt,
+		"revoked_at":   k.RevokedAt,
+		"created_at":   k.CreatedAt,
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+)
+
+// createKey 以 token 的身份创建 API 密钥，返回明文密钥和密钥 ID
+func (s *testServer) createKey(token string, scopes, paths []string) (string, string) {
+	s.t.Helper()
+	var created struct {
+		Key   string `json:"key"`
+		KeyID string `json:"key_id"`
+	}
+	s.must(http.MethodPost, "/api/v1/keys", token, gin.H{"name": "test", "scopes": scopes, "paths": paths}).decode(s.t, &created)
+	return created.Key, created.KeyID
+}
+
+// withKey 以 API 密钥发送请求
+func (s *testServer) withKey(method, target, key string) testResponse {
+	s.t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("X-API-Key", key)
+	return s.serve(req, "-")
+}
+
+func TestAPIKeyIsStoredAsHash(t *testing.T) {
+	s := newTestServer(t)
+	key, keyID := s.createKey("", []string{"file:read"}, nil)
+	if !strings.HasPrefix(key, "cpk_"+keyID+"_") {
+		t.Fatalf("key %q does not carry key id %q", key, keyID)
+	}
+
+	record, err := file.Database.GetAPIKey(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(key))
+	if record.KeyHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("key hash = %q", record.KeyHash)
+	}
+	var count int64
+	file.Database.Model(&database.APIKey{}).Where("key_hash = ? OR scopes = ? OR name = ?", key, key, key).Count(&count)
+	if count != 0 {
+		t.Fatal("plaintext key stored in the database")
+	}
+	if resp := s.must(http.MethodGet, "/api/v1/keys", "", nil); bytes.Contains(resp.Body, []byte(key)) {
+		t.Fatal("key listing returns the plaintext key")
+	}
+
+	if resp := s.withKey(http.MethodGet, "/api/v1/folders", key); resp.Status != http.StatusOK {
+		t.Fatalf("valid key: %d %s", resp.Status, resp.Body)
+	}
+	// 密钥 ID 正确但秘密部分不符
+	if resp := s.withKey(http.MethodGet, "/api/v1/folders", key[:len(key)-1]+"x"); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: %d %s", resp.Status, resp.Body)
+	}
+
+	s.must(http.MethodDelete, "/api/v1/keys/"+keyID, "", nil)
+	if resp := s.withKey(http.MethodGet, "/api/v1/folders", key); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("revoked key: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	s.put("/docs/a.txt", "hello")
+	mkdir := func(key, name string) testResponse {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/folders/by-path?path="+url.QueryEscape("/docs/"+name), nil)
+		req.Header.Set("X-API-Key", key)
+		return s.serve(req, "-")
+	}
+
+	tests := []struct {
+		scope string
+		read  bool
+		write bool
+		mail  bool
+	}{
+		{"file:read", true, false, false},
+		{"file:write", false, true, false},
+		{"file:*", true, true, false},
+		{"mail:*", false, false, true},
+		{"*", true, true, true},
+	}
+	for i, tt := range tests {
+		key, _ := s.createKey("", []string{tt.scope}, nil)
+
+		resp := s.withKey(http.MethodGet, "/api/v1/files/by-path/download?path=/docs/a.txt", key)
+		if (resp.Status == http.StatusOK) != tt.read || (!tt.read && resp.Status != http.StatusForbidden) {
+			t.Errorf("%s read: %d %s", tt.scope, resp.Status, resp.Body)
+		}
+		resp = mkdir(key, "dir"+string(rune('a'+i)))
+		if (resp.Status == http.StatusOK) != tt.write || (!tt.write && resp.Status != http.StatusForbidden) {
+			t.Errorf("%s write: %d %s", tt.scope, resp.Status, resp.Body)
+		}
+		// 邮件模块未配置时返回其他错误，这里只关心是否因 scope 被拒绝
+		resp = s.withKey(http.MethodGet, "/api/v1/mail/accounts", key)
+		if (resp.Status != http.StatusForbidden) != tt.mail {
+			t.Errorf("%s mail: %d %s", tt.scope, resp.Status, resp.Body)
+		}
+
+		// 任何 scope 的密钥都不能管理密钥
+		if resp := s.withKey(http.MethodGet, "/api/v1/keys", key); resp.Status != http.StatusForbidden {
+			t.Errorf("%s keys: %d %s", tt.scope, resp.Status, resp.Body)
+		}
+	}
+
+	for _, scopes := range [][]string{{}, {"file:admin"}, {"files:*"}, {"file"}} {
+		if resp := s.do(http.MethodPost, "/api/v1/keys", "", gin.H{"name": "bad", "scopes": scopes}); resp.Status != http.StatusBadRequest {
+			t.Errorf("scopes %v: %d %s", scopes, resp.Status, resp.Body)
+		}
+	}
+}
+
+func TestAPIKeyPathLimits(t *testing.T) {
+	s := newTestServer(t)
+	projects := s.mkdir("/projects")
+	s.mkdir("/projects/alpha")
+	s.mkdir("/projects/beta")
+	s.put("/projects/alpha/a.txt", "alpha")
+	s.put("/projects/beta/b.txt", "beta")
+	s.put("/projects/alphabet.txt", "sibling")
+
+	key, _ := s.createKey("", []string{"*"}, []string{"/projects/alpha/"})
+
+	if resp := s.withKey(http.MethodGet, "/api/v1/files/by-path/download?path=/projects/alpha/a.txt", key); resp.Status != http.StatusOK {
+		t.Fatalf("inside prefix: %d %s", resp.Status, resp.Body)
+	}
+	// 前缀按路径段匹配，/projects/alphabet.txt 不在 /projects/alpha 之下
+	for _, target := range []string{"/projects/beta/b.txt", "/projects/alphabet.txt"} {
+		if resp := s.withKey(http.MethodGet, "/api/v1/files/by-path/download?path="+target, key); resp.Status == http.StatusOK {
+			t.Fatalf("outside prefix %s: %d %s", target, resp.Status, resp.Body)
+		}
+	}
+
+	// 上级目录本身不可读，只列出通往允许范围的文件夹
+	if resp := s.withKey(http.MethodGet, "/api/v1/files/by-path?path=/projects", key); resp.Status != http.StatusForbidden {
+		t.Fatalf("list parent files: %d %s", resp.Status, resp.Body)
+	}
+	for target, want := range map[string]string{
+		"/api/v1/folders":                       `"projects"`,
+		"/api/v1/folders?parent_id=" + projects: `"alpha"`,
+	} {
+		resp := s.withKey(http.MethodGet, target, key)
+		if resp.Status != http.StatusOK || !bytes.Contains(resp.Body, []byte(want)) || bytes.Contains(resp.Body, []byte(`"beta"`)) {
+			t.Fatalf("%s: %d %s", target, resp.Status, resp.Body)
+		}
+	}
+
+	if resp := s.do(http.MethodPost, "/api/v1/keys", "", gin.H{"name": "bad", "scopes": []string{"*"}, "paths": []string{"relative"}}); resp.Status != http.StatusBadRequest {
+		t.Fatalf("relative path: %d %s", resp.Status, resp.Body)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+// maxAuditPageSize 为审计日志分页查询单页的最大条数，更多记录使用导出接口
+const maxAuditPageSize = 1000
+
+type AuditHandler struct {
+	Config  *config.Config
+	Service *service.AuditService
+}
+
+func NewAuditHandler(cfg *config.Config, svc *service.AuditService) *AuditHandler {
+	return &AuditHandler{Config: cfg, Service: svc}
+}
+
+// ListAudit 按 actor、action、status、path（前缀）和 since/until（RFC 3339）筛选审计日志，按时间倒序分页返回
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+	query, ok := auditQueryFromRequest(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > maxAuditPageSize {
+		response.Error(c, http.StatusBadRequest, 10004, "limit must be between 1 and 1000")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid offset")
+		return
+	}
+
+	entries, total, err := h.Service.Query(c.Request.Context(), query, limit, offset)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to query audit logs")
+		return
+	}
+
+	items := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, auditEntryResponse(e))
+	}
+
+	response.Success(c, gin.H{
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"items":  items,
+	})
+}
+
+// ExportAudit 以 JSONL（默认）或 CSV 格式按时间顺序流式导出全部符合条件的审计日志
+func (h *AuditHandler) ExportAudit(c *gin.Context) {
+	query, ok := auditQueryFromRequest(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "jsonl")
+	var export func(context.Context, io.Writer, service.AuditQuery) error
+	switch format {
+	case "jsonl":
+		c.Header("Content-Type", "application/x-ndjson")
+		export = h.exportJSONL
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		export = h.exportCSV
+	default:
+		response.Error(c, http.StatusBadRequest, 10004, "format must be jsonl or csv")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="audit.`+format+`"`)
+	c.Status(http.StatusOK)
+	if err := export(c.Request.Context(), c.Writer, query); err != nil {
+		// 响应已经开始写出，只能记录错误，客户端会收到不完整的导出
+		logger.Get().Error().Err(err).Str("format", format).Msg("failed to export audit logs")
+	}
+}
+
+func (h *AuditHandler) exportJSONL(ctx context.Context, w io.Writer, query service.AuditQuery) error {
+	encoder := json.NewEncoder(w)
+	return h.Service.Each(ctx, query, func(e service.AuditEntry) error {
+		return encoder.Encode(auditEntryResponse(e))
+	})
+}
+
+func (h *AuditHandler) exportCSV(ctx context.Context, w io.Writer, query service.AuditQuery) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "created_at", "actor", "ip", "action", "status", "path", "file_id", "message"}); err != nil {
+		return err
+	}
+
+	err := h.Service.Each(ctx, query, func(e service.AuditEntry) error {
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.Actor, e.IP, e.Action, e.Status, e.Path, e.FileID, e.Message,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func auditQueryFromRequest(c *gin.Context) (service.AuditQuery, bool) {
+	query := service.AuditQuery{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		PathPrefix: c.Query("path"),
+		Status:     c.Query("status"),
+	}
+
+	var ok bool
+	if query.Since, ok = auditTimeParam(c, "since"); !ok {
+		return service.AuditQuery{}, false
+	}
+	if query.Until, ok = auditTimeParam(c, "until"); !ok {
+		return service.AuditQuery{}, false
+	}
+	return query, true
+}
+
+func auditTimeParam(c *gin.Context, name string) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, name+" must be an RFC 3339 time")
+		return nil, false
+	}
+	t = t.UTC()
+	return &t, true
+}
+
+func auditEntryResponse(e service.AuditEntry) gin.H {
+	return gin.H{
+		"id":         e.ID,
+		"created_at": e.CreatedAt,
+		"actor":      e.Actor,
+		"ip":         e.IP,
+		"action":     e.Action,
+		"status":     e.Status,
+		"path":       e.Path,
+		"file_id":    e.FileID,
+		"message":    e.Message,
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type AuthHandler struct {
+	Config  *config.Config
+	Service *service.AuthService
+	Limiter *service.RateLimitService
+}
+
+func NewAuthHandler(cfg *config.Config, svc *service.AuthService, limiter *service.RateLimitService) *AuthHandler {
+	return &AuthHandler{Config: cfg, Service: svc, Limiter: limiter}
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "username and password are required")
+		return
+	}
+	setAuditActor(c, req.Username)
+
+	pair, err := h.Service.Login(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		h.respondError(c, err, "failed to log in")
+		return
+	}
+
+	response.Success(c, tokenPairResponse(pair))
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		return
+	}
+
+	pair, err := h.Service.Refresh(c.Request.Context(), refreshToken)
+	if err != nil {
+		h.respondError(c, err, "failed to refresh token")
+		return
+	}
+
+	response.Success(c, tokenPairResponse(pair))
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Logout(c.Request.Context(), refreshToken); err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to log out")
+		return
+	}
+
+	response.Message(c, "logged_out")
+}
+
+func (h *AuthHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrAuthDisabled):
+		response.Error(c, http.StatusServiceUnavailable, 10001, err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTokenReused):
+		recordAuthFailure(c, h.Limiter)
+		response.Error(c, http.StatusUnauthorized, 10001, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, 19999, message)
+	}
+}
+
+func refreshTokenFromRequest(c *gin.Context) (string, bool) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "refresh_token is required")
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+func tokenPairResponse(pair service.TokenPair) gin.H {
+	return gin.H{
+		"access_token":       pair.AccessToken,
+		"token_type":         "Bearer",
+		"expires_in":         pair.ExpiresIn,
+		"refresh_token":      pair.RefreshToken,
+		"refresh_expires_in": pair.RefreshExpiresIn,
+	}
+}
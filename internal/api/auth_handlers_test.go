@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testTokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (s *testServer) login(name string) testTokenPair {
+	s.t.Helper()
+	var pair testTokenPair
+	s.must(http.MethodPost, "/api/v1/auth/login", "-", gin.H{"username": name, "password": "pw12345678"}).decode(s.t, &pair)
+	return pair
+}
+
+func (s *testServer) refresh(refreshToken string) (testTokenPair, testResponse) {
+	s.t.Helper()
+	var pair testTokenPair
+	resp := s.do(http.MethodPost, "/api/v1/auth/refresh", "-", gin.H{"refresh_token": refreshToken})
+	if resp.Status == http.StatusOK {
+		resp.decode(s.t, &pair)
+	}
+	return pair, resp
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	s := newTestServer(t)
+	s.user("alice", "viewer")
+	first := s.login("alice")
+
+	second, resp := s.refresh(first.RefreshToken)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("refresh: %d %s", resp.Status, resp.Body)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh returned %+v", second)
+	}
+	if resp := s.do(http.MethodGet, "/api/v1/folders", second.AccessToken, nil); resp.Status != http.StatusOK {
+		t.Fatalf("new access token: %d %s", resp.Status, resp.Body)
+	}
+	if _, resp := s.refresh(second.RefreshToken); resp.Status != http.StatusOK {
+		t.Fatalf("refresh with rotated token: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	s := newTestServer(t)
+	s.user("alice", "viewer")
+	stolen := s.login("alice")
+	other := s.login("alice")
+
+	rotated, resp := s.refresh(stolen.RefreshToken)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("refresh: %d %s", resp.Status, resp.Body)
+	}
+
+	// 已轮换的令牌再次出现，同一令牌族中最新的令牌也随之失效
+	if _, resp := s.refresh(stolen.RefreshToken); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("reuse: %d %s", resp.Status, resp.Body)
+	}
+	if _, resp := s.refresh(rotated.RefreshToken); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("refresh after reuse: %d %s", resp.Status, resp.Body)
+	}
+
+	// 另一次登录属于不同的令牌族，不受影响
+	if _, resp := s.refresh(other.RefreshToken); resp.Status != http.StatusOK {
+		t.Fatalf("other session: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	s := newTestServer(t)
+	s.user("alice", "viewer")
+	pair := s.login("alice")
+
+	s.must(http.MethodPost, "/api/v1/auth/logout", "-", gin.H{"refresh_token": pair.RefreshToken})
+	if _, resp := s.refresh(pair.RefreshToken); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: %d %s", resp.Status, resp.Body)
+	}
+	// 令牌无效时登出仍然成功
+	s.must(http.MethodPost, "/api/v1/auth/logout", "-", gin.H{"refresh_token": "unknown"})
+}
+
+func TestRefreshRejectsDisabledUser(t *testing.T) {
+	s := newTestServer(t)
+	s.user("alice", "viewer")
+	pair := s.login("alice")
+
+	s.must(http.MethodPut, "/api/v1/admin/users/alice", "", gin.H{"disabled": true})
+	if _, resp := s.refresh(pair.RefreshToken); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("refresh for disabled user: %d %s", resp.Status, resp.Body)
+	}
+	if resp := s.do(http.MethodPost, "/api/v1/auth/login", "-", gin.H{"username": "alice", "password": "pw12345678"}); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("login for disabled user: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestAccessTokenIsVerified(t *testing.T) {
+	s := newTestServer(t)
+	token := s.user("alice", "viewer")
+
+	for _, bad := range []string{token + "x", token[:len(token)-2], "not-a-jwt"} {
+		if resp := s.do(http.MethodGet, "/api/v1/folders", bad, nil); resp.Status != http.StatusUnauthorized {
+			t.Fatalf("token %q: %d %s", bad, resp.Status, resp.Body)
+		}
+	}
+	if resp := s.do(http.MethodPost, "/api/v1/auth/login", "-", gin.H{"username": "alice", "password": "wrong-password"}); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d %s", resp.Status, resp.Body)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+// contentHashHeader 携带客户端已计算的 SHA-256，服务端已有相同内容时直接秒传
+const contentHashHeader = "X-Content-SHA256"
+
+// contentHashFromRequest 读取并规范化内容哈希，未提供时返回空串，格式错误时 ok 为 false
+func contentHashFromRequest(c *gin.Context) (string, bool) {
+	value := strings.ToLower(strings.TrimSpace(c.GetHeader(contentHashHeader)))
+	if value == "" {
+		return "", true
+	}
+	if len(value) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// uploadFromHash 尝试按哈希秒传，已写出响应时返回 true；
+// 内容不存在且请求未携带文件体时返回 412，由客户端改为完整上传
+func (h *FileHandler) uploadFromHash(c *gin.Context, contentHash, fileID, fileName, folderID string, hashOnly bool, extra gin.H) bool {
+	var metadata service.FileMetadata
+	err := h.reusableContent(c, contentHash)
+	if err == nil {
+		metadata, err = h.Service.CreateFileFromHash(c.Request.Context(), contentHash, fileID, fileName, folderID, getUser(c))
+	}
+	if errors.Is(err, service.ErrContentNotFound) {
+		if hashOnly {
+			// 秒传探测未命中，客户端随后会完整上传，不记为一次失败的上传
+			skipAudit(c)
+			response.Error(c, http.StatusPreconditionFailed, 10004, "content not found, upload the file body")
+			return true
+		}
+		return false
+	}
+	if err != nil {
+		respondStorageError(c, err, "failed to save file")
+		return true
+	}
+
+	setAuditFile(c, metadata.FileID)
+	data := gin.H{
+		"file_id":       metadata.FileID,
+		"original_name": metadata.OriginalName,
+		"size":          metadata.Size,
+		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+		"deduplicated":  metadata.Deduplicated,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	response.Success(c, data)
+	return true
+}
+
+// reusableContent 检查当前用户能否按哈希复用已有内容：须能读取至少一个当前内容相同的文件，
+// 否则返回 ErrContentNotFound，与内容不存在时一样要求上传文件体
+func (h *FileHandler) reusableContent(c *gin.Context, contentHash string) error {
+	ok, err := h.Access.CanReadContent(c.Request.Context(), getPrincipal(c), contentHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return service.ErrContentNotFound
+	}
+	return nil
+}
+
+// verifyContentHash 校验上传内容与声明的哈希一致，不一致时删除刚创建的文件并返回 400
+func (h *FileHandler) verifyContentHash(c *gin.Context, metadata service.FileMetadata, contentHash string) bool {
+	if contentHash == "" || metadata.SHA256 == contentHash {
+		return true
+	}
+
+	h.Service.PurgeFile(c.Request.Context(), metadata.FileID)
+	response.Error(c, http.StatusBadRequest, 10004, contentHashHeader+" does not match uploaded content")
+	return false
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadFromHashRequiresReadAccess(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/secret")
+	s.mkdir("/public")
+	s.put("/secret/key.txt", "top secret")
+	bob := s.user("bob", "editor")
+	s.grant("/", "bob", "write")
+	s.grant("/secret", "bob", "none")
+
+	sum := sha256.Sum256([]byte("top secret"))
+	hash := hex.EncodeToString(sum[:])
+	probe := func(target string) testResponse {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set(contentHashHeader, hash)
+		return s.serve(req, bob)
+	}
+
+	if resp := probe("/api/v1/files/by-path?path=/public/copy.txt"); resp.Status != http.StatusPreconditionFailed {
+		t.Fatalf("hash upload of unreadable content: %d %s", resp.Status, resp.Body)
+	}
+
+	s.put("/public/other.txt", "public")
+	if resp := probe("/api/v1/files/by-path?path=/public/other.txt"); resp.Status != http.StatusPreconditionFailed {
+		t.Fatalf("hash overwrite with unreadable content: %d %s", resp.Status, resp.Body)
+	}
+
+	// 内容出现在可读的位置后可以秒传
+	s.put("/public/shared.txt", "top secret")
+	if resp := probe("/api/v1/files/by-path?path=/public/copy.txt"); resp.Status != http.StatusOK || resp.Code != 0 {
+		t.Fatalf("hash upload of readable content: %d %s", resp.Status, resp.Body)
+	}
+}
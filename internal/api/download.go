@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+)
+
+// downloadTarget 描述一次下载响应所需的对象信息
+type downloadTarget struct {
+	ObjectKey   string
+	Name        string
+	MimeType    string
+	ModTime     time.Time
+	ETag        string
+	Disposition string
+}
+
+// serveDownload 通过 http.ServeContent 输出对象，支持 Range/206、multipart/byteranges、
+// If-Range、If-None-Match、If-Modified-Since 等 RFC 7232/7233 语义
+func serveDownload(c *gin.Context, storage file.Storage, target downloadTarget) {
+	info, err := storage.Stat(c.Request.Context(), target.ObjectKey)
+	if err != nil {
+		respondStorageError(c, err, "failed to get file")
+		return
+	}
+
+	disposition := target.Disposition
+	if disposition == "" {
+		disposition = "attachment"
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": target.Name}))
+	if target.MimeType != "" {
+		c.Header("Content-Type", target.MimeType)
+	}
+	if target.ETag != "" {
+		c.Header("ETag", target.ETag)
+	}
+
+	content := file.NewObjectReadSeeker(c.Request.Context(), storage, target.ObjectKey, info.Size)
+	defer content.Close()
+
+	clearWriteDeadline(c)
+
+	http.ServeContent(c.Writer, c.Request, target.Name, target.ModTime, content)
+}
+
+// clearWriteDeadline 取消本次响应的写超时。server 的 WriteTimeout 自读完请求头起计时，
+// 大文件和 zip 的流式下载耗时可能超过它而被截断
+func clearWriteDeadline(c *gin.Context) {
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.Get().Warn().Err(err).Msg("failed to clear write deadline")
+	}
+}
+
+// fileETag 生成强校验 ETag，文件内容变化时 updated_at 随之变化
+func fileETag(fileID string, updatedAt time.Time) string {
+	return `"` + fileID + "-" + strconv.FormatInt(updatedAt.UnixNano(), 36) + `"`
+}
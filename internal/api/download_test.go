@@ -0,0 +1,39 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadOutlivesWriteTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	content := strings.Repeat("0123456789abcdef", 2*1024*1024)
+	s.put("/docs/big.bin", content)
+	link := s.share("/docs/big.bin", nil)
+
+	server := httptest.NewUnstartedServer(s.router)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// 客户端读取缓慢，响应写完所需时间超过 WriteTimeout
+	time.Sleep(500 * time.Millisecond)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("download cut off after %d bytes: %v", len(body), err)
+	}
+	if len(body) != len(content) {
+		t.Fatalf("downloaded %d bytes, want %d", len(body), len(content))
+	}
+}
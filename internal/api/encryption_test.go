@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+)
+
+func newMasterKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// withEncryptedStorage 使用 dir 下的本地存储和数据库并以 masterKey 加密，previous 为轮换前的主密钥
+func withEncryptedStorage(dir, masterKey string, previous ...string) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Database.Path = filepath.Join(dir, "test.db")
+		cfg.Storage.Mode = file.ModeRequired
+		cfg.Storage.Driver = "local"
+		cfg.Storage.Root = filepath.Join(dir, "objects")
+		cfg.Storage.Encryption = config.EncryptionConfig{Enabled: true, MasterKey: masterKey, PreviousKeys: previous}
+	}
+}
+
+// rangeGet 以本地密钥发送带 Range 的下载请求
+func (s *testServer) rangeGet(target, byteRange string) testResponse {
+	s.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Range", byteRange)
+	return s.serve(req, "")
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, withEncryptedStorage(dir, newMasterKey(t)))
+	s.mkdir("/docs")
+
+	content := string(testContent(200 * 1024))
+	id := s.put("/docs/a.bin", content)
+
+	resp := s.must(http.MethodGet, "/api/v1/files/"+id+"/download", "", nil)
+	if string(resp.Body) != content {
+		t.Fatalf("downloaded %d bytes, want %d", len(resp.Body), len(content))
+	}
+	// 范围跨越两个加密分段的边界
+	resp = s.rangeGet("/api/v1/files/"+id+"/download", "bytes=65000-140000")
+	if resp.Status != http.StatusPartialContent || string(resp.Body) != content[65000:140001] {
+		t.Fatalf("range: %d, %d bytes", resp.Status, len(resp.Body))
+	}
+	resp = s.rangeGet("/api/v1/files/"+id+"/download", "bytes=-10")
+	if resp.Status != http.StatusPartialContent || string(resp.Body) != content[len(content)-10:] {
+		t.Fatalf("suffix range: %d %q", resp.Status, resp.Body)
+	}
+
+	// 存储中的对象不含明文
+	var found bool
+	filepath.Walk(filepath.Join(dir, "objects"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		found = true
+		if bytes.Contains(data, []byte(content[:4096])) {
+			t.Errorf("object %s is stored in plaintext", path)
+		}
+		return nil
+	})
+	if !found {
+		t.Fatal("no stored objects")
+	}
+}
+
+func TestEncryptedChunkedUpload(t *testing.T) {
+	s := newTestServer(t, withEncryptedStorage(t.TempDir(), newMasterKey(t)))
+	s.mkdir("/docs")
+	content := testContent(2*testChunkSize + 100)
+	parts := chunks(content)
+	id := s.createUpload("/docs/big.bin", int64(len(content)), "")
+
+	// 最后一个分片先到，第一个分片重传
+	for _, i := range []int{2, 0, 1, 0} {
+		if resp := s.putChunk(id, i, parts[i], ""); resp.Code != 0 {
+			t.Fatalf("chunk %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	var done struct {
+		FileID string `json:"file_id"`
+		Size   int64  `json:"size"`
+	}
+	s.must(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil).decode(t, &done)
+	if done.Size != int64(len(content)) {
+		t.Fatalf("size = %d", done.Size)
+	}
+
+	resp := s.must(http.MethodGet, "/api/v1/files/"+done.FileID+"/download", "", nil)
+	if !bytes.Equal(resp.Body, content) {
+		t.Fatalf("downloaded %d bytes, want %d", len(resp.Body), len(content))
+	}
+	resp = s.rangeGet("/api/v1/files/"+done.FileID+"/download", "bytes=5242800-5242999")
+	if resp.Status != http.StatusPartialContent || !bytes.Equal(resp.Body, content[5242800:5243000]) {
+		t.Fatalf("range across chunks: %d, %d bytes", resp.Status, len(resp.Body))
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+
+	s := newTestServer(t, withEncryptedStorage(dir, oldKey))
+	s.mkdir("/docs")
+	id := s.put("/docs/a.txt", "rotated secret")
+
+	// 新主密钥启用后，旧密钥加密的数据密钥仍可用旧密钥解开
+	s = newTestServer(t, withEncryptedStorage(dir, newKey, oldKey))
+	if resp := s.must(http.MethodGet, "/api/v1/files/"+id+"/download", "", nil); string(resp.Body) != "rotated secret" {
+		t.Fatalf("read with previous key: %q", resp.Body)
+	}
+	var rotated struct {
+		Rewrapped int `json:"rewrapped"`
+	}
+	s.must(http.MethodPost, "/api/v1/admin/encryption/rotate", "", nil).decode(t, &rotated)
+	if rotated.Rewrapped != 1 {
+		t.Fatalf("rewrapped = %d", rotated.Rewrapped)
+	}
+
+	// 轮换后可以删除旧主密钥
+	s = newTestServer(t, withEncryptedStorage(dir, newKey))
+	if resp := s.must(http.MethodGet, "/api/v1/files/"+id+"/download", "", nil); string(resp.Body) != "rotated secret" {
+		t.Fatalf("read after rotation: %q", resp.Body)
+	}
+	var status struct {
+		CurrentKeyID string           `json:"current_key_id"`
+		Keys         map[string]int64 `json:"keys"`
+	}
+	s.must(http.MethodGet, "/api/v1/admin/encryption", "", nil).decode(t, &status)
+	if len(status.Keys) != 1 || status.Keys[status.CurrentKeyID] != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+}
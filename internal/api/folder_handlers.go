@@ -6,7 +6,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiry163/claw-pliers/internal/config"
-	"github.com/kiry163/claw-pliers/internal/database"
 	"github.com/kiry163/claw-pliers/internal/file"
 	"github.com/kiry163/claw-pliers/internal/response"
 	"github.com/kiry163/claw-pliers/internal/service"
@@ -15,10 +14,11 @@ import (
 type FolderHandler struct {
 	Config  *config.Config
 	Service *service.FolderService
+	Access  *service.AccessService
 }
 
-func NewFolderHandler(cfg *config.Config, svc *service.FolderService) *FolderHandler {
-	return &FolderHandler{Config: cfg, Service: svc}
+func NewFolderHandler(cfg *config.Config, svc *service.FolderService, access *service.AccessService) *FolderHandler {
+	return &FolderHandler{Config: cfg, Service: svc, Access: access}
 }
 
 func (h *FolderHandler) CreateFolder(c *gin.Context) {
@@ -35,12 +35,16 @@ func (h *FolderHandler) CreateFolder(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, 10004, "name is required")
 		return
 	}
+	if !authorize(c, h.Access, nil, service.PermWrite) {
+		return
+	}
 
 	metadata, err := h.Service.CreateFolder(c.Request.Context(), req.Name, "", getUser(c))
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, 19999, "failed to create folder")
 		return
 	}
+	setAuditTarget(c, "/"+metadata.Name)
 
 	response.Success(c, gin.H{
 		"folder_id":  metadata.FolderID,
@@ -63,8 +67,22 @@ func (h *FolderHandler) ListFolders(c *gin.Context) {
 		return
 	}
 
+	// 只列出当前用户可读或其下有授权的文件夹
+	ids := make([]string, 0, len(folders))
+	for _, f := range folders {
+		ids = append(ids, f.FolderID)
+	}
+	visible, err := h.Access.VisibleFolders(c.Request.Context(), getPrincipal(c), parentIDPtr, ids)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list folders")
+		return
+	}
+
 	items := make([]gin.H, 0, len(folders))
 	for _, f := range folders {
+		if !visible[f.FolderID] {
+			continue
+		}
 		items = append(items, gin.H{
 			"folder_id":  f.FolderID,
 			"name":       f.Name,
@@ -74,7 +92,7 @@ func (h *FolderHandler) ListFolders(c *gin.Context) {
 	}
 
 	response.Success(c, gin.H{
-		"total":   len(folders),
+		"total":   len(items),
 		"folders": items,
 	})
 }
@@ -90,6 +108,14 @@ func (h *FolderHandler) GetFolderByPath(c *gin.Context) {
 		response.Error(c, http.StatusNotFound, 10002, "folder not found")
 		return
 	}
+	visible, err := h.Access.VisibleFolders(c.Request.Context(), getPrincipal(c), metadata.ParentID, []string{metadata.FolderID})
+	if err == nil && !visible[metadata.FolderID] {
+		err = service.ErrForbidden
+	}
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
 
 	response.Success(c, gin.H{
 		"folder_id":  metadata.FolderID,
@@ -114,37 +140,29 @@ func (h *FolderHandler) CreateFolderByPath(c *gin.Context) {
 		return
 	}
 
-	var currentParentID *string
-	for i := 0; i < len(parts)-1; i++ {
-		folder, err := h.Service.GetFolderByPath(c.Request.Context(), "/"+parts[i])
-		if err != nil {
-			newFolderID := h.Service.GenerateFolderID()
-			record := database.Folder{
-				FolderID:  newFolderID,
-				Name:      parts[i],
-				ParentID:  currentParentID,
-				CreatedBy: getUser(c),
-				CreatedAt: database.NowRFC3339(),
-				UpdatedAt: database.NowRFC3339(),
-			}
-			if err := file.Database.CreateFolder(&record); err != nil {
-				response.Error(c, http.StatusInternalServerError, 19999, "failed to create folder")
-				return
-			}
-			currentParentID = &newFolderID
-		} else {
-			currentParentID = &folder.FolderID
-		}
+	parentPath := strings.Join(parts[:len(parts)-1], "/")
+	if !authorizePath(c, h.Access, parentPath, service.PermWrite) {
+		return
+	}
+
+	parentID, err := h.Service.EnsureFolderPath(c.Request.Context(), parentPath, getUser(c))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to create folder")
+		return
 	}
 
 	folderName := parts[len(parts)-1]
-	existing, _ := file.Database.GetFolderByName(folderName, currentParentID)
+	existing, _ := file.Database.GetFolderByName(folderName, parentID)
 	if existing.FolderID != "" {
 		response.Error(c, http.StatusConflict, 10010, "folder already exists")
 		return
 	}
 
-	metadata, err := h.Service.CreateFolder(c.Request.Context(), folderName, "", getUser(c))
+	var parent string
+	if parentID != nil {
+		parent = *parentID
+	}
+	metadata, err := h.Service.CreateFolder(c.Request.Context(), folderName, parent, getUser(c))
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, 19999, "failed to create folder")
 		return
@@ -159,54 +177,33 @@ func (h *FolderHandler) CreateFolderByPath(c *gin.Context) {
 	})
 }
 
-func (h *FolderHandler) RenameFolderByPath(c *gin.Context) {
+func (h *FolderHandler) DeleteFolderByPath(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
 		response.Error(c, http.StatusBadRequest, 10004, "path is required")
 		return
 	}
 
-	newName := c.Query("new_name")
-	if newName == "" {
-		response.Error(c, http.StatusBadRequest, 10004, "new_name is required")
-		return
-	}
-
 	metadata, err := h.Service.GetFolderByPath(c.Request.Context(), path)
 	if err != nil {
 		response.Error(c, http.StatusNotFound, 10002, "folder not found")
 		return
 	}
 
-	if err := h.Service.RenameFolder(c.Request.Context(), metadata.FolderID, newName); err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to rename folder")
-		return
-	}
-
-	response.Message(c, "folder_renamed")
-}
-
-func (h *FolderHandler) DeleteFolderByPath(c *gin.Context) {
-	path := c.Query("path")
-	if path == "" {
-		response.Error(c, http.StatusBadRequest, 10004, "path is required")
-		return
-	}
-
-	metadata, err := h.Service.GetFolderByPath(c.Request.Context(), path)
-	if err != nil {
-		response.Error(c, http.StatusNotFound, 10002, "folder not found")
+	if !authorize(c, h.Access, metadata.ParentID, service.PermWrite) || !authorizeTree(c, h.Access, metadata.FolderID, service.PermWrite) {
 		return
 	}
 
-	count, _, err := h.Service.GetFolderItemCount(c.Request.Context(), metadata.FolderID)
+	files, folders, err := h.Service.GetFolderItemCount(c.Request.Context(), metadata.FolderID)
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, 19999, "failed to check folder")
 		return
 	}
+	count := files + folders
 
-	if count > 0 {
-		response.Error(c, http.StatusBadRequest, 10011, "folder not empty")
+	// recursive=true 时整个文件夹连同其内容移入回收站
+	if count > 0 && c.Query("recursive") != "true" {
+		response.Error(c, http.StatusBadRequest, 10011, "folder not empty, use recursive=true")
 		return
 	}
 
@@ -1,8 +1,7 @@
 package api
 
 import (
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,28 +15,56 @@ import (
 )
 
 type FileHandler struct {
-	Config  *config.Config
-	Service *service.FileService
+	Config   *config.Config
+	Service  *service.FileService
+	Versions *service.VersionService
+	Shares   *service.ShareService
+	Access   *service.AccessService
 }
 
-func NewFileHandler(cfg *config.Config, svc *service.FileService) *FileHandler {
-	return &FileHandler{Config: cfg, Service: svc}
+func NewFileHandler(cfg *config.Config, svc *service.FileService, versions *service.VersionService, shares *service.ShareService, access *service.AccessService) *FileHandler {
+	return &FileHandler{Config: cfg, Service: svc, Versions: versions, Shares: shares, Access: access}
 }
 
 func (h *FileHandler) UploadFile(c *gin.Context) {
+	contentHash, ok := contentHashFromRequest(c)
+	if !ok {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid "+contentHashHeader)
+		return
+	}
+
+	folderID := c.Query("folder_id")
+	if !authorize(c, h.Access, optionalID(folderID), service.PermWrite) {
+		return
+	}
+	fileID := h.Service.GenerateFileID()
+
 	uploadedFile, err := c.FormFile("file")
-	if err != nil {
+	if err != nil && contentHash == "" {
 		response.Error(c, http.StatusBadRequest, 10004, "file required")
 		return
 	}
+
+	if contentHash != "" {
+		fileName := c.Query("name")
+		if uploadedFile != nil {
+			fileName = uploadedFile.Filename
+		}
+		if fileName == "" {
+			response.Error(c, http.StatusBadRequest, 10004, "name is required")
+			return
+		}
+		if h.uploadFromHash(c, contentHash, fileID, fileName, folderID, uploadedFile == nil, nil) {
+			return
+		}
+	}
+
 	maxBytes := h.Config.Upload.MaxSizeMB * 1024 * 1024
 	if maxBytes > 0 && uploadedFile.Size > maxBytes {
 		response.Error(c, http.StatusBadRequest, 10004, "file too large")
 		return
 	}
 
-	folderID := c.Query("folder_id")
-
 	src, err := uploadedFile.Open()
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, 19999, "failed to open file")
@@ -45,18 +72,23 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 	defer src.Close()
 
-	fileID := h.Service.GenerateFileID()
 	metadata, err := h.Service.CreateFile(c.Request.Context(), src, uploadedFile.Size, fileID, uploadedFile.Filename, folderID, getUser(c))
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to save file")
+		respondStorageError(c, err, "failed to save file")
 		return
 	}
+	if !h.verifyContentHash(c, metadata, contentHash) {
+		return
+	}
+	setAuditFile(c, metadata.FileID)
 
 	response.Success(c, gin.H{
 		"file_id":       metadata.FileID,
 		"original_name": metadata.OriginalName,
 		"size":          metadata.Size,
 		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+		"deduplicated":  metadata.Deduplicated,
 	})
 }
 
@@ -67,9 +99,9 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 	keyword := c.Query("keyword")
 	folderID := c.Query("folder_id")
 
-	var folderIDPtr *string
-	if folderID != "" {
-		folderIDPtr = &folderID
+	folderIDPtr := optionalID(folderID)
+	if !authorize(c, h.Access, folderIDPtr, service.PermRead) {
+		return
 	}
 
 	result, err := h.Service.ListFiles(c.Request.Context(), folderIDPtr, limit, offset, order, keyword)
@@ -85,6 +117,7 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 			"original_name": r.OriginalName,
 			"size":          r.Size,
 			"mime_type":     r.MimeType,
+			"sha256":        r.SHA256,
 			"created_at":    r.CreatedAt,
 		})
 	}
@@ -97,6 +130,9 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 
 func (h *FileHandler) GetFile(c *gin.Context) {
 	fileID := c.Param("id")
+	if !authorizeFile(c, h.Access, fileID, service.PermRead) {
+		return
+	}
 	metadata, err := h.Service.GetFile(c.Request.Context(), fileID)
 	if err != nil {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
@@ -108,28 +144,38 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		"original_name": metadata.OriginalName,
 		"size":          metadata.Size,
 		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+		"version":       metadata.Version,
 		"created_at":    metadata.CreatedAt,
 	})
 }
 
 func (h *FileHandler) DownloadFile(c *gin.Context) {
 	fileID := c.Param("id")
-	reader, metadata, err := h.Service.GetFileContent(c.Request.Context(), fileID)
+	if !authorizeFile(c, h.Access, fileID, service.PermRead) {
+		return
+	}
+	metadata, err := h.Service.GetFile(c.Request.Context(), fileID)
 	if err != nil {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
 	}
-	defer reader.Close()
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", metadata.OriginalName))
-	c.Header("Content-Type", metadata.MimeType)
-	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
-	c.Status(http.StatusOK)
-	io.Copy(c.Writer, reader)
+	serveDownload(c, file.FileStorage, downloadTarget{
+		ObjectKey: metadata.ObjectKey,
+		Name:      metadata.OriginalName,
+		MimeType:  metadata.MimeType,
+		ModTime:   metadata.UpdatedAt,
+		ETag:      fileETag(metadata.FileID, metadata.UpdatedAt),
+	})
 }
 
 func (h *FileHandler) DeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
+	setAuditFile(c, fileID)
+	if !authorizeFile(c, h.Access, fileID, service.PermWrite) {
+		return
+	}
 	if err := h.Service.DeleteFile(c.Request.Context(), fileID); err != nil {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
@@ -147,25 +193,12 @@ func (h *FileHandler) UploadFileByPath(c *gin.Context) {
 
 	path = strings.TrimPrefix(path, "/")
 
-	uploadedFile, err := c.FormFile("file")
-	if err != nil {
-		response.Error(c, http.StatusBadRequest, 10004, "file required")
-		return
-	}
-
-	maxBytes := h.Config.Upload.MaxSizeMB * 1024 * 1024
-	if maxBytes > 0 && uploadedFile.Size > maxBytes {
-		response.Error(c, http.StatusBadRequest, 10004, "file too large")
+	contentHash, ok := contentHashFromRequest(c)
+	if !ok {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid "+contentHashHeader)
 		return
 	}
 
-	src, err := uploadedFile.Open()
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to open file")
-		return
-	}
-	defer src.Close()
-
 	parts := strings.Split(path, "/")
 	var folderID string
 	var fileName string
@@ -182,11 +215,47 @@ func (h *FileHandler) UploadFileByPath(c *gin.Context) {
 	} else {
 		fileName = parts[0]
 	}
+	if !authorize(c, h.Access, optionalID(folderID), service.PermWrite) {
+		return
+	}
 
 	fileID := h.Service.GenerateFileID()
+
+	uploadedFile, err := c.FormFile("file")
+	if err != nil && contentHash == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "file required")
+		return
+	}
+
+	// 同一路径已有文件时写为新版本，旧内容保留在版本历史中
+	if existing, err := file.Database.GetFileByName(fileName, optionalID(folderID)); err == nil {
+		h.overwriteFile(c, existing.FileID, contentHash, uploadedFile, "/"+path)
+		return
+	}
+
+	if contentHash != "" && h.uploadFromHash(c, contentHash, fileID, fileName, folderID, uploadedFile == nil, gin.H{"path": "/" + path}) {
+		return
+	}
+
+	maxBytes := h.Config.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && uploadedFile.Size > maxBytes {
+		response.Error(c, http.StatusBadRequest, 10004, "file too large")
+		return
+	}
+
+	src, err := uploadedFile.Open()
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to open file")
+		return
+	}
+	defer src.Close()
+
 	metadata, err := h.Service.CreateFile(c.Request.Context(), src, uploadedFile.Size, fileID, fileName, folderID, getUser(c))
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to save file")
+		respondStorageError(c, err, "failed to save file")
+		return
+	}
+	if !h.verifyContentHash(c, metadata, contentHash) {
 		return
 	}
 
@@ -196,6 +265,8 @@ func (h *FileHandler) UploadFileByPath(c *gin.Context) {
 		"path":          "/" + path,
 		"size":          metadata.Size,
 		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+		"deduplicated":  metadata.Deduplicated,
 	})
 }
 
@@ -213,6 +284,9 @@ func (h *FileHandler) ListFilesByPath(c *gin.Context) {
 			folderID = &folder.FolderID
 		}
 	}
+	if !authorize(c, h.Access, folderID, service.PermRead) {
+		return
+	}
 
 	result, err := h.Service.ListFiles(c.Request.Context(), folderID, limit, offset, order, keyword)
 	if err != nil {
@@ -236,6 +310,7 @@ func (h *FileHandler) ListFilesByPath(c *gin.Context) {
 			"path":          filePath,
 			"size":          r.Size,
 			"mime_type":     r.MimeType,
+			"sha256":        r.SHA256,
 			"created_at":    r.CreatedAt,
 		})
 	}
@@ -258,6 +333,9 @@ func (h *FileHandler) GetFileByPath(c *gin.Context) {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
 	}
+	if !authorize(c, h.Access, record.FolderID, service.PermRead) {
+		return
+	}
 
 	response.Success(c, gin.H{
 		"file_id":       record.FileID,
@@ -265,6 +343,8 @@ func (h *FileHandler) GetFileByPath(c *gin.Context) {
 		"path":          path,
 		"size":          record.Size,
 		"mime_type":     record.MimeType,
+		"sha256":        record.SHA256,
+		"version":       record.Version,
 		"created_at":    record.CreatedAt,
 	})
 }
@@ -281,19 +361,17 @@ func (h *FileHandler) DownloadFileByPath(c *gin.Context) {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
 	}
-
-	reader, _, err := file.FileStorage.Get(c.Request.Context(), record.ObjectKey, nil, nil)
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to get file")
+	if !authorize(c, h.Access, record.FolderID, service.PermRead) {
 		return
 	}
-	defer reader.Close()
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", record.OriginalName))
-	c.Header("Content-Type", record.MimeType)
-	c.Header("Content-Length", strconv.FormatInt(record.Size, 10))
-	c.Status(http.StatusOK)
-	io.Copy(c.Writer, reader)
+	serveDownload(c, file.FileStorage, downloadTarget{
+		ObjectKey: record.ObjectKey,
+		Name:      record.OriginalName,
+		MimeType:  record.MimeType,
+		ModTime:   record.UpdatedAt,
+		ETag:      fileETag(record.FileID, record.UpdatedAt),
+	})
 }
 
 func (h *FileHandler) DeleteFileByPath(c *gin.Context) {
@@ -308,6 +386,9 @@ func (h *FileHandler) DeleteFileByPath(c *gin.Context) {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
 	}
+	if !authorize(c, h.Access, record.FolderID, service.PermWrite) {
+		return
+	}
 
 	if err := h.Service.DeleteFile(c.Request.Context(), record.FileID); err != nil {
 		response.Error(c, http.StatusInternalServerError, 19999, "failed to delete file")
@@ -317,55 +398,6 @@ func (h *FileHandler) DeleteFileByPath(c *gin.Context) {
 	response.Message(c, "file_deleted")
 }
 
-func (h *FileHandler) MoveFileByPath(c *gin.Context) {
-	path := c.Query("path")
-	newPath := c.Query("new_path")
-
-	if path == "" || newPath == "" {
-		response.Error(c, http.StatusBadRequest, 10004, "path and new_path are required")
-		return
-	}
-
-	record, err := file.Database.GetFileByPath(path)
-	if err != nil {
-		response.Error(c, http.StatusNotFound, 10002, "file not found")
-		return
-	}
-
-	newPath = strings.TrimPrefix(newPath, "/")
-	parts := strings.Split(newPath, "/")
-	var newFolderID *string
-
-	if len(parts) > 1 {
-		folderPath := "/" + strings.Join(parts[:len(parts)-1], "/")
-
-		folder, err := file.Database.GetFolderByPath(folderPath)
-		if err != nil {
-			response.Error(c, http.StatusNotFound, 10002, "target folder not found")
-			return
-		}
-		newFolderID = &folder.FolderID
-	}
-
-	newFileName := parts[len(parts)-1]
-
-	if newFolderID != nil {
-		if err := file.Database.UpdateFileFolder(record.FileID, newFolderID); err != nil {
-			response.Error(c, http.StatusInternalServerError, 19999, "failed to move file")
-			return
-		}
-	}
-
-	if newFileName != "" && newFileName != record.OriginalName {
-		if err := file.Database.UpdateFileName(record.FileID, newFileName); err != nil {
-			response.Error(c, http.StatusInternalServerError, 19999, "failed to rename file")
-			return
-		}
-	}
-
-	response.Message(c, "file_moved")
-}
-
 func (h *FileHandler) GetFileInfoByPath(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
@@ -378,30 +410,16 @@ func (h *FileHandler) GetFileInfoByPath(c *gin.Context) {
 		response.Error(c, http.StatusNotFound, 10002, "file not found")
 		return
 	}
-
-	shareLink, _ := h.Service.GetActiveShareLink(c.Request.Context(), record.FileID, time.Now().UTC())
-
-	var downloadLink string
-	var expiresAt time.Time
-	publicURL := h.Config.Server.PublicEndpoint
-	if publicURL == "" {
-		publicURL = fmt.Sprintf("http://localhost:%d", h.Config.Server.Port)
+	if !authorize(c, h.Access, record.FolderID, service.PermRead) {
+		return
 	}
 
-	if shareLink.Token == "" {
-		now := time.Now().UTC()
-		expiresAtVal := now.Add(7 * 24 * time.Hour)
-		token, link, err := h.Service.CreateShareLink(c.Request.Context(), record.FileID, getUser(c), publicURL)
-		if err != nil {
-			response.Error(c, http.StatusInternalServerError, 19999, "failed to create share link")
-			return
-		}
-		shareLink.Token = token
-		downloadLink = link
-		expiresAt = expiresAtVal
-	} else {
-		downloadLink = fmt.Sprintf("%s/s/%s", publicURL, shareLink.Token)
-		expiresAt = shareLink.ExpiresAt
+	// 只展示已有的可用分享链接，创建链接使用 POST /api/v1/shares
+	var downloadLink string
+	var expiresAt *time.Time
+	if link, err := h.Shares.Active(c.Request.Context(), record.FileID); err == nil {
+		downloadLink = shareURL(h.Config, link.Token)
+		expiresAt = link.ExpiresAt
 	}
 
 	response.Success(c, gin.H{
@@ -410,82 +428,32 @@ func (h *FileHandler) GetFileInfoByPath(c *gin.Context) {
 		"path":          path,
 		"size":          record.Size,
 		"mime_type":     record.MimeType,
+		"sha256":        record.SHA256,
+		"integrity":     integrityStatus(record.IntegrityError),
+		"version":       record.Version,
 		"created_at":    record.CreatedAt,
 		"download_link": downloadLink,
 		"expires_at":    expiresAt,
 	})
 }
 
-func (h *FileHandler) GenerateShareLinkByPath(c *gin.Context) {
-	path := c.Query("path")
-	if path == "" {
-		response.Error(c, http.StatusBadRequest, 10004, "path is required")
-		return
-	}
-
-	record, err := file.Database.GetFileByPath(path)
-	if err != nil {
-		response.Error(c, http.StatusNotFound, 10002, "file not found")
-		return
-	}
-
-	publicURL := h.Config.Server.PublicEndpoint
-	if publicURL == "" {
-		publicURL = fmt.Sprintf("http://localhost:%d", h.Config.Server.Port)
+// integrityStatus 将 fsck 标记的问题转换为展示用状态，未标记时为 ok
+func integrityStatus(integrityError string) string {
+	if integrityError == "" {
+		return "ok"
 	}
-
-	token, downloadLink, err := h.Service.CreateShareLink(c.Request.Context(), record.FileID, getUser(c), publicURL)
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to create share link")
-		return
-	}
-
-	response.Success(c, gin.H{
-		"token":        token,
-		"download_url": downloadLink,
-		"expires_at":   time.Now().UTC().Add(7 * 24 * time.Hour).Format(time.RFC3339),
-	})
+	return integrityError
 }
 
-func (h *FileHandler) DownloadByShareToken(c *gin.Context) {
-	token := c.Param("token")
-	if token == "" {
-		response.Error(c, http.StatusBadRequest, 10004, "token is required")
-		return
-	}
-
-	link, err := h.Service.GetShareLink(c.Request.Context(), token)
-	if err != nil {
-		response.Error(c, http.StatusNotFound, 10002, "link not found")
-		return
-	}
-
-	if link.Status != "active" {
-		response.Error(c, http.StatusGone, 10003, "link has been revoked")
-		return
-	}
-
-	if time.Now().UTC().After(link.ExpiresAt) {
-		response.Error(c, http.StatusGone, 10003, "link has expired")
-		return
-	}
-
-	record, err := file.Database.GetFile(link.FileID)
-	if err != nil {
-		response.Error(c, http.StatusNotFound, 10002, "file not found")
+// respondStorageError 在存储后端不可用时返回 503，超出配额时返回 413，其余情况按内部错误处理
+func respondStorageError(c *gin.Context, err error, message string) {
+	if errors.Is(err, file.ErrStorageUnavailable) {
+		response.Error(c, http.StatusServiceUnavailable, response.CodeInternalError, "storage unavailable")
 		return
 	}
-
-	reader, _, err := file.FileStorage.Get(c.Request.Context(), record.ObjectKey, nil, nil)
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 19999, "failed to get file")
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		response.Error(c, http.StatusRequestEntityTooLarge, response.CodeQuotaExceeded, err.Error())
 		return
 	}
-	defer reader.Close()
-
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", record.OriginalName))
-	c.Header("Content-Type", record.MimeType)
-	c.Header("Content-Length", strconv.FormatInt(record.Size, 10))
-	c.Status(http.StatusOK)
-	io.Copy(c.Writer, reader)
+	response.Error(c, http.StatusInternalServerError, response.CodeInternalError, message)
 }
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/mail"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+type HealthHandler struct {
+	DB      *database.DB
+	Storage file.Storage
+	Version string
+}
+
+func NewHealthHandler(db *database.DB, storage file.Storage, version string) *HealthHandler {
+	return &HealthHandler{DB: db, Storage: storage, Version: version}
+}
+
+type moduleStatus struct {
+	Ready  bool   `json:"ready"`
+	Driver string `json:"driver,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health 报告各模块就绪状态，任一模块不可用时返回 503
+func (h *HealthHandler) Health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	modules := map[string]moduleStatus{
+		"database": checkModule(ctx, h.DB.Ping),
+		"storage":  checkModule(ctx, h.Storage.Ping),
+		"mail":     {Ready: mail.GetConfig() != nil},
+		"image":    {Ready: true},
+	}
+
+	storage := modules["storage"]
+	storage.Driver = file.Driver
+	storage.Mode = file.Mode
+	modules["storage"] = storage
+
+	status := "ok"
+	code := http.StatusOK
+	for _, m := range modules {
+		if !m.Ready {
+			status = "degraded"
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status":  status,
+		"version": h.Version,
+		"modules": modules,
+	})
+}
+
+func checkModule(ctx context.Context, ping func(context.Context) error) moduleStatus {
+	if err := ping(ctx); err != nil {
+		return moduleStatus{Ready: false, Error: err.Error()}
+	}
+	return moduleStatus{Ready: true}
+}
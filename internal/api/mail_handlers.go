@@ -1,10 +1,24 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/mail"
 	"github.com/kiry163/claw-pliers/internal/response"
 	"github.com/kiry163/claw-pliers/internal/service"
 )
@@ -12,10 +26,11 @@ import (
 type MailHandler struct {
 	cfg     *config.Config
 	Service *service.MailService
+	Access  *service.AccessService
 }
 
-func NewMailHandler(cfg *config.Config, svc *service.MailService) *MailHandler {
-	return &MailHandler{cfg: cfg, Service: svc}
+func NewMailHandler(cfg *config.Config, svc *service.MailService, access *service.AccessService) *MailHandler {
+	return &MailHandler{cfg: cfg, Service: svc, Access: access}
 }
 
 func (h *MailHandler) TestConnection(c *gin.Context) {
@@ -38,32 +53,199 @@ func (h *MailHandler) TestConnection(c *gin.Context) {
 	})
 }
 
+// SendMailRequest 为发送邮件的请求。To、Cc、Bcc 可以是字符串或字符串数组，每项可包含逗号分隔的多个地址；
+// Body 为纯文本正文，HTML 为 HTML 正文，至少提供一项
 type SendMailRequest struct {
-	From    string `json:"from" binding:"required"`
-	To      string `json:"to" binding:"required"`
-	Subject string `json:"subject" binding:"required"`
-	Body    string `json:"body" binding:"required"`
+	From        string            `json:"from"`
+	To          recipientList     `json:"to"`
+	Cc          recipientList     `json:"cc"`
+	Bcc         recipientList     `json:"bcc"`
+	Subject     string            `json:"subject"`
+	Body        string            `json:"body"`
+	HTML        string            `json:"html"`
+	Headers     map[string]string `json:"headers"`
+	InReplyTo   string            `json:"in_reply_to"`
+	References  []string          `json:"references"`
+	ReplyToUID  uint32            `json:"reply_to_uid"`
+	Attachments []SendAttachment  `json:"attachments"`
 }
 
+// SendAttachment 为请求中的附件：Path 引用文件模块中的文件，否则 Content 为 base64 编码的附件内容
+type SendAttachment struct {
+	Path        string `json:"path"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+type recipientList []string
+
+func (r *recipientList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*r = recipientList{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*r = list
+	return nil
+}
+
+// SendMail 发送邮件。请求体为 JSON；也可以是 multipart/form-data，此时 request 字段为 JSON 请求，
+// attachments 字段为随请求上传的附件文件
 func (h *MailHandler) SendMail(c *gin.Context) {
 	var req SendMailRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		response.Error(c, http.StatusBadRequest, 10001, "invalid request body")
+	var uploads []*multipart.FileHeader
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil || len(form.Value["request"]) == 0 || json.Unmarshal([]byte(form.Value["request"][0]), &req) != nil {
+			response.Error(c, http.StatusBadRequest, 10004, "invalid request body")
+			return
+		}
+		uploads = form.File["attachments"]
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid request body")
+		return
+	}
+	if req.From == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "from is required")
+		return
+	}
+	if req.ReplyToUID == 0 && (req.Subject == "" || len(req.To)+len(req.Cc)+len(req.Bcc) == 0) {
+		response.Error(c, http.StatusBadRequest, 10004, "subject and at least one recipient are required")
+		return
+	}
+	if req.Body == "" && req.HTML == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "body or html is required")
 		return
 	}
 
-	err := h.Service.SendMail(req.From, req.To, req.Subject, req.Body)
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, 10002, err.Error())
+	label := "from " + req.From
+	if recipients := append(append(append([]string{}, req.To...), req.Cc...), req.Bcc...); len(recipients) > 0 {
+		label += " to " + strings.Join(recipients, ", ")
+	}
+	if req.ReplyToUID != 0 {
+		label += fmt.Sprintf(" replying to uid %d", req.ReplyToUID)
+	}
+	setAuditMessage(c, label)
+
+	attachments, ok := h.sendAttachments(c, req.Attachments, uploads)
+	if !ok {
+		return
+	}
+
+	msg := mail.OutgoingMessage{
+		From:        req.From,
+		To:          req.To,
+		Cc:          req.Cc,
+		Bcc:         req.Bcc,
+		Subject:     req.Subject,
+		Text:        req.Body,
+		HTML:        req.HTML,
+		Headers:     req.Headers,
+		InReplyTo:   strings.Trim(req.InReplyTo, "<> "),
+		Attachments: attachments,
+	}
+	for _, ref := range req.References {
+		msg.References = append(msg.References, strings.Trim(ref, "<> "))
+	}
+
+	if err := h.Service.SendMail(msg, req.ReplyToUID); err != nil {
+		respondMailError(c, err)
 		return
 	}
 
 	response.Success(c, gin.H{
-		"status":  "ok",
-		"message": "email sent successfully",
+		"status":      "ok",
+		"message":     "email sent successfully",
+		"attachments": len(attachments),
 	})
 }
 
+// sendAttachments 收集请求中的附件：读取 path 引用的文件（需要该文件的读权限和 file:read），
+// 解码内联内容，并读取随请求上传的文件
+func (h *MailHandler) sendAttachments(c *gin.Context, items []SendAttachment, uploads []*multipart.FileHeader) ([]mail.OutgoingAttachment, bool) {
+	attachments := make([]mail.OutgoingAttachment, 0, len(items)+len(uploads))
+	// 读取文件前按记录的大小检查总量，避免把超出限制的大文件读入内存
+	var total int64
+	tooLarge := func(size int64) bool {
+		total += size
+		if total > mail.MaxAttachmentsSize {
+			response.Error(c, http.StatusBadRequest, 10004, fmt.Sprintf("attachments exceed %d MB", mail.MaxAttachmentsSize>>20))
+			return true
+		}
+		return false
+	}
+
+	for _, item := range items {
+		if item.Path == "" {
+			if item.Filename == "" {
+				response.Error(c, http.StatusBadRequest, 10004, "attachment filename is required")
+				return nil, false
+			}
+			if tooLarge(int64(len(item.Content))) {
+				return nil, false
+			}
+			attachments = append(attachments, mail.OutgoingAttachment{Filename: item.Filename, ContentType: item.ContentType, Data: item.Content})
+			continue
+		}
+
+		if !getPrincipal(c).HasScope(service.ScopeFileRead) {
+			response.Error(c, http.StatusForbidden, response.CodeForbidden, "api key lacks scope "+service.ScopeFileRead)
+			return nil, false
+		}
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(item.Path, "claw:"), "/")
+		record, err := file.Database.GetFileByPath(filePath)
+		if err != nil {
+			response.Error(c, http.StatusNotFound, 10002, "attachment file not found: "+filePath)
+			return nil, false
+		}
+		if !authorize(c, h.Access, record.FolderID, service.PermRead) || tooLarge(record.Size) {
+			return nil, false
+		}
+		attachment, err := h.Service.ReadAttachmentFile(c.Request.Context(), record.FileID)
+		if err != nil {
+			respondStorageError(c, err, "failed to read attachment file")
+			return nil, false
+		}
+		if item.Filename != "" {
+			attachment.Filename = item.Filename
+		}
+		if item.ContentType != "" {
+			attachment.ContentType = item.ContentType
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	for _, upload := range uploads {
+		if tooLarge(upload.Size) {
+			return nil, false
+		}
+		src, err := upload.Open()
+		if err != nil {
+			response.Error(c, http.StatusInternalServerError, 19999, "failed to open attachment")
+			return nil, false
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			response.Error(c, http.StatusInternalServerError, 19999, "failed to read attachment")
+			return nil, false
+		}
+		attachments = append(attachments, mail.OutgoingAttachment{
+			Filename:    upload.Filename,
+			ContentType: upload.Header.Get("Content-Type"),
+			Data:        data,
+		})
+	}
+	return attachments, true
+}
+
 func (h *MailHandler) GetLatestEmails(c *gin.Context) {
 	email := c.Query("email")
 	if email == "" {
@@ -91,3 +273,256 @@ func (h *MailHandler) ListAccounts(c *gin.Context) {
 		"accounts": accounts,
 	})
 }
+
+func (h *MailHandler) MonitorStatus(c *gin.Context) {
+	response.Success(c, gin.H{
+		"webhook_enabled": h.Service.WebhookEnabled(),
+		"accounts":        h.Service.MonitorStatus(),
+	})
+}
+
+// StartMonitor 开始监听 email 查询参数指定的账户，未指定时监听所有启用的账户
+func (h *MailHandler) StartMonitor(c *gin.Context) {
+	email := c.Query("email")
+	label := monitorAuditLabel(email)
+	setAuditMessage(c, label)
+
+	started, err := h.Service.StartMonitor(email)
+	if err != nil {
+		respondMailError(c, err)
+		return
+	}
+
+	setAuditMessage(c, fmt.Sprintf("%s: started %d", label, started))
+	response.Success(c, gin.H{
+		"started":  started,
+		"accounts": h.Service.MonitorStatus(),
+	})
+}
+
+// StopMonitor 停止监听 email 查询参数指定的账户，未指定时停止所有账户
+func (h *MailHandler) StopMonitor(c *gin.Context) {
+	email := c.Query("email")
+	label := monitorAuditLabel(email)
+	setAuditMessage(c, label)
+
+	stopped, err := h.Service.StopMonitor(email)
+	if err != nil {
+		respondMailError(c, err)
+		return
+	}
+
+	setAuditMessage(c, fmt.Sprintf("%s: stopped %d", label, stopped))
+	response.Success(c, gin.H{
+		"stopped":  stopped,
+		"accounts": h.Service.MonitorStatus(),
+	})
+}
+
+// GetMessage 按 UID 返回 email 账户 INBOX 中的完整邮件：头部、纯文本和 HTML 正文、转换后的正文以及附件列表
+func (h *MailHandler) GetMessage(c *gin.Context) {
+	email, uid, ok := messageParams(c)
+	if !ok {
+		return
+	}
+
+	msg, err := h.Service.GetMessage(email, uid)
+	if err != nil {
+		respondMailError(c, err)
+		return
+	}
+	response.Success(c, msg)
+}
+
+// DownloadAttachment 下载邮件中序号为 index 的附件
+func (h *MailHandler) DownloadAttachment(c *gin.Context) {
+	email, uid, ok := messageParams(c)
+	if !ok {
+		return
+	}
+	index, ok := attachmentIndexParam(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.Service.GetAttachment(email, uid, index)
+	if err != nil {
+		respondMailError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	if attachment.ContentType != "" {
+		c.Header("Content-Type", attachment.ContentType)
+	}
+	http.ServeContent(c.Writer, c.Request, attachment.Filename, time.Time{}, bytes.NewReader(attachment.Data))
+}
+
+// SaveAttachment 把邮件附件保存到 path 指定的位置：path 为已有文件夹或以 / 结尾时保存到该文件夹下并沿用附件文件名，
+// 否则作为完整的文件路径；目标文件已存在时写为新版本
+func (h *MailHandler) SaveAttachment(c *gin.Context) {
+	email, uid, ok := messageParams(c)
+	if !ok {
+		return
+	}
+	index, ok := attachmentIndexParam(c)
+	if !ok {
+		return
+	}
+	target := c.Query("path")
+	if target == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "path is required")
+		return
+	}
+	setAuditMessage(c, fmt.Sprintf("account %s uid %d attachment %d", email, uid, index))
+
+	folderPath, fileName := "/"+strings.Trim(target, "/"), ""
+	if !strings.HasSuffix(target, "/") {
+		if _, err := h.Service.GetFolder(folderPath); err != nil {
+			folderPath, fileName = path.Split(folderPath)
+		}
+	}
+	var folderID string
+	if trimmed := strings.Trim(folderPath, "/"); trimmed != "" {
+		folder, err := h.Service.GetFolder("/" + trimmed)
+		if err != nil {
+			response.Error(c, http.StatusNotFound, 10002, "parent folder not found")
+			return
+		}
+		folderID = folder.FolderID
+	}
+	if !authorize(c, h.Access, optionalID(folderID), service.PermWrite) {
+		return
+	}
+
+	attachment, err := h.Service.GetAttachment(email, uid, index)
+	if err != nil {
+		respondMailError(c, err)
+		return
+	}
+	maxBytes := h.cfg.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && int64(len(attachment.Data)) > maxBytes {
+		response.Error(c, http.StatusBadRequest, 10004, "file too large")
+		return
+	}
+
+	if fileName == "" {
+		fileName = attachmentFileName(attachment)
+	}
+	filePath := strings.TrimSuffix(folderPath, "/") + "/" + fileName
+	setAuditTarget(c, filePath)
+
+	metadata, err := h.Service.SaveAttachment(c.Request.Context(), attachment, folderID, fileName, getUser(c))
+	if err != nil {
+		respondStorageError(c, err, "failed to save attachment")
+		return
+	}
+	setAuditFile(c, metadata.FileID)
+
+	response.Success(c, gin.H{
+		"file_id":       metadata.FileID,
+		"original_name": metadata.OriginalName,
+		"path":          filePath,
+		"size":          metadata.Size,
+		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+	})
+}
+
+// messageParams 读取 email 查询参数和 uid 路径参数，出错时返回 400
+func messageParams(c *gin.Context) (string, uint32, bool) {
+	email := c.Query("email")
+	if email == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "email is required")
+		return "", 0, false
+	}
+	uid, err := strconv.ParseUint(c.Param("uid"), 10, 32)
+	if err != nil || uid == 0 {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid uid")
+		return "", 0, false
+	}
+	return email, uint32(uid), true
+}
+
+func attachmentIndexParam(c *gin.Context) (int, bool) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 1 {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid attachment index")
+		return 0, false
+	}
+	return index, true
+}
+
+// attachmentFileName 返回保存附件时使用的文件名，去掉发件人可能附带的目录部分
+func attachmentFileName(attachment *mail.Attachment) string {
+	name := path.Base(strings.ReplaceAll(attachment.Filename, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return fmt.Sprintf("attachment-%d", attachment.Index)
+	}
+	return name
+}
+
+// ListEvents 按 account、status 和 since/until（RFC 3339）筛选监听处理过的邮件，按处理时间倒序分页返回
+func (h *MailHandler) ListEvents(c *gin.Context) {
+	filter := database.MailEventFilter{
+		Account: c.Query("account"),
+		Status:  c.Query("status"),
+	}
+	switch filter.Status {
+	case "", mail.EventPending, mail.EventNotified, mail.EventFailed, mail.EventSkipped:
+	default:
+		response.Error(c, http.StatusBadRequest, 10004, "status must be one of pending, notified, failed, skipped")
+		return
+	}
+
+	var ok bool
+	if filter.Since, ok = auditTimeParam(c, "since"); !ok {
+		return
+	}
+	if filter.Until, ok = auditTimeParam(c, "until"); !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > maxAuditPageSize {
+		response.Error(c, http.StatusBadRequest, 10004, "limit must be between 1 and 1000")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid offset")
+		return
+	}
+
+	events, total, err := h.Service.ListEvents(filter, limit, offset)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to query mail events")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"items":  events,
+	})
+}
+
+// monitorAuditLabel 返回审计消息中的账户描述，邮箱不是文件路径，不能记为审计目标
+func monitorAuditLabel(email string) string {
+	if email == "" {
+		return "all accounts"
+	}
+	return "account " + email
+}
+
+func respondMailError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mail.ErrAccountNotFound), errors.Is(err, mail.ErrMessageNotFound), errors.Is(err, mail.ErrAttachmentNotFound):
+		response.Error(c, http.StatusNotFound, 10002, err.Error())
+	case errors.Is(err, mail.ErrAccountDisabled), errors.Is(err, mail.ErrInvalidMessage):
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, 19999, err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/mail"
+)
+
+func TestListMailAccountsHidesCredentials(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Mail.Accounts = []config.AccountConfig{
+			{Provider: "163", Email: "bot@163.com", AuthToken: "secret-token", Enabled: true},
+		}
+	})
+	if err := mail.Init(s.cfg, file.Database); err != nil {
+		t.Fatalf("mail init: %v", err)
+	}
+	bob := s.user("bob", "editor")
+
+	if resp := s.do(http.MethodGet, "/api/v1/mail/accounts", bob, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("editor lists accounts: %d %s", resp.Status, resp.Body)
+	}
+
+	resp := s.must(http.MethodGet, "/api/v1/mail/accounts", "", nil)
+	if strings.Contains(string(resp.Body), "secret-token") || strings.Contains(string(resp.Body), "auth_token") {
+		t.Fatalf("account list leaks credentials: %s", resp.Body)
+	}
+	var data struct {
+		Accounts []mail.AccountInfo `json:"accounts"`
+	}
+	resp.decode(t, &data)
+	if len(data.Accounts) != 1 || data.Accounts[0].IMAP.Host != "imap.163.com" || data.Accounts[0].SMTP.Port != 465 {
+		t.Fatalf("accounts = %+v", data.Accounts)
+	}
+}
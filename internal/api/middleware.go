@@ -1,14 +1,21 @@
 package api
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
 	"github.com/kiry163/claw-pliers/internal/logger"
 	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
 )
 
 type Handler struct {
@@ -48,32 +55,298 @@ func RequestLogger() gin.HandlerFunc {
 	}
 }
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware 接受签名有效的 Bearer 访问令牌、X-API-Key 中的 API 密钥或与配置一致的 X-Local-Key；
+// 令牌和密钥对应的用户须存在且未禁用，X-Local-Key 以内置管理员 local 的身份运行。
+// 启用 mTLS 时，未携带这些凭据的请求以已验证客户端证书映射的用户身份运行。
+// 无效的凭据计为认证失败，失败过多而被锁定的 IP 直接返回 429；认证通过后按密钥或用户限流
+func AuthMiddleware(cfg *config.Config, auth *service.AuthService, access *service.AccessService, keys *service.APIKeyService, limiter *service.RateLimitService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !checkLockout(c, limiter) {
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			_ = tokenString
-			c.Set("user", "bearer")
-			c.Next()
+			username, err := auth.ParseAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				recordAuthFailure(c, limiter)
+				response.Error(c, http.StatusUnauthorized, 10001, "invalid or expired token")
+				c.Abort()
+				return
+			}
+			principal, err := access.Resolve(c.Request.Context(), username)
+			if err != nil {
+				if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrUserDisabled) {
+					recordAuthFailure(c, limiter)
+					response.Error(c, http.StatusUnauthorized, 10001, "user not found or disabled")
+				} else {
+					response.Error(c, http.StatusInternalServerError, 19999, "failed to verify token")
+				}
+				c.Abort()
+				return
+			}
+			authenticated(c, limiter, principal)
+			return
+		}
+
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			principal, err := keys.Authenticate(c.Request.Context(), apiKey)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					recordAuthFailure(c, limiter)
+					response.Error(c, http.StatusUnauthorized, 10001, err.Error())
+				} else {
+					response.Error(c, http.StatusInternalServerError, 19999, "failed to verify api key")
+				}
+				c.Abort()
+				return
+			}
+			authenticated(c, limiter, principal)
 			return
 		}
 
 		localKey := c.GetHeader("X-Local-Key")
-		if localKey != "" && localKey == cfg.Auth.LocalKey {
-			c.Set("user", "local")
-			c.Next()
+		if localKey != "" && cfg.Auth.LocalKey != "" && subtle.ConstantTimeCompare([]byte(localKey), []byte(cfg.Auth.LocalKey)) == 1 {
+			authenticated(c, limiter, service.LocalPrincipal)
 			return
 		}
 
+		if localKey != "" {
+			recordAuthFailure(c, limiter)
+		} else if username, ok := clientCertIdentity(cfg, c.Request); ok {
+			principal, err := access.Resolve(c.Request.Context(), username)
+			if err != nil {
+				response.Error(c, http.StatusUnauthorized, 10001, "client certificate user not found or disabled")
+				c.Abort()
+				return
+			}
+			authenticated(c, limiter, principal)
+			return
+		}
 		response.Error(c, http.StatusUnauthorized, 10001, "unauthorized")
 		c.Abort()
 	}
 }
 
+// authenticated 保存通过认证的身份，并按 API 密钥（未使用密钥时按用户）限流
+func authenticated(c *gin.Context, limiter *service.RateLimitService, principal service.Principal) {
+	setPrincipal(c, principal)
+
+	client := "user:" + principal.Name
+	if principal.KeyID != "" {
+		client = "key:" + principal.KeyID
+	}
+	if allowed, wait := limiter.Allow(service.RateLimitKey, client); !allowed {
+		respondRateLimited(c, wait, "too many requests")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// clientCertIdentity 返回已验证客户端证书对应的用户名：先按完整主题、再按 CN 查找 identities 映射
+// （viper 读取配置时会把键转为小写，因此不区分大小写），未映射时直接使用 CN
+func clientCertIdentity(cfg *config.Config, r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	for _, key := range []string{subject.String(), subject.CommonName} {
+		for name, username := range cfg.Server.TLS.Identities {
+			if strings.EqualFold(name, key) {
+				return username, username != ""
+			}
+		}
+	}
+	return subject.CommonName, subject.CommonName != ""
+}
+
+// RateLimit 按客户端 IP 对 scope 限流，超出时返回 429 及 Retry-After
+func RateLimit(limiter *service.RateLimitService, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if allowed, wait := limiter.Allow(scope, c.ClientIP()); !allowed {
+			respondRateLimited(c, wait, "too many requests")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Lockout 拒绝因认证失败过多而被锁定的 IP，用于登录和带密码的分享链接等自行校验凭据的接口
+func Lockout(limiter *service.RateLimitService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkLockout(c, limiter) {
+			c.Next()
+		}
+	}
+}
+
+// checkLockout 在当前 IP 被锁定时返回 429 并中止请求
+func checkLockout(c *gin.Context, limiter *service.RateLimitService) bool {
+	if wait := limiter.LockedOut(c.ClientIP()); wait > 0 {
+		respondRateLimited(c, wait, "too many failed attempts")
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// recordAuthFailure 记录当前 IP 的一次认证失败，达到上限后该 IP 将被锁定
+func recordAuthFailure(c *gin.Context, limiter *service.RateLimitService) {
+	limiter.RecordFailure(c.Request.Context(), c.ClientIP())
+}
+
+// respondRateLimited 返回 429，Retry-After 为向上取整的等待秒数
+func respondRateLimited(c *gin.Context, wait time.Duration, message string) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	response.Error(c, http.StatusTooManyRequests, response.CodeRateLimited, fmt.Sprintf("%s, retry after %ds", message, seconds))
+}
+
+// RequireRole 要求当前用户的角色不低于 role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !getPrincipal(c).AtLeast(role) {
+			response.Error(c, http.StatusForbidden, response.CodeForbidden, "permission denied")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope 要求 API 密钥具有 scope，其他认证方式不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !getPrincipal(c).HasScope(scope) {
+			response.Error(c, http.StatusForbidden, response.CodeForbidden, "api key lacks scope "+scope)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireMethodScope 对 GET/HEAD 请求要求 readScope，对其他请求要求 writeScope
+func RequireMethodScope(readScope, writeScope string) gin.HandlerFunc {
+	read, write := RequireScope(readScope), RequireScope(writeScope)
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			read(c)
+			return
+		}
+		write(c)
+	}
+}
+
+// RejectAPIKey 拒绝通过 API 密钥认证的请求，用于密钥管理等只允许用户本人操作的接口
+func RejectAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if getPrincipal(c).KeyID != "" {
+			response.Error(c, http.StatusForbidden, response.CodeForbidden, "not allowed with an api key")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Audit 在请求处理完成后写入一条 action 审计日志，记录操作者、来源 IP、目标路径和结果。
+// 目标路径默认取 path 查询参数，处理函数可通过 setAuditTarget、setAuditFile 指定；
+// 响应状态码不小于 400 时记为失败，并附上返回的错误消息
+func Audit(audit *service.AuditService, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.GetBool(auditSkipKey) {
+			return
+		}
+
+		entry := service.AuditEntry{
+			Action: action,
+			Actor:  getUser(c),
+			IP:     c.ClientIP(),
+			Path:   c.Query("path"),
+			Status: service.AuditSuccess,
+		}
+		if actor := c.GetString(auditActorKey); actor != "" {
+			entry.Actor = actor
+		}
+		if target, exists := c.Get(auditTargetKey); exists {
+			entry.Path = target.(string)
+		}
+		if entry.Path != "" {
+			// 客户端传入的路径可能省略开头的 /，统一后才能按前缀查询
+			entry.Path = "/" + strings.TrimPrefix(entry.Path, "/")
+		}
+		entry.FileID = c.GetString(auditFileKey)
+		entry.Message = c.GetString(auditMessageKey)
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			entry.Status = service.AuditFailed
+			if reason := c.GetString(response.ErrorMessageKey); reason != "" {
+				entry.Message = strings.TrimPrefix(entry.Message+": "+reason, ": ")
+			}
+		}
+		audit.Record(c.Request.Context(), entry)
+	}
+}
+
+// 处理函数向 Audit 传递审计信息所用的上下文键
+const (
+	auditActorKey   = "audit_actor"
+	auditTargetKey  = "audit_target"
+	auditFileKey    = "audit_file"
+	auditMessageKey = "audit_message"
+	auditSkipKey    = "audit_skip"
+)
+
+// setAuditActor 指定未认证请求（如登录）的操作者
+func setAuditActor(c *gin.Context, actor string) {
+	c.Set(auditActorKey, actor)
+}
+
+// setAuditTarget 指定审计日志中的目标路径
+func setAuditTarget(c *gin.Context, target string) {
+	c.Set(auditTargetKey, target)
+}
+
+// setAuditFile 指定操作的文件并立即解析其路径，删除文件前调用时也能记录原路径
+func setAuditFile(c *gin.Context, fileID string) {
+	c.Set(auditFileKey, fileID)
+	if filePath, err := file.Database.GetFilePath(fileID); err == nil {
+		setAuditTarget(c, filePath)
+	}
+}
+
+// skipAudit 不为本次请求写入审计日志，用于没有实际修改数据的协议步骤
+func skipAudit(c *gin.Context) {
+	c.Set(auditSkipKey, true)
+}
+
+// setAuditMessage 补充审计日志的说明，如移动的目标位置；失败时错误消息附加在其后
+func setAuditMessage(c *gin.Context, message string) {
+	c.Set(auditMessageKey, message)
+}
+
+func setPrincipal(c *gin.Context, principal service.Principal) {
+	c.Set("user", principal.Name)
+	c.Set("principal", principal)
+}
+
 func getUser(c *gin.Context) string {
 	if user, exists := c.Get("user"); exists {
 		return user.(string)
 	}
 	return "unknown"
 }
+
+func getPrincipal(c *gin.Context) service.Principal {
+	if principal, exists := c.Get("principal"); exists {
+		return principal.(service.Principal)
+	}
+	return service.Principal{Name: getUser(c)}
+}
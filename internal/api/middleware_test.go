@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+func withLockout(maxFailures int) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.Lockout = config.LockoutConfig{MaxFailures: maxFailures, WindowMinutes: 15, DurationMinutes: 15}
+	}
+}
+
+func TestLockoutIgnoresSpoofedForwardedFor(t *testing.T) {
+	s := newTestServer(t, withLockout(3))
+
+	request := func(forwardedFor string) testResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return s.serve(req, "not-a-valid-token")
+	}
+
+	// 每次伪造不同的来源 IP，失败仍计在连接的对端地址上
+	for i := 0; i < 3; i++ {
+		if resp := request(fmt.Sprintf("198.51.100.%d", i)); resp.Status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	if resp := request("198.51.100.99"); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("spoofed header bypassed lockout: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestLockoutTrustsConfiguredProxy(t *testing.T) {
+	s := newTestServer(t, withLockout(2), func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	})
+
+	request := func(forwardedFor string) testResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+		req.RemoteAddr = "10.0.0.2:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return s.serve(req, "not-a-valid-token")
+	}
+
+	request("198.51.100.1")
+	request("198.51.100.1")
+	if resp := request("198.51.100.1"); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("client behind proxy not locked out: %d %s", resp.Status, resp.Body)
+	}
+	// 代理后面的其他客户端不受影响
+	if resp := request("198.51.100.2"); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("other client behind proxy: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestTokenOfDeletedUserCountsAsFailure(t *testing.T) {
+	s := newTestServer(t, withLockout(2))
+	bob := s.user("bob", "editor")
+	s.must(http.MethodDelete, "/api/v1/admin/users/bob", "", nil)
+
+	for i := 0; i < 2; i++ {
+		if resp := s.do(http.MethodGet, "/api/v1/files", bob, nil); resp.Status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	if resp := s.do(http.MethodGet, "/api/v1/files", "", nil); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("not locked out after failures: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func withRateLimit(configure func(*config.RateLimitConfig)) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		configure(&cfg.RateLimit)
+	}
+}
+
+func TestRateLimitRefillsTokens(t *testing.T) {
+	s := newTestServer(t, withRateLimit(func(rl *config.RateLimitConfig) {
+		rl.Groups = map[string]config.RateLimitRule{"folders": {PerMinute: 600, Burst: 2}}
+	}))
+
+	request := func(remoteAddr string) testResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/folders", nil)
+		req.RemoteAddr = remoteAddr
+		return s.serve(req, "")
+	}
+
+	// 桶满时可连续发出 burst 个请求
+	for i := 0; i < 2; i++ {
+		if resp := request("203.0.113.7:40000"); resp.Status != http.StatusOK {
+			t.Fatalf("request %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	resp := request("203.0.113.7:40000")
+	if resp.Status != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Fatalf("over burst: %d %s, Retry-After %q", resp.Status, resp.Body, resp.Header.Get("Retry-After"))
+	}
+	// 其他 IP 使用各自的令牌桶
+	if resp := request("203.0.113.8:40000"); resp.Status != http.StatusOK {
+		t.Fatalf("other client: %d %s", resp.Status, resp.Body)
+	}
+
+	// 每分钟 600 个即每 100ms 补充一个令牌
+	time.Sleep(150 * time.Millisecond)
+	if resp := request("203.0.113.7:40000"); resp.Status != http.StatusOK {
+		t.Fatalf("after refill: %d %s", resp.Status, resp.Body)
+	}
+	if resp := request("203.0.113.7:40000"); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("refill added more than one token: %d %s", resp.Status, resp.Body)
+	}
+
+	var stats struct {
+		Throttled map[string]int64 `json:"throttled"`
+	}
+	s.must(http.MethodGet, "/api/v1/admin/rate-limits", "", nil).decode(t, &stats)
+	if stats.Throttled["folders"] != 2 {
+		t.Fatalf("throttled = %v", stats.Throttled)
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	s := newTestServer(t, withRateLimit(func(rl *config.RateLimitConfig) {
+		rl.Key = config.RateLimitRule{PerMinute: 1, Burst: 3}
+	}))
+	alice := s.user("alice", "viewer")
+	bob := s.user("bob", "viewer")
+
+	for i := 0; i < 3; i++ {
+		if resp := s.do(http.MethodGet, "/api/v1/folders", alice, nil); resp.Status != http.StatusOK {
+			t.Fatalf("request %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	resp := s.do(http.MethodGet, "/api/v1/folders", alice, nil)
+	if resp.Status != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Fatalf("over burst: %d %s, Retry-After %q", resp.Status, resp.Body, resp.Header.Get("Retry-After"))
+	}
+	// 同一 IP 上的其他用户不受影响
+	if resp := s.do(http.MethodGet, "/api/v1/folders", bob, nil); resp.Status != http.StatusOK {
+		t.Fatalf("other user: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestLockoutRejectsValidCredentials(t *testing.T) {
+	s := newTestServer(t, withLockout(3))
+	s.user("alice", "viewer")
+
+	login := func(password, remoteAddr string) testResponse {
+		body := fmt.Sprintf(`{"username":"alice","password":%q}`, password)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		return s.serve(req, "-")
+	}
+
+	for i := 0; i < 3; i++ {
+		if resp := login("wrong-password", "203.0.113.7:40000"); resp.Status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	// 锁定期间正确的密码也被拒绝，Retry-After 为锁定的剩余时间
+	resp := login("pw12345678", "203.0.113.7:40000")
+	if resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("locked login: %d %s", resp.Status, resp.Body)
+	}
+	if retry, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retry < 14*60 || retry > 15*60 {
+		t.Fatalf("Retry-After = %q", resp.Header.Get("Retry-After"))
+	}
+	if resp := login("pw12345678", "203.0.113.8:40000"); resp.Status != http.StatusOK {
+		t.Fatalf("other client: %d %s", resp.Status, resp.Body)
+	}
+
+	var stats struct {
+		AuthFailures int64 `json:"auth_failures"`
+		Lockouts     int64 `json:"lockouts"`
+		Locked       []struct {
+			Client string `json:"client"`
+		} `json:"locked"`
+	}
+	s.must(http.MethodGet, "/api/v1/admin/rate-limits", "", nil).decode(t, &stats)
+	if stats.AuthFailures != 3 || stats.Lockouts != 1 || len(stats.Locked) != 1 || stats.Locked[0].Client != "203.0.113.7" {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+// testCA 为测试用的客户端证书 CA
+type testCA struct {
+	t    *testing.T
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{t: t, cert: cert, key: key, pool: pool}
+}
+
+// issue 签发主题为 subject 的客户端证书
+func (ca *testCA) issue(subject pkix.Name) tls.Certificate {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS 以 TLS 启动测试路由，客户端证书由 ca 验证但不强制出示
+func (s *testServer) serveTLS(ca *testCA) *httptest.Server {
+	s.t.Helper()
+	server := httptest.NewUnstartedServer(s.router)
+	server.TLS = &tls.Config{ClientCAs: ca.pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	s.t.Cleanup(server.Close)
+	return server
+}
+
+// getWithCert 以客户端证书 cert（为 nil 时不出示证书）请求 target，header 为附加的请求头
+func getWithCert(t *testing.T, server *httptest.Server, cert *tls.Certificate, target string, header map[string]string) int {
+	t.Helper()
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	defer transport.CloseIdleConnections()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestClientCertIdentity(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.TLS.Identities = map[string]string{
+			// viper 读取的键均为小写
+			"cn=backup,ou=ops,o=example": "bob",
+			"deploy-bot":                 "bob",
+			"retired-bot":                "",
+		}
+	})
+	s.mkdir("/alice")
+	s.mkdir("/bob")
+	s.user("alice", "viewer")
+	s.user("bob", "viewer")
+	s.grant("/alice", "alice", "read")
+	s.grant("/bob", "bob", "read")
+
+	ca := newTestCA(t)
+	server := s.serveTLS(ca)
+	aliceDir := "/api/v1/files/by-path?path=/alice"
+	bobDir := "/api/v1/files/by-path?path=/bob"
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		alice   int
+		bob     int
+	}{
+		{"common name", pkix.Name{CommonName: "alice"}, http.StatusOK, http.StatusForbidden},
+		{"full subject", pkix.Name{CommonName: "backup", OrganizationalUnit: []string{"Ops"}, Organization: []string{"Example"}}, http.StatusForbidden, http.StatusOK},
+		{"mapped common name", pkix.Name{CommonName: "Deploy-Bot", Organization: []string{"Other"}}, http.StatusForbidden, http.StatusOK},
+		// 完整主题不匹配时按 CN 查找，CN 未映射时直接作为用户名
+		{"unmapped subject", pkix.Name{CommonName: "alice", Organization: []string{"Example"}}, http.StatusOK, http.StatusForbidden},
+		{"mapped to nobody", pkix.Name{CommonName: "retired-bot"}, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"unknown user", pkix.Name{CommonName: "mallory"}, http.StatusUnauthorized, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		cert := ca.issue(tt.subject)
+		if status := getWithCert(t, server, &cert, aliceDir, nil); status != tt.alice {
+			t.Errorf("%s: /alice = %d, want %d", tt.name, status, tt.alice)
+		}
+		if status := getWithCert(t, server, &cert, bobDir, nil); status != tt.bob {
+			t.Errorf("%s: /bob = %d, want %d", tt.name, status, tt.bob)
+		}
+	}
+
+	// 没有证书时需要其他凭据；显式凭据优先于证书
+	if status := getWithCert(t, server, nil, aliceDir, nil); status != http.StatusUnauthorized {
+		t.Errorf("no certificate: %d", status)
+	}
+	cert := ca.issue(pkix.Name{CommonName: "alice"})
+	if status := getWithCert(t, server, &cert, bobDir, map[string]string{"X-Local-Key": testLocalKey}); status != http.StatusOK {
+		t.Errorf("local key with certificate: %d", status)
+	}
+	if status := getWithCert(t, server, &cert, aliceDir, map[string]string{"Authorization": "Bearer invalid"}); status != http.StatusUnauthorized {
+		t.Errorf("invalid token with certificate: %d", status)
+	}
+}
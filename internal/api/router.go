@@ -5,74 +5,203 @@ import (
 	"github.com/kiry163/claw-pliers/internal/config"
 	"github.com/kiry163/claw-pliers/internal/database"
 	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
 	"github.com/kiry163/claw-pliers/internal/service"
 )
 
 func NewRouter(cfg *config.Config, db *database.DB, version string) *gin.Engine {
 	router := gin.New()
+	// 客户端 IP 用于限流和登录锁定，只有来自受信任代理的请求才采用 X-Forwarded-For，否则客户端可以伪造
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Get().Error().Err(err).Msg("invalid server.trusted_proxies, trusting no proxies")
+		router.SetTrustedProxies(nil)
+	}
 	router.Use(gin.Recovery())
 	router.Use(RequestLogger())
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok", "version": version})
-	})
+	healthHandler := NewHealthHandler(db, file.FileStorage, version)
+	router.GET("/health", healthHandler.Health)
 
 	// Initialize services
-	fileService := service.NewFileService(db, file.FileStorage)
+	userService := service.NewUserService(db)
+	accessService := service.NewAccessService(db)
+	apiKeyService := service.NewAPIKeyService(db, accessService)
+	authService := service.NewAuthService(cfg.Auth, db, userService)
+	quotaService := service.NewQuotaService(cfg.Quota, db)
+	auditService := service.NewAuditService(db)
+	fileService := service.NewFileService(db, file.FileStorage, quotaService)
+	shareService := service.NewShareService(cfg.Share, db, file.FileStorage, fileService, auditService)
 	folderService := service.NewFolderService(db)
-	mailService := service.NewMailService()
+	versionService := service.NewVersionService(cfg.Version, db, file.FileStorage, quotaService)
+	mailService := service.NewMailService(db, fileService, versionService)
+	uploadService := service.NewUploadService(cfg.Upload, db, file.FileStorage, fileService, versionService)
+	fsckService := service.NewFsckService(db, file.FileStorage)
+	trashService := service.NewTrashService(db, fileService, folderService)
+	treeService := service.NewTreeService(db, file.FileStorage, quotaService)
+	limiter := service.NewRateLimitService(cfg.RateLimit, auditService)
+	encryptionService := service.NewEncryptionService(db, file.FileStorage)
 
 	// Initialize handlers with dependencies
-	fileHandler := NewFileHandler(cfg, fileService)
-	folderHandler := NewFolderHandler(cfg, folderService)
-	mailHandler := NewMailHandler(cfg, mailService)
+	authHandler := NewAuthHandler(cfg, authService, limiter)
+	userHandler := NewUserHandler(cfg, userService)
+	apiKeyHandler := NewAPIKeyHandler(cfg, apiKeyService)
+	fileHandler := NewFileHandler(cfg, fileService, versionService, shareService, accessService)
+	shareHandler := NewShareHandler(cfg, shareService, accessService, limiter)
+	versionHandler := NewVersionHandler(cfg, versionService, accessService)
+	folderHandler := NewFolderHandler(cfg, folderService, accessService)
+	mailHandler := NewMailHandler(cfg, mailService, accessService)
+	uploadHandler := NewUploadHandler(cfg, uploadService, accessService)
+	adminHandler := NewAdminHandler(cfg, fsckService, limiter, encryptionService)
+	trashHandler := NewTrashHandler(cfg, trashService, accessService)
+	treeHandler := NewTreeHandler(cfg, treeService, accessService)
+	usageHandler := NewUsageHandler(cfg, quotaService, accessService)
+	auditHandler := NewAuditHandler(cfg, auditService)
 
+	requireAuth := AuthMiddleware(cfg, authService, accessService, apiKeyService, limiter)
+	// 每个 IP 的全部请求先经过 ip 限流，再按所在路由组（与 rate_limit.groups 中的名称对应）限流
+	limit := func(group string) gin.HandlerFunc { return RateLimit(limiter, group) }
+	// API 密钥按路由组检查 scope：文件类接口读请求需要 file:read，写请求需要 file:write
+	fileScope := RequireMethodScope(service.ScopeFileRead, service.ScopeFileWrite)
+	// 所有修改数据的操作都按路由写入审计日志
+	audit := func(action string) gin.HandlerFunc { return Audit(auditService, action) }
 	api := router.Group("/api/v1")
+	api.Use(limit(service.RateLimitIP))
+
+	// 登录与令牌刷新（无需认证）
+	auth := api.Group("/auth")
+	auth.Use(limit(service.RateGroupAuth), Lockout(limiter))
+	auth.POST("/login", audit(service.AuditAuthLogin), authHandler.Login)
+	auth.POST("/refresh", audit(service.AuditAuthRefresh), authHandler.Refresh)
+	auth.POST("/logout", audit(service.AuditAuthLogout), authHandler.Logout)
 
 	// 文件操作 (原有)
 	files := api.Group("/files")
-	files.Use(AuthMiddleware(cfg))
-	files.POST("", fileHandler.UploadFile)
+	files.Use(limit("files"), requireAuth, fileScope)
+	files.POST("", audit(service.AuditFileUpload), fileHandler.UploadFile)
 	files.GET("", fileHandler.ListFiles)
 	files.GET("/:id", fileHandler.GetFile)
 	files.GET("/:id/download", fileHandler.DownloadFile)
-	files.DELETE("/:id", fileHandler.DeleteFile)
+	files.HEAD("/:id/download", fileHandler.DownloadFile)
+	files.DELETE("/:id", audit(service.AuditFileDelete), fileHandler.DeleteFile)
+	files.GET("/:id/versions", versionHandler.ListVersions)
+	files.GET("/:id/versions/:version/download", versionHandler.DownloadVersion)
+	files.HEAD("/:id/versions/:version/download", versionHandler.DownloadVersion)
+	files.POST("/:id/versions/:version/promote", audit(service.AuditVersionPromote), versionHandler.PromoteVersion)
 
 	// 文件操作 (按路径)
 	filesByPath := api.Group("/files/by-path")
-	filesByPath.Use(AuthMiddleware(cfg))
-	filesByPath.POST("", fileHandler.UploadFileByPath)
+	filesByPath.Use(limit("files"), requireAuth, fileScope)
+	filesByPath.POST("", audit(service.AuditFileUpload), fileHandler.UploadFileByPath)
 	filesByPath.GET("", fileHandler.ListFilesByPath)
 	filesByPath.GET("/info", fileHandler.GetFileInfoByPath)
-	filesByPath.GET("/share", fileHandler.GenerateShareLinkByPath)
+	filesByPath.GET("/share", RequireScope(service.ScopeFileWrite), audit(service.AuditShareCreate), shareHandler.GenerateShareLinkByPath)
 	filesByPath.GET("/download", fileHandler.DownloadFileByPath)
-	filesByPath.DELETE("", fileHandler.DeleteFileByPath)
-	filesByPath.PUT("", fileHandler.MoveFileByPath)
+	filesByPath.HEAD("/download", fileHandler.DownloadFileByPath)
+	filesByPath.DELETE("", audit(service.AuditFileDelete), fileHandler.DeleteFileByPath)
+	filesByPath.PUT("", audit(service.AuditFileMove), treeHandler.MoveFile)
+	filesByPath.POST("/copy", audit(service.AuditFileCopy), treeHandler.CopyFile)
+
+	// 分片上传（可断点续传）
+	uploads := api.Group("/uploads")
+	uploads.Use(limit("uploads"), requireAuth, fileScope)
+	uploads.POST("", audit(service.AuditUploadStart), uploadHandler.CreateSession)
+	uploads.GET("/:id", uploadHandler.GetSession)
+	uploads.PUT("/:id/chunks/:index", uploadHandler.UploadChunk)
+	uploads.POST("/:id/complete", audit(service.AuditUploadComplete), uploadHandler.CompleteSession)
+	uploads.DELETE("/:id", audit(service.AuditUploadAbort), uploadHandler.AbortSession)
+
+	// 分享链接管理
+	shares := api.Group("/shares")
+	shares.Use(limit("shares"), requireAuth, fileScope)
+	shares.POST("", audit(service.AuditShareCreate), shareHandler.CreateShare)
+	shares.GET("", shareHandler.ListShares)
+	shares.GET("/:token", shareHandler.GetShare)
+	shares.DELETE("/:token", audit(service.AuditShareRevoke), shareHandler.RevokeShare)
 
 	// 公开下载链接（无需认证）
-	router.GET("/s/:token", fileHandler.DownloadByShareToken)
+	public := router.Group("/s")
+	public.Use(limit(service.RateLimitIP), limit(service.RateGroupShare), Lockout(limiter))
+	public.GET("/:token", shareHandler.Download)
+	public.HEAD("/:token", shareHandler.Download)
+	public.POST("/:token", shareHandler.Upload)
+	public.GET("/:token/download", shareHandler.DownloadEntry)
+	public.HEAD("/:token/download", shareHandler.DownloadEntry)
+	public.GET("/:token/zip", shareHandler.DownloadZip)
 
 	// 文件夹操作
 	folders := api.Group("/folders")
-	folders.Use(AuthMiddleware(cfg))
-	folders.POST("", folderHandler.CreateFolder)
+	folders.Use(limit("folders"), requireAuth, fileScope)
+	folders.POST("", audit(service.AuditFolderCreate), folderHandler.CreateFolder)
 	folders.GET("", folderHandler.ListFolders)
 	folders.GET("/by-path", folderHandler.GetFolderByPath)
 
 	// 文件夹操作 (按路径)
 	foldersByPath := api.Group("/folders/by-path")
-	foldersByPath.Use(AuthMiddleware(cfg))
-	foldersByPath.POST("", folderHandler.CreateFolderByPath)
-	foldersByPath.PUT("", folderHandler.RenameFolderByPath)
-	foldersByPath.DELETE("", folderHandler.DeleteFolderByPath)
+	foldersByPath.Use(limit("folders"), requireAuth, fileScope)
+	foldersByPath.POST("", audit(service.AuditFolderCreate), folderHandler.CreateFolderByPath)
+	foldersByPath.PUT("", audit(service.AuditFolderMove), treeHandler.MoveFolder)
+	foldersByPath.POST("/copy", audit(service.AuditFolderCopy), treeHandler.CopyFolder)
+	foldersByPath.DELETE("", audit(service.AuditFolderDelete), folderHandler.DeleteFolderByPath)
+	foldersByPath.GET("/usage", usageHandler.FolderUsage)
+
+	// 用量与配额
+	usage := api.Group("/usage")
+	usage.Use(limit("usage"), requireAuth, fileScope)
+	usage.GET("", usageHandler.GetUsage)
+
+	// 回收站
+	trash := api.Group("/trash")
+	trash.Use(limit("trash"), requireAuth, fileScope)
+	trash.GET("", trashHandler.ListTrash)
+	trash.DELETE("", RequireRole(service.RoleAdmin), RequireScope(service.ScopeAdmin), audit(service.AuditTrashEmpty), trashHandler.EmptyTrash)
+	trash.POST("/:id/restore", audit(service.AuditTrashRestore), trashHandler.RestoreItem)
+	trash.DELETE("/:id", audit(service.AuditTrashPurge), trashHandler.PurgeItem)
 
-	// 邮件操作
+	// 管理操作（仅管理员）
+	admin := api.Group("/admin")
+	admin.Use(limit("admin"), requireAuth, RequireRole(service.RoleAdmin), RequireScope(service.ScopeAdmin))
+	admin.POST("/fsck", audit(service.AuditAdminFsck), adminHandler.RunFsck)
+	admin.GET("/rate-limits", adminHandler.RateLimitStats)
+	admin.GET("/encryption", adminHandler.EncryptionStatus)
+	admin.POST("/encryption/rotate", audit(service.AuditAdminRotateKey), adminHandler.RotateKeys)
+	admin.GET("/users", userHandler.ListUsers)
+	admin.POST("/users", audit(service.AuditUserCreate), userHandler.CreateUser)
+	admin.PUT("/users/:username", audit(service.AuditUserUpdate), userHandler.UpdateUser)
+	admin.DELETE("/users/:username", audit(service.AuditUserDelete), userHandler.DeleteUser)
+	admin.GET("/grants", userHandler.ListGrants)
+	admin.PUT("/grants", audit(service.AuditGrantSet), userHandler.SetGrant)
+	admin.DELETE("/grants", audit(service.AuditGrantDelete), userHandler.DeleteGrant)
+
+	// 审计日志（仅管理员）
+	auditLogs := api.Group("/audit")
+	auditLogs.Use(limit("audit"), requireAuth, RequireRole(service.RoleAdmin), RequireScope(service.ScopeAdmin))
+	auditLogs.GET("", auditHandler.ListAudit)
+	auditLogs.GET("/export", auditHandler.ExportAudit)
+
+	// API 密钥管理：用户管理自己的密钥，管理员可查看和吊销全部密钥；不能用 API 密钥操作
+	keys := api.Group("/keys")
+	keys.Use(limit("keys"), requireAuth, RejectAPIKey())
+	keys.GET("", apiKeyHandler.ListKeys)
+	keys.POST("", audit(service.AuditKeyCreate), apiKeyHandler.CreateKey)
+	keys.DELETE("/:id", audit(service.AuditKeyRevoke), apiKeyHandler.RevokeKey)
+
+	// 邮件操作：所有角色可读取，发送需要 editor 及以上
 	mail := api.Group("/mail")
-	mail.Use(AuthMiddleware(cfg))
+	mail.Use(limit("mail"), requireAuth, RequireRole(service.RoleViewer), RequireMethodScope(service.ScopeMailRead, service.ScopeMailSend))
 	mail.GET("/test-connection", mailHandler.TestConnection)
-	mail.POST("/send", mailHandler.SendMail)
+	mail.POST("/send", RequireRole(service.RoleEditor), audit(service.AuditMailSend), mailHandler.SendMail)
 	mail.GET("/latest", mailHandler.GetLatestEmails)
-	mail.GET("/accounts", mailHandler.ListAccounts)
+	mail.GET("/accounts", RequireRole(service.RoleAdmin), mailHandler.ListAccounts)
+	mail.GET("/monitor", mailHandler.MonitorStatus)
+	mail.GET("/events", mailHandler.ListEvents)
+	mail.GET("/messages/:uid", mailHandler.GetMessage)
+	mail.GET("/messages/:uid/attachments/:index", mailHandler.DownloadAttachment)
+	mail.POST("/monitor/start", RequireRole(service.RoleAdmin), audit(service.AuditMailMonitorStart), mailHandler.StartMonitor)
+	mail.POST("/monitor/stop", RequireRole(service.RoleAdmin), audit(service.AuditMailMonitorStop), mailHandler.StopMonitor)
+
+	// 保存邮件附件到文件模块：读取邮件并写入文件，需要 mail:read 和 file:write，而不是发送邮件的 mail:send
+	api.POST("/mail/messages/:uid/attachments/:index/save", limit("mail"), requireAuth, RequireRole(service.RoleEditor),
+		RequireScope(service.ScopeMailRead), RequireScope(service.ScopeFileWrite), audit(service.AuditMailAttachment), mailHandler.SaveAttachment)
 
 	return router
 }
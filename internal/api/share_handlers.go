@@ -0,0 +1,589 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+// sharePasswordHeader 为访问带密码的分享链接时携带密码的请求头，也可使用 password 查询参数
+const sharePasswordHeader = "X-Share-Password"
+
+type ShareHandler struct {
+	Config  *config.Config
+	Service *service.ShareService
+	Access  *service.AccessService
+	Limiter *service.RateLimitService
+}
+
+func NewShareHandler(cfg *config.Config, svc *service.ShareService, access *service.AccessService, limiter *service.RateLimitService) *ShareHandler {
+	return &ShareHandler{Config: cfg, Service: svc, Access: access, Limiter: limiter}
+}
+
+// CreateShare 为文件或文件夹创建分享链接，可指定有效期、密码、下载次数上限和浏览器打开方式；
+// type 为 upload 时为文件夹创建只能上传的收集链接，可限制单个文件的大小和类型
+func (h *ShareHandler) CreateShare(c *gin.Context) {
+	var req struct {
+		Path         string   `json:"path" binding:"required"`
+		Type         string   `json:"type"`
+		TTL          string   `json:"ttl"`
+		Password     string   `json:"password"`
+		MaxDownloads int      `json:"max_downloads"`
+		Disposition  string   `json:"disposition"`
+		MaxSizeMB    int64    `json:"max_size_mb"`
+		AllowedTypes []string `json:"allowed_types"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "path is required")
+		return
+	}
+
+	ttl, err := parseShareTTL(req.TTL)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid ttl")
+		return
+	}
+
+	if req.Type != "" && req.Type != service.ShareTypeUpload {
+		response.Error(c, http.StatusBadRequest, 10004, "type must be upload or omitted")
+		return
+	}
+
+	h.create(c, req.Path, service.ShareOptions{
+		TTL:          ttl,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		Disposition:  req.Disposition,
+		Upload:       req.Type == service.ShareTypeUpload,
+		MaxSize:      req.MaxSizeMB * 1024 * 1024,
+		AllowedTypes: req.AllowedTypes,
+	})
+}
+
+// GenerateShareLinkByPath 以查询参数创建分享链接，保留给旧版客户端；新客户端使用 POST /api/v1/shares
+func (h *ShareHandler) GenerateShareLinkByPath(c *gin.Context) {
+	ttl, err := parseShareTTL(c.Query("ttl"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid ttl")
+		return
+	}
+	maxDownloads, err := strconv.Atoi(c.DefaultQuery("max_downloads", "0"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid max_downloads")
+		return
+	}
+
+	h.create(c, c.Query("path"), service.ShareOptions{
+		TTL:          ttl,
+		MaxDownloads: maxDownloads,
+		Disposition:  c.Query("disposition"),
+	})
+}
+
+func (h *ShareHandler) create(c *gin.Context, path string, opts service.ShareOptions) {
+	setAuditTarget(c, path)
+	if path == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "path is required")
+		return
+	}
+
+	target, ok := h.resolveTarget(c, path)
+	if !ok {
+		return
+	}
+	// 文件夹链接公开整个子树，创建者需要能读取其中的每个子文件夹；收集链接只需对目标文件夹有写权限
+	if opts.Upload && target.FolderID != "" {
+		if !authorize(c, h.Access, &target.FolderID, service.PermWrite) {
+			return
+		}
+	} else if target.FolderID != "" {
+		if !authorize(c, h.Access, &target.FolderID, service.PermWrite) ||
+			!authorizeTree(c, h.Access, target.FolderID, service.PermRead) {
+			return
+		}
+	} else if !authorizeFile(c, h.Access, target.FileID, service.PermWrite) {
+		return
+	}
+
+	link, err := h.Service.Create(c.Request.Context(), target, getUser(c), opts)
+	if err != nil {
+		h.respondError(c, err, "failed to create share link")
+		return
+	}
+	setAuditMessage(c, link.Type+" link "+shortToken(link.Token))
+
+	response.Success(c, h.shareResponse(link))
+}
+
+// ListShares 返回 path 指定文件或文件夹的全部链接；未指定 path 时返回当前用户创建的链接，管理员返回全部链接
+func (h *ShareHandler) ListShares(c *gin.Context) {
+	var target service.ShareTarget
+	var createdBy *string
+	if path := c.Query("path"); path != "" {
+		var ok bool
+		if target, ok = h.resolveTarget(c, path); !ok {
+			return
+		}
+		if !h.authorizeTarget(c, target, service.PermRead) {
+			return
+		}
+	} else if principal := getPrincipal(c); !principal.IsAdmin() {
+		createdBy = &principal.Name
+	}
+
+	links, err := h.Service.List(c.Request.Context(), target, createdBy)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list share links")
+		return
+	}
+
+	items := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		items = append(items, h.shareResponse(link))
+	}
+
+	response.Success(c, gin.H{
+		"total":  len(items),
+		"shares": items,
+	})
+}
+
+func (h *ShareHandler) GetShare(c *gin.Context) {
+	link, ok := h.managedLink(c, service.PermRead)
+	if !ok {
+		return
+	}
+
+	response.Success(c, h.shareResponse(link))
+}
+
+func (h *ShareHandler) RevokeShare(c *gin.Context) {
+	setAuditMessage(c, "link "+shortToken(c.Param("token")))
+	link, ok := h.managedLink(c, service.PermWrite)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, link.Path)
+
+	if err := h.Service.Revoke(c.Request.Context(), link.Token); err != nil {
+		h.respondError(c, err, "failed to revoke share link")
+		return
+	}
+
+	response.Message(c, "share_revoked")
+}
+
+// Download 打开分享链接（无需认证）：文件链接直接下载，HEAD 请求和续传的 Range 请求不计入下载次数；
+// 文件夹链接返回 path 参数指定目录（默认为分享的文件夹）的内容列表，浏览不计入下载次数；
+// 收集链接只返回上传限制，不暴露目标文件夹的内容
+func (h *ShareHandler) Download(c *gin.Context) {
+	link, ok := h.open(c)
+	if !ok {
+		return
+	}
+
+	switch link.Type {
+	case service.ShareTypeFolder:
+		h.browse(c, link)
+		return
+	case service.ShareTypeUpload:
+		response.Success(c, gin.H{
+			"type":          link.Type,
+			"upload_url":    shareURL(h.Config, link.Token),
+			"expires_at":    link.ExpiresAt,
+			"max_size":      h.uploadLimit(link),
+			"allowed_types": nonNil(link.AllowedTypes),
+		})
+		return
+	}
+
+	if countsAsDownload(c.Request) {
+		var err error
+		if link, err = h.Service.Count(c.Request.Context(), link); err != nil {
+			h.respondError(c, err, "failed to open share link")
+			return
+		}
+	}
+
+	record, err := file.Database.GetFile(link.FileID)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "file not found")
+		return
+	}
+	h.serveFile(c, link, record)
+}
+
+// Upload 通过收集链接上传文件（无需认证），文件放在 multipart 表单的 file 字段中
+func (h *ShareHandler) Upload(c *gin.Context) {
+	link, ok := h.open(c)
+	if !ok {
+		return
+	}
+	if link.Type != service.ShareTypeUpload {
+		h.respondError(c, service.ErrNotUploadShare, "failed to upload file")
+		return
+	}
+
+	// 在解析表单前限制请求体大小，超大请求不会先落盘再被拒绝
+	maxBytes := h.uploadLimit(link)
+	if maxBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1024*1024)
+	}
+
+	uploadedFile, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.respondError(c, service.ErrShareFileTooLarge, "failed to upload file")
+			return
+		}
+		response.Error(c, http.StatusBadRequest, 10004, "file required")
+		return
+	}
+
+	src, err := uploadedFile.Open()
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to open file")
+		return
+	}
+	defer src.Close()
+
+	// 由服务按合并后的上限检查大小，超限的上传同样写入审计日志
+	link.MaxSize = maxBytes
+	metadata, err := h.Service.Receive(c.Request.Context(), link, service.ShareUpload{
+		Name:   uploadedFile.Filename,
+		Size:   uploadedFile.Size,
+		Reader: src,
+		IP:     c.ClientIP(),
+	})
+	if err != nil {
+		h.respondError(c, err, "failed to save file")
+		return
+	}
+
+	// 上传者对目标文件夹没有读权限，只返回其上传的文件的基本信息
+	response.Success(c, gin.H{
+		"name":      metadata.OriginalName,
+		"size":      metadata.Size,
+		"mime_type": metadata.MimeType,
+		"sha256":    metadata.SHA256,
+	})
+}
+
+// uploadLimit 返回收集链接的单个文件大小上限，取链接设置与全局 upload.max_size_mb 中较小者，0 表示不限制
+func (h *ShareHandler) uploadLimit(link service.ShareInfo) int64 {
+	limit := h.Config.Upload.MaxSizeMB * 1024 * 1024
+	if link.MaxSize > 0 && (limit == 0 || link.MaxSize < limit) {
+		limit = link.MaxSize
+	}
+	return limit
+}
+
+// DownloadEntry 下载文件夹链接中 path 参数指定的文件，计数规则与文件链接相同
+func (h *ShareHandler) DownloadEntry(c *gin.Context) {
+	link, ok := h.open(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.Service.FileAt(c.Request.Context(), link, c.Query("path"))
+	if err != nil {
+		h.respondError(c, err, "failed to get file")
+		return
+	}
+
+	if countsAsDownload(c.Request) {
+		if link, err = h.Service.Count(c.Request.Context(), link); err != nil {
+			h.respondError(c, err, "failed to open share link")
+			return
+		}
+	}
+	h.serveFile(c, link, record)
+}
+
+// DownloadZip 将文件夹链接中 path 参数指定的目录打包为 zip 流式下载，整个压缩包计入一次下载
+func (h *ShareHandler) DownloadZip(c *gin.Context) {
+	link, ok := h.open(c)
+	if !ok {
+		return
+	}
+
+	rel := c.Query("path")
+	name, err := h.Service.FolderName(c.Request.Context(), link, rel)
+	if err != nil {
+		h.respondError(c, err, "failed to get folder")
+		return
+	}
+	if _, err := h.Service.Count(c.Request.Context(), link); err != nil {
+		h.respondError(c, err, "failed to open share link")
+		return
+	}
+
+	clearWriteDeadline(c)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Status(http.StatusOK)
+	if err := h.Service.WriteZip(c.Request.Context(), link, rel, c.Writer); err != nil {
+		// 响应已经开始写出，无法再返回错误；压缩包缺少目录区，客户端解压时会发现不完整
+		logger.Get().Error().Err(err).Str("token", link.Token).Msg("failed to write share zip")
+	}
+}
+
+// open 校验 :token 指定链接的状态和密码，密码来自请求头或 password 查询参数
+func (h *ShareHandler) open(c *gin.Context) (service.ShareInfo, bool) {
+	token := c.Param("token")
+	if token == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "token is required")
+		return service.ShareInfo{}, false
+	}
+
+	password := c.GetHeader(sharePasswordHeader)
+	if password == "" {
+		password = c.Query("password")
+	}
+
+	resume := c.Request.Method == http.MethodGet && !countsAsDownload(c.Request)
+	link, err := h.Service.Open(c.Request.Context(), token, password, resume)
+	if err != nil {
+		h.respondError(c, err, "failed to open share link")
+		return service.ShareInfo{}, false
+	}
+	return link, true
+}
+
+func (h *ShareHandler) browse(c *gin.Context, link service.ShareInfo) {
+	listing, err := h.Service.Browse(c.Request.Context(), link, c.Query("path"))
+	if err != nil {
+		h.respondError(c, err, "failed to list folder")
+		return
+	}
+
+	base := shareURL(h.Config, link.Token)
+	folders := make([]gin.H, 0, len(listing.Folders))
+	for _, f := range listing.Folders {
+		folders = append(folders, gin.H{
+			"name":       f.Name,
+			"path":       f.Path,
+			"updated_at": f.UpdatedAt,
+			"url":        base + "?path=" + url.QueryEscape(f.Path),
+		})
+	}
+	files := make([]gin.H, 0, len(listing.Files))
+	for _, f := range listing.Files {
+		files = append(files, gin.H{
+			"name":         f.Name,
+			"path":         f.Path,
+			"size":         f.Size,
+			"mime_type":    f.MimeType,
+			"updated_at":   f.UpdatedAt,
+			"download_url": base + "/download?path=" + url.QueryEscape(f.Path),
+		})
+	}
+
+	response.Success(c, gin.H{
+		"name":       listing.Name,
+		"path":       listing.Path,
+		"expires_at": link.ExpiresAt,
+		"folders":    folders,
+		"files":      files,
+		"zip_url":    base + "/zip?path=" + url.QueryEscape(listing.Path),
+	})
+}
+
+// countsAsDownload 判断请求是否计入一次下载：不带 Range 或 Range 从第 0 字节开始的 GET 请求。
+// 断点续传和播放器的后续分段请求不再重复计数
+func countsAsDownload(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	spec, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Range")), "bytes=")
+	if !ok {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(spec), "0-")
+}
+
+func (h *ShareHandler) serveFile(c *gin.Context, link service.ShareInfo, record database.File) {
+	serveDownload(c, file.FileStorage, downloadTarget{
+		ObjectKey:   record.ObjectKey,
+		Name:        record.OriginalName,
+		MimeType:    record.MimeType,
+		ModTime:     record.UpdatedAt,
+		ETag:        fileETag(record.FileID, record.UpdatedAt),
+		Disposition: link.Disposition,
+	})
+}
+
+// resolveTarget 按路径查找要分享的对象，先匹配文件再匹配文件夹
+func (h *ShareHandler) resolveTarget(c *gin.Context, path string) (service.ShareTarget, bool) {
+	if record, err := file.Database.GetFileByPath(path); err == nil {
+		return service.ShareTarget{FileID: record.FileID}, true
+	}
+	if folder, err := file.Database.GetFolderByPath(path); err == nil {
+		return service.ShareTarget{FolderID: folder.FolderID}, true
+	}
+	response.Error(c, http.StatusNotFound, 10002, "file or folder not found")
+	return service.ShareTarget{}, false
+}
+
+// authorizeTarget 检查对链接目标的权限：文件按所在文件夹判断，文件夹按其自身判断
+func (h *ShareHandler) authorizeTarget(c *gin.Context, target service.ShareTarget, perm service.Permission) bool {
+	if target.FolderID != "" {
+		return authorize(c, h.Access, &target.FolderID, perm)
+	}
+	return authorizeFile(c, h.Access, target.FileID, perm)
+}
+
+// managedLink 加载 :token 指定的链接，并检查当前用户能否管理它：
+// 链接的创建者、管理员，或对链接目标具有 perm 权限的用户
+func (h *ShareHandler) managedLink(c *gin.Context, perm service.Permission) (service.ShareInfo, bool) {
+	link, err := h.Service.Get(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		h.respondError(c, err, "failed to get share link")
+		return service.ShareInfo{}, false
+	}
+
+	principal := getPrincipal(c)
+	if link.CreatedBy == principal.Name && principal.KeyID == "" {
+		return link, true
+	}
+
+	// 目标已被删除时只有管理员可以管理
+	if link.FolderID != "" {
+		_, err = file.Database.GetFolder(link.FolderID)
+	} else {
+		_, err = file.Database.GetFile(link.FileID)
+	}
+	if err != nil {
+		if principal.IsAdmin() {
+			return link, true
+		}
+		response.Error(c, http.StatusForbidden, response.CodeForbidden, "permission denied")
+		return service.ShareInfo{}, false
+	}
+	if !h.authorizeTarget(c, service.ShareTarget{FileID: link.FileID, FolderID: link.FolderID}, perm) {
+		return service.ShareInfo{}, false
+	}
+	return link, true
+}
+
+func (h *ShareHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrShareNotFound), errors.Is(err, service.ErrSharePathNotFound):
+		response.Error(c, http.StatusNotFound, 10002, err.Error())
+	case errors.Is(err, service.ErrShareRevoked), errors.Is(err, service.ErrShareExpired), errors.Is(err, service.ErrShareExhausted):
+		response.Error(c, http.StatusGone, 10003, err.Error())
+	case errors.Is(err, service.ErrSharePasswordRequired):
+		response.Error(c, http.StatusUnauthorized, 10001, err.Error())
+	case errors.Is(err, service.ErrSharePasswordInvalid):
+		// 猜错密码计为认证失败，防止暴力破解链接密码
+		recordAuthFailure(c, h.Limiter)
+		response.Error(c, http.StatusUnauthorized, 10001, err.Error())
+	case errors.Is(err, service.ErrInvalidShareTTL), errors.Is(err, service.ErrInvalidShareOptions),
+		errors.Is(err, service.ErrNotFolderShare), errors.Is(err, service.ErrNotUploadShare),
+		errors.Is(err, service.ErrUploadShareTarget), errors.Is(err, service.ErrInvalidShareTypes),
+		errors.Is(err, service.ErrInvalidShareFileName):
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+	case errors.Is(err, service.ErrShareFileTooLarge):
+		response.Error(c, http.StatusRequestEntityTooLarge, 10004, err.Error())
+	case errors.Is(err, service.ErrShareTypeNotAllowed):
+		response.Error(c, http.StatusUnsupportedMediaType, 10004, err.Error())
+	default:
+		respondStorageError(c, err, message)
+	}
+}
+
+func (h *ShareHandler) shareResponse(link service.ShareInfo) gin.H {
+	data := gin.H{
+		"token":            link.Token,
+		"type":             link.Type,
+		"download_url":     shareURL(h.Config, link.Token),
+		"file_id":          link.FileID,
+		"folder_id":        link.FolderID,
+		"path":             link.Path,
+		"status":           link.Status,
+		"expires_at":       link.ExpiresAt,
+		"has_password":     link.HasPassword,
+		"max_downloads":    link.MaxDownloads,
+		"download_count":   link.DownloadCount,
+		"disposition":      link.Disposition,
+		"last_accessed_at": link.LastAccessedAt,
+		"created_by":       link.CreatedBy,
+		"created_at":       link.CreatedAt,
+	}
+	switch link.Type {
+	case service.ShareTypeFolder:
+		data["zip_url"] = shareURL(h.Config, link.Token) + "/zip"
+	case service.ShareTypeUpload:
+		data["max_size"] = link.MaxSize
+		data["allowed_types"] = nonNil(link.AllowedTypes)
+	}
+	return data
+}
+
+// parseShareTTL 解析有效期：空串使用默认值，never 或 0 表示永不过期，
+// 其余按 Go 时长格式解析，另支持以 d 结尾的天数
+func parseShareTTL(value string) (*time.Duration, error) {
+	var ttl time.Duration
+	switch {
+	case value == "":
+		return nil, nil
+	case value == "never" || value == "0":
+		return &ttl, nil
+	case strings.HasSuffix(value, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return nil, errors.New("invalid ttl")
+		}
+		ttl = time.Duration(days) * 24 * time.Hour
+	default:
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, errors.New("invalid ttl")
+		}
+		ttl = parsed
+	}
+	return &ttl, nil
+}
+
+// shareURL 返回分享链接的公开地址，未配置 public_endpoint 时使用本机地址
+func shareURL(cfg *config.Config, token string) string {
+	publicURL := cfg.Server.PublicEndpoint
+	if publicURL == "" {
+		scheme := "http"
+		if cfg.Server.TLS.Enabled {
+			scheme = "https"
+		}
+		publicURL = fmt.Sprintf("%s://localhost:%d", scheme, cfg.Server.Port)
+	}
+	return publicURL + "/s/" + token
+}
+
+// nonNil 使空列表序列化为 [] 而不是 null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// shortToken 返回令牌前缀，用于审计日志中标识链接而不记录完整令牌
+func shortToken(token string) string {
+	if len(token) > 8 {
+		return token[:8]
+	}
+	return token
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+)
+
+func TestShareRangeRequestsCountOnce(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	s.put("/docs/a.txt", "0123456789abcdefghij")
+	link := s.share("/docs/a.txt", gin.H{"max_downloads": 1})
+
+	get := func(rng string) testResponse {
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		return s.serve(req, "-")
+	}
+
+	// 从第 0 字节开始的请求计一次，后续分段不再计数
+	if resp := get("bytes=0-4"); resp.Status != http.StatusPartialContent || string(resp.Body) != "01234" {
+		t.Fatalf("first range: %d %s", resp.Status, resp.Body)
+	}
+	for _, rng := range []string{"bytes=5-9", "bytes=10-", "bytes=-5"} {
+		if resp := get(rng); resp.Status != http.StatusPartialContent {
+			t.Fatalf("range %s: %d %s", rng, resp.Status, resp.Body)
+		}
+	}
+
+	for _, rng := range []string{"", "bytes=0-"} {
+		if resp := get(rng); resp.Status != http.StatusGone {
+			t.Fatalf("new download %q after limit: %d %s", rng, resp.Status, resp.Body)
+		}
+	}
+
+	// 续传只在最近一次访问后的一段时间内有效
+	stale := time.Now().UTC().Add(-time.Hour)
+	file.Database.Model(&database.ShareLink{}).Where("token = ?", strings.TrimPrefix(link, "/s/")).Update("last_accessed_at", stale)
+	if resp := get("bytes=5-9"); resp.Status != http.StatusGone {
+		t.Fatalf("stale range after limit: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestShareRangeRequestsDoNotExhaustLink(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	s.put("/docs/a.txt", "0123456789abcdefghij")
+	link := s.share("/docs/a.txt", gin.H{"max_downloads": 1})
+
+	for _, rng := range []string{"bytes=10-", "bytes=15-19", "bytes=1-3"} {
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		req.Header.Set("Range", rng)
+		if resp := s.serve(req, "-"); resp.Status != http.StatusPartialContent {
+			t.Fatalf("range %s: %d %s", rng, resp.Status, resp.Body)
+		}
+	}
+	if resp := s.do(http.MethodGet, link, "-", nil); resp.Status != http.StatusOK || string(resp.Body) != "0123456789abcdefghij" {
+		t.Fatalf("full download: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestUploadLinkRefundsFailedUpload(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Quota.DefaultUser = config.QuotaLimit{MaxSizeMB: 1}
+	})
+	s.mkdir("/drop")
+	link := s.share("/drop", gin.H{"type": "upload", "max_downloads": 1})
+
+	send := func(name, content string) testResponse {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, link, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return s.serve(req, "-")
+	}
+
+	// 超出链接创建者的配额，保存失败不占用上传次数
+	if resp := send("big.txt", strings.Repeat("a", 2*1024*1024)); resp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over quota: %d %s", resp.Status, resp.Body)
+	}
+	if resp := send("small.txt", "hello"); resp.Status != http.StatusOK {
+		t.Fatalf("upload after failed attempt: %d %s", resp.Status, resp.Body)
+	}
+	if resp := send("again.txt", "hello"); resp.Status != http.StatusGone {
+		t.Fatalf("upload after limit: %d %s", resp.Status, resp.Body)
+	}
+}
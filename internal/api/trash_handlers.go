@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type TrashHandler struct {
+	Config  *config.Config
+	Service *service.TrashService
+	Access  *service.AccessService
+}
+
+func NewTrashHandler(cfg *config.Config, svc *service.TrashService, access *service.AccessService) *TrashHandler {
+	return &TrashHandler{Config: cfg, Service: svc, Access: access}
+}
+
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	items, err := h.Service.List(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list trash")
+		return
+	}
+
+	// 只列出当前用户可以恢复的项
+	principal := getPrincipal(c)
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		if h.requireItem(c.Request.Context(), principal, item) != nil {
+			continue
+		}
+		result = append(result, trashItemResponse(item))
+	}
+
+	response.Success(c, gin.H{
+		"total":          len(result),
+		"items":          result,
+		"retention_days": h.Config.Trash.RetentionDays,
+	})
+}
+
+func (h *TrashHandler) RestoreItem(c *gin.Context) {
+	onConflict := c.DefaultQuery("on_conflict", service.RestoreConflictFail)
+	switch onConflict {
+	case service.RestoreConflictFail, service.RestoreConflictRename, service.RestoreConflictOverwrite:
+	default:
+		response.Error(c, http.StatusBadRequest, 10004, "on_conflict must be fail, rename or overwrite")
+		return
+	}
+	if !h.authorizeItem(c) {
+		return
+	}
+
+	item, err := h.Service.Restore(c.Request.Context(), c.Param("id"), onConflict, getUser(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTrashItemNotFound):
+			response.Error(c, http.StatusNotFound, 10002, "trash item not found")
+		case errors.Is(err, service.ErrRestoreConflict):
+			response.Error(c, http.StatusConflict, 10010, err.Error())
+		default:
+			response.Error(c, http.StatusInternalServerError, 19999, "failed to restore item")
+		}
+		return
+	}
+
+	setAuditMessage(c, "restored to "+item.Path)
+	response.Success(c, trashItemResponse(item))
+}
+
+func (h *TrashHandler) PurgeItem(c *gin.Context) {
+	if !h.authorizeItem(c) {
+		return
+	}
+	if err := h.Service.Purge(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrTrashItemNotFound) {
+			response.Error(c, http.StatusNotFound, 10002, "trash item not found")
+			return
+		}
+		respondStorageError(c, err, "failed to purge item")
+		return
+	}
+
+	response.Message(c, "item_purged")
+}
+
+func (h *TrashHandler) EmptyTrash(c *gin.Context) {
+	purged, err := h.Service.Empty(c.Request.Context())
+	if err != nil {
+		respondStorageError(c, err, "failed to empty trash")
+		return
+	}
+	setAuditMessage(c, fmt.Sprintf("purged %d items", purged))
+
+	response.Success(c, gin.H{"purged": purged})
+}
+
+// authorizeItem 检查当前用户能否恢复或彻底删除回收站项；项不存在时放行，由调用方返回 404
+func (h *TrashHandler) authorizeItem(c *gin.Context) bool {
+	item, err := h.Service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return true
+	}
+	setAuditTarget(c, item.Path)
+	if err := h.requireItem(c.Request.Context(), getPrincipal(c), item); err != nil {
+		respondAccessError(c, err)
+		return false
+	}
+	return true
+}
+
+// requireItem 要求对原位置有写权限，并且对项本身有写权限：文件按删除前所在的文件夹，
+// 文件夹按其整棵子树判断，以免原位置上的授权绕过项本身的 none 授权
+func (h *TrashHandler) requireItem(ctx context.Context, p service.Principal, item service.TrashItem) error {
+	if err := h.Access.Require(ctx, p, nearestFolder(path.Dir(item.Path)), service.PermWrite); err != nil {
+		return err
+	}
+	if item.Type == service.TrashItemFolder {
+		return h.Access.RequireTree(ctx, p, *item.FolderID, service.PermWrite)
+	}
+	return h.Access.Require(ctx, p, item.FolderID, service.PermWrite)
+}
+
+func trashItemResponse(item service.TrashItem) gin.H {
+	return gin.H{
+		"type":       item.Type,
+		"id":         item.ID,
+		"name":       item.Name,
+		"path":       item.Path,
+		"size":       item.Size,
+		"deleted_at": item.DeletedAt,
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTrashFolderHidesContents(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/a/b")
+	fileID := s.put("/a/b/h.txt", "hello")
+	link := s.share("/a/b/h.txt", nil)
+	bob := s.user("bob", "editor")
+	s.grant("/a", "bob", "write")
+
+	s.must(http.MethodDelete, "/api/v1/folders/by-path?path=/a&recursive=true", "", nil)
+
+	for _, token := range []string{"", bob} {
+		if resp := s.do(http.MethodGet, "/api/v1/files/"+fileID, token, nil); resp.Status != http.StatusNotFound {
+			t.Fatalf("get file in trashed folder: %d %s", resp.Status, resp.Body)
+		}
+	}
+	if resp := s.do(http.MethodGet, link, "-", nil); resp.Status != http.StatusNotFound {
+		t.Fatalf("share of file in trashed folder: %d %s", resp.Status, resp.Body)
+	}
+	var listing struct {
+		Total int `json:"total"`
+	}
+	s.must(http.MethodGet, "/api/v1/files/by-path?path=/a/b", "", nil).decode(t, &listing)
+	if listing.Total != 0 {
+		t.Fatalf("trashed folder still lists %d files", listing.Total)
+	}
+
+	var trash struct {
+		Items []struct {
+			ID   string `json:"id"`
+			Path string `json:"path"`
+		} `json:"items"`
+	}
+	s.must(http.MethodGet, "/api/v1/trash", "", nil).decode(t, &trash)
+	if len(trash.Items) != 1 || trash.Items[0].Path != "/a" {
+		t.Fatalf("trash items: %+v", trash.Items)
+	}
+	if resp := s.do(http.MethodPost, "/api/v1/trash/"+fileID+"/restore", "", nil); resp.Status != http.StatusNotFound {
+		t.Fatalf("restore file inside trashed folder: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestRestoreFolderRestoresContents(t *testing.T) {
+	s := newTestServer(t)
+	folderID := s.mkdir("/a")
+	s.mkdir("/a/b")
+	fileID := s.put("/a/b/h.txt", "hello")
+	s.put("/a/top.txt", "top")
+	link := s.share("/a/b/h.txt", nil)
+
+	s.must(http.MethodDelete, "/api/v1/folders/by-path?path=/a&recursive=true", "", nil)
+	s.must(http.MethodPost, "/api/v1/trash/"+folderID+"/restore", "", nil)
+
+	s.must(http.MethodGet, "/api/v1/files/"+fileID, "", nil)
+	s.must(http.MethodGet, "/api/v1/files/by-path/info?path=/a/top.txt", "", nil)
+	if resp := s.do(http.MethodGet, link, "-", nil); resp.Status != http.StatusOK || string(resp.Body) != "hello" {
+		t.Fatalf("share after restore: %d %s", resp.Status, resp.Body)
+	}
+
+	var trash struct {
+		Total int `json:"total"`
+	}
+	s.must(http.MethodGet, "/api/v1/trash", "", nil).decode(t, &trash)
+	if trash.Total != 0 {
+		t.Fatalf("trash not empty after restore: %d", trash.Total)
+	}
+}
+
+func TestTrashRespectsNoneGrantOnItem(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/a/secret")
+	s.put("/a/secret/s.txt", "secret")
+	fileID := s.put("/a/secret/other.txt", "other")
+	bob := s.user("bob", "editor")
+	s.grant("/a", "bob", "write")
+	s.grant("/a/secret", "bob", "none")
+
+	// 文件夹下的文件单独删除后，仍按其所在文件夹的 none 授权拒绝
+	s.must(http.MethodDelete, "/api/v1/files/"+fileID, "", nil)
+	// 子文件夹整体删除后，原位置 /a 上的 write 授权不能绕过 /a/secret 上的 none
+	secret := s.mustFolderID("/a/secret")
+	s.must(http.MethodDelete, "/api/v1/folders/by-path?path=/a/secret&recursive=true", "", nil)
+
+	for _, id := range []string{fileID, secret} {
+		if resp := s.do(http.MethodPost, "/api/v1/trash/"+id+"/restore", bob, nil); resp.Status != http.StatusForbidden {
+			t.Fatalf("restore %s: %d %s", id, resp.Status, resp.Body)
+		}
+		if resp := s.do(http.MethodDelete, "/api/v1/trash/"+id, bob, nil); resp.Status != http.StatusForbidden {
+			t.Fatalf("purge %s: %d %s", id, resp.Status, resp.Body)
+		}
+	}
+
+	var trash struct {
+		Total int `json:"total"`
+	}
+	s.must(http.MethodGet, "/api/v1/trash", bob, nil).decode(t, &trash)
+	if trash.Total != 0 {
+		t.Fatalf("bob sees %d trash items", trash.Total)
+	}
+}
+
+func (s *testServer) mustFolderID(dirPath string) string {
+	s.t.Helper()
+	var folder struct {
+		FolderID string `json:"folder_id"`
+	}
+	s.must(http.MethodGet, "/api/v1/folders/by-path?path="+dirPath, "", nil).decode(s.t, &folder)
+	return folder.FolderID
+}
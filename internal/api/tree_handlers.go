@@ -0,0 +1,211 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type TreeHandler struct {
+	Config  *config.Config
+	Service *service.TreeService
+	Access  *service.AccessService
+}
+
+func NewTreeHandler(cfg *config.Config, svc *service.TreeService, access *service.AccessService) *TreeHandler {
+	return &TreeHandler{Config: cfg, Service: svc, Access: access}
+}
+
+func (h *TreeHandler) MoveFile(c *gin.Context) {
+	srcPath, newPath, ok := sourceAndTarget(c)
+	if !ok {
+		return
+	}
+
+	record, err := file.Database.GetFileByPath(srcPath)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "file not found")
+		return
+	}
+
+	folderID, name, ok := targetLocation(c, newPath, record.OriginalName)
+	if !ok {
+		return
+	}
+	if !authorize(c, h.Access, record.FolderID, service.PermWrite) || !authorize(c, h.Access, folderID, service.PermWrite) {
+		return
+	}
+
+	if err := h.Service.MoveFile(c.Request.Context(), record.FileID, folderID, name); err != nil {
+		h.respondError(c, err, "failed to move file")
+		return
+	}
+
+	response.Message(c, "file_moved")
+}
+
+// MoveFolder 移动或重命名文件夹：new_path 为目标完整路径，仅改名时也可只传 new_name
+func (h *TreeHandler) MoveFolder(c *gin.Context) {
+	srcPath := c.Query("path")
+	if srcPath == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "path is required")
+		return
+	}
+
+	folder, err := file.Database.GetFolderByPath(srcPath)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "folder not found")
+		return
+	}
+
+	parentID, name := folder.ParentID, c.Query("new_name")
+	setAuditMessage(c, "rename to "+name)
+	if newPath := c.Query("new_path"); newPath != "" {
+		setAuditMessage(c, "to "+newPath)
+		var ok bool
+		if parentID, name, ok = targetLocation(c, newPath, folder.Name); !ok {
+			return
+		}
+	} else if name == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "new_path or new_name is required")
+		return
+	}
+
+	if !authorize(c, h.Access, folder.ParentID, service.PermWrite) || !authorize(c, h.Access, parentID, service.PermWrite) {
+		return
+	}
+
+	if err := h.Service.MoveFolder(c.Request.Context(), folder.FolderID, parentID, name); err != nil {
+		h.respondError(c, err, "failed to move folder")
+		return
+	}
+
+	response.Message(c, "folder_moved")
+}
+
+func (h *TreeHandler) CopyFile(c *gin.Context) {
+	srcPath, newPath, ok := sourceAndTarget(c)
+	if !ok {
+		return
+	}
+
+	record, err := file.Database.GetFileByPath(srcPath)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "file not found")
+		return
+	}
+
+	folderID, name, ok := targetLocation(c, newPath, record.OriginalName)
+	if !ok {
+		return
+	}
+	if !authorize(c, h.Access, record.FolderID, service.PermRead) || !authorize(c, h.Access, folderID, service.PermWrite) {
+		return
+	}
+
+	result, err := h.Service.CopyFile(c.Request.Context(), record.FileID, folderID, name, getUser(c))
+	if err != nil {
+		h.respondError(c, err, "failed to copy file")
+		return
+	}
+
+	response.Success(c, copyResponse(result, folderID, name))
+}
+
+func (h *TreeHandler) CopyFolder(c *gin.Context) {
+	srcPath, newPath, ok := sourceAndTarget(c)
+	if !ok {
+		return
+	}
+
+	folder, err := file.Database.GetFolderByPath(srcPath)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "folder not found")
+		return
+	}
+
+	parentID, name, ok := targetLocation(c, newPath, folder.Name)
+	if !ok {
+		return
+	}
+	if !authorizeTree(c, h.Access, folder.FolderID, service.PermRead) || !authorize(c, h.Access, parentID, service.PermWrite) {
+		return
+	}
+
+	result, err := h.Service.CopyFolder(c.Request.Context(), folder.FolderID, parentID, name, getUser(c))
+	if err != nil {
+		h.respondError(c, err, "failed to copy folder")
+		return
+	}
+
+	response.Success(c, copyResponse(result, parentID, name))
+}
+
+func (h *TreeHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrTargetExists):
+		response.Error(c, http.StatusConflict, 10010, "target already exists")
+	case errors.Is(err, service.ErrFolderCycle):
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+	default:
+		respondStorageError(c, err, message)
+	}
+}
+
+func sourceAndTarget(c *gin.Context) (string, string, bool) {
+	srcPath := c.Query("path")
+	newPath := c.Query("new_path")
+	if srcPath == "" || newPath == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "path and new_path are required")
+		return "", "", false
+	}
+	setAuditMessage(c, "to "+newPath)
+	return srcPath, newPath, true
+}
+
+// targetLocation 解析目标路径的上级文件夹和名称，路径以 / 结尾时沿用原名称
+func targetLocation(c *gin.Context, newPath, fallbackName string) (*string, string, bool) {
+	trimmed := strings.Trim(newPath, "/")
+	name := fallbackName
+	if !strings.HasSuffix(newPath, "/") && trimmed != "" {
+		name = path.Base(trimmed)
+		trimmed = path.Dir(trimmed)
+	}
+	if trimmed == "." {
+		trimmed = ""
+	}
+
+	if trimmed == "" {
+		return nil, name, true
+	}
+
+	folder, err := file.Database.GetFolderByPath("/" + trimmed)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "target folder not found")
+		return nil, "", false
+	}
+	return &folder.FolderID, name, true
+}
+
+func copyResponse(result service.CopyResult, parentID *string, name string) gin.H {
+	targetPath := "/" + name
+	if parentID != nil {
+		if parentPath, err := file.Database.GetFolderPath(*parentID); err == nil {
+			targetPath = parentPath + "/" + name
+		}
+	}
+	return gin.H{
+		"id":      result.ID,
+		"path":    targetPath,
+		"folders": result.Folders,
+		"files":   result.Files,
+		"size":    result.Bytes,
+	}
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+// chunkIdleTimeout 为接收分片时允许的最长无数据间隔。分片上传不受 server 的 ReadTimeout 限制，
+// 慢速但持续的传输可以完成，长时间没有数据时仍会断开
+const chunkIdleTimeout = 30 * time.Second
+
+type UploadHandler struct {
+	Config  *config.Config
+	Service *service.UploadService
+	Access  *service.AccessService
+}
+
+func NewUploadHandler(cfg *config.Config, svc *service.UploadService, access *service.AccessService) *UploadHandler {
+	return &UploadHandler{Config: cfg, Service: svc, Access: access}
+}
+
+func (h *UploadHandler) CreateSession(c *gin.Context) {
+	var req struct {
+		Path      string `json:"path" binding:"required"`
+		Size      int64  `json:"size" binding:"required"`
+		ChunkSize int64  `json:"chunk_size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+
+	maxBytes := h.Config.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && req.Size > maxBytes {
+		response.Error(c, http.StatusBadRequest, 10004, "file too large")
+		return
+	}
+
+	path := strings.TrimPrefix(req.Path, "/")
+	setAuditTarget(c, "/"+path)
+	parts := strings.Split(path, "/")
+	fileName := parts[len(parts)-1]
+	if fileName == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid path")
+		return
+	}
+
+	var folderID string
+	if len(parts) > 1 {
+		folder, err := file.Database.GetFolderByPath("/" + strings.Join(parts[:len(parts)-1], "/"))
+		if err != nil {
+			response.Error(c, http.StatusNotFound, 10002, "parent folder not found")
+			return
+		}
+		folderID = folder.FolderID
+	}
+	if !authorize(c, h.Access, optionalID(folderID), service.PermWrite) {
+		return
+	}
+
+	info, err := h.Service.CreateSession(c.Request.Context(), service.CreateUploadRequest{
+		FileName:  fileName,
+		FolderID:  folderID,
+		Path:      "/" + path,
+		Size:      req.Size,
+		ChunkSize: req.ChunkSize,
+		CreatedBy: getUser(c),
+	})
+	if err != nil {
+		h.respondError(c, err, "failed to create upload session")
+		return
+	}
+
+	response.Success(c, uploadSessionResponse(info))
+}
+
+func (h *UploadHandler) GetSession(c *gin.Context) {
+	info, ok := h.ownSession(c)
+	if !ok {
+		return
+	}
+
+	response.Success(c, uploadSessionResponse(info))
+}
+
+func (h *UploadHandler) UploadChunk(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid chunk index")
+		return
+	}
+	if c.Request.ContentLength < 0 {
+		response.Error(c, http.StatusLengthRequired, 10004, "content length required")
+		return
+	}
+	if _, ok := h.ownSession(c); !ok {
+		return
+	}
+
+	chunk, err := h.Service.UploadChunk(c.Request.Context(), c.Param("id"), index, idleTimeoutBody(c), c.Request.ContentLength)
+	if err != nil {
+		h.respondError(c, err, "failed to save chunk")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"index":  chunk.Index,
+		"offset": chunk.Offset,
+		"size":   chunk.Size,
+	})
+}
+
+// CompleteSession 提交上传。写权限在会话创建后可能已被收回，须重新检查目标文件夹；
+// 同名的已有文件在同一文件夹下，其权限与文件夹一致
+func (h *UploadHandler) CompleteSession(c *gin.Context) {
+	info, ok := h.ownSession(c)
+	if !ok {
+		return
+	}
+	if info.FolderID != nil {
+		if _, err := file.Database.GetFolder(*info.FolderID); err != nil {
+			response.Error(c, http.StatusNotFound, 10002, "parent folder not found")
+			return
+		}
+	}
+	if !authorize(c, h.Access, info.FolderID, service.PermWrite) {
+		return
+	}
+
+	metadata, err := h.Service.CompleteSession(c.Request.Context(), info.SessionID)
+	if err != nil {
+		h.respondError(c, err, "failed to complete upload")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"file_id":       metadata.FileID,
+		"original_name": metadata.OriginalName,
+		"path":          info.Path,
+		"size":          metadata.Size,
+		"mime_type":     metadata.MimeType,
+		"version":       metadata.Version,
+	})
+}
+
+func (h *UploadHandler) AbortSession(c *gin.Context) {
+	if _, ok := h.ownSession(c); !ok {
+		return
+	}
+	if err := h.Service.AbortSession(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondError(c, err, "failed to abort upload")
+		return
+	}
+
+	response.Message(c, "upload_aborted")
+}
+
+// idleTimeoutBody 返回请求体，读取期间每收到数据就顺延读超时 chunkIdleTimeout；
+// 写超时同样自读完请求头起计时，接收完分片后才写响应，一并取消
+func idleTimeoutBody(c *gin.Context) io.Reader {
+	clearWriteDeadline(c)
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Now().Add(chunkIdleTimeout)); err != nil {
+		if !errors.Is(err, http.ErrNotSupported) {
+			logger.Get().Warn().Err(err).Msg("failed to extend read deadline")
+		}
+		return c.Request.Body
+	}
+	return &idleTimeoutReader{body: c.Request.Body, rc: rc, extended: time.Now()}
+}
+
+type idleTimeoutReader struct {
+	body     io.Reader
+	rc       *http.ResponseController
+	extended time.Time
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	// 每秒至多顺延一次，避免每次读取都重设超时
+	if now := time.Now(); n > 0 && now.Sub(r.extended) >= time.Second {
+		r.rc.SetReadDeadline(now.Add(chunkIdleTimeout))
+		r.extended = now
+	}
+	return n, err
+}
+
+// ownSession 加载路径参数中的上传会话，只有创建者和管理员可以继续操作
+func (h *UploadHandler) ownSession(c *gin.Context) (service.UploadSessionInfo, bool) {
+	info, err := h.Service.GetSession(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.respondError(c, err, "failed to get upload session")
+		return service.UploadSessionInfo{}, false
+	}
+	setAuditTarget(c, info.Path)
+
+	principal := getPrincipal(c)
+	if info.CreatedBy != principal.Name && !principal.IsAdmin() {
+		respondAccessError(c, service.ErrForbidden)
+		return service.UploadSessionInfo{}, false
+	}
+	return info, true
+}
+
+func (h *UploadHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUploadSessionNotFound):
+		response.Error(c, http.StatusNotFound, response.CodeNotFound, "upload session not found")
+	case errors.Is(err, service.ErrUploadSessionBusy):
+		response.Error(c, http.StatusConflict, 10010, "upload session is being completed")
+	case errors.Is(err, service.ErrUploadSessionClosed):
+		response.Error(c, http.StatusGone, response.CodeGone, "upload session expired or closed")
+	case errors.Is(err, service.ErrInvalidChunk), errors.Is(err, service.ErrUploadIncomplete):
+		response.Error(c, http.StatusBadRequest, response.CodeInvalidParam, err.Error())
+	default:
+		respondStorageError(c, err, message)
+	}
+}
+
+func uploadSessionResponse(info service.UploadSessionInfo) gin.H {
+	received := make([]gin.H, 0, len(info.Received))
+	for _, chunk := range info.Received {
+		received = append(received, gin.H{
+			"index":  chunk.Index,
+			"offset": chunk.Offset,
+			"size":   chunk.Size,
+		})
+	}
+
+	return gin.H{
+		"upload_id":      info.SessionID,
+		"path":           info.Path,
+		"size":           info.Size,
+		"chunk_size":     info.ChunkSize,
+		"total_chunks":   info.TotalChunks,
+		"status":         info.Status,
+		"received":       received,
+		"received_bytes": info.ReceivedBytes,
+		"created_at":     info.CreatedAt,
+		"expires_at":     info.ExpiresAt,
+	}
+}
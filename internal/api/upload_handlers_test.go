@@ -0,0 +1,257 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+const testChunkSize = service.MinChunkSize
+
+// createUpload 以 token 的身份创建上传会话，返回会话 ID
+func (s *testServer) createUpload(filePath string, size int64, token string) string {
+	s.t.Helper()
+	resp := s.must(http.MethodPost, "/api/v1/uploads", token, gin.H{"path": filePath, "size": size, "chunk_size": testChunkSize})
+	var session struct {
+		UploadID string `json:"upload_id"`
+	}
+	resp.decode(s.t, &session)
+	return session.UploadID
+}
+
+func (s *testServer) putChunk(uploadID string, index int, data []byte, token string) testResponse {
+	s.t.Helper()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/uploads/%s/chunks/%d", uploadID, index), bytes.NewReader(data))
+	return s.serve(req, token)
+}
+
+// chunks 把 content 按测试分片大小切分
+func chunks(content []byte) [][]byte {
+	var list [][]byte
+	for offset := 0; offset < len(content); offset += testChunkSize {
+		list = append(list, content[offset:min(offset+testChunkSize, len(content))])
+	}
+	return list
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestUploadSessionChunksInAnyOrder(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	content := testContent(2*testChunkSize + 100)
+	parts := chunks(content)
+	id := s.createUpload("/docs/big.bin", int64(len(content)), "")
+
+	// 分片可以乱序上传，重传同一分片覆盖之前的内容
+	for _, i := range []int{2, 0} {
+		if resp := s.putChunk(id, i, parts[i], ""); resp.Code != 0 {
+			t.Fatalf("chunk %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+	if resp := s.putChunk(id, 0, parts[0], ""); resp.Code != 0 {
+		t.Fatalf("re-upload chunk 0: %d %s", resp.Status, resp.Body)
+	}
+
+	var info struct {
+		TotalChunks   int   `json:"total_chunks"`
+		ReceivedBytes int64 `json:"received_bytes"`
+		Received      []struct {
+			Index  int   `json:"index"`
+			Offset int64 `json:"offset"`
+		} `json:"received"`
+	}
+	s.must(http.MethodGet, "/api/v1/uploads/"+id, "", nil).decode(t, &info)
+	if info.TotalChunks != 3 || len(info.Received) != 2 || info.ReceivedBytes != int64(testChunkSize+100) {
+		t.Fatalf("session = %+v", info)
+	}
+	for _, chunk := range info.Received {
+		if chunk.Offset != int64(chunk.Index*testChunkSize) {
+			t.Fatalf("chunk %d at offset %d", chunk.Index, chunk.Offset)
+		}
+	}
+
+	// 缺少分片时不能完成
+	if resp := s.do(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil); resp.Status != http.StatusBadRequest {
+		t.Fatalf("complete with missing chunk: %d %s", resp.Status, resp.Body)
+	}
+
+	if resp := s.putChunk(id, 1, parts[1], ""); resp.Code != 0 {
+		t.Fatalf("chunk 1: %d %s", resp.Status, resp.Body)
+	}
+	var done struct {
+		FileID string `json:"file_id"`
+	}
+	s.must(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil).decode(t, &done)
+	resp := s.must(http.MethodGet, "/api/v1/files/"+done.FileID+"/download", "", nil)
+	if !bytes.Equal(resp.Body, content) {
+		t.Fatalf("downloaded %d bytes, want %d", len(resp.Body), len(content))
+	}
+
+	// 完成后的会话不再接收分片
+	if resp := s.putChunk(id, 0, parts[0], ""); resp.Status != http.StatusGone {
+		t.Fatalf("chunk after complete: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestUploadSessionChecksSizes(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	content := testContent(testChunkSize + 100)
+	id := s.createUpload("/docs/big.bin", int64(len(content)), "")
+
+	for _, tc := range []struct {
+		index int
+		data  []byte
+	}{
+		{0, content[:testChunkSize-1]},
+		{1, content[:101]},
+		{2, content[:100]},
+		{-1, content[:100]},
+	} {
+		if resp := s.putChunk(id, tc.index, tc.data, ""); resp.Status != http.StatusBadRequest {
+			t.Fatalf("chunk %d of %d bytes: %d %s", tc.index, len(tc.data), resp.Status, resp.Body)
+		}
+	}
+
+	for _, body := range []gin.H{
+		{"path": "/docs/a.bin", "size": 0, "chunk_size": testChunkSize},
+		{"path": "/docs/a.bin", "size": 100, "chunk_size": 1024 * 1024},
+		{"path": "/docs/a.bin", "size": 100, "chunk_size": service.MaxChunkSize + 1},
+	} {
+		if resp := s.do(http.MethodPost, "/api/v1/uploads", "", body); resp.Status != http.StatusBadRequest {
+			t.Fatalf("create %v: %d %s", body, resp.Status, resp.Body)
+		}
+	}
+}
+
+func TestUploadSessionBelongsToCreator(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/shared")
+	alice := s.user("alice", "editor")
+	bob := s.user("bob", "editor")
+	s.grant("/shared", "alice", "write")
+	s.grant("/shared", "bob", "write")
+
+	id := s.createUpload("/shared/a.bin", 100, alice)
+	if resp := s.putChunk(id, 0, testContent(100), bob); resp.Status != http.StatusForbidden {
+		t.Fatalf("chunk by another user: %d %s", resp.Status, resp.Body)
+	}
+	if resp := s.do(http.MethodDelete, "/api/v1/uploads/"+id, bob, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("abort by another user: %d %s", resp.Status, resp.Body)
+	}
+	if resp := s.putChunk(id, 0, testContent(100), alice); resp.Code != 0 {
+		t.Fatalf("chunk by creator: %d %s", resp.Status, resp.Body)
+	}
+	s.must(http.MethodPost, "/api/v1/uploads/"+id+"/complete", alice, nil)
+}
+
+func TestUploadCompleteRetriesWithAssembledObject(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	content := testContent(testChunkSize + 100)
+	id := s.createUpload("/docs/big.bin", int64(len(content)), "")
+	for i, chunk := range chunks(content) {
+		if resp := s.putChunk(id, i, chunk, ""); resp.Code != 0 {
+			t.Fatalf("chunk %d: %d %s", i, resp.Status, resp.Body)
+		}
+	}
+
+	// 正在完成的会话拒绝重复的完成和取消请求
+	file.Database.Model(&database.UploadSession{}).Where("session_id = ?", id).Update("status", service.UploadStatusCompleting)
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		target := "/api/v1/uploads/" + id
+		if method == http.MethodPost {
+			target += "/complete"
+		}
+		if resp := s.do(method, target, "", nil); resp.Status != http.StatusConflict {
+			t.Fatalf("%s while completing: %d %s", method, resp.Status, resp.Body)
+		}
+	}
+	file.Database.Model(&database.UploadSession{}).Where("session_id = ?", id).Update("status", service.UploadStatusActive)
+
+	// 文件 ID 已被占用时写入记录失败，已合并的对象保留给重试使用
+	session, err := file.Database.GetUploadSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker := &database.File{FileID: session.FileID, OriginalName: "blocker.txt", ObjectKey: "memory/blocker"}
+	if err := file.Database.Create(blocker).Error; err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.do(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil); resp.Status == http.StatusOK {
+		t.Fatalf("complete with taken file id: %d %s", resp.Status, resp.Body)
+	}
+	var info struct {
+		Status string `json:"status"`
+	}
+	s.must(http.MethodGet, "/api/v1/uploads/"+id, "", nil).decode(t, &info)
+	if info.Status != service.UploadStatusAssembled {
+		t.Fatalf("status after failed complete = %q", info.Status)
+	}
+
+	file.Database.Unscoped().Delete(blocker)
+	var done struct {
+		FileID string `json:"file_id"`
+		Size   int64  `json:"size"`
+	}
+	s.must(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil).decode(t, &done)
+	if done.FileID != session.FileID || done.Size != int64(len(content)) {
+		t.Fatalf("completed = %+v", done)
+	}
+	resp := s.must(http.MethodGet, "/api/v1/files/"+done.FileID+"/download", "", nil)
+	if !bytes.Equal(resp.Body, content) {
+		t.Fatalf("downloaded %d bytes, want %d", len(resp.Body), len(content))
+	}
+}
+
+func TestSlowChunkOutlivesReadTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.mkdir("/docs")
+	content := testContent(1000)
+	id := s.createUpload("/docs/small.bin", int64(len(content)), "")
+
+	server := httptest.NewUnstartedServer(s.router)
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// 分片分多次缓慢写出，总耗时超过 ReadTimeout 和 WriteTimeout
+	body, writer := io.Pipe()
+	go func() {
+		for offset := 0; offset < len(content); offset += 100 {
+			time.Sleep(60 * time.Millisecond)
+			writer.Write(content[offset : offset+100])
+		}
+		writer.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/v1/uploads/"+id+"/chunks/0", body)
+	req.ContentLength = int64(len(content))
+	req.Header.Set("X-Local-Key", testLocalKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("slow chunk: %d", resp.StatusCode)
+	}
+
+	s.must(http.MethodPost, "/api/v1/uploads/"+id+"/complete", "", nil)
+}
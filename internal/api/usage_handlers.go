@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type UsageHandler struct {
+	Config  *config.Config
+	Service *service.QuotaService
+	Access  *service.AccessService
+}
+
+func NewUsageHandler(cfg *config.Config, svc *service.QuotaService, access *service.AccessService) *UsageHandler {
+	return &UsageHandler{Config: cfg, Service: svc, Access: access}
+}
+
+// GetUsage 返回当前用户及其可读的各顶层文件夹的用量和配额
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	report, err := h.Service.Report(c.Request.Context(), getUser(c))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to get usage")
+		return
+	}
+
+	principal := getPrincipal(c)
+	folders := make([]gin.H, 0, len(report.Folders))
+	for _, f := range report.Folders {
+		if h.Access.Require(c.Request.Context(), principal, nearestFolder(f.Path), service.PermRead) != nil {
+			continue
+		}
+		folders = append(folders, usageResponse(f))
+	}
+
+	response.Success(c, gin.H{
+		"user":    usageResponse(report.User),
+		"folders": folders,
+	})
+}
+
+// FolderUsage 返回目录及其直接子文件夹递归统计的文件数和大小，path 为空或 / 时统计根目录
+func (h *UsageHandler) FolderUsage(c *gin.Context) {
+	var folderID *string
+	if path := c.Query("path"); path != "" && path != "/" {
+		folder, err := file.Database.GetFolderByPath(path)
+		if err != nil {
+			response.Error(c, http.StatusNotFound, 10002, "folder not found")
+			return
+		}
+		folderID = &folder.FolderID
+	}
+	if !authorize(c, h.Access, folderID, service.PermRead) {
+		return
+	}
+
+	total, children, err := h.Service.DiskUsage(c.Request.Context(), folderID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to get folder usage")
+		return
+	}
+
+	items := make([]gin.H, 0, len(children))
+	for _, child := range children {
+		items = append(items, gin.H{
+			"path":  child.Path,
+			"files": child.Files,
+			"size":  child.Bytes,
+		})
+	}
+
+	response.Success(c, gin.H{
+		"path":    total.Path,
+		"files":   total.Files,
+		"size":    total.Bytes,
+		"folders": items,
+	})
+}
+
+func usageResponse(u service.Usage) gin.H {
+	data := gin.H{
+		"name":      u.Name,
+		"files":     u.Files,
+		"size":      u.Bytes,
+		"max_files": u.MaxFiles,
+		"max_size":  u.MaxBytes,
+	}
+	if u.Path != "" {
+		data["path"] = u.Path
+	}
+	return data
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+func TestUsageIncludesFileVersions(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Quota.DefaultUser = config.QuotaLimit{MaxSizeMB: 1}
+	})
+	bob := s.user("bob", "editor")
+	s.mkdir("/docs")
+	s.grant("/docs", "bob", "write")
+
+	content := strings.Repeat("a", 400*1024)
+	if resp := s.upload("/docs/a.bin", content, bob); resp.Code != 0 {
+		t.Fatalf("upload: %s", resp.Body)
+	}
+	if resp := s.upload("/docs/a.bin", strings.Repeat("b", 400*1024), bob); resp.Code != 0 {
+		t.Fatalf("overwrite: %s", resp.Body)
+	}
+
+	var usage struct {
+		User struct {
+			Files int64 `json:"files"`
+			Size  int64 `json:"size"`
+		} `json:"user"`
+	}
+	s.must(http.MethodGet, "/api/v1/usage", bob, nil).decode(t, &usage)
+	if usage.User.Files != 1 || usage.User.Size != 800*1024 {
+		t.Fatalf("usage = %+v, want 1 file of %d bytes", usage.User, 800*1024)
+	}
+
+	var folder struct {
+		Size int64 `json:"size"`
+	}
+	s.must(http.MethodGet, "/api/v1/folders/by-path/usage?path=/docs", bob, nil).decode(t, &folder)
+	if folder.Size != 800*1024 {
+		t.Fatalf("folder usage = %d, want %d", folder.Size, 800*1024)
+	}
+
+	// 原内容保留为历史版本，再次覆盖后总量超出 1 MB
+	if resp := s.upload("/docs/a.bin", strings.Repeat("c", 400*1024), bob); resp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("overwrite beyond quota: %d %s", resp.Status, resp.Body)
+	}
+}
+
+func TestOverwriteQuotaReleasesPrunedVersions(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Quota.DefaultUser = config.QuotaLimit{MaxSizeMB: 1}
+		cfg.Version.KeepVersions = 1
+	})
+	bob := s.user("bob", "editor")
+	s.mkdir("/docs")
+	s.grant("/docs", "bob", "write")
+
+	// 只保留一个历史版本，每次覆盖清理的旧版本抵消新增的大小
+	for _, c := range []string{"a", "b", "c", "d"} {
+		if resp := s.upload("/docs/a.bin", strings.Repeat(c, 400*1024), bob); resp.Code != 0 {
+			t.Fatalf("upload %s: %d %s", c, resp.Status, resp.Body)
+		}
+	}
+}
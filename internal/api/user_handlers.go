@@ -0,0 +1,221 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type UserHandler struct {
+	Config  *config.Config
+	Service *service.UserService
+}
+
+func NewUserHandler(cfg *config.Config, svc *service.UserService) *UserHandler {
+	return &UserHandler{Config: cfg, Service: svc}
+}
+
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.Service.List(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list users")
+		return
+	}
+
+	items := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		items = append(items, userResponse(u))
+	}
+
+	response.Success(c, gin.H{
+		"total": len(items),
+		"users": items,
+	})
+}
+
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "username and password are required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = service.RoleViewer
+	}
+	setAuditMessage(c, "user "+req.Username+" as "+req.Role)
+
+	user, err := h.Service.Create(c.Request.Context(), req.Username, req.Password, req.Role)
+	if err != nil {
+		h.respondError(c, err, "failed to create user")
+		return
+	}
+
+	response.Success(c, userResponse(user))
+}
+
+// UpdateUser 修改用户的密码、角色或禁用状态，未提供的字段保持不变
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var req struct {
+		Password *string `json:"password"`
+		Role     *string `json:"role"`
+		Disabled *bool   `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	setAuditMessage(c, "user "+c.Param("username"))
+
+	user, err := h.Service.Update(c.Request.Context(), c.Param("username"), service.UserUpdate{
+		Password: req.Password,
+		Role:     req.Role,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		h.respondError(c, err, "failed to update user")
+		return
+	}
+
+	response.Success(c, userResponse(user))
+}
+
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	setAuditMessage(c, "user "+c.Param("username"))
+	if err := h.Service.Delete(c.Request.Context(), c.Param("username")); err != nil {
+		h.respondError(c, err, "failed to delete user")
+		return
+	}
+
+	response.Message(c, "user_deleted")
+}
+
+// ListGrants 返回 path 指定文件夹上的授权，未指定 path 时返回全部授权
+func (h *UserHandler) ListGrants(c *gin.Context) {
+	path := c.Query("path")
+	folderID, ok := grantFolder(c, path)
+	if !ok {
+		return
+	}
+
+	grants, err := h.Service.ListGrants(c.Request.Context(), folderID, path == "")
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, 19999, "failed to list grants")
+		return
+	}
+
+	items := make([]gin.H, 0, len(grants))
+	for _, g := range grants {
+		items = append(items, gin.H{
+			"path":       g.Path,
+			"username":   g.Username,
+			"permission": g.Permission,
+			"created_by": g.CreatedBy,
+			"created_at": g.CreatedAt,
+		})
+	}
+
+	response.Success(c, gin.H{
+		"total":  len(items),
+		"grants": items,
+	})
+}
+
+// SetGrant 设置用户对文件夹的权限，子文件夹继承该权限，permission 为 none 时收回继承来的权限
+func (h *UserHandler) SetGrant(c *gin.Context) {
+	var req struct {
+		Path       string `json:"path" binding:"required"`
+		Username   string `json:"username" binding:"required"`
+		Permission string `json:"permission" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, 10004, "path, username and permission are required")
+		return
+	}
+	setAuditTarget(c, req.Path)
+	setAuditMessage(c, "user "+req.Username+" permission "+req.Permission)
+
+	folderID, ok := grantFolder(c, req.Path)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Grant(c.Request.Context(), folderID, req.Username, req.Permission, getUser(c)); err != nil {
+		h.respondError(c, err, "failed to set grant")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"path":       req.Path,
+		"username":   req.Username,
+		"permission": req.Permission,
+	})
+}
+
+func (h *UserHandler) DeleteGrant(c *gin.Context) {
+	path, username := c.Query("path"), c.Query("username")
+	if path == "" || username == "" {
+		response.Error(c, http.StatusBadRequest, 10004, "path and username are required")
+		return
+	}
+	setAuditMessage(c, "user "+username)
+
+	folderID, ok := grantFolder(c, path)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Revoke(c.Request.Context(), folderID, username); err != nil {
+		h.respondError(c, err, "failed to delete grant")
+		return
+	}
+
+	response.Message(c, "grant_deleted")
+}
+
+func (h *UserHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrGrantNotFound):
+		response.Error(c, http.StatusNotFound, 10002, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		response.Error(c, http.StatusConflict, 10010, err.Error())
+	case errors.Is(err, service.ErrInvalidUsername), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidPermission), errors.Is(err, service.ErrPasswordRequired),
+		errors.Is(err, service.ErrLastAdmin):
+		response.Error(c, http.StatusBadRequest, 10004, err.Error())
+	default:
+		response.Error(c, http.StatusInternalServerError, 19999, message)
+	}
+}
+
+// grantFolder 将授权路径解析为文件夹 ID，/ 或空串表示根目录
+func grantFolder(c *gin.Context, path string) (*string, bool) {
+	if path == "" || path == "/" {
+		return nil, true
+	}
+
+	folder, err := file.Database.GetFolderByPath(path)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, 10002, "folder not found")
+		return nil, false
+	}
+	return &folder.FolderID, true
+}
+
+func userResponse(u service.UserInfo) gin.H {
+	return gin.H{
+		"username":   u.Username,
+		"role":       u.Role,
+		"disabled":   u.Disabled,
+		"created_at": u.CreatedAt,
+		"updated_at": u.UpdatedAt,
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/response"
+	"github.com/kiry163/claw-pliers/internal/service"
+)
+
+type VersionHandler struct {
+	Config  *config.Config
+	Service *service.VersionService
+	Access  *service.AccessService
+}
+
+func NewVersionHandler(cfg *config.Config, svc *service.VersionService, access *service.AccessService) *VersionHandler {
+	return &VersionHandler{Config: cfg, Service: svc, Access: access}
+}
+
+func (h *VersionHandler) ListVersions(c *gin.Context) {
+	if !authorizeFile(c, h.Access, c.Param("id"), service.PermRead) {
+		return
+	}
+
+	versions, err := h.Service.List(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.respondError(c, err, "failed to list versions")
+		return
+	}
+
+	items := make([]gin.H, 0, len(versions))
+	for _, v := range versions {
+		items = append(items, versionResponse(v))
+	}
+
+	response.Success(c, gin.H{
+		"file_id":       c.Param("id"),
+		"total":         len(items),
+		"items":         items,
+		"keep_versions": h.Config.Version.KeepVersions,
+		"keep_days":     h.Config.Version.KeepDays,
+	})
+}
+
+func (h *VersionHandler) DownloadVersion(c *gin.Context) {
+	version, ok := versionParam(c)
+	if !ok || !authorizeFile(c, h.Access, c.Param("id"), service.PermRead) {
+		return
+	}
+
+	v, err := h.Service.Get(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		h.respondError(c, err, "failed to get version")
+		return
+	}
+
+	// 同一版本号的内容不会改变，可直接用版本号作为强校验 ETag
+	serveDownload(c, file.FileStorage, downloadTarget{
+		ObjectKey: v.ObjectKey,
+		Name:      v.Name,
+		MimeType:  v.MimeType,
+		ModTime:   v.CreatedAt,
+		ETag:      fmt.Sprintf(`"%s-v%d"`, v.FileID, v.Version),
+	})
+}
+
+func (h *VersionHandler) PromoteVersion(c *gin.Context) {
+	setAuditFile(c, c.Param("id"))
+	version, ok := versionParam(c)
+	if !ok || !authorizeFile(c, h.Access, c.Param("id"), service.PermWrite) {
+		return
+	}
+	setAuditMessage(c, fmt.Sprintf("version %d", version))
+
+	metadata, err := h.Service.Promote(c.Request.Context(), c.Param("id"), version, getUser(c))
+	if err != nil {
+		h.respondError(c, err, "failed to promote version")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"file_id":       metadata.FileID,
+		"original_name": metadata.OriginalName,
+		"version":       metadata.Version,
+		"size":          metadata.Size,
+		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+	})
+}
+
+func (h *VersionHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrVersionNotFound):
+		response.Error(c, http.StatusNotFound, 10002, "version not found")
+	case errors.Is(err, service.ErrFileNotFound):
+		response.Error(c, http.StatusNotFound, 10002, "file not found")
+	default:
+		respondStorageError(c, err, message)
+	}
+}
+
+func versionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		response.Error(c, http.StatusBadRequest, 10004, "invalid version")
+		return 0, false
+	}
+	return version, true
+}
+
+func versionResponse(v service.FileVersionInfo) gin.H {
+	data := gin.H{
+		"version":    v.Version,
+		"current":    v.Current,
+		"size":       v.Size,
+		"mime_type":  v.MimeType,
+		"sha256":     v.SHA256,
+		"created_by": v.CreatedBy,
+		"created_at": v.CreatedAt,
+	}
+	if !v.Current {
+		data["archived_at"] = v.ArchivedAt
+	}
+	return data
+}
+
+// overwriteFile 将上传内容写为已有文件的新版本，逻辑与新建文件一致：先尝试按哈希秒传，再读取文件体
+func (h *FileHandler) overwriteFile(c *gin.Context, fileID, contentHash string, uploadedFile *multipart.FileHeader, path string) {
+	ctx := c.Request.Context()
+
+	var metadata service.FileMetadata
+	var err error
+	if contentHash != "" {
+		if err = h.reusableContent(c, contentHash); err == nil {
+			metadata, err = h.Versions.OverwriteFromHash(ctx, fileID, contentHash, getUser(c))
+		}
+		if errors.Is(err, service.ErrContentNotFound) && uploadedFile == nil {
+			response.Error(c, http.StatusPreconditionFailed, 10004, "content not found, upload the file body")
+			return
+		}
+	}
+
+	if uploadedFile != nil && (contentHash == "" || errors.Is(err, service.ErrContentNotFound)) {
+		maxBytes := h.Config.Upload.MaxSizeMB * 1024 * 1024
+		if maxBytes > 0 && uploadedFile.Size > maxBytes {
+			response.Error(c, http.StatusBadRequest, 10004, "file too large")
+			return
+		}
+
+		src, openErr := uploadedFile.Open()
+		if openErr != nil {
+			response.Error(c, http.StatusInternalServerError, 19999, "failed to open file")
+			return
+		}
+		defer src.Close()
+
+		metadata, err = h.Versions.Overwrite(ctx, fileID, src, uploadedFile.Size, contentHash, getUser(c))
+	}
+
+	if err != nil {
+		if errors.Is(err, service.ErrContentHashMismatch) {
+			response.Error(c, http.StatusBadRequest, 10004, contentHashHeader+" does not match uploaded content")
+			return
+		}
+		respondStorageError(c, err, "failed to save file")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"file_id":       metadata.FileID,
+		"original_name": metadata.OriginalName,
+		"path":          path,
+		"size":          metadata.Size,
+		"mime_type":     metadata.MimeType,
+		"sha256":        metadata.SHA256,
+		"deduplicated":  metadata.Deduplicated,
+		"version":       metadata.Version,
+	})
+}
@@ -10,21 +10,42 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig    `mapstructure:"server" json:"server"`
-	Database DatabaseConfig  `mapstructure:"database" json:"database"`
-	Auth     AuthConfig      `mapstructure:"auth" json:"auth"`
-	Upload   UploadConfig    `mapstructure:"upload" json:"upload"`
-	Minio    MinioConfig     `mapstructure:"minio" json:"minio"`
-	Includes []IncludeConfig `mapstructure:"includes" json:"includes"`
-	Mail     MailConfig      `mapstructure:"mail" json:"mail"`
-	Image    ImageConfig     `mapstructure:"image" json:"image"`
-	Logger   LoggerConfig    `mapstructure:"logger" json:"logger"`
+	Server    ServerConfig    `mapstructure:"server" json:"server"`
+	Database  DatabaseConfig  `mapstructure:"database" json:"database"`
+	Auth      AuthConfig      `mapstructure:"auth" json:"auth"`
+	Upload    UploadConfig    `mapstructure:"upload" json:"upload"`
+	Minio     MinioConfig     `mapstructure:"minio" json:"minio"`
+	Storage   StorageConfig   `mapstructure:"storage" json:"storage"`
+	Trash     TrashConfig     `mapstructure:"trash" json:"trash"`
+	Version   VersionConfig   `mapstructure:"versioning" json:"versioning"`
+	Quota     QuotaConfig     `mapstructure:"quota" json:"quota"`
+	Share     ShareConfig     `mapstructure:"share" json:"share"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit" json:"rate_limit"`
+	Includes  []IncludeConfig `mapstructure:"includes" json:"includes"`
+	Mail      MailConfig      `mapstructure:"mail" json:"mail"`
+	Image     ImageConfig     `mapstructure:"image" json:"image"`
+	Logger    LoggerConfig    `mapstructure:"logger" json:"logger"`
 }
 
 type ServerConfig struct {
-	Port           int    `mapstructure:"port" json:"port"`
-	LogLevel       string `mapstructure:"log_level" json:"log_level"`
-	PublicEndpoint string `mapstructure:"public_endpoint" json:"public_endpoint"`
+	Port           int       `mapstructure:"port" json:"port"`
+	LogLevel       string    `mapstructure:"log_level" json:"log_level"`
+	PublicEndpoint string    `mapstructure:"public_endpoint" json:"public_endpoint"`
+	TLS            TLSConfig `mapstructure:"tls" json:"tls"`
+	// TrustedProxies 为反向代理的 IP 或 CIDR，只有来自这些地址的请求才按 X-Forwarded-For 取客户端 IP；为空时不信任任何代理
+	TrustedProxies []string `mapstructure:"trusted_proxies" json:"trusted_proxies"`
+}
+
+// TLSConfig 为 API 服务的 HTTPS 配置，证书文件在收到 SIGHUP 时重新加载。
+// ClientAuth 为 none（默认）、optional 或 require；后两者按 ClientCAFile 校验客户端证书，
+// 证书主题通过 Identities 映射为用户名，未映射时使用证书的 CN
+type TLSConfig struct {
+	Enabled      bool              `mapstructure:"enabled" json:"enabled"`
+	CertFile     string            `mapstructure:"cert_file" json:"cert_file"`
+	KeyFile      string            `mapstructure:"key_file" json:"key_file"`
+	ClientAuth   string            `mapstructure:"client_auth" json:"client_auth"`
+	ClientCAFile string            `mapstructure:"client_ca_file" json:"client_ca_file"`
+	Identities   map[string]string `mapstructure:"identities" json:"identities"`
 }
 
 type DatabaseConfig struct {
@@ -41,7 +62,9 @@ type AuthConfig struct {
 }
 
 type UploadConfig struct {
-	MaxSizeMB int64 `mapstructure:"max_size_mb" json:"max_size_mb"`
+	MaxSizeMB       int64 `mapstructure:"max_size_mb" json:"max_size_mb"`
+	ChunkSizeMB     int64 `mapstructure:"chunk_size_mb" json:"chunk_size_mb"`
+	SessionTTLHours int64 `mapstructure:"session_ttl_hours" json:"session_ttl_hours"`
 }
 
 type MinioConfig struct {
@@ -53,6 +76,87 @@ type MinioConfig struct {
 	Region    string `mapstructure:"region" json:"region"`
 }
 
+type StorageConfig struct {
+	Driver     string           `mapstructure:"driver" json:"driver"`
+	Mode       string           `mapstructure:"mode" json:"mode"`
+	Root       string           `mapstructure:"root" json:"root"`
+	Encryption EncryptionConfig `mapstructure:"encryption" json:"encryption"`
+}
+
+// EncryptionConfig 控制存储对象的信封加密：每个对象使用独立的数据密钥加密，数据密钥再用主密钥加密后保存在数据库中。
+// 主密钥为 32 字节，以 base64 写在 MasterKey 中或保存在 MasterKeyFile 指向的文件里；轮换主密钥时将旧密钥移到
+// PreviousKeys 或 PreviousKeyFiles，重新加密全部数据密钥后即可删除
+type EncryptionConfig struct {
+	Enabled          bool     `mapstructure:"enabled" json:"enabled"`
+	MasterKey        string   `mapstructure:"master_key" json:"-"`
+	MasterKeyFile    string   `mapstructure:"master_key_file" json:"master_key_file"`
+	PreviousKeys     []string `mapstructure:"previous_keys" json:"-"`
+	PreviousKeyFiles []string `mapstructure:"previous_key_files" json:"previous_key_files"`
+}
+
+// TrashConfig 控制回收站保留时间，RetentionDays 为 0 时不自动清空
+type TrashConfig struct {
+	RetentionDays int64 `mapstructure:"retention_days" json:"retention_days"`
+}
+
+// VersionConfig 控制覆盖上传产生的历史版本保留策略，超出任一限制的历史版本会被清理，0 表示不限制
+type VersionConfig struct {
+	KeepVersions int   `mapstructure:"keep_versions" json:"keep_versions"`
+	KeepDays     int64 `mapstructure:"keep_days" json:"keep_days"`
+}
+
+// ShareConfig 控制分享链接的有效期：DefaultTTLHours 为未指定有效期时的默认值，
+// MaxTTLHours 为允许的最长有效期，0 表示不限制且允许永不过期的链接
+type ShareConfig struct {
+	DefaultTTLHours int64 `mapstructure:"default_ttl_hours" json:"default_ttl_hours"`
+	MaxTTLHours     int64 `mapstructure:"max_ttl_hours" json:"max_ttl_hours"`
+}
+
+// RateLimitConfig 控制请求限流和认证失败锁定。IP 限制每个客户端 IP 的全部请求，Key 限制每个 API 密钥
+// 或登录用户的请求，Groups 按路由组名称（auth、share、files 等）限制每个 IP 在该组内的请求
+type RateLimitConfig struct {
+	Enabled bool                     `mapstructure:"enabled" json:"enabled"`
+	IP      RateLimitRule            `mapstructure:"ip" json:"ip"`
+	Key     RateLimitRule            `mapstructure:"key" json:"key"`
+	Groups  map[string]RateLimitRule `mapstructure:"groups" json:"groups"`
+	Lockout LockoutConfig            `mapstructure:"lockout" json:"lockout"`
+}
+
+// RateLimitRule 为一个令牌桶：每分钟补充 PerMinute 个请求，最多累积 Burst 个；PerMinute 为 0 表示不限制
+type RateLimitRule struct {
+	PerMinute int `mapstructure:"per_minute" json:"per_minute"`
+	Burst     int `mapstructure:"burst" json:"burst"`
+}
+
+// LockoutConfig 控制认证失败锁定：同一 IP 在 WindowMinutes 内认证失败 MaxFailures 次后，
+// 锁定 DurationMinutes 分钟；MaxFailures 为 0 表示不锁定
+type LockoutConfig struct {
+	MaxFailures     int   `mapstructure:"max_failures" json:"max_failures"`
+	WindowMinutes   int64 `mapstructure:"window_minutes" json:"window_minutes"`
+	DurationMinutes int64 `mapstructure:"duration_minutes" json:"duration_minutes"`
+}
+
+// QuotaConfig 限制每个用户及每个顶层文件夹的总大小和文件数；Users/Folders 中按名称覆盖默认值
+type QuotaConfig struct {
+	DefaultUser   QuotaLimit  `mapstructure:"default_user" json:"default_user"`
+	DefaultFolder QuotaLimit  `mapstructure:"default_folder" json:"default_folder"`
+	Users         []QuotaRule `mapstructure:"users" json:"users"`
+	Folders       []QuotaRule `mapstructure:"folders" json:"folders"`
+}
+
+// QuotaLimit 为一组配额，0 表示不限制
+type QuotaLimit struct {
+	MaxSizeMB int64 `mapstructure:"max_size_mb" json:"max_size_mb"`
+	MaxFiles  int64 `mapstructure:"max_files" json:"max_files"`
+}
+
+// QuotaRule 为指定用户或顶层文件夹（按名称）单独设置的配额
+type QuotaRule struct {
+	Name      string `mapstructure:"name" json:"name"`
+	MaxSizeMB int64  `mapstructure:"max_size_mb" json:"max_size_mb"`
+	MaxFiles  int64  `mapstructure:"max_files" json:"max_files"`
+}
+
 type IncludeConfig struct {
 	Name string `mapstructure:"name" json:"name"`
 	Path string `mapstructure:"path" json:"path"`
@@ -64,11 +168,26 @@ type MailConfig struct {
 	Monitoring MonitoringConfig `mapstructure:"monitoring" json:"monitoring"`
 }
 
+// AccountConfig 为一个邮件账户。Provider 为预置的服务商（163、126、qq、gmail、outlook），
+// IMAP 和 SMTP 中未配置的字段使用服务商的预置值；自建或企业邮件服务器不设置 Provider，直接配置 IMAP 和 SMTP
 type AccountConfig struct {
-	Provider  string `mapstructure:"provider" json:"provider"`
-	Email     string `mapstructure:"email" json:"email"`
-	AuthToken string `mapstructure:"auth_token" json:"auth_token"`
-	Enabled   bool   `mapstructure:"enabled" json:"enabled"`
+	Provider  string           `mapstructure:"provider" json:"provider"`
+	Email     string           `mapstructure:"email" json:"email"`
+	AuthToken string           `mapstructure:"auth_token" json:"auth_token"`
+	Enabled   bool             `mapstructure:"enabled" json:"enabled"`
+	IMAP      MailServerConfig `mapstructure:"imap" json:"imap"`
+	SMTP      MailServerConfig `mapstructure:"smtp" json:"smtp"`
+}
+
+// MailServerConfig 为 IMAP 或 SMTP 服务器的连接设置。Security 为 tls（隐式 TLS）、starttls 或 plain（不加密，只允许 localhost 和环回地址），
+// 未设置 Port 时按 Security 使用标准端口；Auth 为 plain、login 或 xoauth2，xoauth2 时 auth_token 为 OAuth2 访问令牌；
+// Username 为空时使用邮箱地址登录
+type MailServerConfig struct {
+	Host     string `mapstructure:"host" json:"host,omitempty"`
+	Port     int    `mapstructure:"port" json:"port,omitempty"`
+	Security string `mapstructure:"security" json:"security,omitempty"`
+	Auth     string `mapstructure:"auth" json:"auth,omitempty"`
+	Username string `mapstructure:"username" json:"username,omitempty"`
 }
 
 type WebhookConfig struct {
@@ -80,8 +199,14 @@ type WebhookConfig struct {
 	Enable        bool   `mapstructure:"enable" json:"enable"`
 }
 
+// MonitoringConfig 为服务端邮件监听配置：AutoStart 为 true 时随服务启动监听所有启用的账户；
+// Idle 为 true 时使用 IMAP IDLE 等待新邮件，服务器不支持 IDLE 或 Idle 为 false 时按 PollInterval 轮询；
+// EventRetentionDays 为已处理邮件记录的保留天数，为 0 时不自动清理
 type MonitoringConfig struct {
-	PollInterval string `mapstructure:"poll_interval" json:"poll_interval"`
+	PollInterval       string `mapstructure:"poll_interval" json:"poll_interval"`
+	AutoStart          bool   `mapstructure:"auto_start" json:"auto_start"`
+	Idle               bool   `mapstructure:"idle" json:"idle"`
+	EventRetentionDays int64  `mapstructure:"event_retention_days" json:"event_retention_days"`
 }
 
 type ImageConfig struct {
@@ -131,15 +256,47 @@ func DefaultConfig() Config {
 			RefreshExpireDays: 7,
 		},
 		Upload: UploadConfig{
-			MaxSizeMB: 1024,
+			MaxSizeMB:       1024,
+			ChunkSizeMB:     8,
+			SessionTTLHours: 24,
 		},
 		Minio: MinioConfig{
 			Bucket: "claw-pliers",
 			UseSSL: false,
 		},
+		Storage: StorageConfig{
+			Driver: "minio",
+			Mode:   "required",
+			Root:   "./data/objects",
+		},
+		Trash: TrashConfig{
+			RetentionDays: 30,
+		},
+		Version: VersionConfig{
+			KeepVersions: 10,
+		},
+		Share: ShareConfig{
+			DefaultTTLHours: 7 * 24,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			IP:      RateLimitRule{PerMinute: 600, Burst: 120},
+			Key:     RateLimitRule{PerMinute: 600, Burst: 120},
+			Groups: map[string]RateLimitRule{
+				"auth":  {PerMinute: 20, Burst: 10},
+				"share": {PerMinute: 120, Burst: 30},
+			},
+			Lockout: LockoutConfig{
+				MaxFailures:     10,
+				WindowMinutes:   15,
+				DurationMinutes: 15,
+			},
+		},
 		Mail: MailConfig{
 			Monitoring: MonitoringConfig{
-				PollInterval: "30s",
+				PollInterval:       "30s",
+				Idle:               true,
+				EventRetentionDays: 90,
 			},
 		},
 		Logger: LoggerConfig{
@@ -184,8 +341,9 @@ func Load(path string) (Config, error) {
 
 	overrideWithEnv(&cfg)
 
-	if cfg.Auth.LocalKey == "" {
-		return Config{}, fmt.Errorf("missing auth.local_key in config")
+	// local_key 为可选的管理员密钥，未配置时须启用 JWT 登录，以便管理员登录后创建 API 密钥
+	if cfg.Auth.LocalKey == "" && cfg.Auth.JWTSecret == "" {
+		return Config{}, fmt.Errorf("missing auth.local_key or auth.jwt_secret in config")
 	}
 
 	return cfg, nil
@@ -218,6 +376,32 @@ func loadIncludes(cfg *Config, baseDir string) error {
 			if v.IsSet("upload.max_size_mb") {
 				cfg.Upload.MaxSizeMB = v.GetInt64("upload.max_size_mb")
 			}
+			if v.IsSet("upload.chunk_size_mb") {
+				cfg.Upload.ChunkSizeMB = v.GetInt64("upload.chunk_size_mb")
+			}
+			if v.IsSet("upload.session_ttl_hours") {
+				cfg.Upload.SessionTTLHours = v.GetInt64("upload.session_ttl_hours")
+			}
+			if v.IsSet("trash.retention_days") {
+				cfg.Trash.RetentionDays = v.GetInt64("trash.retention_days")
+			}
+			if v.IsSet("versioning.keep_versions") {
+				cfg.Version.KeepVersions = v.GetInt("versioning.keep_versions")
+			}
+			if v.IsSet("versioning.keep_days") {
+				cfg.Version.KeepDays = v.GetInt64("versioning.keep_days")
+			}
+			if v.IsSet("share.default_ttl_hours") {
+				cfg.Share.DefaultTTLHours = v.GetInt64("share.default_ttl_hours")
+			}
+			if v.IsSet("share.max_ttl_hours") {
+				cfg.Share.MaxTTLHours = v.GetInt64("share.max_ttl_hours")
+			}
+			if v.IsSet("quota") {
+				if err := v.UnmarshalKey("quota", &cfg.Quota); err != nil {
+					return fmt.Errorf("invalid quota config in %s: %w", inc.Path, err)
+				}
+			}
 			if v.IsSet("minio.endpoint") {
 				cfg.Minio.Endpoint = v.GetString("minio.endpoint")
 			}
@@ -236,6 +420,20 @@ func loadIncludes(cfg *Config, baseDir string) error {
 			if v.IsSet("minio.region") {
 				cfg.Minio.Region = v.GetString("minio.region")
 			}
+			if v.IsSet("storage.driver") {
+				cfg.Storage.Driver = v.GetString("storage.driver")
+			}
+			if v.IsSet("storage.mode") {
+				cfg.Storage.Mode = v.GetString("storage.mode")
+			}
+			if v.IsSet("storage.root") {
+				cfg.Storage.Root = v.GetString("storage.root")
+			}
+			if v.IsSet("storage.encryption") {
+				if err := v.UnmarshalKey("storage.encryption", &cfg.Storage.Encryption); err != nil {
+					return fmt.Errorf("invalid storage encryption config in %s: %w", inc.Path, err)
+				}
+			}
 			if v.IsSet("auth.local_key") && cfg.Auth.LocalKey == "" {
 				cfg.Auth.LocalKey = v.GetString("auth.local_key")
 			}
@@ -275,6 +473,15 @@ func loadIncludes(cfg *Config, baseDir string) error {
 			if v.IsSet("monitoring.poll_interval") {
 				cfg.Mail.Monitoring.PollInterval = v.GetString("monitoring.poll_interval")
 			}
+			if v.IsSet("monitoring.auto_start") {
+				cfg.Mail.Monitoring.AutoStart = v.GetBool("monitoring.auto_start")
+			}
+			if v.IsSet("monitoring.idle") {
+				cfg.Mail.Monitoring.Idle = v.GetBool("monitoring.idle")
+			}
+			if v.IsSet("monitoring.event_retention_days") {
+				cfg.Mail.Monitoring.EventRetentionDays = v.GetInt64("monitoring.event_retention_days")
+			}
 
 		case "image":
 			if v.IsSet("libvips.path") {
@@ -314,12 +521,41 @@ func parseAccounts(list []interface{}) []AccountConfig {
 			if en, ok := acc["enabled"].(bool); ok {
 				account.Enabled = en
 			}
+			if server, ok := acc["imap"].(map[string]interface{}); ok {
+				account.IMAP = parseServer(server)
+			}
+			if server, ok := acc["smtp"].(map[string]interface{}); ok {
+				account.SMTP = parseServer(server)
+			}
 			accounts = append(accounts, account)
 		}
 	}
 	return accounts
 }
 
+func parseServer(server map[string]interface{}) MailServerConfig {
+	var result MailServerConfig
+	if h, ok := server["host"].(string); ok {
+		result.Host = h
+	}
+	switch p := server["port"].(type) {
+	case int:
+		result.Port = p
+	case string:
+		result.Port = parseIntValue(p, 0)
+	}
+	if s, ok := server["security"].(string); ok {
+		result.Security = strings.ToLower(s)
+	}
+	if a, ok := server["auth"].(string); ok {
+		result.Auth = strings.ToLower(a)
+	}
+	if u, ok := server["username"].(string); ok {
+		result.Username = u
+	}
+	return result
+}
+
 func overrideWithEnv(cfg *Config) {
 	if value := os.Getenv("CLAWPLIERS_SERVER_PORT"); value != "" {
 		cfg.Server.Port = parseIntValue(value, cfg.Server.Port)
@@ -330,6 +566,18 @@ func overrideWithEnv(cfg *Config) {
 	if value := os.Getenv("CLAWPLIERS_SERVER_PUBLIC_ENDPOINT"); value != "" {
 		cfg.Server.PublicEndpoint = value
 	}
+	if value := os.Getenv("CLAWPLIERS_SERVER_TRUSTED_PROXIES"); value != "" {
+		cfg.Server.TrustedProxies = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if value := os.Getenv("CLAWPLIERS_SERVER_TLS_ENABLED"); value != "" {
+		cfg.Server.TLS.Enabled = parseBoolValue(value, cfg.Server.TLS.Enabled)
+	}
+	if value := os.Getenv("CLAWPLIERS_SERVER_TLS_CERT_FILE"); value != "" {
+		cfg.Server.TLS.CertFile = value
+	}
+	if value := os.Getenv("CLAWPLIERS_SERVER_TLS_KEY_FILE"); value != "" {
+		cfg.Server.TLS.KeyFile = value
+	}
 	if value := os.Getenv("CLAWPLIERS_DATABASE_PATH"); value != "" {
 		cfg.Database.Path = value
 	}
@@ -345,6 +593,12 @@ func overrideWithEnv(cfg *Config) {
 	if value := os.Getenv("CLAWPLIERS_AUTH_ADMIN_PASSWORD"); value != "" {
 		cfg.Auth.AdminPassword = value
 	}
+	if value := os.Getenv("CLAWPLIERS_STORAGE_ENCRYPTION_MASTER_KEY"); value != "" {
+		cfg.Storage.Encryption.MasterKey = value
+	}
+	if value := os.Getenv("CLAWPLIERS_RATE_LIMIT_ENABLED"); value != "" {
+		cfg.RateLimit.Enabled = parseBoolValue(value, cfg.RateLimit.Enabled)
+	}
 	if value := os.Getenv("CLAWPLIERS_MINIO_ENDPOINT"); value != "" {
 		cfg.Minio.Endpoint = value
 	}
@@ -360,12 +614,24 @@ func overrideWithEnv(cfg *Config) {
 	if value := os.Getenv("CLAWPLIERS_MINIO_USE_SSL"); value != "" {
 		cfg.Minio.UseSSL = parseBoolValue(value, cfg.Minio.UseSSL)
 	}
+	if value := os.Getenv("CLAWPLIERS_STORAGE_DRIVER"); value != "" {
+		cfg.Storage.Driver = value
+	}
+	if value := os.Getenv("CLAWPLIERS_STORAGE_MODE"); value != "" {
+		cfg.Storage.Mode = value
+	}
+	if value := os.Getenv("CLAWPLIERS_STORAGE_ROOT"); value != "" {
+		cfg.Storage.Root = value
+	}
 	if value := os.Getenv("CLAWPLIERS_MAIL_WEBHOOK_URL"); value != "" {
 		cfg.Mail.Webhook.URL = value
 	}
 	if value := os.Getenv("CLAWPLIERS_MAIL_WEBHOOK_TOKEN"); value != "" {
 		cfg.Mail.Webhook.Token = value
 	}
+	if value := os.Getenv("CLAWPLIERS_MAIL_MONITORING_AUTO_START"); value != "" {
+		cfg.Mail.Monitoring.AutoStart = parseBoolValue(value, cfg.Mail.Monitoring.AutoStart)
+	}
 	if value := os.Getenv("CLAWPLIERS_OCR_API_KEY"); value != "" {
 		cfg.Image.OCR.APIKey = value
 	}
@@ -1,12 +1,15 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -19,13 +22,17 @@ type DB struct {
 }
 
 type Folder struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	FolderID  string    `gorm:"column:folder_id;uniqueIndex" json:"folder_id"`
-	Name      string    `gorm:"column:name" json:"name"`
-	ParentID  *string   `gorm:"column:parent_id" json:"parent_id"`
-	CreatedBy string    `gorm:"column:created_by" json:"created_by"`
-	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	FolderID  string         `gorm:"column:folder_id;uniqueIndex" json:"folder_id"`
+	Name      string         `gorm:"column:name" json:"name"`
+	ParentID  *string        `gorm:"column:parent_id" json:"parent_id"`
+	CreatedBy string         `gorm:"column:created_by" json:"created_by"`
+	CreatedAt time.Time      `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at"`
+	TrashPath string         `gorm:"column:trash_path" json:"trash_path"`
+	// TrashRoot 为随上级文件夹一起移入回收站时该文件夹的 ID，这样的项不单独出现在回收站中
+	TrashRoot string `gorm:"column:trash_root;index" json:"trash_root"`
 }
 
 func (Folder) TableName() string {
@@ -33,26 +40,91 @@ func (Folder) TableName() string {
 }
 
 type File struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	FileID       string    `gorm:"column:file_id;uniqueIndex" json:"file_id"`
-	OriginalName string    `gorm:"column:original_name" json:"original_name"`
-	ObjectKey    string    `gorm:"column:object_key" json:"object_key"`
-	Size         int64     `gorm:"column:size" json:"size"`
-	MimeType     string    `gorm:"column:mime_type" json:"mime_type"`
-	FolderID     *string   `gorm:"column:folder_id" json:"folder_id"`
-	CreatedBy    string    `gorm:"column:created_by" json:"created_by"`
-	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"column:updated_at" json:"updated_at"`
-	Metadata     string    `gorm:"column:metadata;type:json" json:"metadata"`
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	FileID       string         `gorm:"column:file_id;uniqueIndex" json:"file_id"`
+	OriginalName string         `gorm:"column:original_name" json:"original_name"`
+	ObjectKey    string         `gorm:"column:object_key" json:"object_key"`
+	Size         int64          `gorm:"column:size" json:"size"`
+	MimeType     string         `gorm:"column:mime_type" json:"mime_type"`
+	SHA256       string         `gorm:"column:sha256;index" json:"sha256"`
+	FolderID     *string        `gorm:"column:folder_id" json:"folder_id"`
+	CreatedBy    string         `gorm:"column:created_by" json:"created_by"`
+	CreatedAt    time.Time      `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt    time.Time      `gorm:"column:updated_at" json:"updated_at"`
+	Version      int            `gorm:"column:version;default:1" json:"version"`
+	UpdatedBy    string         `gorm:"column:updated_by" json:"updated_by"`
+	Metadata     string         `gorm:"column:metadata;type:json" json:"metadata"`
+	DeletedAt    gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at"`
+	TrashPath    string         `gorm:"column:trash_path" json:"trash_path"`
+	// TrashRoot 为随所在文件夹一起移入回收站时该文件夹的 ID，这样的文件不单独出现在回收站中
+	TrashRoot string `gorm:"column:trash_root;index" json:"trash_root"`
+	// IntegrityError 由 fsck --repair 写入，记录对象缺失或内容不一致等问题，为空表示正常
+	IntegrityError string `gorm:"column:integrity_error" json:"integrity_error"`
 }
 
 func (File) TableName() string {
 	return "files"
 }
 
+// FileVersion 记录文件被覆盖前的历史内容，当前版本仍保存在 files 表中；每个历史版本持有其对象的一个引用
+type FileVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	FileID     string    `gorm:"column:file_id;uniqueIndex:idx_file_versions_file_version" json:"file_id"`
+	Version    int       `gorm:"column:version;uniqueIndex:idx_file_versions_file_version" json:"version"`
+	ObjectKey  string    `gorm:"column:object_key;index" json:"object_key"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	MimeType   string    `gorm:"column:mime_type" json:"mime_type"`
+	SHA256     string    `gorm:"column:sha256" json:"sha256"`
+	CreatedBy  string    `gorm:"column:created_by" json:"created_by"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+	ArchivedAt time.Time `gorm:"column:archived_at;index" json:"archived_at"`
+}
+
+func (FileVersion) TableName() string {
+	return "file_versions"
+}
+
+// StorageObject 记录按内容去重后的存储对象，RefCount 为引用它的文件数
+type StorageObject struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SHA256    string    `gorm:"column:sha256;uniqueIndex" json:"sha256"`
+	ObjectKey string    `gorm:"column:object_key;uniqueIndex" json:"object_key"`
+	Size      int64     `gorm:"column:size" json:"size"`
+	MimeType  string    `gorm:"column:mime_type" json:"mime_type"`
+	RefCount  int64     `gorm:"column:ref_count" json:"ref_count"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (StorageObject) TableName() string {
+	return "storage_objects"
+}
+
+// DataKey 记录加密存储对象的数据密钥，WrappedKey 为用主密钥 KeyID 加密后的数据密钥；
+// 没有记录的对象以明文存储。Format 为分段加密格式，Size 为对象的明文大小，读取时用于校验密文是否被截断，
+// 分片上传完成前为空
+type DataKey struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ObjectKey  string    `gorm:"column:object_key;uniqueIndex" json:"object_key"`
+	KeyID      string    `gorm:"column:key_id;index" json:"key_id"`
+	WrappedKey string    `gorm:"column:wrapped_key" json:"-"`
+	Format     int       `gorm:"column:format;not null;default:0" json:"format"`
+	Size       *int64    `gorm:"column:size" json:"size"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (DataKey) TableName() string {
+	return "data_keys"
+}
+
+// RefreshToken 记录签发的刷新令牌，Token 保存令牌的 SHA-256 而非明文；
+// 同一次登录轮换出的令牌共享 Family，旧令牌被重复使用时整个 Family 一并吊销
 type RefreshToken struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Token     string    `gorm:"column:token;uniqueIndex" json:"token"`
+	Family    string    `gorm:"column:family;index" json:"family"`
+	Subject   string    `gorm:"column:subject" json:"subject"`
 	ExpiresAt time.Time `gorm:"column:expires_at" json:"expires_at"`
 	IsRevoked bool      `gorm:"column:is_revoked;default:false" json:"is_revoked"`
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
@@ -62,33 +134,188 @@ func (RefreshToken) TableName() string {
 	return "refresh_tokens"
 }
 
+// User 为可登录的账号，Role 为 admin、editor 或 viewer；PasswordHash 为 bcrypt 哈希
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"column:username;uniqueIndex" json:"username"`
+	PasswordHash string    `gorm:"column:password_hash" json:"-"`
+	Role         string    `gorm:"column:role" json:"role"`
+	Disabled     bool      `gorm:"column:disabled;default:false" json:"disabled"`
+	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// FolderGrant 授予用户对文件夹的访问权限，子文件夹继承最近一级上级的授权；FolderID 为空串表示根目录
+type FolderGrant struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	FolderID   string    `gorm:"column:folder_id;uniqueIndex:idx_folder_grants_folder_user" json:"folder_id"`
+	Username   string    `gorm:"column:username;uniqueIndex:idx_folder_grants_folder_user;index" json:"username"`
+	Permission string    `gorm:"column:permission" json:"permission"`
+	CreatedBy  string    `gorm:"column:created_by" json:"created_by"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (FolderGrant) TableName() string {
+	return "folder_grants"
+}
+
+// APIKey 为具名 API 密钥，KeyHash 保存完整密钥的 SHA-256 而非明文，KeyID 为密钥中可公开的部分，用于查找记录。
+// 密钥以 Owner 的身份访问，并受 Scopes（逗号分隔）和 PathPrefixes（逗号分隔，空表示不限制）进一步限制
+type APIKey struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	KeyID        string     `gorm:"column:key_id;uniqueIndex" json:"key_id"`
+	Name         string     `gorm:"column:name" json:"name"`
+	KeyHash      string     `gorm:"column:key_hash" json:"-"`
+	Owner        string     `gorm:"column:owner;index" json:"owner"`
+	Scopes       string     `gorm:"column:scopes" json:"scopes"`
+	PathPrefixes string     `gorm:"column:path_prefixes" json:"path_prefixes"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt   *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	RevokedAt    *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// AuditLog 为一次操作的审计记录，Path 为操作目标的路径，与文件无关的操作为空
 type AuditLog struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Action    string    `gorm:"column:action" json:"action"`
+	Action    string    `gorm:"column:action;index" json:"action"`
 	FileID    *string   `gorm:"column:file_id" json:"file_id"`
-	Actor     string    `gorm:"column:actor" json:"actor"`
+	Path      string    `gorm:"column:path;index" json:"path"`
+	Actor     string    `gorm:"column:actor;index" json:"actor"`
 	IPAddress *string   `gorm:"column:ip_address" json:"ip_address"`
 	Status    string    `gorm:"column:status" json:"status"`
 	Message   string    `gorm:"column:message;type:text" json:"message"`
-	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`
+}
+
+// AuditFilter 为审计日志的查询条件，零值字段不参与筛选；PathPrefix 匹配该路径本身及其下的全部路径
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	PathPrefix string
+	Status     string
+	Since      *time.Time
+	Until      *time.Time
 }
 
 func (AuditLog) TableName() string {
 	return "audit_logs"
 }
 
+// ShareLink 为文件或文件夹的公开链接，FileID 与 FolderID 只设置其一。ExpiresAt 为 nil 表示永不过期；PasswordHash 为 bcrypt 哈希，空表示无需密码；
+// MaxDownloads 为 0 表示不限制下载次数，DownloadCount 和 LastAccessedAt 记录链接的访问情况。
+// Upload 为 true 时是只能向 FolderID 上传、不能查看其内容的收集链接，此时下载次数字段记录上传次数，
+// MaxSizeBytes 为单个文件的大小上限（0 表示只受全局上限约束），AllowedTypes 为逗号分隔的允许 MIME 类型
 type ShareLink struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Token          string     `gorm:"column:token;uniqueIndex" json:"token"`
+	FileID         string     `gorm:"column:file_id;index" json:"file_id"`
+	FolderID       string     `gorm:"column:folder_id;index" json:"folder_id"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	PasswordHash   string     `gorm:"column:password_hash" json:"-"`
+	MaxDownloads   int        `gorm:"column:max_downloads;default:0" json:"max_downloads"`
+	DownloadCount  int        `gorm:"column:download_count;default:0" json:"download_count"`
+	Disposition    string     `gorm:"column:disposition" json:"disposition"`
+	Upload         bool       `gorm:"column:upload;default:false" json:"upload"`
+	MaxSizeBytes   int64      `gorm:"column:max_size_bytes;default:0" json:"max_size_bytes"`
+	AllowedTypes   string     `gorm:"column:allowed_types" json:"allowed_types"`
+	LastAccessedAt *time.Time `gorm:"column:last_accessed_at" json:"last_accessed_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+	CreatedBy      string     `gorm:"column:created_by" json:"created_by"`
+	Status         string     `gorm:"column:status" json:"status"`
+}
+
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+type UploadSession struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Token     string    `gorm:"column:token;uniqueIndex" json:"token"`
+	SessionID string    `gorm:"column:session_id;uniqueIndex" json:"session_id"`
+	UploadID  string    `gorm:"column:upload_id" json:"upload_id"`
+	ObjectKey string    `gorm:"column:object_key" json:"object_key"`
 	FileID    string    `gorm:"column:file_id" json:"file_id"`
-	ExpiresAt time.Time `gorm:"column:expires_at" json:"expires_at"`
-	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	FileName  string    `gorm:"column:file_name" json:"file_name"`
+	FolderID  *string   `gorm:"column:folder_id" json:"folder_id"`
+	Path      string    `gorm:"column:path" json:"path"`
+	Size      int64     `gorm:"column:size" json:"size"`
+	ChunkSize int64     `gorm:"column:chunk_size" json:"chunk_size"`
+	Status    string    `gorm:"column:status;index" json:"status"`
+	MimeType  string    `gorm:"column:mime_type" json:"mime_type"`
 	CreatedBy string    `gorm:"column:created_by" json:"created_by"`
-	Status    string    `gorm:"column:status" json:"status"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index" json:"expires_at"`
 }
 
-func (ShareLink) TableName() string {
-	return "share_links"
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+type UploadPart struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SessionID  string    `gorm:"column:session_id;uniqueIndex:idx_upload_parts_session_part" json:"session_id"`
+	PartNumber int       `gorm:"column:part_number;uniqueIndex:idx_upload_parts_session_part" json:"part_number"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	ETag       string    `gorm:"column:etag" json:"etag"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (UploadPart) TableName() string {
+	return "upload_parts"
+}
+
+// MailAccountState 记录邮件监听在账户 INBOX 上的处理进度，重启后从 LastUID 之后继续；
+// UIDValidity 变化说明服务器重新编号了 UID，此时需要重新取基线
+type MailAccountState struct {
+	Email       string     `gorm:"column:email;primaryKey" json:"email"`
+	UIDValidity uint32     `gorm:"column:uid_validity" json:"uid_validity"`
+	LastUID     uint32     `gorm:"column:last_uid" json:"last_uid"`
+	LastError   string     `gorm:"column:last_error;type:text" json:"last_error"`
+	LastPollAt  *time.Time `gorm:"column:last_poll_at" json:"last_poll_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (MailAccountState) TableName() string {
+	return "mail_accounts_state"
+}
+
+// MailEvent 为监听处理过的一封新邮件。同一账户的 UIDValidity 和 UID 唯一，
+// 处理前先写入记录，重启后再次取到同一封邮件时据此跳过，不会重复推送
+type MailEvent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Account     string    `gorm:"column:account;uniqueIndex:idx_mail_events_message;index" json:"account"`
+	UIDValidity uint32    `gorm:"column:uid_validity;uniqueIndex:idx_mail_events_message" json:"uid_validity"`
+	UID         uint32    `gorm:"column:uid;uniqueIndex:idx_mail_events_message" json:"uid"`
+	MessageID   string    `gorm:"column:message_id" json:"message_id"`
+	From        string    `gorm:"column:from_addr" json:"from"`
+	To          string    `gorm:"column:to_addr" json:"to"`
+	Subject     string    `gorm:"column:subject" json:"subject"`
+	Summary     string    `gorm:"column:summary;type:text" json:"summary"`
+	ReceivedAt  time.Time `gorm:"column:received_at" json:"received_at"`
+	Status      string    `gorm:"column:status;index" json:"status"`
+	Error       string    `gorm:"column:error;type:text" json:"error"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`
+}
+
+// MailEventFilter 为邮件事件的查询条件，零值字段不参与筛选
+type MailEventFilter struct {
+	Account string
+	Status  string
+	Since   *time.Time
+	Until   *time.Time
+}
+
+func (MailEvent) TableName() string {
+	return "mail_events"
 }
 
 func Open(cfg Config) (*DB, error) {
@@ -112,14 +339,64 @@ func Open(cfg Config) (*DB, error) {
 	return &DB{db}, nil
 }
 
+func (db *DB) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 func migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&Folder{},
 		&File{},
+		&FileVersion{},
+		&StorageObject{},
+		&DataKey{},
 		&RefreshToken{},
+		&User{},
+		&FolderGrant{},
+		&APIKey{},
 		&AuditLog{},
 		&ShareLink{},
+		&UploadSession{},
+		&UploadPart{},
+		&MailAccountState{},
+		&MailEvent{},
 	)
+	if err != nil {
+		return err
+	}
+	if err := backfillDataKeySizes(db); err != nil {
+		return err
+	}
+	return trashOrphans(db)
+}
+
+// backfillDataKeySizes 为早期版本写入、未记录明文大小的数据密钥补上存储对象记录中的大小
+func backfillDataKeySizes(db *gorm.DB) error {
+	return db.Exec(`UPDATE data_keys SET size = (SELECT o.size FROM storage_objects o WHERE o.object_key = data_keys.object_key)
+		WHERE size IS NULL AND EXISTS (SELECT 1 FROM storage_objects o WHERE o.object_key = data_keys.object_key)`).Error
+}
+
+// trashOrphans 把位于回收站中文件夹下、但仍未删除的项一并移入回收站。
+// 早期版本删除文件夹时只标记文件夹本身，其中的内容仍可访问
+func trashOrphans(db *gorm.DB) error {
+	const parentDeleted = `SELECT p.deleted_at FROM folders p WHERE p.folder_id = %[1]s AND p.deleted_at IS NOT NULL`
+	const parentRoot = `SELECT CASE WHEN COALESCE(p.trash_root, '') = '' THEN p.folder_id ELSE p.trash_root END FROM folders p WHERE p.folder_id = %[1]s`
+	for {
+		result := db.Exec(fmt.Sprintf(`UPDATE folders SET deleted_at = (`+parentDeleted+`), trash_root = (`+parentRoot+`)
+			WHERE deleted_at IS NULL AND EXISTS (`+parentDeleted+`)`, "folders.parent_id"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			break
+		}
+	}
+	return db.Exec(fmt.Sprintf(`UPDATE files SET deleted_at = (`+parentDeleted+`), trash_root = (`+parentRoot+`)
+		WHERE deleted_at IS NULL AND EXISTS (`+parentDeleted+`)`, "files.folder_id")).Error
 }
 
 func (db *DB) CreateFile(record *File) error {
@@ -163,13 +440,348 @@ func (db *DB) ListFiles(limit, offset int, order, keyword string) ([]File, int64
 	return files, total, err
 }
 
-func (db *DB) DeleteFile(fileID string) (File, error) {
-	file, err := db.GetFile(fileID)
+// CreateFileWithObject 创建文件记录并登记其存储对象；已有相同 SHA-256 的对象时复用该对象并增加引用计数，
+// 返回的 reused 为 true 表示调用方新写入的对象已是多余的
+func (db *DB) CreateFileWithObject(record *File, object StorageObject) (reused bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		reused, err = createFileWithObject(tx, record, object)
+		return err
+	})
+	return reused, err
+}
+
+func createFileWithObject(tx *gorm.DB, record *File, object StorageObject) (bool, error) {
+	reused := false
+	var existing StorageObject
+	findErr := tx.Where("sha256 = ?", object.SHA256).First(&existing).Error
+	switch {
+	case findErr == nil:
+		if err := acquireObject(tx, &existing, record); err != nil {
+			return false, err
+		}
+		reused = true
+	case errors.Is(findErr, gorm.ErrRecordNotFound):
+		object.RefCount = 1
+		if err := tx.Create(&object).Error; err != nil {
+			return false, err
+		}
+	default:
+		return false, findErr
+	}
+	return reused, tx.Create(record).Error
+}
+
+// CreateFileFromHash 仅凭内容哈希创建文件记录，对象不存在时返回 gorm.ErrRecordNotFound
+func (db *DB) CreateFileFromHash(record *File) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing StorageObject
+		if err := tx.Where("sha256 = ?", record.SHA256).First(&existing).Error; err != nil {
+			return err
+		}
+		if err := acquireObject(tx, &existing, record); err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+}
+
+func acquireObject(tx *gorm.DB, object *StorageObject, record *File) error {
+	record.ObjectKey = object.ObjectKey
+	record.Size = object.Size
+	record.MimeType = object.MimeType
+	record.SHA256 = object.SHA256
+	return tx.Model(object).Updates(map[string]interface{}{
+		"ref_count":  gorm.Expr("ref_count + 1"),
+		"updated_at": NowRFC3339(),
+	}).Error
+}
+
+// EachFile 按批遍历全部文件记录
+func (db *DB) EachFile(batchSize int, fn func([]File) error) error {
+	var batch []File
+	return db.Unscoped().Order("id ASC").FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (db *DB) SetFileIntegrityError(fileID, message string) error {
+	return db.Model(&File{}).Where("file_id = ?", fileID).Update("integrity_error", message).Error
+}
+
+func (db *DB) ListStorageObjects() ([]StorageObject, error) {
+	var objects []StorageObject
+	err := db.Order("id ASC").Find(&objects).Error
+	return objects, err
+}
+
+func (db *DB) SetStorageObjectRefCount(objectKey string, refCount int64) error {
+	return db.Model(&StorageObject{}).Where("object_key = ?", objectKey).
+		Updates(map[string]interface{}{"ref_count": refCount, "updated_at": NowRFC3339()}).Error
+}
+
+func (db *DB) DeleteStorageObject(objectKey string) error {
+	return db.Where("object_key = ?", objectKey).Delete(&StorageObject{}).Error
+}
+
+func (db *DB) GetStorageObjectByHash(sha256 string) (StorageObject, error) {
+	var object StorageObject
+	err := db.Where("sha256 = ?", sha256).First(&object).Error
+	return object, err
+}
+
+// ListFileFoldersByHash 返回当前内容为 sha256 的未删除文件所在的文件夹，每个文件夹一条，FolderID 为 nil 表示根目录
+func (db *DB) ListFileFoldersByHash(sha256 string) ([]File, error) {
+	var files []File
+	err := db.Model(&File{}).Distinct("folder_id").Where("sha256 = ?", sha256).Find(&files).Error
+	return files, err
+}
+
+// SaveDataKey 保存对象的数据密钥，同一对象键已有记录时覆盖
+func (db *DB) SaveDataKey(record *DataKey) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"key_id", "wrapped_key", "format", "size", "updated_at"}),
+	}).Create(record).Error
+}
+
+func (db *DB) GetDataKey(objectKey string) (DataKey, error) {
+	var record DataKey
+	err := db.Where("object_key = ?", objectKey).First(&record).Error
+	return record, err
+}
+
+func (db *DB) DeleteDataKey(objectKey string) error {
+	return db.Where("object_key = ?", objectKey).Delete(&DataKey{}).Error
+}
+
+// RenameDataKey 在对象被移动（如移入隔离区）后让数据密钥跟随新的对象键
+func (db *DB) RenameDataKey(objectKey, target string) error {
+	return db.Model(&DataKey{}).Where("object_key = ?", objectKey).
+		Updates(map[string]interface{}{"object_key": target, "updated_at": NowRFC3339()}).Error
+}
+
+// SetDataKeySize 记录对象的明文大小，用于分片上传完成后补上大小
+func (db *DB) SetDataKeySize(objectKey string, size int64) error {
+	return db.Model(&DataKey{}).Where("object_key = ?", objectKey).
+		Updates(map[string]interface{}{"size": size, "updated_at": NowRFC3339()}).Error
+}
+
+// RenameDataKeyID 把由 fromKeyID 加密的数据密钥改记为 keyID，用于主密钥标识的计算方式变化后迁移，返回更新的数量
+func (db *DB) RenameDataKeyID(fromKeyID, keyID string) (int64, error) {
+	result := db.Model(&DataKey{}).Where("key_id = ?", fromKeyID).
+		Updates(map[string]interface{}{"key_id": keyID, "updated_at": NowRFC3339()})
+	return result.RowsAffected, result.Error
+}
+
+// RewrapDataKey 替换数据密钥的加密结果，仅当它仍由 fromKeyID 加密时生效，返回是否已更新
+func (db *DB) RewrapDataKey(id uint, fromKeyID, keyID, wrappedKey string) (bool, error) {
+	result := db.Model(&DataKey{}).Where("id = ? AND key_id = ?", id, fromKeyID).
+		Updates(map[string]interface{}{"key_id": keyID, "wrapped_key": wrappedKey, "updated_at": NowRFC3339()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListDataKeysNotWrappedBy 按 ID 顺序返回 afterID 之后不由 keyID 加密的数据密钥，用于分批轮换
+func (db *DB) ListDataKeysNotWrappedBy(keyID string, afterID uint, limit int) ([]DataKey, error) {
+	var records []DataKey
+	err := db.Where("key_id <> ? AND id > ?", keyID, afterID).Order("id ASC").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+func (db *DB) CountDataKeys() (int64, error) {
+	var count int64
+	err := db.Model(&DataKey{}).Count(&count).Error
+	return count, err
+}
+
+// CountDataKeysByKeyID 按主密钥统计数据密钥数量
+func (db *DB) CountDataKeysByKeyID() (map[string]int64, error) {
+	var rows []struct {
+		KeyID string
+		Count int64
+	}
+	err := db.Model(&DataKey{}).Select("key_id, count(*) AS count").Group("key_id").Scan(&rows).Error
 	if err != nil {
-		return file, err
+		return nil, err
 	}
-	err = db.Delete(&file).Error
-	return file, err
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.KeyID] = r.Count
+	}
+	return counts, nil
+}
+
+// PurgeFile 彻底删除文件记录（包括回收站中的）及其历史版本并释放对象引用，released 为引用归零、调用方应删除的对象
+func (db *DB) PurgeFile(fileID string) (file File, released []string, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("file_id = ?", fileID).First(&file).Error; err != nil {
+			return err
+		}
+
+		var versions []FileVersion
+		if err := tx.Where("file_id = ?", fileID).Find(&versions).Error; err != nil {
+			return err
+		}
+		keys := []string{file.ObjectKey}
+		for _, v := range versions {
+			keys = append(keys, v.ObjectKey)
+		}
+
+		if err := tx.Where("file_id = ?", fileID).Delete(&FileVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&file).Error; err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			ok, err := releaseObject(tx, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				released = append(released, key)
+			}
+		}
+		return nil
+	})
+	return file, released, err
+}
+
+// ReplaceFileContent 将文件当前内容存为历史版本，再让文件指向 object 描述的新内容并递增版本号。
+// 已有相同 SHA-256 的对象时复用该对象，返回的 reused 为 true 表示调用方新写入的对象已是多余的；
+// object.ObjectKey 为空表示仅凭哈希覆盖，内容不存在时返回 gorm.ErrRecordNotFound
+func (db *DB) ReplaceFileContent(fileID string, object StorageObject, updatedBy string) (file File, reused bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", fileID).First(&file).Error; err != nil {
+			return err
+		}
+
+		var existing StorageObject
+		findErr := tx.Where("sha256 = ?", object.SHA256).First(&existing).Error
+		switch {
+		case findErr == nil:
+			if err := tx.Model(&existing).Updates(map[string]interface{}{
+				"ref_count":  gorm.Expr("ref_count + 1"),
+				"updated_at": NowRFC3339(),
+			}).Error; err != nil {
+				return err
+			}
+			object = existing
+			reused = true
+		case errors.Is(findErr, gorm.ErrRecordNotFound) && object.ObjectKey != "":
+			object.RefCount = 1
+			if err := tx.Create(&object).Error; err != nil {
+				return err
+			}
+		default:
+			return findErr
+		}
+
+		// 当前内容的引用转移给历史版本
+		createdBy := file.UpdatedBy
+		if createdBy == "" {
+			createdBy = file.CreatedBy
+		}
+		version := &FileVersion{
+			FileID:     file.FileID,
+			Version:    file.Version,
+			ObjectKey:  file.ObjectKey,
+			Size:       file.Size,
+			MimeType:   file.MimeType,
+			SHA256:     file.SHA256,
+			CreatedBy:  createdBy,
+			CreatedAt:  file.UpdatedAt,
+			ArchivedAt: NowRFC3339(),
+		}
+		if version.Version < 1 {
+			version.Version = 1
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+
+		file.ObjectKey = object.ObjectKey
+		file.Size = object.Size
+		file.MimeType = object.MimeType
+		file.SHA256 = object.SHA256
+		file.Version = version.Version + 1
+		file.UpdatedBy = updatedBy
+		file.UpdatedAt = NowRFC3339()
+		file.IntegrityError = ""
+		return tx.Model(&File{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+			"object_key":      file.ObjectKey,
+			"size":            file.Size,
+			"mime_type":       file.MimeType,
+			"sha256":          file.SHA256,
+			"version":         file.Version,
+			"updated_by":      file.UpdatedBy,
+			"updated_at":      file.UpdatedAt,
+			"integrity_error": "",
+		}).Error
+	})
+	return file, reused, err
+}
+
+// ListFileVersions 按版本号倒序返回文件的历史版本
+func (db *DB) ListFileVersions(fileID string) ([]FileVersion, error) {
+	var versions []FileVersion
+	err := db.Where("file_id = ?", fileID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+func (db *DB) GetFileVersion(fileID string, version int) (FileVersion, error) {
+	var record FileVersion
+	err := db.Where("file_id = ? AND version = ?", fileID, version).First(&record).Error
+	return record, err
+}
+
+// ListFileVersionsArchivedBefore 返回在 cutoff 之前被覆盖的历史版本
+func (db *DB) ListFileVersionsArchivedBefore(cutoff time.Time) ([]FileVersion, error) {
+	var versions []FileVersion
+	err := db.Where("archived_at < ?", cutoff).Order("id ASC").Find(&versions).Error
+	return versions, err
+}
+
+// ListFileVersionObjectKeys 返回所有历史版本引用的对象键，供 fsck 统计引用
+func (db *DB) ListFileVersionObjectKeys() ([]string, error) {
+	var keys []string
+	err := db.Model(&FileVersion{}).Pluck("object_key", &keys).Error
+	return keys, err
+}
+
+// DeleteFileVersion 删除历史版本并释放对象引用，released 为 true 时调用方应删除底层对象
+func (db *DB) DeleteFileVersion(id uint) (version FileVersion, released bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&version, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&version).Error; err != nil {
+			return err
+		}
+		released, err = releaseObject(tx, version.ObjectKey)
+		return err
+	})
+	return version, released, err
+}
+
+// releaseObject 减少对象引用计数，归零时删除对象记录；未登记的旧对象视为独占
+func releaseObject(tx *gorm.DB, objectKey string) (bool, error) {
+	var object StorageObject
+	err := tx.Where("object_key = ?", objectKey).First(&object).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if object.RefCount > 1 {
+		return false, tx.Model(&object).Updates(map[string]interface{}{
+			"ref_count":  gorm.Expr("ref_count - 1"),
+			"updated_at": NowRFC3339(),
+		}).Error
+	}
+	return true, tx.Delete(&object).Error
 }
 
 func (db *DB) CreateRefreshToken(record *RefreshToken) error {
@@ -190,6 +802,153 @@ func (db *DB) RevokeAllRefreshTokens() error {
 	return db.Model(&RefreshToken{}).Where("1=1").Update("is_revoked", true).Error
 }
 
+// RevokeRefreshTokenFamily 吊销同一次登录轮换出的全部刷新令牌
+func (db *DB) RevokeRefreshTokenFamily(family string) error {
+	return db.Model(&RefreshToken{}).Where("family = ?", family).Update("is_revoked", true).Error
+}
+
+// RotateRefreshToken 在一个事务中吊销旧令牌并登记新令牌；旧令牌已被吊销（即被重复使用）时返回 false 且不登记新令牌
+func (db *DB) RotateRefreshToken(oldToken string, next *RefreshToken) (rotated bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&RefreshToken{}).Where("token = ? AND is_revoked = ?", oldToken, false).Update("is_revoked", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		rotated = true
+		return tx.Create(next).Error
+	})
+	return rotated, err
+}
+
+// DeleteExpiredRefreshTokens 删除已过期的刷新令牌
+func (db *DB) DeleteExpiredRefreshTokens(now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeUserRefreshTokens 吊销用户的全部刷新令牌
+func (db *DB) RevokeUserRefreshTokens(username string) error {
+	return db.Model(&RefreshToken{}).Where("subject = ?", username).Update("is_revoked", true).Error
+}
+
+func (db *DB) CreateUser(record *User) error {
+	return db.Create(record).Error
+}
+
+func (db *DB) GetUser(username string) (User, error) {
+	var user User
+	err := db.Where("username = ?", username).First(&user).Error
+	return user, err
+}
+
+func (db *DB) ListUsers() ([]User, error) {
+	var users []User
+	err := db.Order("username ASC").Find(&users).Error
+	return users, err
+}
+
+func (db *DB) UpdateUser(username string, updates map[string]interface{}) error {
+	updates["updated_at"] = NowRFC3339()
+	return db.Model(&User{}).Where("username = ?", username).Updates(updates).Error
+}
+
+// DeleteUser 删除用户及其全部文件夹授权，并吊销其 API 密钥
+func (db *DB) DeleteUser(username string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("username = ?", username).Delete(&FolderGrant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&APIKey{}).Where("owner = ? AND revoked_at IS NULL", username).
+			Update("revoked_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+		result := tx.Where("username = ?", username).Delete(&User{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
+
+// CountActiveAdmins 返回未禁用的管理员数量
+func (db *DB) CountActiveAdmins() (int64, error) {
+	var count int64
+	err := db.Model(&User{}).Where("role = ? AND disabled = ?", "admin", false).Count(&count).Error
+	return count, err
+}
+
+// SetFolderGrant 设置用户对文件夹的权限，已有授权时覆盖
+func (db *DB) SetFolderGrant(record *FolderGrant) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("folder_id = ? AND username = ?", record.FolderID, record.Username).Delete(&FolderGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+}
+
+func (db *DB) DeleteFolderGrant(folderID, username string) error {
+	result := db.Where("folder_id = ? AND username = ?", folderID, username).Delete(&FolderGrant{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// ListFolderGrants 返回文件夹上的授权，folderID 为 nil 时返回全部授权
+func (db *DB) ListFolderGrants(folderID *string) ([]FolderGrant, error) {
+	var grants []FolderGrant
+	query := db.Order("folder_id ASC, username ASC")
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+	err := query.Find(&grants).Error
+	return grants, err
+}
+
+func (db *DB) ListUserGrants(username string) ([]FolderGrant, error) {
+	var grants []FolderGrant
+	err := db.Where("username = ?", username).Find(&grants).Error
+	return grants, err
+}
+
+func (db *DB) CreateAPIKey(record *APIKey) error {
+	return db.Create(record).Error
+}
+
+func (db *DB) GetAPIKey(keyID string) (APIKey, error) {
+	var key APIKey
+	err := db.Where("key_id = ?", keyID).First(&key).Error
+	return key, err
+}
+
+// ListAPIKeys 返回 owner 的 API 密钥，owner 为 nil 时返回全部密钥
+func (db *DB) ListAPIKeys(owner *string) ([]APIKey, error) {
+	var keys []APIKey
+	query := db.Order("created_at DESC")
+	if owner != nil {
+		query = query.Where("owner = ?", *owner)
+	}
+	err := query.Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey 吊销尚未吊销的 API 密钥，密钥不存在或已吊销时返回 gorm.ErrRecordNotFound
+func (db *DB) RevokeAPIKey(keyID string, now time.Time) error {
+	result := db.Model(&APIKey{}).Where("key_id = ? AND revoked_at IS NULL", keyID).Update("revoked_at", now)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (db *DB) TouchAPIKey(keyID string, now time.Time) error {
+	return db.Model(&APIKey{}).Where("key_id = ?", keyID).Update("last_used_at", now).Error
+}
+
 func (db *DB) CreateShareLink(link *ShareLink) error {
 	return db.Create(link).Error
 }
@@ -200,14 +959,64 @@ func (db *DB) GetShareLink(token string) (ShareLink, error) {
 	return link, err
 }
 
+// GetActiveShareLink 返回文件最新的可用分享链接：未吊销、未过期且未达到下载次数上限
 func (db *DB) GetActiveShareLink(fileID string, now time.Time) (ShareLink, error) {
 	var link ShareLink
-	err := db.Where("file_id = ? AND status = ? AND expires_at > ?", fileID, "active", now).
+	err := db.Where("file_id = ? AND status = ?", fileID, "active").
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads = 0 OR download_count < max_downloads").
 		Order("created_at DESC").
 		First(&link).Error
 	return link, err
 }
 
+// ListShareLinks 按文件、文件夹和创建者筛选分享链接，参数为 nil 时不按该项筛选
+func (db *DB) ListShareLinks(fileID, folderID, createdBy *string) ([]ShareLink, error) {
+	var links []ShareLink
+	query := db.Order("created_at DESC")
+	if fileID != nil {
+		query = query.Where("file_id = ?", *fileID)
+	}
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+	if createdBy != nil {
+		query = query.Where("created_by = ?", *createdBy)
+	}
+	err := query.Find(&links).Error
+	return links, err
+}
+
+// RevokeShareLink 吊销分享链接，链接不存在或已吊销时返回 gorm.ErrRecordNotFound
+func (db *DB) RevokeShareLink(token string) error {
+	result := db.Model(&ShareLink{}).Where("token = ? AND status = ?", token, "active").Update("status", "revoked")
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// CountShareDownload 在未达到下载次数上限时将下载次数加一，返回是否计数成功
+func (db *DB) CountShareDownload(token string, now time.Time) (bool, error) {
+	result := db.Model(&ShareLink{}).
+		Where("token = ? AND (max_downloads = 0 OR download_count < max_downloads)", token).
+		Updates(map[string]interface{}{
+			"download_count":   gorm.Expr("download_count + 1"),
+			"last_accessed_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RefundShareDownload 退还一次已计入的次数，用于占用次数后操作失败的情况
+func (db *DB) RefundShareDownload(token string) error {
+	return db.Model(&ShareLink{}).Where("token = ? AND download_count > 0", token).
+		Update("download_count", gorm.Expr("download_count - 1")).Error
+}
+
+func (db *DB) TouchShareLink(token string, now time.Time) error {
+	return db.Model(&ShareLink{}).Where("token = ?", token).Update("last_accessed_at", now).Error
+}
+
 func (db *DB) CreateFolder(record *Folder) error {
 	return db.Create(record).Error
 }
@@ -231,8 +1040,25 @@ func (db *DB) GetFolderByName(name string, parentID *string) (Folder, error) {
 }
 
 func (db *DB) GetFolderPath(folderID string) (string, error) {
-	folder, err := db.GetFolder(folderID)
-	if err != nil {
+	return folderPath(db.DB, folderID)
+}
+
+// GetFolderWithTrashed 按 ID 查找文件夹，包括回收站中的，用于按删除前的位置检查权限
+func (db *DB) GetFolderWithTrashed(folderID string) (Folder, error) {
+	var folder Folder
+	err := db.Unscoped().Where("folder_id = ?", folderID).First(&folder).Error
+	return folder, err
+}
+
+// GetFolderPathWithTrashed 返回文件夹的路径，文件夹或其上级在回收站中时按删除前的位置拼接。
+// folderPath 逐级复用 tx 查询，须以新会话传入，否则每一级的查询条件会累加在同一语句上
+func (db *DB) GetFolderPathWithTrashed(folderID string) (string, error) {
+	return folderPath(db.Unscoped().Session(&gorm.Session{}), folderID)
+}
+
+func folderPath(tx *gorm.DB, folderID string) (string, error) {
+	var folder Folder
+	if err := tx.Where("folder_id = ?", folderID).First(&folder).Error; err != nil {
 		return "", err
 	}
 
@@ -240,7 +1066,7 @@ func (db *DB) GetFolderPath(folderID string) (string, error) {
 		return "/" + folder.Name, nil
 	}
 
-	parentPath, err := db.GetFolderPath(*folder.ParentID)
+	parentPath, err := folderPath(tx, *folder.ParentID)
 	if err != nil {
 		return "", err
 	}
@@ -286,8 +1112,294 @@ func (db *DB) MoveFolder(folderID string, parentID *string) error {
 	return db.Model(&Folder{}).Where("folder_id = ?", folderID).Update("parent_id", parentID).Error
 }
 
-func (db *DB) DeleteFolder(folderID string) error {
-	return db.Where("folder_id = ?", folderID).Delete(&Folder{}).Error
+var (
+	// ErrNameTaken 表示目标位置已有同名文件或文件夹
+	ErrNameTaken = errors.New("name already taken")
+	// ErrFolderCycle 表示目标位置是被操作的文件夹自身或其子孙
+	ErrFolderCycle = errors.New("target is inside the source folder")
+)
+
+// nameTaken 检查 parentID 下是否已有名为 name 的文件或文件夹，exceptID 为被移动项自身的 ID
+func nameTaken(tx *gorm.DB, name string, parentID *string, exceptID string) (bool, error) {
+	var files, folders int64
+	fileQuery := tx.Model(&File{}).Where("original_name = ? AND file_id <> ?", name, exceptID)
+	folderQuery := tx.Model(&Folder{}).Where("name = ? AND folder_id <> ?", name, exceptID)
+	if parentID == nil {
+		fileQuery = fileQuery.Where("folder_id IS NULL")
+		folderQuery = folderQuery.Where("parent_id IS NULL")
+	} else {
+		fileQuery = fileQuery.Where("folder_id = ?", *parentID)
+		folderQuery = folderQuery.Where("parent_id = ?", *parentID)
+	}
+	if err := fileQuery.Count(&files).Error; err != nil {
+		return false, err
+	}
+	if err := folderQuery.Count(&folders).Error; err != nil {
+		return false, err
+	}
+	return files+folders > 0, nil
+}
+
+// IsFolderWithin 判断 folderID 是否为 ancestorID 自身或其子孙，folderID 为 nil 表示根目录
+func (db *DB) IsFolderWithin(folderID *string, ancestorID string) (bool, error) {
+	return isFolderWithin(db.DB, folderID, ancestorID)
+}
+
+func isFolderWithin(tx *gorm.DB, folderID *string, ancestorID string) (bool, error) {
+	for current := folderID; current != nil; {
+		if *current == ancestorID {
+			return true, nil
+		}
+		// 授权所在的文件夹可能已在回收站中，仍按删除前的位置判断
+		var folder Folder
+		if err := tx.Unscoped().Where("folder_id = ?", *current).First(&folder).Error; err != nil {
+			return false, err
+		}
+		current = folder.ParentID
+	}
+	return false, nil
+}
+
+// RelocateFolder 在一个事务中将文件夹移到 parentID 下并改名为 name；
+// 目标为其自身或子孙时返回 ErrFolderCycle，目标位置已有同名项时返回 ErrNameTaken
+func (db *DB) RelocateFolder(folderID string, parentID *string, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var folder Folder
+		if err := tx.Where("folder_id = ?", folderID).First(&folder).Error; err != nil {
+			return err
+		}
+
+		within, err := isFolderWithin(tx, parentID, folderID)
+		if err != nil {
+			return err
+		}
+		if within {
+			return ErrFolderCycle
+		}
+
+		taken, err := nameTaken(tx, name, parentID, folderID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNameTaken
+		}
+
+		return tx.Model(&folder).Updates(map[string]interface{}{
+			"parent_id":  parentID,
+			"name":       name,
+			"updated_at": NowRFC3339(),
+		}).Error
+	})
+}
+
+// RelocateFile 在一个事务中将文件移到 folderID 下并改名为 name，目标位置已有同名项时返回 ErrNameTaken
+func (db *DB) RelocateFile(fileID string, folderID *string, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var file File
+		if err := tx.Where("file_id = ?", fileID).First(&file).Error; err != nil {
+			return err
+		}
+
+		taken, err := nameTaken(tx, name, folderID, fileID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNameTaken
+		}
+
+		return tx.Model(&file).Updates(map[string]interface{}{
+			"folder_id":     folderID,
+			"original_name": name,
+			"updated_at":    NowRFC3339(),
+		}).Error
+	})
+}
+
+// FileCopy 为待复制的文件记录；Object 非空时表示调用方已写入一份新对象，否则按 SHA-256 共享已登记的对象
+type FileCopy struct {
+	Record *File
+	Object *StorageObject
+}
+
+// CopyTree 在一个事务中创建复制出的文件夹和文件记录，rootName/rootParentID 为复制结果顶层项的位置，
+// 已有同名项时返回 ErrNameTaken；redundant 为因内容已存在而多余的新对象，调用方应删除
+func (db *DB) CopyTree(rootName string, rootParentID *string, folders []*Folder, files []FileCopy) (redundant []string, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		redundant = nil
+
+		taken, err := nameTaken(tx, rootName, rootParentID, "")
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNameTaken
+		}
+
+		for _, folder := range folders {
+			if err := tx.Create(folder).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, f := range files {
+			if f.Object != nil {
+				reused, err := createFileWithObject(tx, f.Record, *f.Object)
+				if err != nil {
+					return err
+				}
+				if reused {
+					redundant = append(redundant, f.Object.ObjectKey)
+				}
+				continue
+			}
+
+			var existing StorageObject
+			if err := tx.Where("sha256 = ?", f.Record.SHA256).First(&existing).Error; err != nil {
+				return err
+			}
+			if err := acquireObject(tx, &existing, f.Record); err != nil {
+				return err
+			}
+			if err := tx.Create(f.Record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return redundant, err
+}
+
+// TrashFile 将文件移入回收站，path 为删除时的完整路径
+func (db *DB) TrashFile(fileID, path string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&File{}).Where("file_id = ?", fileID).Update("trash_path", path).Error; err != nil {
+			return err
+		}
+		result := tx.Where("file_id = ?", fileID).Delete(&File{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
+
+// TrashFolder 将文件夹连同其下全部未删除的文件和子文件夹移入回收站，path 为删除时的完整路径。
+// 子项记录 trash_root 为该文件夹，随它一起恢复或彻底删除
+func (db *DB) TrashFolder(folderID, path string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var subfolders []string
+		err := tx.Raw(`
+			WITH RECURSIVE tree(folder_id) AS (
+				SELECT folder_id FROM folders WHERE parent_id = ? AND deleted_at IS NULL
+				UNION ALL
+				SELECT f.folder_id FROM folders f JOIN tree t ON f.parent_id = t.folder_id WHERE f.deleted_at IS NULL
+			)
+			SELECT folder_id FROM tree`, folderID).Scan(&subfolders).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Folder{}).Where("folder_id = ?", folderID).Update("trash_path", path).Error; err != nil {
+			return err
+		}
+		result := tx.Where("folder_id = ?", folderID).Delete(&Folder{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		trashed := map[string]interface{}{"deleted_at": time.Now().UTC(), "trash_root": folderID}
+		if len(subfolders) > 0 {
+			if err := tx.Model(&Folder{}).Where("folder_id IN ?", subfolders).Updates(trashed).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&File{}).Where("folder_id IN ?", append(subfolders, folderID)).Updates(trashed).Error
+	})
+}
+
+// trashedItem 为回收站中单独列出的项，不包括随上级文件夹一起删除的
+const trashedItem = "deleted_at IS NOT NULL AND COALESCE(trash_root, '') = ''"
+
+func (db *DB) ListTrashedFiles() ([]File, error) {
+	var files []File
+	err := db.Unscoped().Where(trashedItem).Order("deleted_at DESC").Find(&files).Error
+	return files, err
+}
+
+func (db *DB) ListTrashedFolders() ([]Folder, error) {
+	var folders []Folder
+	err := db.Unscoped().Where(trashedItem).Order("deleted_at DESC").Find(&folders).Error
+	return folders, err
+}
+
+func (db *DB) GetTrashedFile(fileID string) (File, error) {
+	var file File
+	err := db.Unscoped().Where("file_id = ?", fileID).Where(trashedItem).First(&file).Error
+	return file, err
+}
+
+func (db *DB) GetTrashedFolder(folderID string) (Folder, error) {
+	var folder Folder
+	err := db.Unscoped().Where("folder_id = ?", folderID).Where(trashedItem).First(&folder).Error
+	return folder, err
+}
+
+// RestoreFile 将回收站中的文件恢复到指定文件夹和名称
+func (db *DB) RestoreFile(fileID string, folderID *string, name string) error {
+	return db.Unscoped().Model(&File{}).Where("file_id = ?", fileID).Updates(map[string]interface{}{
+		"deleted_at":    nil,
+		"trash_path":    "",
+		"folder_id":     folderID,
+		"original_name": name,
+		"updated_at":    NowRFC3339(),
+	}).Error
+}
+
+// RestoreFolder 将回收站中的文件夹恢复到指定父文件夹和名称，随它一起删除的文件和子文件夹一并恢复
+func (db *DB) RestoreFolder(folderID string, parentID *string, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&Folder{}).Where("folder_id = ?", folderID).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"trash_path": "",
+			"parent_id":  parentID,
+			"name":       name,
+			"updated_at": NowRFC3339(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		restored := map[string]interface{}{"deleted_at": nil, "trash_root": ""}
+		if err := tx.Unscoped().Model(&Folder{}).Where("trash_root = ?", folderID).Updates(restored).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&File{}).Where("trash_root = ?", folderID).Updates(restored).Error
+	})
+}
+
+// PurgeFolder 彻底删除文件夹记录及其上的授权
+func (db *DB) PurgeFolder(folderID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("folder_id = ?", folderID).Delete(&FolderGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("folder_id = ?", folderID).Delete(&Folder{}).Error
+	})
+}
+
+// ListAllChildren 返回文件夹下的全部文件和子文件夹，包括已在回收站中的，彻底删除文件夹时需要一并清理
+func (db *DB) ListAllChildren(folderID string) (fileIDs, folderIDs []string, err error) {
+	err = db.Unscoped().Model(&File{}).Where("folder_id = ?", folderID).Pluck("file_id", &fileIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = db.Unscoped().Model(&Folder{}).Where("parent_id = ?", folderID).Pluck("folder_id", &folderIDs).Error
+	return fileIDs, folderIDs, err
 }
 
 func (db *DB) GetFolderItemCount(folderID string) (int64, int64, error) {
@@ -297,12 +1409,55 @@ func (db *DB) GetFolderItemCount(folderID string) (int64, int64, error) {
 	return fileCount, folderCount, nil
 }
 
-func (db *DB) GetFolderStats(folderID string) (int64, int64, error) {
-	var fileCount int64
-	var totalSize int64
-	db.Model(&File{}).Where("folder_id = ?", folderID).Count(&fileCount)
-	db.Model(&File{}).Where("folder_id = ?", folderID).Select("COALESCE(SUM(size), 0)").Scan(&totalSize)
-	return fileCount, totalSize, nil
+// GetFolderStats 递归统计文件夹及其全部子文件夹中未删除文件的数量和总大小
+func (db *DB) GetFolderStats(folderID string) (fileCount, totalSize int64, err error) {
+	err = db.Raw(`
+		WITH RECURSIVE tree(folder_id) AS (
+			SELECT folder_id FROM folders WHERE folder_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.folder_id FROM folders f JOIN tree t ON f.parent_id = t.folder_id WHERE f.deleted_at IS NULL
+		)
+		SELECT COUNT(*), `+fileBytes+` FROM files
+		WHERE deleted_at IS NULL AND folder_id IN (SELECT folder_id FROM tree)`, folderID).
+		Row().Scan(&fileCount, &totalSize)
+	return fileCount, totalSize, err
+}
+
+// GetFileStats 统计直接位于文件夹下（不含子文件夹）的文件数量和总大小，folderID 为 nil 表示根目录
+func (db *DB) GetFileStats(folderID *string) (fileCount, totalSize int64, err error) {
+	query := db.Model(&File{})
+	if folderID == nil {
+		query = query.Where("folder_id IS NULL")
+	} else {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+	err = query.Select("COUNT(*), "+fileBytes).Row().Scan(&fileCount, &totalSize)
+	return fileCount, totalSize, err
+}
+
+// GetUserStats 统计用户创建的文件数量和总大小，回收站中的文件仍占用空间，一并计入
+func (db *DB) GetUserStats(user string) (fileCount, totalSize int64, err error) {
+	err = db.Unscoped().Model(&File{}).Where("created_by = ?", user).
+		Select("COUNT(*), "+fileBytes).Row().Scan(&fileCount, &totalSize)
+	return fileCount, totalSize, err
+}
+
+// fileBytes 为统计用量时文件的总大小，包括当前内容和保留的历史版本
+const fileBytes = "COALESCE(SUM(size + (SELECT COALESCE(SUM(v.size), 0) FROM file_versions v WHERE v.file_id = files.file_id)), 0)"
+
+// GetRootFolder 返回文件夹所在的顶层文件夹，文件夹本身位于根目录时返回其自身
+func (db *DB) GetRootFolder(folderID string) (Folder, error) {
+	current := folderID
+	for {
+		var folder Folder
+		if err := db.Where("folder_id = ?", current).First(&folder).Error; err != nil {
+			return Folder{}, err
+		}
+		if folder.ParentID == nil {
+			return folder, nil
+		}
+		current = *folder.ParentID
+	}
 }
 
 func (db *DB) UpdateFileFolder(fileID string, folderID *string) error {
@@ -386,18 +1541,172 @@ func (db *DB) GetFileByPath(path string) (File, error) {
 	return file, err
 }
 
-func (db *DB) AddAuditLog(action, fileID, actor, ipAddress, status, message string) error {
-	record := &AuditLog{
-		Action:    action,
-		FileID:    &fileID,
-		Actor:     actor,
-		IPAddress: &ipAddress,
-		Status:    status,
-		Message:   message,
-	}
+func (db *DB) CreateUploadSession(record *UploadSession) error {
+	return db.Create(record).Error
+}
+
+func (db *DB) GetUploadSession(sessionID string) (UploadSession, error) {
+	var session UploadSession
+	err := db.Where("session_id = ?", sessionID).First(&session).Error
+	return session, err
+}
+
+func (db *DB) UpdateUploadSessionStatus(sessionID, status string) error {
+	return db.Model(&UploadSession{}).Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{"status": status, "updated_at": NowRFC3339()}).Error
+}
+
+// TransitionUploadSession 仅当会话仍处于 from 状态时改为 to，返回是否已更新；并发的完成或取消请求只有一个能成功
+func (db *DB) TransitionUploadSession(sessionID, from, to string) (bool, error) {
+	result := db.Model(&UploadSession{}).Where("session_id = ? AND status = ?", sessionID, from).
+		Updates(map[string]interface{}{"status": to, "updated_at": NowRFC3339()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetUploadSessionMimeType 记录分片合并后对象的 MIME 类型，重试完成时复用已合并的对象
+func (db *DB) SetUploadSessionMimeType(sessionID, mimeType string) error {
+	return db.Model(&UploadSession{}).Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{"mime_type": mimeType, "updated_at": NowRFC3339()}).Error
+}
+
+func (db *DB) TouchUploadSession(sessionID string, expiresAt time.Time) error {
+	return db.Model(&UploadSession{}).Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{"expires_at": expiresAt, "updated_at": NowRFC3339()}).Error
+}
+
+// ListExpiredUploadSessions 返回已过期、仍在接收分片或已合并但未完成的会话
+func (db *DB) ListExpiredUploadSessions(now time.Time) ([]UploadSession, error) {
+	var sessions []UploadSession
+	err := db.Where("status IN ? AND expires_at < ?", []string{"active", "assembled"}, now).Find(&sessions).Error
+	return sessions, err
+}
+
+// SaveUploadPart 记录已接收的分片，重复上传同一分片时覆盖旧记录
+func (db *DB) SaveUploadPart(record *UploadPart) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ? AND part_number = ?", record.SessionID, record.PartNumber).
+			Delete(&UploadPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+}
+
+func (db *DB) ListUploadParts(sessionID string) ([]UploadPart, error) {
+	var parts []UploadPart
+	err := db.Where("session_id = ?", sessionID).Order("part_number ASC").Find(&parts).Error
+	return parts, err
+}
+
+func (db *DB) DeleteUploadParts(sessionID string) error {
+	return db.Where("session_id = ?", sessionID).Delete(&UploadPart{}).Error
+}
+
+func (db *DB) AddAuditLog(record *AuditLog) error {
 	return db.Create(record).Error
 }
 
+// ListAuditLogs 按时间倒序分页查询审计日志，同时返回符合条件的总数
+func (db *DB) ListAuditLogs(filter AuditFilter, limit, offset int) ([]AuditLog, int64, error) {
+	var logs []AuditLog
+	var total int64
+
+	query := db.auditQuery(filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+// ScanAuditLogs 按时间顺序返回 id 大于 afterID 的至多 limit 条审计日志，用于分批导出
+func (db *DB) ScanAuditLogs(filter AuditFilter, afterID uint, limit int) ([]AuditLog, error) {
+	var logs []AuditLog
+	err := db.auditQuery(filter).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+func (db *DB) auditQuery(filter AuditFilter) *gorm.DB {
+	query := db.Model(&AuditLog{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.PathPrefix != "" {
+		// 用 substr 比较前缀，避免路径中的 % 和 _ 被当作 LIKE 通配符
+		if prefix := strings.TrimSuffix(filter.PathPrefix, "/"); prefix == "" {
+			query = query.Where("path <> ''")
+		} else {
+			query = query.Where("path = ? OR substr(path, 1, ?) = ?", prefix, len(prefix)+1, prefix+"/")
+		}
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	return query
+}
+
+func (db *DB) ListMailAccountStates() ([]MailAccountState, error) {
+	var states []MailAccountState
+	err := db.Find(&states).Error
+	return states, err
+}
+
+// SaveMailAccountState 写入账户的监听进度，已有记录时覆盖
+func (db *DB) SaveMailAccountState(state *MailAccountState) error {
+	return db.Save(state).Error
+}
+
+// CreateMailEvent 写入一封新邮件的处理记录；该邮件已有记录时不写入并返回 false
+func (db *DB) CreateMailEvent(event *MailEvent) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (db *DB) UpdateMailEventStatus(id uint, status, message string) error {
+	return db.Model(&MailEvent{}).Where("id = ?", id).Updates(map[string]interface{}{"status": status, "error": message}).Error
+}
+
+// ListMailEvents 按处理时间倒序分页查询邮件事件，同时返回符合条件的总数
+func (db *DB) ListMailEvents(filter MailEventFilter, limit, offset int) ([]MailEvent, int64, error) {
+	var events []MailEvent
+	var total int64
+
+	query := db.Model(&MailEvent{})
+	if filter.Account != "" {
+		query = query.Where("account = ?", filter.Account)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	return events, total, err
+}
+
+// DeleteMailEventsBefore 删除 cutoff 之前处理的邮件事件，返回删除的条数
+func (db *DB) DeleteMailEventsBefore(cutoff time.Time) (int64, error) {
+	result := db.Where("created_at < ?", cutoff).Delete(&MailEvent{})
+	return result.RowsAffected, result.Error
+}
+
 func NowRFC3339() time.Time {
 	return time.Now().UTC()
 }
@@ -0,0 +1,583 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+)
+
+// EncryptionSegmentSize 为加密时的明文分段大小。每段单独以 AES-256-GCM 加密并附带认证标签，
+// 范围读取只需取回并解密覆盖该范围的分段；分片上传的分片偏移须按该大小对齐
+const EncryptionSegmentSize = 64 * 1024
+
+// segmentFormat 为对象的分段加密格式，保存在数据密钥记录的 Format 中
+type segmentFormat int
+
+// segmentFormatLegacy 为早期格式，nonce 只含分段序号；segmentFormatStream 按 STREAM 构造在最后一个分段的
+// nonce 中加入结束标记，对象在分段边界被截断或追加了分段时解密失败。这两种格式的 nonce 由分段序号决定，
+// 重传的分片会以相同的 nonce 加密不同的明文。segmentFormatRandomNonce 为每个分段生成随机 nonce 并写在分段开头，
+// 分段序号和结束标记作为附加数据参与认证
+const (
+	segmentFormatLegacy segmentFormat = iota
+	segmentFormatStream
+	segmentFormatRandomNonce
+)
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// rewrapBatchSize 为轮换主密钥时每批处理的数据密钥数量
+const rewrapBatchSize = 200
+
+// ErrCorruptObject 表示加密对象的内容无法通过认证，对象被截断或篡改
+var ErrCorruptObject = errors.New("encrypted object is corrupt")
+
+// EncryptedStorage 为任意 Storage 增加信封加密：每个对象生成独立的数据密钥，对象内容按分段加密后交给底层存储，
+// 数据密钥由主密钥加密后保存在数据库中。启用加密前写入、没有数据密钥记录的对象仍按明文读取
+type EncryptedStorage struct {
+	inner Storage
+	db    *database.DB
+	keys  *Keyring
+}
+
+func NewEncryptedStorage(inner Storage, db *database.DB, keys *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, db: db, keys: keys}
+}
+
+// CurrentKeyID 返回新数据密钥所用主密钥的标识
+func (s *EncryptedStorage) CurrentKeyID() string {
+	return s.keys.CurrentKeyID()
+}
+
+func (s *EncryptedStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	dataKey, aead, err := newDataKey()
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	// 底层存储只能看到密文，MIME 类型须在加密前推断
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(reader, buf)
+	mimeType := "application/octet-stream"
+	if n > 0 {
+		mimeType = http.DetectContentType(buf[:n])
+	}
+	plaintext := io.MultiReader(bytes.NewReader(buf[:n]), reader)
+
+	result, err := s.inner.Save(ctx, newSegmentEncrypter(aead, segmentFormatRandomNonce, plaintext, 0, true), segmentFormatRandomNonce.encryptedSize(size), fileID, originalName)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	result.Size = segmentFormatRandomNonce.plaintextSize(result.Size)
+	if err := s.storeDataKey(result.ObjectKey, dataKey, &result.Size); err != nil {
+		s.inner.Delete(ctx, result.ObjectKey)
+		return SaveResult{}, err
+	}
+
+	result.MimeType = mimeType
+	return result, nil
+}
+
+// Get 读取并解密对象；指定范围时只从底层存储取回覆盖该范围的分段。密文长度与记录的明文大小不符时返回 ErrCorruptObject
+func (s *EncryptedStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	aead, record, err := s.dataKey(objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if record == nil {
+		return s.inner.Get(ctx, objectKey, rangeStart, rangeEnd)
+	}
+
+	format := segmentFormat(record.Format)
+	segmentSize := format.segmentSize()
+	ranged := rangeStart != nil && rangeEnd != nil
+	var first int64
+	var cipherStart, cipherEnd *int64
+	if ranged {
+		if *rangeStart < 0 || *rangeEnd < *rangeStart {
+			return nil, ObjectInfo{}, fmt.Errorf("invalid range %d-%d", *rangeStart, *rangeEnd)
+		}
+		first = *rangeStart / EncryptionSegmentSize
+		start := first * segmentSize
+		end := (*rangeEnd/EncryptionSegmentSize+1)*segmentSize - 1
+		cipherStart, cipherEnd = &start, &end
+	}
+
+	reader, info, err := s.inner.Get(ctx, objectKey, cipherStart, cipherEnd)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	cipherSize := info.Size
+	if err := checkObjectSize(record, cipherSize); err != nil {
+		reader.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("object %s: %w", objectKey, err)
+	}
+	info.Size = format.plaintextSize(cipherSize)
+
+	offset, remaining := int64(0), info.Size
+	if ranged {
+		if *rangeStart >= info.Size {
+			reader.Close()
+			return nil, ObjectInfo{}, fmt.Errorf("invalid range %d-%d for object of size %d", *rangeStart, *rangeEnd, info.Size)
+		}
+		offset = *rangeStart - first*EncryptionSegmentSize
+		remaining = min(*rangeEnd, info.Size-1) - *rangeStart + 1
+	}
+
+	return &segmentDecrypter{
+		source:    reader,
+		aead:      aead,
+		format:    format,
+		last:      uint64((cipherSize - 1) / segmentSize),
+		index:     uint64(first),
+		skip:      offset,
+		remaining: remaining,
+		buf:       make([]byte, segmentSize),
+	}, info, nil
+}
+
+func (s *EncryptedStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	info, err := s.inner.Stat(ctx, objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	record, err := s.dataKeyRecord(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if record != nil {
+		info.Size = segmentFormat(record.Format).plaintextSize(info.Size)
+	}
+	return info, nil
+}
+
+func (s *EncryptedStorage) Delete(ctx context.Context, objectKey string) error {
+	if err := s.inner.Delete(ctx, objectKey); err != nil {
+		return err
+	}
+	return s.db.DeleteDataKey(objectKey)
+}
+
+func (s *EncryptedStorage) Ping(ctx context.Context) error {
+	return s.inner.Ping(ctx)
+}
+
+// CreateMultipart 在开始分片上传时生成数据密钥，之后的每个分片都用它加密
+func (s *EncryptedStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	upload, err := s.inner.CreateMultipart(ctx, fileID, originalName)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+
+	dataKey, _, err := newDataKey()
+	if err == nil {
+		err = s.storeDataKey(upload.ObjectKey, dataKey, nil)
+	}
+	if err != nil {
+		s.inner.AbortMultipart(ctx, upload)
+		return MultipartUpload{}, err
+	}
+	return upload, nil
+}
+
+// UploadPart 加密分片并写到密文中的对应位置，分片偏移须是 EncryptionSegmentSize 的整数倍；
+// part.Last 为 true 时分片的最后一个分段带结束标记。新对象的每个分段使用随机 nonce，重传同一分片不会重用 nonce
+func (s *EncryptedStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	aead, record, err := s.dataKey(upload.ObjectKey)
+	if err != nil {
+		return PartInfo{}, err
+	}
+	if record == nil {
+		return s.inner.UploadPart(ctx, upload, part)
+	}
+	if part.Offset%EncryptionSegmentSize != 0 {
+		return PartInfo{}, fmt.Errorf("part offset %d is not a multiple of the %d byte encryption segment", part.Offset, EncryptionSegmentSize)
+	}
+
+	format := segmentFormat(record.Format)
+	index := part.Offset / EncryptionSegmentSize
+	info, err := s.inner.UploadPart(ctx, upload, PartInput{
+		PartNumber: part.PartNumber,
+		Offset:     index * format.segmentSize(),
+		Size:       format.encryptedSize(part.Size),
+		Reader:     newSegmentEncrypter(aead, format, part.Reader, uint64(index), part.Last),
+	})
+	if err != nil {
+		return PartInfo{}, err
+	}
+	info.Size = format.plaintextSize(info.Size)
+	return info, nil
+}
+
+func (s *EncryptedStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	record, err := s.dataKeyRecord(upload.ObjectKey)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	if record == nil {
+		return s.inner.CompleteMultipart(ctx, upload, parts)
+	}
+
+	format := segmentFormat(record.Format)
+	cipherParts := make([]PartInfo, 0, len(parts))
+	for _, p := range parts {
+		p.Size = format.encryptedSize(p.Size)
+		cipherParts = append(cipherParts, p)
+	}
+	result, err := s.inner.CompleteMultipart(ctx, upload, cipherParts)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	result.Size = format.plaintextSize(result.Size)
+	if err := s.db.SetDataKeySize(result.ObjectKey, result.Size); err != nil {
+		return SaveResult{}, err
+	}
+	// 解密最后一个字节所在的分段，最后一个分片未带结束标记时在此发现
+	if result.Size > 0 {
+		last := result.Size - 1
+		reader, _, err := s.Get(ctx, result.ObjectKey, &last, &last)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		_, err = io.Copy(io.Discard, reader)
+		reader.Close()
+		if err != nil {
+			return SaveResult{}, err
+		}
+	}
+	if result.MimeType, err = sniffContentType(ctx, s, result.ObjectKey, result.Size); err != nil {
+		return SaveResult{}, err
+	}
+	return result, nil
+}
+
+func (s *EncryptedStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	if err := s.inner.AbortMultipart(ctx, upload); err != nil {
+		return err
+	}
+	return s.db.DeleteDataKey(upload.ObjectKey)
+}
+
+// Walk 遍历底层存储的对象，加密对象报告明文大小
+func (s *EncryptedStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	return s.inner.Walk(ctx, func(entry ObjectEntry) error {
+		record, err := s.dataKeyRecord(entry.Key)
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			entry.Size = segmentFormat(record.Format).plaintextSize(entry.Size)
+		}
+		return fn(entry)
+	})
+}
+
+// Quarantine 隔离对象，数据密钥随之改用新的对象键，隔离后仍可解密
+func (s *EncryptedStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	target, err := s.inner.Quarantine(ctx, objectKey)
+	if err != nil {
+		return "", err
+	}
+	return target, s.db.RenameDataKey(objectKey, target)
+}
+
+// RewrapKeys 用当前主密钥重新加密所有由旧主密钥加密的数据密钥，对象内容不变；返回重新加密的数量
+func (s *EncryptedStorage) RewrapKeys(ctx context.Context) (int, error) {
+	current := s.keys.CurrentKeyID()
+	rewrapped := 0
+	var afterID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return rewrapped, err
+		}
+
+		records, err := s.db.ListDataKeysNotWrappedBy(current, afterID, rewrapBatchSize)
+		if err != nil {
+			return rewrapped, err
+		}
+		for _, record := range records {
+			dataKey, err := s.keys.Unwrap(record.KeyID, record.WrappedKey)
+			if err != nil {
+				return rewrapped, fmt.Errorf("object %s: %w", record.ObjectKey, err)
+			}
+			keyID, wrapped, err := s.keys.Wrap(dataKey)
+			if err != nil {
+				return rewrapped, err
+			}
+			updated, err := s.db.RewrapDataKey(record.ID, record.KeyID, keyID, wrapped)
+			if err != nil {
+				return rewrapped, err
+			}
+			if updated {
+				rewrapped++
+			}
+		}
+		if len(records) < rewrapBatchSize {
+			return rewrapped, nil
+		}
+		afterID = records[len(records)-1].ID
+	}
+}
+
+// storeDataKey 保存新对象的数据密钥，size 为明文大小，分片上传完成前为 nil
+func (s *EncryptedStorage) storeDataKey(objectKey string, dataKey []byte, size *int64) error {
+	keyID, wrapped, err := s.keys.Wrap(dataKey)
+	if err != nil {
+		return err
+	}
+	return s.db.SaveDataKey(&database.DataKey{
+		ObjectKey:  objectKey,
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Format:     int(segmentFormatRandomNonce),
+		Size:       size,
+	})
+}
+
+// dataKey 返回对象的数据密钥及其记录，对象未加密时 record 为 nil
+func (s *EncryptedStorage) dataKey(objectKey string) (cipher.AEAD, *database.DataKey, error) {
+	record, err := s.dataKeyRecord(objectKey)
+	if record == nil || err != nil {
+		return nil, nil, err
+	}
+
+	key, err := s.keys.Unwrap(record.KeyID, record.WrappedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, record, nil
+}
+
+// dataKeyRecord 返回对象的数据密钥记录，对象未加密时返回 nil
+func (s *EncryptedStorage) dataKeyRecord(objectKey string) (*database.DataKey, error) {
+	record, err := s.db.GetDataKey(objectKey)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func newDataKey() ([]byte, cipher.AEAD, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, aead, nil
+}
+
+// segmentSize 返回一个完整分段加密后的长度
+func (f segmentFormat) segmentSize() int64 {
+	if f == segmentFormatRandomNonce {
+		return EncryptionSegmentSize + gcmNonceSize + gcmTagSize
+	}
+	return EncryptionSegmentSize + gcmTagSize
+}
+
+// encryptedSize 返回 size 字节明文加密后的长度，空对象也有一个结束分段；size 未知（小于 0）时原样返回
+func (f segmentFormat) encryptedSize(size int64) int64 {
+	if size < 0 {
+		return size
+	}
+	segments := max((size+EncryptionSegmentSize-1)/EncryptionSegmentSize, 1)
+	return size + segments*(f.segmentSize()-EncryptionSegmentSize)
+}
+
+// plaintextSize 由密文长度推算明文长度
+func (f segmentFormat) plaintextSize(size int64) int64 {
+	segments := (size + f.segmentSize() - 1) / f.segmentSize()
+	return max(size-segments*(f.segmentSize()-EncryptionSegmentSize), 0)
+}
+
+// seal 加密序号为 index 的分段并追加到 dst，final 标记对象的最后一个分段，早期格式忽略该标记
+func (f segmentFormat) seal(aead cipher.AEAD, dst []byte, index uint64, final bool, plain []byte) ([]byte, error) {
+	if f != segmentFormatRandomNonce {
+		return aead.Seal(dst, segmentNonce(index, final && f == segmentFormatStream), plain, nil), nil
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(append(dst, nonce...), nonce, plain, segmentAAD(index, final)), nil
+}
+
+// open 原地解密 seal 写出的分段
+func (f segmentFormat) open(aead cipher.AEAD, index uint64, final bool, sealed []byte) ([]byte, error) {
+	if f != segmentFormatRandomNonce {
+		return aead.Open(sealed[:0], segmentNonce(index, final && f == segmentFormatStream), sealed, nil)
+	}
+	if len(sealed) < gcmNonceSize {
+		return nil, errors.New("segment is shorter than its nonce")
+	}
+	ciphertext := sealed[gcmNonceSize:]
+	return aead.Open(ciphertext[:0], sealed[:gcmNonceSize], ciphertext, segmentAAD(index, final))
+}
+
+// checkObjectSize 校验密文长度是有效的分段加密长度，且与记录的明文大小一致
+func checkObjectSize(record *database.DataKey, cipherSize int64) error {
+	format := segmentFormat(record.Format)
+	size := format.plaintextSize(cipherSize)
+	if format != segmentFormatLegacy && format.encryptedSize(size) != cipherSize {
+		return fmt.Errorf("%w: invalid ciphertext length %d", ErrCorruptObject, cipherSize)
+	}
+	if record.Size != nil && *record.Size != size {
+		return fmt.Errorf("%w: size is %d, expected %d", ErrCorruptObject, size, *record.Size)
+	}
+	return nil
+}
+
+// segmentNonce 为早期格式的 GCM nonce，由分段序号构成，final 在首字节标记对象的最后一个分段
+func segmentNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, gcmNonceSize)
+	if final {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], index)
+	return nonce
+}
+
+// segmentAAD 为随机 nonce 格式的附加数据，绑定分段序号和结束标记，分段被调换、截断或追加时认证失败
+func segmentAAD(index uint64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, index)
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// segmentEncrypter 从明文读取器按分段读出密文，index 为第一个分段的序号。last 表示明文读完即到达对象末尾，
+// 此时最后一个分段带结束标记，空对象也写出一个空的结束分段
+type segmentEncrypter struct {
+	source *bufio.Reader
+	aead   cipher.AEAD
+	format segmentFormat
+	index  uint64
+	last   bool
+	buf    []byte
+	out    []byte
+	sealed []byte
+	done   bool
+}
+
+func newSegmentEncrypter(aead cipher.AEAD, format segmentFormat, source io.Reader, index uint64, last bool) *segmentEncrypter {
+	return &segmentEncrypter{
+		source: bufio.NewReader(source),
+		aead:   aead,
+		format: format,
+		index:  index,
+		last:   last,
+		buf:    make([]byte, EncryptionSegmentSize),
+		sealed: make([]byte, 0, format.segmentSize()),
+	}
+}
+
+func (r *segmentEncrypter) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.source, r.buf)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		} else if _, err := r.source.Peek(1); errors.Is(err, io.EOF) {
+			// 明文恰好在分段边界结束，这个完整分段就是最后一个
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		// 只有明文为空时才会读到空分段
+		if n == 0 && !r.last {
+			continue
+		}
+		if r.out, err = r.format.seal(r.aead, r.sealed[:0], r.index, r.last && r.done, r.buf[:n]); err != nil {
+			return 0, err
+		}
+		r.index++
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// segmentDecrypter 从密文读取器逐段解密，跳过第一个分段开头的 skip 字节，共返回 remaining 字节明文。
+// 早期格式以外，序号为 last 的分段须带结束标记
+type segmentDecrypter struct {
+	source    io.ReadCloser
+	aead      cipher.AEAD
+	format    segmentFormat
+	last      uint64
+	index     uint64
+	skip      int64
+	remaining int64
+	buf       []byte
+	plain     []byte
+}
+
+func (r *segmentDecrypter) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.source, r.buf)
+		if n == 0 {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+
+		plain, err := r.format.open(r.aead, r.index, r.index == r.last, r.buf[:n])
+		if err != nil {
+			return 0, fmt.Errorf("%w: segment %d failed authentication", ErrCorruptObject, r.index)
+		}
+		r.index++
+
+		skip := min(r.skip, int64(len(plain)))
+		plain = plain[skip:]
+		r.skip -= skip
+		if int64(len(plain)) > r.remaining {
+			plain = plain[:r.remaining]
+		}
+		r.remaining -= int64(len(plain))
+		r.plain = plain
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *segmentDecrypter) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,241 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+)
+
+func newTestEncryptedStorage(t *testing.T) (*EncryptedStorage, *MemoryStorage) {
+	t.Helper()
+	db, err := database.Open(database.Config{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	keys, err := LoadKeyring(config.EncryptionConfig{Enabled: true, MasterKey: base64.StdEncoding.EncodeToString(randomBytes(t, masterKeySize))})
+	if err != nil {
+		t.Fatalf("load keyring: %v", err)
+	}
+	inner := NewMemoryStorage()
+	return NewEncryptedStorage(inner, db, keys), inner
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readObject(s Storage, objectKey string, rangeStart, rangeEnd *int64) ([]byte, error) {
+	reader, _, err := s.Get(context.Background(), objectKey, rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// truncate 把底层对象截断为 segments 个完整的密文分段
+func truncate(inner *MemoryStorage, objectKey string, segments int) {
+	inner.mu.Lock()
+	defer inner.mu.Unlock()
+	obj := inner.objects[objectKey]
+	obj.data = obj.data[:int64(segments)*segmentFormatRandomNonce.segmentSize()]
+	inner.objects[objectKey] = obj
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	s, _ := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	for _, size := range []int{0, 1, EncryptionSegmentSize, EncryptionSegmentSize + 1, 3 * EncryptionSegmentSize} {
+		content := randomBytes(t, size)
+		result, err := s.Save(ctx, bytes.NewReader(content), int64(size), "f", "a.bin")
+		if err != nil {
+			t.Fatalf("save %d bytes: %v", size, err)
+		}
+		if result.Size != int64(size) {
+			t.Fatalf("saved size = %d, want %d", result.Size, size)
+		}
+		data, err := readObject(s, result.ObjectKey, nil, nil)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("read %d bytes: %v", size, err)
+		}
+		if size > 1 {
+			start, end := int64(size/2), int64(size-1)
+			data, err := readObject(s, result.ObjectKey, &start, &end)
+			if err != nil || !bytes.Equal(data, content[start:]) {
+				t.Fatalf("read range of %d bytes: %v", size, err)
+			}
+		}
+	}
+}
+
+func TestEncryptedStorageRejectsTruncation(t *testing.T) {
+	s, inner := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	result, err := s.Save(ctx, bytes.NewReader(randomBytes(t, 3*EncryptionSegmentSize+10)), -1, "f", "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncate(inner, result.ObjectKey, 2)
+	if _, err := readObject(s, result.ObjectKey, nil, nil); !errors.Is(err, ErrCorruptObject) {
+		t.Fatalf("read truncated object: %v", err)
+	}
+
+	// 没有记录明文大小时，由最后一个分段的结束标记发现截断
+	if err := s.db.Model(&database.DataKey{}).Where("object_key = ?", result.ObjectKey).Update("size", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readObject(s, result.ObjectKey, nil, nil); !errors.Is(err, ErrCorruptObject) {
+		t.Fatalf("read truncated object without recorded size: %v", err)
+	}
+	start, end := int64(EncryptionSegmentSize), int64(2*EncryptionSegmentSize-1)
+	if _, err := readObject(s, result.ObjectKey, &start, &end); !errors.Is(err, ErrCorruptObject) {
+		t.Fatalf("read range ending at truncation: %v", err)
+	}
+}
+
+func TestEncryptedMultipartMarksLastPart(t *testing.T) {
+	s, _ := newTestEncryptedStorage(t)
+	ctx := context.Background()
+	content := randomBytes(t, 3*EncryptionSegmentSize+10)
+
+	upload := func(markLast bool) (SaveResult, error) {
+		upload, err := s.CreateMultipart(ctx, "f", "a.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parts []PartInfo
+		for i, offset := range []int{0, 2 * EncryptionSegmentSize} {
+			end := min(offset+2*EncryptionSegmentSize, len(content))
+			part, err := s.UploadPart(ctx, upload, PartInput{
+				PartNumber: i + 1,
+				Offset:     int64(offset),
+				Size:       int64(end - offset),
+				Reader:     bytes.NewReader(content[offset:end]),
+				Last:       markLast && i == 1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts = append(parts, part)
+		}
+		return s.CompleteMultipart(ctx, upload, parts)
+	}
+
+	result, err := upload(true)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if data, err := readObject(s, result.ObjectKey, nil, nil); err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("read multipart object: %v", err)
+	}
+
+	// 最后一个分片未标记时对象缺少结束分段，读取时按截断处理
+	if _, err := upload(false); !errors.Is(err, ErrCorruptObject) {
+		t.Fatalf("complete without last part: %v", err)
+	}
+}
+
+func TestEncryptedPartReuploadUsesFreshNonces(t *testing.T) {
+	s, inner := newTestEncryptedStorage(t)
+	ctx := context.Background()
+	upload, err := s.CreateMultipart(ctx, "f", "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重传同一分片时密文不能相同，否则说明 nonce 由分段序号决定，重传不同内容时会重用 nonce
+	content := randomBytes(t, 100)
+	var sealed [][]byte
+	var part PartInfo
+	for range 2 {
+		part, err = s.UploadPart(ctx, upload, PartInput{PartNumber: 1, Size: 100, Reader: bytes.NewReader(content), Last: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Size != 100 {
+			t.Fatalf("part size = %d", part.Size)
+		}
+		inner.mu.Lock()
+		sealed = append(sealed, inner.uploads[upload.UploadID][1])
+		inner.mu.Unlock()
+	}
+	if bytes.Equal(sealed[0], sealed[1]) {
+		t.Fatal("re-uploaded part was encrypted with the same nonce")
+	}
+	if _, err := s.CompleteMultipart(ctx, upload, []PartInfo{part}); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+}
+
+func TestEncryptedStorageReadsEarlierFormats(t *testing.T) {
+	s, inner := newTestEncryptedStorage(t)
+	ctx := context.Background()
+	content := randomBytes(t, 2*EncryptionSegmentSize+10)
+
+	for _, format := range []segmentFormat{segmentFormatLegacy, segmentFormatStream} {
+		dataKey, aead, err := newDataKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := inner.Save(ctx, newSegmentEncrypter(aead, format, bytes.NewReader(content), 0, true), -1, "f", "a.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, wrapped, err := s.keys.Wrap(dataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.db.SaveDataKey(&database.DataKey{ObjectKey: result.ObjectKey, KeyID: keyID, WrappedKey: wrapped, Format: int(format)}); err != nil {
+			t.Fatal(err)
+		}
+
+		if info, err := s.Stat(ctx, result.ObjectKey); err != nil || info.Size != int64(len(content)) {
+			t.Fatalf("format %d: stat = %+v, %v", format, info, err)
+		}
+		start, end := int64(EncryptionSegmentSize-5), int64(2*EncryptionSegmentSize+5)
+		data, err := readObject(s, result.ObjectKey, &start, &end)
+		if err != nil || !bytes.Equal(data, content[start:end+1]) {
+			t.Fatalf("format %d: read range: %v", format, err)
+		}
+	}
+}
+
+func TestKeyringKeyIDIsNotKeyHash(t *testing.T) {
+	key := randomBytes(t, masterKeySize)
+	keys, err := LoadKeyring(config.EncryptionConfig{Enabled: true, MasterKey: base64.StdEncoding.EncodeToString(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(key)
+	legacy := hex.EncodeToString(sum[:8])
+	if keys.CurrentKeyID() == legacy {
+		t.Fatal("key id is a prefix of the master key hash")
+	}
+	if keys.LegacyKeyIDs()[legacy] != keys.CurrentKeyID() {
+		t.Fatalf("legacy ids = %v", keys.LegacyKeyIDs())
+	}
+}
@@ -2,59 +2,127 @@ package file
 
 import (
 	"context"
-	"io"
+	"fmt"
 
 	"github.com/kiry163/claw-pliers/internal/config"
 	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+)
+
+// 存储模式
+const (
+	ModeRequired = "required"
+	ModeDegraded = "degraded"
+	ModeMemory   = "memory-for-tests"
 )
 
 var (
 	Database    *database.DB
 	FileStorage Storage
+	// Driver 为当前生效的存储驱动名称
+	Driver string
+	// Mode 为当前生效的存储模式
+	Mode string
+	// Degraded 为 degraded 模式下启动时后端不可用而使用的存储，后端正常时为 nil
+	Degraded *DegradedStorage
 )
 
-type StubStorage struct{}
+func Init(cfg config.Config) error {
+	var err error
 
-func (s *StubStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
-	return SaveResult{ObjectKey: fileID, Size: size, MimeType: "application/octet-stream"}, nil
-}
+	Database, err = database.Open(database.Config{Path: cfg.Database.Path})
+	if err != nil {
+		return err
+	}
 
-type stubReader struct{}
+	Mode = cfg.Storage.Mode
+	if Mode == "" {
+		Mode = ModeRequired
+	}
+	Driver = cfg.Storage.Driver
+	if Driver == "" {
+		Driver = "minio"
+	}
 
-func (r *stubReader) Read(p []byte) (n int, err error) {
-	return 0, io.EOF
-}
+	keys, err := loadEncryption(cfg.Storage.Encryption)
+	if err != nil {
+		return err
+	}
 
-func (r *stubReader) Close() error {
-	return nil
-}
+	switch Mode {
+	case ModeMemory:
+		Driver = "memory"
+		FileStorage = encrypt(NewMemoryStorage(), keys)
+		logger.Get().Warn().Msg("file storage running in memory-for-tests mode, data will be lost on restart")
+		return nil
+	case ModeRequired, ModeDegraded:
+	default:
+		return fmt.Errorf("unknown storage mode: %s", Mode)
+	}
 
-func (s *StubStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
-	return &stubReader{}, ObjectInfo{}, nil
-}
+	if Driver != "local" && Driver != "minio" {
+		return fmt.Errorf("unknown storage driver: %s", Driver)
+	}
 
-func (s *StubStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
-	return ObjectInfo{}, nil
-}
+	storage, err := openStorage(cfg, Driver)
+	if err != nil {
+		if Mode == ModeRequired {
+			return fmt.Errorf("storage driver %s unavailable: %w", Driver, err)
+		}
+		logger.Get().Error().Err(err).Str("driver", Driver).Msg("storage unavailable, running in degraded mode")
+		Degraded = newDegradedStorage(err, func() (Storage, error) { return openStorage(cfg, Driver) })
+		FileStorage = encrypt(Degraded, keys)
+		return nil
+	}
 
-func (s *StubStorage) Delete(ctx context.Context, objectKey string) error {
+	FileStorage = encrypt(storage, keys)
 	return nil
 }
 
-func Init(cfg config.Config) error {
-	var err error
+// loadEncryption 读取主密钥；未启用加密时返回 nil，但若已有加密对象则拒绝启动，避免把密文当作明文返回
+func loadEncryption(cfg config.EncryptionConfig) (*Keyring, error) {
+	if !cfg.Enabled {
+		count, err := Database.CountDataKeys()
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%d stored objects are encrypted but storage.encryption is disabled", count)
+		}
+		return nil, nil
+	}
 
-	Database, err = database.Open(database.Config{Path: cfg.Database.Path})
+	keys, err := LoadKeyring(cfg)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("storage encryption: %w", err)
 	}
+	for legacy, id := range keys.LegacyKeyIDs() {
+		renamed, err := Database.RenameDataKeyID(legacy, id)
+		if err != nil {
+			return nil, fmt.Errorf("storage encryption: %w", err)
+		}
+		if renamed > 0 {
+			logger.Get().Info().Str("key_id", id).Int64("data_keys", renamed).Msg("migrated master key id")
+		}
+	}
+	logger.Get().Info().Str("key_id", keys.CurrentKeyID()).Msg("storage encryption enabled")
+	return keys, nil
+}
 
-	storage, err := NewMinioStorage(context.Background(), cfg.Minio)
-	if err != nil {
-		FileStorage = &StubStorage{}
-	} else {
-		FileStorage = storage
+func encrypt(storage Storage, keys *Keyring) Storage {
+	if keys == nil {
+		return storage
 	}
+	return NewEncryptedStorage(storage, Database, keys)
+}
 
-	return nil
+func openStorage(cfg config.Config, driver string) (Storage, error) {
+	switch driver {
+	case "local":
+		return NewLocalStorage(cfg.Storage)
+	case "minio":
+		return NewMinioStorage(context.Background(), cfg.Minio)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
+	}
 }
@@ -0,0 +1,154 @@
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+// masterKeySize 为主密钥和数据密钥的长度（AES-256）
+const masterKeySize = 32
+
+// keyIDLabel 为计算主密钥标识时的 HMAC 消息，标识由主密钥本身作为 HMAC 密钥得出，不能用于离线验证猜测的主密钥
+const keyIDLabel = "claw-pliers master key id"
+
+// ErrUnknownMasterKey 表示数据密钥由未配置的主密钥加密，通常是轮换后过早删除了旧密钥
+var ErrUnknownMasterKey = errors.New("data key is wrapped by an unknown master key")
+
+// Keyring 保存当前主密钥和轮换前的旧主密钥，新数据密钥总是用当前主密钥加密
+type Keyring struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+	legacyIDs map[string]string
+}
+
+// LoadKeyring 按配置读取主密钥，旧密钥只用于解密轮换前加密的数据密钥
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	if (cfg.MasterKey == "") == (cfg.MasterKeyFile == "") {
+		return nil, errors.New("exactly one of storage.encryption.master_key and master_key_file is required")
+	}
+
+	ring := &Keyring{keys: make(map[string]cipher.AEAD), legacyIDs: make(map[string]string)}
+	current, err := readMasterKey(cfg.MasterKey, cfg.MasterKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	if ring.currentID, err = ring.add(current); err != nil {
+		return nil, err
+	}
+
+	for i, value := range cfg.PreviousKeys {
+		key, err := readMasterKey(value, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous_keys[%d]: %w", i, err)
+		}
+		if _, err := ring.add(key); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range cfg.PreviousKeyFiles {
+		key, err := readMasterKey("", path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous key file %s: %w", path, err)
+		}
+		if _, err := ring.add(key); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// CurrentKeyID 返回当前主密钥的标识
+func (r *Keyring) CurrentKeyID() string {
+	return r.currentID
+}
+
+// LegacyKeyIDs 返回旧标识到当前标识的映射。早期版本以主密钥的 SHA-256 前缀为标识，已保存的数据密钥记录需迁移
+func (r *Keyring) LegacyKeyIDs() map[string]string {
+	return r.legacyIDs
+}
+
+// Wrap 用当前主密钥加密数据密钥，返回主密钥标识和 base64 编码的密文
+func (r *Keyring) Wrap(dataKey []byte) (string, string, error) {
+	aead := r.keys[r.currentID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	sealed := aead.Seal(nonce, nonce, dataKey, nil)
+	return r.currentID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap 用 keyID 对应的主密钥解密数据密钥
+func (r *Keyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	aead, ok := r.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed wrapped data key")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with master key %s: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+func (r *Keyring) add(key []byte) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(keyIDLabel))
+	id := hex.EncodeToString(mac.Sum(nil)[:8])
+	r.keys[id] = aead
+
+	legacy := sha256.Sum256(key)
+	r.legacyIDs[hex.EncodeToString(legacy[:8])] = id
+	return id, nil
+}
+
+// readMasterKey 读取 base64 编码的主密钥；密钥文件也可以直接保存 32 字节的原始密钥
+func readMasterKey(value, path string) ([]byte, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == masterKeySize {
+			return data, nil
+		}
+		value = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.New("expected base64")
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", masterKeySize, len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
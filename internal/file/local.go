@@ -0,0 +1,383 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/utils"
+)
+
+const localTempDir = ".tmp"
+
+// LocalStorage 将对象保存在本地磁盘，按 fileID 前缀分片到子目录
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(cfg config.StorageConfig) (*LocalStorage, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("storage.root is required for local driver")
+	}
+
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage root: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, localTempDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage root: %w", err)
+	}
+
+	return &LocalStorage{root: root}, nil
+}
+
+func (s *LocalStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	objectKey := localObjectKey(fileID, originalName)
+	target, err := s.objectPath(objectKey)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(reader, buf)
+	mimeType := "application/octet-stream"
+	if n > 0 {
+		mimeType = http.DetectContentType(buf[:n])
+	}
+	contentReader := io.MultiReader(bytes.NewReader(buf[:n]), reader)
+
+	written, err := s.writeAtomic(ctx, target, contentReader, size)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	return SaveResult{ObjectKey: objectKey, Size: written, MimeType: mimeType}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info, err := statLocalFile(f)
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	if rangeStart == nil || rangeEnd == nil {
+		return f, info, nil
+	}
+
+	if *rangeStart < 0 || *rangeEnd < *rangeStart || *rangeStart >= info.Size {
+		f.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("invalid range %d-%d for object of size %d", *rangeStart, *rangeEnd, info.Size)
+	}
+	if _, err := f.Seek(*rangeStart, io.SeekStart); err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	return &limitedReadCloser{Reader: io.LimitReader(f, *rangeEnd-*rangeStart+1), Closer: f}, info, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer f.Close()
+
+	return statLocalFile(f)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, objectKey string) error {
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Ping(ctx context.Context) error {
+	info, err := os.Stat(filepath.Join(s.root, localTempDir))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage root is not a directory: %s", s.root)
+	}
+	return nil
+}
+
+func (s *LocalStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	upload := MultipartUpload{
+		UploadID:  utils.GenerateID(24),
+		ObjectKey: localObjectKey(fileID, originalName),
+	}
+
+	dir, err := s.uploadDir(upload.UploadID)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return MultipartUpload{}, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return upload, nil
+}
+
+func (s *LocalStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	dir, err := s.uploadDir(upload.UploadID)
+	if err != nil {
+		return PartInfo{}, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return PartInfo{}, fmt.Errorf("upload %s not found: %w", upload.UploadID, err)
+	}
+
+	hash := md5.New()
+	written, err := s.writeAtomic(ctx, localPartPath(dir, part.PartNumber), io.TeeReader(part.Reader, hash), part.Size)
+	if err != nil {
+		return PartInfo{}, err
+	}
+	return PartInfo{PartNumber: part.PartNumber, ETag: hex.EncodeToString(hash.Sum(nil)), Size: written}, nil
+}
+
+func (s *LocalStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	dir, err := s.uploadDir(upload.UploadID)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	target, err := s.objectPath(upload.ObjectKey)
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	var total int64
+	for _, p := range parts {
+		f, err := os.Open(localPartPath(dir, p.PartNumber))
+		if err != nil {
+			return SaveResult{}, fmt.Errorf("missing part %d: %w", p.PartNumber, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+		total += p.Size
+	}
+
+	written, err := s.writeAtomic(ctx, target, io.MultiReader(readers...), total)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	os.RemoveAll(dir)
+
+	mimeType, err := sniffContentType(ctx, s, upload.ObjectKey, written)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	return SaveResult{ObjectKey: upload.ObjectKey, Size: written, MimeType: mimeType}, nil
+}
+
+func (s *LocalStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	dir, err := s.uploadDir(upload.UploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if key == localTempDir || key+"/" == QuarantinePrefix {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ObjectEntry{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+func (s *LocalStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	source, err := s.objectPath(objectKey)
+	if err != nil {
+		return "", err
+	}
+
+	targetKey := QuarantinePrefix + objectKey
+	target, err := s.objectPath(targetKey)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(source, target); err != nil {
+		return "", err
+	}
+	return targetKey, nil
+}
+
+// uploadDir 返回分片上传的暂存目录，位于临时目录下，不会被当作对象读取
+func (s *LocalStorage) uploadDir(uploadID string) (string, error) {
+	if uploadID == "" {
+		return "", errors.New("upload id is required")
+	}
+	for _, r := range uploadID {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return "", fmt.Errorf("invalid upload id: %s", uploadID)
+		}
+	}
+	return filepath.Join(s.root, localTempDir, "uploads", uploadID), nil
+}
+
+func localPartPath(dir string, partNumber int) string {
+	return filepath.Join(dir, fmt.Sprintf("%05d.part", partNumber))
+}
+
+// writeAtomic 先写入临时文件，fsync 后再 rename 到目标路径，避免读到半截对象
+// size 为负数时不校验写入长度
+func (s *LocalStorage) writeAtomic(ctx context.Context, target string, reader io.Reader, size int64) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, localTempDir), "upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	written, err := io.Copy(tmp, &contextReader{ctx: ctx, reader: reader})
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write object: %w", err)
+	}
+	if size >= 0 && written != size {
+		tmp.Close()
+		return 0, fmt.Errorf("size mismatch: expected %d bytes, wrote %d", size, written)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to sync object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close object: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	if err := os.Rename(tmpName, target); err != nil {
+		return 0, fmt.Errorf("failed to commit object: %w", err)
+	}
+
+	return written, nil
+}
+
+// objectPath 将对象键映射到 root 下的绝对路径，并拒绝越界的键
+func (s *LocalStorage) objectPath(objectKey string) (string, error) {
+	if objectKey == "" {
+		return "", errors.New("object key is required")
+	}
+
+	path := filepath.Join(s.root, filepath.FromSlash(objectKey))
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") || strings.HasPrefix(rel, localTempDir) {
+		return "", fmt.Errorf("invalid object key: %s", objectKey)
+	}
+	return path, nil
+}
+
+// localObjectKey 按 fileID 前两段字符分片，例如 ab/cd/abcdef123456.txt
+func localObjectKey(fileID, originalName string) string {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+
+	id := fileID
+	for len(id) < 4 {
+		id += "_"
+	}
+	return id[0:2] + "/" + id[2:4] + "/" + fileID + ext
+}
+
+func statLocalFile(f *os.File) (ObjectInfo, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("object is a directory: %s", f.Name())
+	}
+
+	buf := make([]byte, 512)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ObjectInfo{}, err
+	}
+
+	contentType := "application/octet-stream"
+	if n > 0 {
+		contentType = http.DetectContentType(buf[:n])
+	}
+	return ObjectInfo{Size: stat.Size(), ContentType: contentType}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,214 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/utils"
+)
+
+// MemoryStorage 将对象保存在进程内存中，仅用于测试和演示，重启后数据丢失
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	uploads map[string]map[int][]byte
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (s *MemoryStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return SaveResult{}, fmt.Errorf("size mismatch: expected %d bytes, got %d", size, len(data))
+	}
+
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+	objectKey := "memory/" + fileID + ext
+	mimeType := http.DetectContentType(data)
+
+	s.mu.Lock()
+	s.objects[objectKey] = memoryObject{data: data, contentType: mimeType, modTime: time.Now()}
+	s.mu.Unlock()
+
+	return SaveResult{ObjectKey: objectKey, Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	obj, err := s.lookup(objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{Size: int64(len(obj.data)), ContentType: obj.contentType}
+	data := obj.data
+	if rangeStart != nil && rangeEnd != nil {
+		if *rangeStart < 0 || *rangeEnd < *rangeStart || *rangeStart >= info.Size {
+			return nil, ObjectInfo{}, fmt.Errorf("invalid range %d-%d for object of size %d", *rangeStart, *rangeEnd, info.Size)
+		}
+		end := *rangeEnd + 1
+		if end > info.Size {
+			end = info.Size
+		}
+		data = data[*rangeStart:end]
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), info, nil
+}
+
+func (s *MemoryStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	obj, err := s.lookup(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: int64(len(obj.data)), ContentType: obj.contentType}, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, objectKey string) error {
+	s.mu.Lock()
+	delete(s.objects, objectKey)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+	upload := MultipartUpload{UploadID: utils.GenerateID(24), ObjectKey: "memory/" + fileID + ext}
+
+	s.mu.Lock()
+	s.uploads[upload.UploadID] = make(map[int][]byte)
+	s.mu.Unlock()
+
+	return upload, nil
+}
+
+func (s *MemoryStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	data, err := io.ReadAll(part.Reader)
+	if err != nil {
+		return PartInfo{}, err
+	}
+	if part.Size >= 0 && int64(len(data)) != part.Size {
+		return PartInfo{}, fmt.Errorf("size mismatch: expected %d bytes, got %d", part.Size, len(data))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts, ok := s.uploads[upload.UploadID]
+	if !ok {
+		return PartInfo{}, fmt.Errorf("upload not found: %s", upload.UploadID)
+	}
+	parts[part.PartNumber] = data
+
+	sum := md5.Sum(data)
+	return PartInfo{PartNumber: part.PartNumber, ETag: hex.EncodeToString(sum[:]), Size: int64(len(data))}, nil
+}
+
+func (s *MemoryStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.uploads[upload.UploadID]
+	if !ok {
+		return SaveResult{}, fmt.Errorf("upload not found: %s", upload.UploadID)
+	}
+
+	var buf bytes.Buffer
+	for _, p := range parts {
+		data, ok := stored[p.PartNumber]
+		if !ok {
+			return SaveResult{}, fmt.Errorf("missing part %d", p.PartNumber)
+		}
+		buf.Write(data)
+	}
+
+	mimeType := http.DetectContentType(buf.Bytes())
+	s.objects[upload.ObjectKey] = memoryObject{data: buf.Bytes(), contentType: mimeType, modTime: time.Now()}
+	delete(s.uploads, upload.UploadID)
+
+	return SaveResult{ObjectKey: upload.ObjectKey, Size: int64(buf.Len()), MimeType: mimeType}, nil
+}
+
+func (s *MemoryStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	s.mu.Lock()
+	delete(s.uploads, upload.UploadID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	s.mu.RLock()
+	entries := make([]ObjectEntry, 0, len(s.objects))
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, QuarantinePrefix) {
+			continue
+		}
+		entries = append(entries, ObjectEntry{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[objectKey]
+	if !ok {
+		return "", fmt.Errorf("object not found: %s", objectKey)
+	}
+	target := QuarantinePrefix + objectKey
+	s.objects[target] = obj
+	delete(s.objects, objectKey)
+	return target, nil
+}
+
+func (s *MemoryStorage) lookup(objectKey string) (memoryObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[objectKey]
+	if !ok {
+		return memoryObject{}, fmt.Errorf("object not found: %s", objectKey)
+	}
+	return obj, nil
+}
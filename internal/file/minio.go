@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -59,11 +60,7 @@ func NewMinioStorage(ctx context.Context, cfg config.MinioConfig) (*MinioStorage
 }
 
 func (s *MinioStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
-	ext := strings.ToLower(filepath.Ext(originalName))
-	if ext == "" {
-		ext = ".bin"
-	}
-	objectKey := time.Now().UTC().Format("2006-01-02") + "/" + fileID + ext
+	objectKey := minioObjectKey(fileID, originalName)
 
 	buf := make([]byte, 512)
 	n, _ := io.ReadFull(reader, buf)
@@ -114,6 +111,106 @@ func (s *MinioStorage) Delete(ctx context.Context, objectKey string) error {
 	return s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{})
 }
 
+func (s *MinioStorage) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *MinioStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	objectKey := minioObjectKey(fileID, originalName)
+	contentType := mime.TypeByExtension(filepath.Ext(originalName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	core := minio.Core{Client: s.client}
+	uploadID, err := core.NewMultipartUpload(ctx, s.bucket, objectKey, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	return MultipartUpload{UploadID: uploadID, ObjectKey: objectKey}, nil
+}
+
+func (s *MinioStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	core := minio.Core{Client: s.client}
+	objectPart, err := core.PutObjectPart(ctx, s.bucket, upload.ObjectKey, upload.UploadID, part.PartNumber, part.Reader, part.Size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return PartInfo{}, err
+	}
+	return PartInfo{PartNumber: part.PartNumber, ETag: objectPart.ETag, Size: objectPart.Size}, nil
+}
+
+func (s *MinioStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+
+	core := minio.Core{Client: s.client}
+	info, err := core.CompleteMultipartUpload(ctx, s.bucket, upload.ObjectKey, upload.UploadID, completeParts, minio.PutObjectOptions{})
+	if err != nil {
+		return SaveResult{}, err
+	}
+
+	mimeType, err := sniffContentType(ctx, s, upload.ObjectKey, info.Size)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	return SaveResult{ObjectKey: upload.ObjectKey, Size: info.Size, MimeType: mimeType}, nil
+}
+
+func (s *MinioStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	core := minio.Core{Client: s.client}
+	return core.AbortMultipartUpload(ctx, s.bucket, upload.ObjectKey, upload.UploadID)
+}
+
+func (s *MinioStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if strings.HasPrefix(object.Key, QuarantinePrefix) {
+			continue
+		}
+		if err := fn(ObjectEntry{Key: object.Key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MinioStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	target := QuarantinePrefix + objectKey
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: target},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: objectKey},
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func minioObjectKey(fileID, originalName string) string {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+	return time.Now().UTC().Format("2006-01-02") + "/" + fileID + ext
+}
+
 func ensureBucket(ctx context.Context, client *minio.Client, bucket string) error {
 	exists, err := client.BucketExists(ctx, bucket)
 	if err != nil {
@@ -0,0 +1,85 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReadSeeker 基于 Storage.Get 的范围读取实现 io.ReadSeeker，
+// Seek 不产生 I/O，只在下一次 Read 时按新偏移量重新打开对象
+type ObjectReadSeeker struct {
+	ctx       context.Context
+	storage   Storage
+	objectKey string
+	size      int64
+	offset    int64
+	reader    io.ReadCloser
+}
+
+func NewObjectReadSeeker(ctx context.Context, storage Storage, objectKey string, size int64) *ObjectReadSeeker {
+	return &ObjectReadSeeker{
+		ctx:       ctx,
+		storage:   storage,
+		objectKey: objectKey,
+		size:      size,
+	}
+}
+
+func (r *ObjectReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.reader == nil {
+		start, end := r.offset, r.size-1
+		reader, _, err := r.storage.Get(r.ctx, r.objectKey, &start, &end)
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *ObjectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if next < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if next != r.offset {
+		r.closeReader()
+		r.offset = next
+	}
+	return next, nil
+}
+
+func (r *ObjectReadSeeker) Close() error {
+	return r.closeReader()
+}
+
+func (r *ObjectReadSeeker) closeReader() error {
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
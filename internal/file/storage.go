@@ -2,7 +2,10 @@ package file
 
 import (
 	"context"
+	"errors"
 	"io"
+	"net/http"
+	"time"
 )
 
 type Storage interface {
@@ -10,6 +13,29 @@ type Storage interface {
 	Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error)
 	Stat(ctx context.Context, objectKey string) (ObjectInfo, error)
 	Delete(ctx context.Context, objectKey string) error
+	// Ping 检查后端是否可达，用于健康检查
+	Ping(ctx context.Context) error
+
+	// 分片上传：CreateMultipart 分配上传 ID，UploadPart 按序号写入分片（offset 为分片在对象中的起始位置），
+	// CompleteMultipart 按分片序号拼接为最终对象，AbortMultipart 丢弃所有已上传分片
+	CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error)
+	UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error)
+	CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error)
+	AbortMultipart(ctx context.Context, upload MultipartUpload) error
+
+	// Walk 遍历所有已提交的对象（不含隔离区与临时数据），fn 返回错误时停止遍历
+	Walk(ctx context.Context, fn func(ObjectEntry) error) error
+	// Quarantine 将对象移入隔离区并返回新的对象键，隔离区中的对象不会再被 Walk 遍历
+	Quarantine(ctx context.Context, objectKey string) (string, error)
+}
+
+// QuarantinePrefix 为隔离区对象键前缀
+const QuarantinePrefix = "quarantine/"
+
+type ObjectEntry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
 }
 
 type SaveResult struct {
@@ -22,3 +48,49 @@ type ObjectInfo struct {
 	Size        int64
 	ContentType string
 }
+
+// MultipartUpload 标识一次进行中的分片上传
+type MultipartUpload struct {
+	UploadID  string
+	ObjectKey string
+}
+
+// PartInput 描述待写入的分片，PartNumber 从 1 开始；Last 表示分片位于对象末尾，加密存储据此标记最后一个分段
+type PartInput struct {
+	PartNumber int
+	Offset     int64
+	Size       int64
+	Reader     io.Reader
+	Last       bool
+}
+
+// PartInfo 描述已写入的分片
+type PartInfo struct {
+	PartNumber int
+	ETag       string
+	Size       int64
+}
+
+// sniffContentType 读取对象开头 512 字节推断 MIME 类型
+func sniffContentType(ctx context.Context, storage Storage, objectKey string, size int64) (string, error) {
+	if size <= 0 {
+		return "application/octet-stream", nil
+	}
+
+	start, end := int64(0), int64(511)
+	if end >= size {
+		end = size - 1
+	}
+	reader, _, err := storage.Get(ctx, objectKey, &start, &end)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,186 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/logger"
+)
+
+// ErrStorageUnavailable 表示存储后端在 degraded 模式下不可用
+var ErrStorageUnavailable = errors.New("storage backend unavailable")
+
+// UnavailableStorage 在 degraded 模式下替代无法连接的后端，所有操作都显式返回错误
+type UnavailableStorage struct {
+	Cause error
+}
+
+func (s *UnavailableStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	return SaveResult{}, s.err()
+}
+
+func (s *UnavailableStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	return nil, ObjectInfo{}, s.err()
+}
+
+func (s *UnavailableStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	return ObjectInfo{}, s.err()
+}
+
+func (s *UnavailableStorage) Delete(ctx context.Context, objectKey string) error {
+	return s.err()
+}
+
+func (s *UnavailableStorage) Ping(ctx context.Context) error {
+	return s.err()
+}
+
+func (s *UnavailableStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	return MultipartUpload{}, s.err()
+}
+
+func (s *UnavailableStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	return PartInfo{}, s.err()
+}
+
+func (s *UnavailableStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	return SaveResult{}, s.err()
+}
+
+func (s *UnavailableStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	return s.err()
+}
+
+func (s *UnavailableStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	return s.err()
+}
+
+func (s *UnavailableStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	return "", s.err()
+}
+
+func (s *UnavailableStorage) err() error {
+	if s.Cause == nil {
+		return ErrStorageUnavailable
+	}
+	return fmt.Errorf("%w: %v", ErrStorageUnavailable, s.Cause)
+}
+
+// DegradedStorage 为 degraded 模式下启动时使用的存储：后端恢复前所有操作返回 ErrStorageUnavailable，
+// Retry 按间隔重新连接后端，连接且 Ping 成功后把所有操作转发给真实的后端
+type DegradedStorage struct {
+	mu      sync.RWMutex
+	backend Storage
+	ready   bool
+	open    func() (Storage, error)
+}
+
+func newDegradedStorage(cause error, open func() (Storage, error)) *DegradedStorage {
+	return &DegradedStorage{backend: &UnavailableStorage{Cause: cause}, open: open}
+}
+
+// Recovered 报告后端是否已经恢复
+func (s *DegradedStorage) Recovered() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ready
+}
+
+// reconnect 尝试连接后端，成功后替换不可用的存储
+func (s *DegradedStorage) reconnect(ctx context.Context) error {
+	if s.Recovered() {
+		return nil
+	}
+	storage, err := s.open()
+	if err == nil {
+		err = storage.Ping(ctx)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.backend = &UnavailableStorage{Cause: err}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	s.backend = storage
+	s.ready = true
+	s.mu.Unlock()
+	return nil
+}
+
+// Retry 每隔 interval 重新连接后端直到成功或 ctx 取消
+func (s *DegradedStorage) Retry(ctx context.Context, interval time.Duration) {
+	log := logger.Get()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := s.reconnect(ctx); err != nil {
+				log.Debug().Err(err).Msg("storage still unavailable")
+				continue
+			}
+			log.Info().Msg("storage backend recovered, leaving degraded mode")
+			return
+		}
+	}()
+}
+
+func (s *DegradedStorage) current() Storage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.backend
+}
+
+func (s *DegradedStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	return s.current().Save(ctx, reader, size, fileID, originalName)
+}
+
+func (s *DegradedStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	return s.current().Get(ctx, objectKey, rangeStart, rangeEnd)
+}
+
+func (s *DegradedStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	return s.current().Stat(ctx, objectKey)
+}
+
+func (s *DegradedStorage) Delete(ctx context.Context, objectKey string) error {
+	return s.current().Delete(ctx, objectKey)
+}
+
+func (s *DegradedStorage) Ping(ctx context.Context) error {
+	return s.current().Ping(ctx)
+}
+
+func (s *DegradedStorage) CreateMultipart(ctx context.Context, fileID, originalName string) (MultipartUpload, error) {
+	return s.current().CreateMultipart(ctx, fileID, originalName)
+}
+
+func (s *DegradedStorage) UploadPart(ctx context.Context, upload MultipartUpload, part PartInput) (PartInfo, error) {
+	return s.current().UploadPart(ctx, upload, part)
+}
+
+func (s *DegradedStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []PartInfo) (SaveResult, error) {
+	return s.current().CompleteMultipart(ctx, upload, parts)
+}
+
+func (s *DegradedStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	return s.current().AbortMultipart(ctx, upload)
+}
+
+func (s *DegradedStorage) Walk(ctx context.Context, fn func(ObjectEntry) error) error {
+	return s.current().Walk(ctx, fn)
+}
+
+func (s *DegradedStorage) Quarantine(ctx context.Context, objectKey string) (string, error) {
+	return s.current().Quarantine(ctx, objectKey)
+}
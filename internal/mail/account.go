@@ -0,0 +1,217 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+// 服务器连接的加密方式
+const (
+	SecurityTLS      = "tls"
+	SecurityStartTLS = "starttls"
+	SecurityPlain    = "plain"
+)
+
+// 登录使用的认证方式。IMAP 的 login 为 LOGIN 命令，其余为 AUTHENTICATE 对应的 SASL 机制
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthXOAuth2 = "xoauth2"
+)
+
+// providerPreset 为预置服务商的服务器地址和加密方式，端口按加密方式取标准端口
+type providerPreset struct {
+	imap config.MailServerConfig
+	smtp config.MailServerConfig
+}
+
+var providerPresets = map[string]providerPreset{
+	"163": {
+		imap: config.MailServerConfig{Host: "imap.163.com", Security: SecurityTLS},
+		smtp: config.MailServerConfig{Host: "smtp.163.com", Security: SecurityTLS},
+	},
+	"126": {
+		imap: config.MailServerConfig{Host: "imap.126.com", Security: SecurityTLS},
+		smtp: config.MailServerConfig{Host: "smtp.126.com", Security: SecurityTLS},
+	},
+	"qq": {
+		imap: config.MailServerConfig{Host: "imap.qq.com", Security: SecurityTLS},
+		smtp: config.MailServerConfig{Host: "smtp.qq.com", Security: SecurityTLS},
+	},
+	"gmail": {
+		imap: config.MailServerConfig{Host: "imap.gmail.com", Security: SecurityTLS},
+		smtp: config.MailServerConfig{Host: "smtp.gmail.com", Security: SecurityTLS},
+	},
+	"outlook": {
+		imap: config.MailServerConfig{Host: "outlook.office365.com", Security: SecurityTLS},
+		smtp: config.MailServerConfig{Host: "smtp.office365.com", Security: SecurityStartTLS},
+	},
+}
+
+var (
+	imapPorts = map[string]int{SecurityTLS: 993, SecurityStartTLS: 143, SecurityPlain: 143}
+	smtpPorts = map[string]int{SecurityTLS: 465, SecurityStartTLS: 587, SecurityPlain: 25}
+)
+
+// imapServer 返回账户的 IMAP 连接设置，未配置的字段使用服务商预置值，认证方式默认为 LOGIN 命令
+func imapServer(account config.AccountConfig) (config.MailServerConfig, error) {
+	preset := providerPresets[account.Provider].imap
+	server, err := resolveServer(account, account.IMAP, preset, imapPorts, AuthLogin)
+	if err != nil {
+		return server, fmt.Errorf("imap: %w", err)
+	}
+	return server, nil
+}
+
+// smtpServer 返回账户的 SMTP 连接设置，未配置的字段使用服务商预置值，认证方式默认为 PLAIN
+func smtpServer(account config.AccountConfig) (config.MailServerConfig, error) {
+	preset := providerPresets[account.Provider].smtp
+	server, err := resolveServer(account, account.SMTP, preset, smtpPorts, AuthPlain)
+	if err != nil {
+		return server, fmt.Errorf("smtp: %w", err)
+	}
+	return server, nil
+}
+
+func resolveServer(account config.AccountConfig, server, preset config.MailServerConfig, ports map[string]int, defaultAuth string) (config.MailServerConfig, error) {
+	if server.Host == "" {
+		server.Host = preset.Host
+	}
+	if server.Host == "" {
+		if account.Provider != "" {
+			return server, fmt.Errorf("unknown provider: %s", account.Provider)
+		}
+		return server, errors.New("host is required when provider is not set")
+	}
+
+	if server.Security == "" {
+		server.Security = preset.Security
+	}
+	if server.Security == "" {
+		server.Security = SecurityTLS
+	}
+	if _, ok := ports[server.Security]; !ok {
+		return server, fmt.Errorf("invalid security %q, must be tls, starttls or plain", server.Security)
+	}
+	// 不加密的连接会以明文发送密码或令牌，只允许连接本机上的测试服务器
+	if server.Security == SecurityPlain && !isLoopbackHost(server.Host) {
+		return server, fmt.Errorf("security plain sends credentials in cleartext and is only allowed for loopback hosts, not %s", server.Host)
+	}
+	if server.Port == 0 {
+		server.Port = ports[server.Security]
+	}
+	if server.Port < 1 || server.Port > 65535 {
+		return server, fmt.Errorf("invalid port %d", server.Port)
+	}
+
+	if server.Auth == "" {
+		server.Auth = defaultAuth
+	}
+	switch server.Auth {
+	case AuthPlain, AuthLogin, AuthXOAuth2:
+	default:
+		return server, fmt.Errorf("invalid auth %q, must be plain, login or xoauth2", server.Auth)
+	}
+	if server.Username == "" {
+		server.Username = account.Email
+	}
+	return server, nil
+}
+
+// isLoopbackHost 判断 host 是否为 localhost 或环回地址
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateAccounts 检查启用的账户的 IMAP 和 SMTP 设置，配置有误时邮件模块初始化失败
+func validateAccounts(list []config.AccountConfig) error {
+	for _, account := range list {
+		if !account.Enabled {
+			continue
+		}
+		if _, err := imapServer(account); err != nil {
+			return fmt.Errorf("mail account %s: %w", account.Email, err)
+		}
+		if _, err := smtpServer(account); err != nil {
+			return fmt.Errorf("mail account %s: %w", account.Email, err)
+		}
+	}
+	return nil
+}
+
+// saslClient 返回 server.Auth 对应的 SASL 客户端，secret 为密码或 OAuth2 访问令牌
+func saslClient(server config.MailServerConfig, secret string) sasl.Client {
+	switch server.Auth {
+	case AuthLogin:
+		return &loginClient{username: server.Username, password: secret}
+	case AuthXOAuth2:
+		return &xoauth2Client{username: server.Username, token: secret}
+	default:
+		return sasl.NewPlainClient("", server.Username, secret)
+	}
+}
+
+// loginClient 为 SASL LOGIN 机制，不带初始响应，按服务器的提示依次发送用户名和密码
+type loginClient struct {
+	username string
+	password string
+	step     int
+}
+
+func (c *loginClient) Start() (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (c *loginClient) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		return []byte(c.username), nil
+	case 2:
+		return []byte(c.password), nil
+	default:
+		return nil, sasl.ErrUnexpectedServerChallenge
+	}
+}
+
+// xoauth2Client 为 Gmail、Outlook 等使用的 XOAUTH2 机制。认证失败时服务器先返回 JSON 格式的错误，
+// 客户端回复空响应后服务器才结束认证
+type xoauth2Client struct {
+	username string
+	token    string
+}
+
+func (c *xoauth2Client) Start() (string, []byte, error) {
+	ir := "user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01"
+	return "XOAUTH2", []byte(ir), nil
+}
+
+func (c *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// smtpAuth 把 SASL 客户端适配为 net/smtp 的认证方式
+type smtpAuth struct {
+	client sasl.Client
+}
+
+func (a smtpAuth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	return a.client.Start()
+}
+
+func (a smtpAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	return a.client.Next(fromServer)
+}
@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+func TestResolveServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		account config.AccountConfig
+		imap    config.MailServerConfig
+		smtp    config.MailServerConfig
+		err     string
+	}{
+		{
+			name:    "preset",
+			account: config.AccountConfig{Provider: "outlook", Email: "me@outlook.com"},
+			imap:    config.MailServerConfig{Host: "outlook.office365.com", Port: 993, Security: SecurityTLS, Auth: AuthLogin, Username: "me@outlook.com"},
+			smtp:    config.MailServerConfig{Host: "smtp.office365.com", Port: 587, Security: SecurityStartTLS, Auth: AuthPlain, Username: "me@outlook.com"},
+		},
+		{
+			name: "explicit settings override the preset",
+			account: config.AccountConfig{
+				Provider: "163",
+				Email:    "me@163.com",
+				IMAP:     config.MailServerConfig{Security: SecurityStartTLS, Auth: AuthXOAuth2},
+				SMTP:     config.MailServerConfig{Host: "relay.example.com", Port: 2525, Username: "relay"},
+			},
+			imap: config.MailServerConfig{Host: "imap.163.com", Port: 143, Security: SecurityStartTLS, Auth: AuthXOAuth2, Username: "me@163.com"},
+			smtp: config.MailServerConfig{Host: "relay.example.com", Port: 2525, Security: SecurityTLS, Auth: AuthPlain, Username: "relay"},
+		},
+		{
+			name: "custom host defaults to tls",
+			account: config.AccountConfig{
+				Email: "me@corp.example",
+				IMAP:  config.MailServerConfig{Host: "mail.corp.example"},
+				SMTP:  config.MailServerConfig{Host: "mail.corp.example", Auth: AuthLogin},
+			},
+			imap: config.MailServerConfig{Host: "mail.corp.example", Port: 993, Security: SecurityTLS, Auth: AuthLogin, Username: "me@corp.example"},
+			smtp: config.MailServerConfig{Host: "mail.corp.example", Port: 465, Security: SecurityTLS, Auth: AuthLogin, Username: "me@corp.example"},
+		},
+		{
+			name: "plain on loopback",
+			account: config.AccountConfig{
+				Email: "me@localhost",
+				IMAP:  config.MailServerConfig{Host: "127.0.0.1", Security: SecurityPlain},
+				SMTP:  config.MailServerConfig{Host: "localhost", Security: SecurityPlain},
+			},
+			imap: config.MailServerConfig{Host: "127.0.0.1", Port: 143, Security: SecurityPlain, Auth: AuthLogin, Username: "me@localhost"},
+			smtp: config.MailServerConfig{Host: "localhost", Port: 25, Security: SecurityPlain, Auth: AuthPlain, Username: "me@localhost"},
+		},
+		{
+			name: "plain on a remote host",
+			account: config.AccountConfig{
+				Provider: "qq",
+				Email:    "me@qq.com",
+				SMTP:     config.MailServerConfig{Security: SecurityPlain},
+			},
+			err: "smtp: security plain",
+		},
+		{
+			name:    "unknown provider",
+			account: config.AccountConfig{Provider: "example", Email: "me@example.com"},
+			err:     "imap: unknown provider",
+		},
+		{
+			name:    "missing host",
+			account: config.AccountConfig{Email: "me@example.com"},
+			err:     "imap: host is required",
+		},
+		{
+			name: "invalid security",
+			account: config.AccountConfig{
+				Provider: "gmail",
+				Email:    "me@gmail.com",
+				IMAP:     config.MailServerConfig{Security: "ssl"},
+			},
+			err: `imap: invalid security "ssl"`,
+		},
+		{
+			name: "invalid auth",
+			account: config.AccountConfig{
+				Provider: "gmail",
+				Email:    "me@gmail.com",
+				SMTP:     config.MailServerConfig{Auth: "cram-md5"},
+			},
+			err: `smtp: invalid auth "cram-md5"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.account.Enabled = true
+			err := validateAccounts([]config.AccountConfig{tt.account})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			imap, _ := imapServer(tt.account)
+			if imap != tt.imap {
+				t.Errorf("imap = %+v, want %+v", imap, tt.imap)
+			}
+			smtp, _ := smtpServer(tt.account)
+			if smtp != tt.smtp {
+				t.Errorf("smtp = %+v, want %+v", smtp, tt.smtp)
+			}
+		})
+	}
+}
@@ -3,22 +3,36 @@ package mail
 import (
 	"crypto/tls"
 	"fmt"
-	"net/smtp"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/emersion/go-imap"
+	id "github.com/emersion/go-imap-id"
 	"github.com/emersion/go-imap/client"
 	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
 )
 
 var (
 	cfg      *config.Config
 	accounts []config.AccountConfig
+	monitor  *Monitor
 )
 
-func Init(mailCfg config.Config) error {
+// Init 加载邮件配置并创建邮件监听器，db 用于保存监听进度和已处理的邮件
+func Init(mailCfg config.Config, db *database.DB) error {
+	if err := validateAccounts(mailCfg.Mail.Accounts); err != nil {
+		return err
+	}
 	cfg = &mailCfg
 	accounts = mailCfg.Mail.Accounts
+	m, err := NewMonitor(mailCfg.Mail, db)
+	if err != nil {
+		return err
+	}
+	monitor = m
 	return nil
 }
 
@@ -26,10 +40,40 @@ func GetConfig() *config.Config {
 	return cfg
 }
 
+// GetMonitor 返回服务端的邮件监听器
+func GetMonitor() *Monitor {
+	return monitor
+}
+
 func ListAccounts() []config.AccountConfig {
 	return accounts
 }
 
+// AccountInfo 为对外展示的账户信息，IMAP 和 SMTP 为补全预置值后实际使用的设置，不含 auth_token
+type AccountInfo struct {
+	Email    string                  `json:"email"`
+	Provider string                  `json:"provider"`
+	Enabled  bool                    `json:"enabled"`
+	IMAP     config.MailServerConfig `json:"imap"`
+	SMTP     config.MailServerConfig `json:"smtp"`
+}
+
+// ListAccountInfo 返回全部账户的展示信息；未启用的账户设置有误时保留其原始配置
+func ListAccountInfo() []AccountInfo {
+	list := make([]AccountInfo, 0, len(accounts))
+	for _, acc := range accounts {
+		info := AccountInfo{Email: acc.Email, Provider: acc.Provider, Enabled: acc.Enabled, IMAP: acc.IMAP, SMTP: acc.SMTP}
+		if server, err := imapServer(acc); err == nil {
+			info.IMAP = server
+		}
+		if server, err := smtpServer(acc); err == nil {
+			info.SMTP = server
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
 func FindAccount(email string) (config.AccountConfig, bool) {
 	for _, acc := range accounts {
 		if acc.Email == email {
@@ -39,11 +83,13 @@ func FindAccount(email string) (config.AccountConfig, bool) {
 	return config.AccountConfig{}, false
 }
 
+// EmailSummary 为最近邮件列表中的一项，UID 可用于取回完整邮件
 type EmailSummary struct {
-	From    string
-	Subject string
-	Date    string
-	Preview string
+	UID     uint32 `json:"uid"`
+	From    string `json:"from"`
+	Subject string `json:"subject"`
+	Date    string `json:"date"`
+	Preview string `json:"preview"`
 }
 
 func GetLatestEmails(accountEmail string, count int) ([]EmailSummary, error) {
@@ -52,26 +98,15 @@ func GetLatestEmails(accountEmail string, count int) ([]EmailSummary, error) {
 		return nil, fmt.Errorf("account not found: %s", accountEmail)
 	}
 
-	imapHost, _ := getProviderSettings(account.Provider)
-	if imapHost == "" {
-		return nil, fmt.Errorf("unknown provider: %s", account.Provider)
-	}
-
-	addr := fmt.Sprintf("%s:993", imapHost)
-	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: imapHost})
+	conn, err := dialIMAP(account)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to IMAP: %v", err)
+		return nil, err
 	}
 	defer conn.Close()
 
-	c, err := client.New(conn)
+	c, err := loginIMAP(conn, account)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create IMAP client: %v", err)
-	}
-	defer c.Logout()
-
-	if err := c.Login(account.Email, account.AuthToken); err != nil {
-		return nil, fmt.Errorf("login failed: %v", err)
+		return nil, err
 	}
 	defer c.Logout()
 
@@ -92,20 +127,18 @@ func GetLatestEmails(accountEmail string, count int) ([]EmailSummary, error) {
 	seqset := new(imap.SeqSet)
 	seqset.AddRange(fromSeqNum, mbox.Messages)
 
-	items := []imap.FetchItem{
-		imap.FetchEnvelope,
+	msgs, err := fetchMessages(c, seqset, false)
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %v", err)
+	}
+	previews, err := fetchPreviews(c, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %v", err)
 	}
 
-	messages := make(chan *imap.Message, 10)
-	done := make(chan error, 1)
-
-	go func() {
-		done <- c.Fetch(seqset, items, messages)
-	}()
-
-	var results []EmailSummary
-	for msg := range messages {
-		summary := EmailSummary{}
+	results := make([]EmailSummary, 0, len(msgs))
+	for _, msg := range msgs {
+		summary := EmailSummary{UID: msg.Uid}
 
 		if len(msg.Envelope.From) > 0 {
 			summary.From = msg.Envelope.From[0].PersonalName
@@ -116,130 +149,161 @@ func GetLatestEmails(accountEmail string, count int) ([]EmailSummary, error) {
 
 		summary.Subject = msg.Envelope.Subject
 		summary.Date = msg.Envelope.Date.Format("2006-01-02 15:04:05")
-		summary.Preview = "(body not fetched)"
+		summary.Preview = ParsePreview(msg, previews[msg.Uid]).Summary
 
 		results = append(results, summary)
 	}
 
-	if err := <-done; err != nil {
-		return nil, fmt.Errorf("fetch failed: %v", err)
-	}
-
 	return results, nil
 }
 
-func SendMail(fromEmail, to, subject, body string) error {
-	account, found := FindAccount(fromEmail)
-	if !found {
-		return fmt.Errorf("account not found: %s", fromEmail)
-	}
-
-	_, smtpHost := getProviderSettings(account.Provider)
-	if smtpHost == "" {
-		return fmt.Errorf("unknown provider: %s", account.Provider)
-	}
+// previewSize 为列表和新邮件通知取回的正文字节数，只用于生成摘要；完整邮件由 GetMessage 取回
+const previewSize = 16 * 1024
 
-	addr := fmt.Sprintf("%s:465", smtpHost)
-	host := smtpHost
+// fetchMessages 取回 seqset 中邮件的信封和 BODYSTRUCTURE，不取正文；uid 为 true 时 seqset 为 UID
+func fetchMessages(c *client.Client, seqset *imap.SeqSet, uid bool) ([]*imap.Message, error) {
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchBodyStructure}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		if uid {
+			done <- c.UidFetch(seqset, items, messages)
+		} else {
+			done <- c.Fetch(seqset, items, messages)
+		}
+	}()
 
-	tlsConfig := &tls.Config{ServerName: host}
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP: %v", err)
+	var msgs []*imap.Message
+	for msg := range messages {
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
 	}
-	defer conn.Close()
+	return msgs, <-done
+}
 
-	c, err := smtp.NewClient(conn, host)
-	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %v", err)
+// fetchPreviews 按 BODYSTRUCTURE 只取回每封邮件文本部分开头的 previewSize 字节并解码，返回 UID 到正文开头的映射。
+// 文本部分位置相同的邮件在同一次 FETCH 中取回，没有文本部分的邮件不在结果中
+func fetchPreviews(c *client.Client, msgs []*imap.Message) (map[uint32]string, error) {
+	type previewGroup struct {
+		section *imap.BodySectionName
+		uids    imap.SeqSet
+		parts   map[uint32]*imap.BodyStructure
 	}
-	defer c.Quit()
-
-	auth := smtp.PlainAuth("", account.Email, account.AuthToken, host)
-	if err := c.Auth(auth); err != nil {
-		return fmt.Errorf("auth failed: %v", err)
+	groups := make(map[imap.FetchItem]*previewGroup)
+	for _, msg := range msgs {
+		section, part := textSection(msg.BodyStructure, previewSize)
+		if section == nil {
+			continue
+		}
+		group := groups[section.FetchItem()]
+		if group == nil {
+			group = &previewGroup{section: section, parts: make(map[uint32]*imap.BodyStructure)}
+			groups[section.FetchItem()] = group
+		}
+		group.uids.AddNum(msg.Uid)
+		group.parts[msg.Uid] = part
 	}
 
-	if err := c.Mail(account.Email); err != nil {
-		return fmt.Errorf("mail from failed: %v", err)
+	previews := make(map[uint32]string, len(msgs))
+	for _, group := range groups {
+		messages := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(&group.uids, []imap.FetchItem{imap.FetchUid, group.section.FetchItem()}, messages)
+		}()
+
+		for msg := range messages {
+			part, body := group.parts[msg.Uid], msg.GetBody(group.section)
+			if part != nil && body != nil {
+				previews[msg.Uid] = decodeText(part, body)
+			}
+		}
+		if err := <-done; err != nil {
+			return nil, err
+		}
 	}
+	return previews, nil
+}
 
-	if err := c.Rcpt(to); err != nil {
-		return fmt.Errorf("rcpt failed: %v", err)
+func TestConnection(email string) (int64, error) {
+	account, found := FindAccount(email)
+	if !found {
+		return 0, fmt.Errorf("account not found: %s", email)
 	}
 
-	w, err := c.Data()
+	start := time.Now()
+
+	conn, err := dialIMAP(account)
 	if err != nil {
-		return fmt.Errorf("data failed: %v", err)
+		return 0, err
 	}
-	defer w.Close()
-
-	msg := fmt.Sprintf(
-		"From: %s\r\n"+
-			"To: %s\r\n"+
-			"Subject: %s\r\n"+
-			"MIME-Version: 1.0\r\n"+
-			"Content-Type: text/plain; charset=utf-8\r\n"+
-			"\r\n"+
-			"%s\r\n",
-		account.Email, to, subject, body)
+	defer conn.Close()
 
-	_, err = w.Write([]byte(msg))
+	c, err := loginIMAP(conn, account)
 	if err != nil {
-		return fmt.Errorf("write failed: %v", err)
+		return 0, err
 	}
+	defer c.Logout()
 
-	return nil
+	latency := time.Since(start).Milliseconds()
+	return latency, nil
 }
 
-func TestConnection(email string) (int64, error) {
-	account, found := FindAccount(email)
-	if !found {
-		return 0, fmt.Errorf("account not found: %s", email)
+// dialIMAP 建立到账户 IMAP 服务器的连接，加密方式为 starttls 或 plain 时返回未加密的连接
+func dialIMAP(account config.AccountConfig) (net.Conn, error) {
+	server, err := imapServer(account)
+	if err != nil {
+		return nil, err
 	}
 
-	imapHost, _ := getProviderSettings(account.Provider)
-	if imapHost == "" {
-		return 0, fmt.Errorf("unknown provider: %s", account.Provider)
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if server.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: server.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP: %v", err)
+	}
+	return conn, nil
+}
 
-	start := time.Now()
-
-	addr := fmt.Sprintf("%s:993", imapHost)
-	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: imapHost})
+// loginIMAP 在 conn 上按需升级 STARTTLS 并登录账户，然后发送 IMAP ID（网易邮箱不接受未标识的客户端选择邮箱）
+func loginIMAP(conn net.Conn, account config.AccountConfig) (*client.Client, error) {
+	server, err := imapServer(account)
 	if err != nil {
-		return 0, fmt.Errorf("failed to connect: %v", err)
+		return nil, err
 	}
-	defer conn.Close()
 
 	c, err := client.New(conn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create IMAP client: %v", err)
+		return nil, fmt.Errorf("failed to create IMAP client: %v", err)
 	}
-	defer c.Logout()
 
-	if err := c.Login(account.Email, account.AuthToken); err != nil {
-		return 0, fmt.Errorf("login failed: %v", err)
+	if server.Security == SecurityStartTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: server.Host}); err != nil {
+			c.Logout()
+			return nil, fmt.Errorf("starttls failed: %v", err)
+		}
 	}
-	defer c.Logout()
 
-	latency := time.Since(start).Milliseconds()
-	return latency, nil
-}
+	if server.Auth == AuthLogin {
+		err = c.Login(server.Username, account.AuthToken)
+	} else {
+		err = c.Authenticate(saslClient(server, account.AuthToken))
+	}
+	if err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("login failed: %v", err)
+	}
 
-func getProviderSettings(provider string) (imapHost, smtpHost string) {
-	switch provider {
-	case "163":
-		return "imap.163.com", "smtp.163.com"
-	case "126":
-		return "imap.126.com", "smtp.126.com"
-	case "qq":
-		return "imap.qq.com", "smtp.qq.com"
-	case "gmail":
-		return "imap.gmail.com", "smtp.gmail.com"
-	case "outlook":
-		return "outlook.office365.com", "smtp.office365.com"
-	default:
-		return "", ""
+	if ok, _ := c.Support("ID"); ok {
+		if _, err := id.NewClient(c).ID(id.ID{id.FieldName: "claw-pliers", id.FieldVersion: "1.0"}); err != nil {
+			logger.Get().Warn().Err(err).Str("email", account.Email).Msg("imap id command failed")
+		}
 	}
+	return c, nil
 }
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+func newTestIMAP(t *testing.T) *client.Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	c, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Logout() })
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFetchPreviewsReadsOnlyTextPart(t *testing.T) {
+	c := newTestIMAP(t)
+
+	text := strings.Repeat("预览内容 preview ", 4096)
+	attachment := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, 256*1024))
+	raw := strings.Join([]string{
+		"From: alice@example.com",
+		"To: bob@example.com",
+		"Subject: report",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="b"`,
+		"",
+		"--b",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString([]byte(text)),
+		"--b",
+		"Content-Type: application/octet-stream",
+		`Content-Disposition: attachment; filename="a.bin"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		attachment,
+		"--b--",
+		"",
+	}, "\r\n")
+	if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatal(err)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(1, 0)
+	msgs, err := fetchMessages(c, seqset, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previews, err := fetchPreviews(c, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 内存后端预置了一封邮件，追加的邮件在最后
+	last := msgs[len(msgs)-1]
+	preview := previews[last.Uid]
+	if !strings.HasPrefix(text, preview) || len(preview) < 1024 || len(preview) > previewSize {
+		t.Fatalf("preview of %d bytes is not a prefix of the text part", len(preview))
+	}
+	if summary := ParsePreview(last, preview).Summary; !strings.HasPrefix(summary, "预览内容") {
+		t.Fatalf("summary = %q", summary)
+	}
+}
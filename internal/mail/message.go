@@ -0,0 +1,227 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+var (
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// Header 为邮件头部的一个字段，Value 已解码 RFC 2047 编码
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AttachmentInfo 描述邮件中的一个附件，Index 从 1 开始，用于下载或保存该附件
+type AttachmentInfo struct {
+	Index       int    `json:"index"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Inline      bool   `json:"inline"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// Attachment 为附件及其解码后的内容
+type Attachment struct {
+	AttachmentInfo
+	Data []byte
+}
+
+// Message 为按 UID 取回的完整邮件。Body 优先取纯文本部分，只有 HTML 时为转换后的 Markdown
+type Message struct {
+	UID         uint32           `json:"uid"`
+	MessageID   string           `json:"message_id"`
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Cc          string           `json:"cc"`
+	ReplyTo     string           `json:"reply_to"`
+	Subject     string           `json:"subject"`
+	Date        time.Time        `json:"date"`
+	Headers     []Header         `json:"headers"`
+	Text        string           `json:"text"`
+	HTML        string           `json:"html"`
+	Body        string           `json:"body"`
+	Attachments []AttachmentInfo `json:"attachments"`
+}
+
+// GetMessage 取回账户 INBOX 中指定 UID 的邮件，只读打开，不会标记为已读
+func GetMessage(accountEmail string, uid uint32) (*Message, error) {
+	msg, raw, err := fetchMessage(accountEmail, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Message{UID: msg.Uid}
+	if msg.Envelope != nil {
+		result.MessageID = msg.Envelope.MessageId
+		result.From = formatAddresses(msg.Envelope.From)
+		result.To = formatAddresses(msg.Envelope.To)
+		result.Cc = formatAddresses(msg.Envelope.Cc)
+		result.ReplyTo = formatAddresses(msg.Envelope.ReplyTo)
+		result.Subject = msg.Envelope.Subject
+		result.Date = msg.Envelope.Date
+	}
+
+	parts, err := readParts(raw)
+	if err != nil {
+		if !errors.Is(err, errNotMIME) {
+			return nil, err
+		}
+		result.Text = string(raw)
+		result.Body = string(raw)
+		result.Headers = []Header{}
+		result.Attachments = []AttachmentInfo{}
+		return result, nil
+	}
+
+	result.Headers = []Header{}
+	fields := parts.header.Fields()
+	for fields.Next() {
+		value, err := fields.Text()
+		if err != nil {
+			value = fields.Value()
+		}
+		result.Headers = append(result.Headers, Header{Name: fields.Key(), Value: value})
+	}
+	if result.Date.IsZero() {
+		result.Date, _ = parts.header.Date()
+	}
+
+	result.Text = parts.plain
+	result.HTML = parts.html
+	result.Body = parts.body()
+	result.Attachments = make([]AttachmentInfo, 0, len(parts.attachments))
+	for _, a := range parts.attachments {
+		result.Attachments = append(result.Attachments, a.AttachmentInfo)
+	}
+	return result, nil
+}
+
+// GetAttachment 取回邮件中序号为 index 的附件，序号与 GetMessage 返回的附件列表一致
+func GetAttachment(accountEmail string, uid uint32, index int) (*Attachment, error) {
+	_, raw, err := fetchMessage(accountEmail, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := readParts(raw)
+	if err != nil && !errors.Is(err, errNotMIME) {
+		return nil, err
+	}
+	if index < 1 || index > len(parts.attachments) {
+		return nil, fmt.Errorf("%w: %d", ErrAttachmentNotFound, index)
+	}
+
+	attachment := parts.attachments[index-1]
+	if attachment.Filename == "" {
+		attachment.Filename = fmt.Sprintf("attachment-%d", index)
+	}
+	return &attachment, nil
+}
+
+// fetchMessage 以只读方式打开 INBOX，按 UID 取回邮件的信封和完整的 RFC 822 内容
+func fetchMessage(accountEmail string, uid uint32) (*imap.Message, []byte, error) {
+	account, ok := FindAccount(accountEmail)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrAccountNotFound, accountEmail)
+	}
+
+	conn, err := dialIMAP(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	c, err := loginIMAP(conn, account)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select("INBOX", true); err != nil {
+		return nil, nil, fmt.Errorf("failed to select inbox: %v", err)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, items, messages)
+	}()
+
+	var fetched *imap.Message
+	var raw []byte
+	for msg := range messages {
+		if msg == nil || msg.Uid != uid {
+			continue
+		}
+		fetched = msg
+		if body := msg.GetBody(section); body != nil {
+			raw, err = io.ReadAll(body)
+		}
+	}
+	if fetchErr := <-done; fetchErr != nil {
+		return nil, nil, fmt.Errorf("fetch failed: %v", fetchErr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read message failed: %v", err)
+	}
+	if fetched == nil {
+		return nil, nil, fmt.Errorf("%w: uid %d", ErrMessageNotFound, uid)
+	}
+	return fetched, raw, nil
+}
+
+// ReplyContext 为回复一封邮件所需的信息：MessageID 和 References 不带尖括号，
+// Subject 已加上 "Re: " 前缀，To 为原邮件的 Reply-To，没有时为发件人
+type ReplyContext struct {
+	MessageID  string
+	References []string
+	Subject    string
+	To         string
+}
+
+// GetReplyContext 取回账户 INBOX 中指定 UID 的邮件，返回回复它时使用的线程头部、主题和收件人
+func GetReplyContext(accountEmail string, uid uint32) (*ReplyContext, error) {
+	msg, raw, err := fetchMessage(accountEmail, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &ReplyContext{}
+	if msg.Envelope != nil {
+		reply.MessageID = strings.Trim(msg.Envelope.MessageId, "<> ")
+		reply.Subject = msg.Envelope.Subject
+		reply.To = formatAddresses(msg.Envelope.ReplyTo)
+		if reply.To == "" {
+			reply.To = formatAddresses(msg.Envelope.From)
+		}
+	}
+	if parts, err := readParts(raw); err == nil {
+		reply.References, _ = parts.header.MsgIDList("References")
+		if reply.MessageID == "" {
+			reply.MessageID, _ = parts.header.MessageID()
+		}
+	}
+	if reply.MessageID != "" {
+		reply.References = append(reply.References, reply.MessageID)
+	}
+	if !strings.HasPrefix(strings.ToLower(reply.Subject), "re:") {
+		reply.Subject = "Re: " + reply.Subject
+	}
+	return reply, nil
+}
@@ -0,0 +1,539 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	minReconnectDelay   = 5 * time.Second
+	maxReconnectDelay   = 5 * time.Minute
+)
+
+// 邮件事件的处理状态
+const (
+	EventPending  = "pending"
+	EventNotified = "notified"
+	EventFailed   = "failed"
+	EventSkipped  = "skipped"
+)
+
+var (
+	ErrAccountNotFound = errors.New("mail account not found")
+	ErrAccountDisabled = errors.New("mail account is disabled")
+)
+
+// MonitorStatus 为单个账户的监听状态。LastUID 为已处理的最大 UID，保存在数据库中，
+// 停止或服务重启后再次启动时从该 UID 之后继续，UIDVALIDITY 变化时重新以当前最大 UID 为基线
+type MonitorStatus struct {
+	Email       string     `json:"email"`
+	Running     bool       `json:"running"`
+	Connected   bool       `json:"connected"`
+	Idle        bool       `json:"idle"`
+	UIDValidity uint32     `json:"uid_validity"`
+	LastUID     uint32     `json:"last_uid"`
+	Received    int64      `json:"received"`
+	Notified    int64      `json:"notified"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	LastPollAt  *time.Time `json:"last_poll_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Monitor 为每个邮箱账户运行一个监听循环：连接后以 INBOX 当前最大 UID 为基线，
+// 通过 IDLE（服务器不支持时轮询）等待新邮件，按 UID 递增取回并推送 webhook；连接断开后按指数退避重连
+type Monitor struct {
+	accounts     []config.AccountConfig
+	webhook      *WebhookClient
+	pollInterval time.Duration
+	idle         bool
+	db           *database.DB
+	logger       *zerolog.Logger
+
+	mu      sync.Mutex
+	running map[string]*monitorRun
+	status  map[string]*MonitorStatus
+}
+
+type monitorRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor 创建邮件监听器，并从数据库恢复各账户上次的监听进度
+func NewMonitor(cfg config.MailConfig, db *database.DB) (*Monitor, error) {
+	l := logger.Get()
+
+	pollInterval := defaultPollInterval
+	if cfg.Monitoring.PollInterval != "" {
+		if v, err := time.ParseDuration(cfg.Monitoring.PollInterval); err == nil && v > 0 {
+			pollInterval = v
+		} else {
+			l.Warn().Str("value", cfg.Monitoring.PollInterval).Msg("invalid mail poll interval, fallback to default")
+		}
+	}
+
+	m := &Monitor{
+		accounts:     cfg.Accounts,
+		webhook:      NewWebhookClient(cfg.Webhook),
+		pollInterval: pollInterval,
+		idle:         cfg.Monitoring.Idle,
+		db:           db,
+		logger:       l,
+		running:      make(map[string]*monitorRun),
+		status:       make(map[string]*MonitorStatus),
+	}
+
+	states, err := db.ListMailAccountStates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mail monitor state: %w", err)
+	}
+	for _, state := range states {
+		status := m.statusLocked(state.Email)
+		status.UIDValidity = state.UIDValidity
+		status.LastUID = state.LastUID
+		status.LastPollAt = state.LastPollAt
+		status.LastError = state.LastError
+	}
+	return m, nil
+}
+
+// Start 开始监听 email 对应的账户，已在监听时不做任何事
+func (m *Monitor) Start(email string) error {
+	account, err := m.account(email)
+	if err != nil {
+		return err
+	}
+	if !account.Enabled {
+		return fmt.Errorf("%w: %s", ErrAccountDisabled, email)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[email]; ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &monitorRun{cancel: cancel, done: make(chan struct{})}
+	m.running[email] = run
+
+	now := time.Now().UTC()
+	status := m.statusLocked(email)
+	status.Running = true
+	status.StartedAt = &now
+	status.LastError = ""
+
+	m.logger.Info().Str("email", email).Msg("mail monitor starting")
+	go m.loop(ctx, account, run)
+	return nil
+}
+
+// StartAll 开始监听所有启用的账户，返回本次新启动的账户数
+func (m *Monitor) StartAll() int {
+	started := 0
+	for _, account := range m.accounts {
+		if !account.Enabled || m.IsRunning(account.Email) {
+			continue
+		}
+		if err := m.Start(account.Email); err == nil {
+			started++
+		}
+	}
+	return started
+}
+
+// Stop 停止监听 email 对应的账户并等待监听循环退出
+func (m *Monitor) Stop(email string) error {
+	if _, err := m.account(email); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	run, ok := m.running[email]
+	delete(m.running, email)
+	m.mu.Unlock()
+
+	if ok {
+		m.logger.Info().Str("email", email).Msg("mail monitor stopping")
+		run.cancel()
+		<-run.done
+	}
+	return nil
+}
+
+// StopAll 停止所有账户的监听，返回本次停止的账户数
+func (m *Monitor) StopAll() int {
+	m.mu.Lock()
+	emails := make([]string, 0, len(m.running))
+	for email := range m.running {
+		emails = append(emails, email)
+	}
+	m.mu.Unlock()
+
+	for _, email := range emails {
+		m.Stop(email)
+	}
+	return len(emails)
+}
+
+func (m *Monitor) IsRunning(email string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.running[email]
+	return ok
+}
+
+// Status 返回所有已配置账户的监听状态，按邮箱排序
+func (m *Monitor) Status() []MonitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]MonitorStatus, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		result = append(result, *m.statusLocked(account.Email))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Email < result[j].Email })
+	return result
+}
+
+// WebhookEnabled 判断新邮件是否会推送到 webhook
+func (m *Monitor) WebhookEnabled() bool {
+	return m.webhook.Enabled()
+}
+
+func (m *Monitor) account(email string) (config.AccountConfig, error) {
+	for _, account := range m.accounts {
+		if account.Email == email {
+			return account, nil
+		}
+	}
+	return config.AccountConfig{}, fmt.Errorf("%w: %s", ErrAccountNotFound, email)
+}
+
+func (m *Monitor) statusLocked(email string) *MonitorStatus {
+	status, ok := m.status[email]
+	if !ok {
+		status = &MonitorStatus{Email: email}
+		m.status[email] = status
+	}
+	return status
+}
+
+func (m *Monitor) updateStatus(email string, fn func(*MonitorStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m.statusLocked(email))
+}
+
+func (m *Monitor) snapshot(email string) MonitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.statusLocked(email)
+}
+
+// loop 反复建立监听会话；会话持续超过最大退避时间说明此前连接正常，退避重新从最小值开始
+func (m *Monitor) loop(ctx context.Context, account config.AccountConfig, run *monitorRun) {
+	defer close(run.done)
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// 停止期间已重新启动时，状态归新的监听循环所有
+		if current, ok := m.running[account.Email]; ok && current != run {
+			return
+		}
+		status := m.statusLocked(account.Email)
+		status.Running = false
+		status.Connected = false
+	}()
+
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := m.session(ctx, account)
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.updateStatus(account.Email, func(s *MonitorStatus) {
+			s.Connected = false
+			s.LastError = err.Error()
+		})
+		m.saveState(account.Email)
+		if time.Since(started) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		m.logger.Warn().Err(err).Str("email", account.Email).Dur("retry_after", delay).Msg("mail monitor disconnected")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// session 连接并登录账户，取回基线之后的新邮件，然后等待下一封新邮件，直到连接出错或 ctx 取消
+func (m *Monitor) session(ctx context.Context, account config.AccountConfig) error {
+	conn, err := dialIMAP(account)
+	if err != nil {
+		return err
+	}
+	// ctx 取消时关闭连接，使阻塞中的 IMAP 命令立即返回
+	stopClose := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopClose()
+	defer conn.Close()
+
+	// 客户端会阻塞直到 Updates 被读取，因此在退出登录之前持续读取，只把新邮件到达转为信号
+	updates := make(chan client.Update, 16)
+	newMail := make(chan struct{}, 1)
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		for {
+			select {
+			case update := <-updates:
+				if _, ok := update.(*client.MailboxUpdate); ok {
+					select {
+					case newMail <- struct{}{}:
+					default:
+					}
+				}
+			case <-sessionDone:
+				return
+			}
+		}
+	}()
+
+	c, err := loginIMAP(conn, account)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+	c.Updates = updates
+
+	mailbox, err := c.Select("INBOX", true)
+	if err != nil {
+		return fmt.Errorf("failed to select inbox: %v", err)
+	}
+
+	lastUID, err := m.baselineUID(c, account.Email, mailbox)
+	if err != nil {
+		return err
+	}
+
+	idle := false
+	if m.idle {
+		idle, _ = c.Support("IDLE")
+	}
+	m.updateStatus(account.Email, func(s *MonitorStatus) {
+		s.Connected = true
+		s.Idle = idle
+		s.UIDValidity = mailbox.UidValidity
+		s.LastUID = lastUID
+		s.LastError = ""
+	})
+	m.saveState(account.Email)
+	m.logger.Info().Str("email", account.Email).Uint32("last_uid", lastUID).Bool("idle", idle).Msg("mail monitor connected")
+
+	for {
+		if err := m.fetchNew(ctx, c, account.Email); err != nil {
+			return err
+		}
+		if err := m.wait(ctx, c, idle, newMail); err != nil {
+			return err
+		}
+	}
+}
+
+// baselineUID 返回本次会话的起始 UID：UIDVALIDITY 未变时沿用已处理的 UID，否则以当前最大 UID 为基线，不通知已有邮件
+func (m *Monitor) baselineUID(c *client.Client, email string, mailbox *imap.MailboxStatus) (uint32, error) {
+	status := m.snapshot(email)
+	if status.LastUID > 0 && status.UIDValidity == mailbox.UidValidity {
+		return status.LastUID, nil
+	}
+
+	if mailbox.UidNext > 1 {
+		return mailbox.UidNext - 1, nil
+	}
+	if mailbox.Messages == 0 {
+		return 0, nil
+	}
+
+	// 服务器未返回 UIDNEXT 时取最后一封邮件的 UID
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(mailbox.Messages)
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	var baseline uint32
+	for msg := range messages {
+		if msg != nil && msg.Uid > baseline {
+			baseline = msg.Uid
+		}
+	}
+	if err := <-done; err != nil {
+		return 0, fmt.Errorf("failed to fetch baseline uid: %v", err)
+	}
+	return baseline, nil
+}
+
+// fetchNew 取回 LastUID 之后的邮件并逐封推送 webhook。每封邮件推送前先写入邮件事件，
+// 已有事件的邮件说明此前处理过，只推进 LastUID 不再推送；推送失败只记录在事件中，不会重试
+func (m *Monitor) fetchNew(ctx context.Context, c *client.Client, email string) error {
+	current := m.snapshot(email)
+	lastUID := current.LastUID
+
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(lastUID+1, 0)
+	fetched, err := fetchMessages(c, seqset, true)
+	if err != nil {
+		return fmt.Errorf("failed to fetch new emails: %v", err)
+	}
+
+	// UID 范围 N:* 在没有新邮件时仍会返回最后一封邮件
+	msgs := make([]*imap.Message, 0, len(fetched))
+	for _, msg := range fetched {
+		if msg.Uid > lastUID {
+			msgs = append(msgs, msg)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Uid < msgs[j].Uid })
+
+	previews, err := fetchPreviews(c, msgs)
+	if err != nil {
+		return fmt.Errorf("failed to fetch new emails: %v", err)
+	}
+
+	for _, msg := range msgs {
+		parsed := ParsePreview(msg, previews[msg.Uid])
+		if parsed.Date.IsZero() {
+			parsed.Date = time.Now()
+		}
+		m.logger.Info().Str("email", email).Uint32("uid", msg.Uid).Str("from", parsed.From).Str("subject", parsed.Subject).Msg("new email received")
+
+		notified, err := m.process(ctx, email, current.UIDValidity, parsed)
+		if err != nil {
+			return err
+		}
+
+		m.updateStatus(email, func(s *MonitorStatus) {
+			s.LastUID = msg.Uid
+			s.Received++
+			if notified {
+				s.Notified++
+			}
+		})
+		m.saveState(email)
+	}
+
+	now := time.Now().UTC()
+	m.updateStatus(email, func(s *MonitorStatus) { s.LastPollAt = &now })
+	m.saveState(email)
+	return nil
+}
+
+// process 记录一封新邮件的事件并推送 webhook，返回是否推送成功；邮件已有事件时跳过
+func (m *Monitor) process(ctx context.Context, email string, uidValidity uint32, parsed ParsedEmail) (bool, error) {
+	event := &database.MailEvent{
+		Account:     email,
+		UIDValidity: uidValidity,
+		UID:         parsed.UID,
+		MessageID:   parsed.MessageID,
+		From:        parsed.From,
+		To:          parsed.To,
+		Subject:     parsed.Subject,
+		Summary:     parsed.Summary,
+		ReceivedAt:  parsed.Date.UTC(),
+		Status:      EventPending,
+	}
+	created, err := m.db.CreateMailEvent(event)
+	if err != nil {
+		return false, fmt.Errorf("failed to record mail event: %w", err)
+	}
+	if !created {
+		m.logger.Info().Str("email", email).Uint32("uid", parsed.UID).Msg("email already processed, skip notification")
+		return false, nil
+	}
+
+	status, message := EventSkipped, ""
+	if m.webhook.Enabled() {
+		if err := m.webhook.Send(ctx, FormatNotification(email, parsed)); err != nil {
+			m.logger.Warn().Err(err).Str("email", email).Uint32("uid", parsed.UID).Msg("failed to deliver mail webhook")
+			status, message = EventFailed, err.Error()
+		} else {
+			status = EventNotified
+		}
+	}
+	if err := m.db.UpdateMailEventStatus(event.ID, status, message); err != nil {
+		m.logger.Warn().Err(err).Str("email", email).Uint32("uid", parsed.UID).Msg("failed to update mail event")
+	}
+	return status == EventNotified, nil
+}
+
+// saveState 把账户当前的监听进度写入数据库，失败只记录日志
+func (m *Monitor) saveState(email string) {
+	status := m.snapshot(email)
+	state := &database.MailAccountState{
+		Email:       email,
+		UIDValidity: status.UIDValidity,
+		LastUID:     status.LastUID,
+		LastError:   status.LastError,
+		LastPollAt:  status.LastPollAt,
+	}
+	if err := m.db.SaveMailAccountState(state); err != nil {
+		m.logger.Warn().Err(err).Str("email", email).Msg("failed to save mail monitor state")
+	}
+}
+
+// wait 阻塞到有新邮件到达：IDLE 模式下等待服务器推送，否则等待一个轮询间隔
+func (m *Monitor) wait(ctx context.Context, c *client.Client, idle bool, newMail <-chan struct{}) error {
+	if !idle {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.pollInterval):
+			return nil
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop, &client.IdleOptions{PollInterval: m.pollInterval})
+	}()
+
+	select {
+	case <-newMail:
+		close(stop)
+		return <-done
+	case err := <-done:
+		if err == nil {
+			err = errors.New("idle ended unexpectedly")
+		}
+		return err
+	case <-ctx.Done():
+		close(stop)
+		<-done
+		return ctx.Err()
+	}
+}
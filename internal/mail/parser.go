@@ -0,0 +1,267 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+
+	html2markdown "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message/charset"
+	gomail "github.com/emersion/go-message/mail"
+)
+
+// ParsedEmail 为解析后的邮件，Body 优先取纯文本部分，只有 HTML 时转换为 Markdown
+type ParsedEmail struct {
+	MessageID string
+	From      string
+	To        string
+	Subject   string
+	Date      time.Time
+	Body      string
+	Summary   string
+	UID       uint32
+}
+
+// ParseMessage 从 IMAP 信封和完整的 RFC 822 正文解析邮件，body 为 nil 时只填充信封字段
+func ParseMessage(msg *imap.Message, body io.Reader) (ParsedEmail, error) {
+	parsed := ParsedEmail{}
+	if msg != nil {
+		parsed.UID = msg.Uid
+		if msg.Envelope != nil {
+			parsed.MessageID = msg.Envelope.MessageId
+			parsed.Subject = msg.Envelope.Subject
+			parsed.Date = msg.Envelope.Date
+			parsed.From = formatAddresses(msg.Envelope.From)
+			parsed.To = formatAddresses(msg.Envelope.To)
+		}
+	}
+
+	if body == nil {
+		return parsed, nil
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return parsed, fmt.Errorf("read body failed: %w", err)
+	}
+
+	parts, err := readParts(raw)
+	if err != nil {
+		if errors.Is(err, errNotMIME) {
+			parsed.Body = strings.TrimSpace(string(raw))
+			parsed.Summary = summarize(parsed.Body)
+			return parsed, nil
+		}
+		return parsed, err
+	}
+
+	parsed.Body = parts.body()
+	if parsed.Body == "" {
+		parsed.Body = strings.TrimSpace(string(raw))
+	}
+	parsed.Summary = summarize(parsed.Body)
+	return parsed, nil
+}
+
+// ParsePreview 从信封和正文文本部分的开头解析邮件，Body 只含取回的部分，用于列表和新邮件通知的摘要
+func ParsePreview(msg *imap.Message, text string) ParsedEmail {
+	parsed, _ := ParseMessage(msg, nil)
+	parsed.Body = text
+	parsed.Summary = summarize(text)
+	return parsed
+}
+
+var errNotMIME = errors.New("not a mime message")
+
+// messageParts 为遍历邮件 MIME 结构得到的头部、正文和附件
+type messageParts struct {
+	header      gomail.Header
+	plain       string
+	html        string
+	attachments []Attachment
+}
+
+// body 返回用于展示的正文：优先纯文本部分，只有 HTML 时转换为 Markdown
+func (p messageParts) body() string {
+	if p.plain != "" {
+		return p.plain
+	}
+	if p.html != "" {
+		return convertHTML(p.html)
+	}
+	return ""
+}
+
+// readParts 解析完整的 RFC 822 邮件，取第一个 text/plain 和 text/html 部分作为正文，
+// 其余带 Content-Disposition: attachment 的部分和非文本的内联部分（如正文引用的图片）按顺序作为附件，序号从 1 开始
+func readParts(raw []byte) (messageParts, error) {
+	mr, err := gomail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return messageParts{}, fmt.Errorf("%w: %v", errNotMIME, err)
+	}
+
+	parts := messageParts{header: mr.Header}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return parts, fmt.Errorf("read multipart failed: %w", err)
+		}
+
+		var disposition gomail.AttachmentHeader
+		inline := true
+		switch header := part.Header.(type) {
+		case *gomail.InlineHeader:
+			partType, _, _ := header.ContentType()
+			if strings.Contains(partType, "text/plain") || strings.Contains(partType, "text/html") {
+				content, _ := io.ReadAll(part.Body)
+				text := strings.TrimSpace(string(content))
+				if strings.Contains(partType, "text/plain") && parts.plain == "" {
+					parts.plain = text
+				} else if strings.Contains(partType, "text/html") && parts.html == "" {
+					parts.html = text
+				}
+				continue
+			}
+			disposition = gomail.AttachmentHeader{Header: header.Header}
+		case *gomail.AttachmentHeader:
+			disposition = *header
+			inline = false
+		default:
+			continue
+		}
+
+		data, err := io.ReadAll(part.Body)
+		if err != nil {
+			return parts, fmt.Errorf("read attachment failed: %w", err)
+		}
+		contentType, _, _ := disposition.ContentType()
+		filename, _ := disposition.Filename()
+		parts.attachments = append(parts.attachments, Attachment{
+			AttachmentInfo: AttachmentInfo{
+				Index:       len(parts.attachments) + 1,
+				Filename:    filename,
+				ContentType: contentType,
+				Size:        int64(len(data)),
+				Inline:      inline,
+				ContentID:   strings.Trim(disposition.Get("Content-Id"), "<>"),
+			},
+			Data: data,
+		})
+	}
+	return parts, nil
+}
+
+// textSection 在 BODYSTRUCTURE 中查找第一个不是附件的 text/plain 部分，没有时取 text/html，
+// 返回只取该部分开头 size 字节的 section；没有文本部分时返回 nil
+func textSection(bs *imap.BodyStructure, size int) (*imap.BodySectionName, *imap.BodyStructure) {
+	if bs == nil {
+		return nil, nil
+	}
+
+	var plainPath, htmlPath []int
+	var plain, html *imap.BodyStructure
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if !strings.EqualFold(part.MIMEType, "text") || strings.EqualFold(part.Disposition, "attachment") {
+			return true
+		}
+		switch {
+		case strings.EqualFold(part.MIMESubType, "plain") && plain == nil:
+			plainPath, plain = path, part
+		case strings.EqualFold(part.MIMESubType, "html") && html == nil:
+			htmlPath, html = path, part
+		}
+		return true
+	})
+
+	path, part := plainPath, plain
+	if part == nil {
+		path, part = htmlPath, html
+	}
+	if part == nil {
+		return nil, nil
+	}
+	return &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Path: path},
+		Peek:         true,
+		Partial:      []int{0, size},
+	}, part
+}
+
+// decodeText 按部分的传输编码和字符集解码正文，被截断的正文在末尾不完整的编码单元处结束；HTML 转换为 Markdown
+func decodeText(part *imap.BodyStructure, body io.Reader) string {
+	reader := body
+	switch strings.ToLower(part.Encoding) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, reader)
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(reader)
+	}
+	if label := part.Params["charset"]; label != "" {
+		if decoded, err := charset.Reader(label, reader); err == nil {
+			reader = decoded
+		}
+	}
+
+	// 截断处可能落在多字节字符中间
+	data, _ := io.ReadAll(reader)
+	text := strings.TrimSpace(strings.ToValidUTF8(string(data), ""))
+	if strings.EqualFold(part.MIMESubType, "html") {
+		return convertHTML(text)
+	}
+	return text
+}
+
+func formatAddresses(list []*imap.Address) string {
+	if len(list) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(list))
+	for _, addr := range list {
+		if addr == nil {
+			continue
+		}
+		email := addr.MailboxName + "@" + addr.HostName
+		if addr.PersonalName != "" {
+			parts = append(parts, fmt.Sprintf("%s <%s>", addr.PersonalName, email))
+		} else {
+			parts = append(parts, email)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func convertHTML(content string) string {
+	converter := html2markdown.NewConverter("", true, nil)
+	markdown, err := converter.ConvertString(content)
+	if err != nil {
+		return strings.TrimSpace(content)
+	}
+	return strings.TrimSpace(markdown)
+}
+
+// summarize 截取正文前 300 个字符作为通知摘要
+func summarize(content string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "(空内容)"
+	}
+
+	const limit = 300
+	runes := []rune(content)
+	if len(runes) <= limit {
+		return content
+	}
+
+	return string(runes[:limit]) + "..."
+}
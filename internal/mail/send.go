@@ -0,0 +1,330 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gomail "github.com/emersion/go-message/mail"
+	"github.com/kiry163/claw-pliers/internal/config"
+)
+
+// MaxAttachmentsSize 为一封邮件中附件的总大小上限，多数邮件服务器拒收超过 25 MB 的邮件
+const MaxAttachmentsSize = 25 << 20
+
+// ErrInvalidMessage 表示待发送的邮件不完整或包含无效的地址、头部
+var ErrInvalidMessage = errors.New("invalid message")
+
+// 自定义头部不能覆盖的字段，这些字段由邮件结构和收件人决定
+var reservedHeaders = map[string]bool{
+	"from": true, "to": true, "cc": true, "bcc": true, "subject": true, "date": true,
+	"message-id": true, "in-reply-to": true, "references": true, "mime-version": true,
+	"content-type": true, "content-transfer-encoding": true, "content-disposition": true,
+}
+
+var headerNamePattern = regexp.MustCompile(`^[!-9;-~]+$`)
+
+// msgIDInvalidChars 为不带尖括号的 Message-ID 中不能出现的字符
+const msgIDInvalidChars = "<>\r\n\t "
+
+// OutgoingAttachment 为待发送邮件的附件
+type OutgoingAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// OutgoingMessage 为待发送的邮件。To、Cc、Bcc 的每一项可以是单个地址或逗号分隔的多个地址，
+// Text 和 HTML 同时提供时作为 multipart/alternative 发送；InReplyTo 和 References 不带尖括号
+type OutgoingMessage struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Text        string
+	HTML        string
+	Headers     map[string]string
+	InReplyTo   string
+	References  []string
+	Attachments []OutgoingAttachment
+}
+
+// Send 通过 From 对应账户的 SMTP 服务器发送邮件，Bcc 只作为收件人投递，不出现在邮件头中
+func Send(msg OutgoingMessage) error {
+	account, ok := FindAccount(msg.From)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAccountNotFound, msg.From)
+	}
+
+	to, err := parseAddresses(msg.To)
+	if err != nil {
+		return err
+	}
+	cc, err := parseAddresses(msg.Cc)
+	if err != nil {
+		return err
+	}
+	bcc, err := parseAddresses(msg.Bcc)
+	if err != nil {
+		return err
+	}
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return fmt.Errorf("%w: at least one recipient is required", ErrInvalidMessage)
+	}
+
+	raw, err := buildMessage(&gomail.Address{Address: account.Email}, to, cc, msg)
+	if err != nil {
+		return err
+	}
+
+	c, err := dialSMTP(account)
+	if err != nil {
+		return err
+	}
+	defer c.Quit()
+
+	if err := c.Mail(account.Email); err != nil {
+		return fmt.Errorf("mail from failed: %v", err)
+	}
+	for _, list := range [][]*gomail.Address{to, cc, bcc} {
+		for _, addr := range list {
+			if err := c.Rcpt(addr.Address); err != nil {
+				return fmt.Errorf("rcpt %s failed: %v", addr.Address, err)
+			}
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data failed: %v", err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		w.Close()
+		return fmt.Errorf("write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send failed: %v", err)
+	}
+	return nil
+}
+
+// buildMessage 生成 MIME 邮件：有附件时为 multipart/mixed，正文同时有纯文本和 HTML 时为 multipart/alternative；
+// 非 ASCII 的头部按 RFC 2047 编码
+func buildMessage(from *gomail.Address, to, cc []*gomail.Address, msg OutgoingMessage) ([]byte, error) {
+	if msg.Text == "" && msg.HTML == "" {
+		return nil, fmt.Errorf("%w: body or html is required", ErrInvalidMessage)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("%w: subject contains a line break", ErrInvalidMessage)
+	}
+	for _, id := range append([]string{msg.InReplyTo}, msg.References...) {
+		if strings.ContainsAny(id, msgIDInvalidChars) {
+			return nil, fmt.Errorf("%w: message id %q", ErrInvalidMessage, id)
+		}
+	}
+
+	var h gomail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*gomail.Address{from})
+	if len(to) > 0 {
+		h.SetAddressList("To", to)
+	}
+	if len(cc) > 0 {
+		h.SetAddressList("Cc", cc)
+	}
+	h.SetSubject(msg.Subject)
+	if err := h.GenerateMessageID(); err != nil {
+		return nil, fmt.Errorf("generate message id failed: %w", err)
+	}
+	if msg.InReplyTo != "" {
+		h.SetMsgIDList("In-Reply-To", []string{msg.InReplyTo})
+	}
+	if len(msg.References) > 0 {
+		h.SetMsgIDList("References", msg.References)
+	}
+	for name, value := range msg.Headers {
+		if !headerNamePattern.MatchString(name) || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%w: header %q", ErrInvalidMessage, name)
+		}
+		if reservedHeaders[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%w: header %s cannot be set", ErrInvalidMessage, name)
+		}
+		h.Set(name, mime.QEncoding.Encode("utf-8", value))
+	}
+
+	var total int
+	for _, a := range msg.Attachments {
+		total += len(a.Data)
+	}
+	if total > MaxAttachmentsSize {
+		return nil, fmt.Errorf("%w: attachments exceed %d MB", ErrInvalidMessage, MaxAttachmentsSize>>20)
+	}
+
+	var buf bytes.Buffer
+	if len(msg.Attachments) == 0 {
+		if err := writeBody(&buf, h, nil, msg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw, err := gomail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBody(nil, h, mw, msg); err != nil {
+		return nil, err
+	}
+	for _, a := range msg.Attachments {
+		var ah gomail.AttachmentHeader
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		// 重新格式化调用方提供的类型，参数中的换行等字符不会原样写入头部
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: attachment %q content type: %v", ErrInvalidMessage, a.Filename, err)
+		}
+		ah.SetContentType(mediaType, params)
+		ah.SetFilename(a.Filename)
+
+		w, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(a.Data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody 写入正文：mw 为 nil 时正文即整封邮件，否则作为 multipart/mixed 的第一部分
+func writeBody(w io.Writer, h gomail.Header, mw *gomail.Writer, msg OutgoingMessage) error {
+	parts := make([]gomail.InlineHeader, 0, 2)
+	bodies := make([]string, 0, 2)
+	if msg.Text != "" {
+		var ph gomail.InlineHeader
+		ph.Set("Content-Type", "text/plain; charset=utf-8")
+		parts, bodies = append(parts, ph), append(bodies, msg.Text)
+	}
+	if msg.HTML != "" {
+		var ph gomail.InlineHeader
+		ph.Set("Content-Type", "text/html; charset=utf-8")
+		parts, bodies = append(parts, ph), append(bodies, msg.HTML)
+	}
+
+	if len(parts) == 1 {
+		var pw io.WriteCloser
+		var err error
+		if mw == nil {
+			h.Set("Content-Type", parts[0].Get("Content-Type"))
+			pw, err = gomail.CreateSingleInlineWriter(w, h)
+		} else {
+			pw, err = mw.CreateSingleInline(parts[0])
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, bodies[0]); err != nil {
+			return err
+		}
+		return pw.Close()
+	}
+
+	var iw *gomail.InlineWriter
+	var err error
+	if mw == nil {
+		iw, err = gomail.CreateInlineWriter(w, h)
+	} else {
+		iw, err = mw.CreateInline()
+	}
+	if err != nil {
+		return err
+	}
+	for i, ph := range parts {
+		pw, err := iw.CreatePart(ph)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, bodies[i]); err != nil {
+			return err
+		}
+		if err := pw.Close(); err != nil {
+			return err
+		}
+	}
+	return iw.Close()
+}
+
+func parseAddresses(values []string) ([]*gomail.Address, error) {
+	var result []*gomail.Address
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		list, err := gomail.ParseAddressList(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: address %q: %v", ErrInvalidMessage, value, err)
+		}
+		result = append(result, list...)
+	}
+	return result, nil
+}
+
+// dialSMTP 按账户的加密方式连接 SMTP 服务器并登录
+func dialSMTP(account config.AccountConfig) (*smtp.Client, error) {
+	server, err := smtpServer(account)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	tlsConfig := &tls.Config{ServerName: server.Host}
+	var conn net.Conn
+	if server.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP: %v", err)
+	}
+
+	c, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create SMTP client: %v", err)
+	}
+
+	if server.Security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("starttls failed: %v", err)
+		}
+	}
+
+	if err := c.Auth(smtpAuth{client: saslClient(server, account.AuthToken)}); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("auth failed: %v", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,197 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+var testFrom = &gomail.Address{Address: "me@example.com"}
+
+// readSent 解析邮件，返回邮件头和各叶子部分的 Content-Type、文件名及内容
+func readSent(t *testing.T, raw []byte) (gomail.Header, []testPart) {
+	t.Helper()
+	r, err := gomail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	var parts []testPart
+	for {
+		p, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		body, err := io.ReadAll(p.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part := testPart{body: string(body)}
+		switch h := p.Header.(type) {
+		case *gomail.InlineHeader:
+			part.contentType, _, _ = h.ContentType()
+		case *gomail.AttachmentHeader:
+			part.contentType, _, _ = h.ContentType()
+			part.filename, _ = h.Filename()
+		}
+		parts = append(parts, part)
+	}
+	return r.Header, parts
+}
+
+type testPart struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+// headerSection 返回邮件头部分的原始内容
+func headerSection(raw []byte) string {
+	header, _, _ := strings.Cut(string(raw), "\r\n\r\n")
+	return header
+}
+
+func TestBuildMessageEncodesHeaders(t *testing.T) {
+	to, err := parseAddresses([]string{"张三 <zhang@example.com>, bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := buildMessage(testFrom, to, nil, OutgoingMessage{
+		Subject:    "季度报告 Q3",
+		Text:       "正文",
+		Headers:    map[string]string{"X-Note": "备注"},
+		InReplyTo:  "orig@example.com",
+		References: []string{"first@example.com", "orig@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 邮件头只含 ASCII，非 ASCII 的内容按 RFC 2047 编码
+	header := headerSection(raw)
+	for _, c := range []byte(header) {
+		if c >= 0x80 {
+			t.Fatalf("header contains 8-bit data:\n%s", header)
+		}
+	}
+	if !strings.Contains(header, "=?utf-8?") {
+		t.Fatalf("header is not RFC 2047 encoded:\n%s", header)
+	}
+
+	h, parts := readSent(t, raw)
+	if subject, _ := h.Subject(); subject != "季度报告 Q3" {
+		t.Errorf("subject = %q", subject)
+	}
+	if list, _ := h.AddressList("To"); len(list) != 2 || list[0].Name != "张三" || list[1].Address != "bob@example.com" {
+		t.Errorf("to = %v", list)
+	}
+	if note, _ := h.Text("X-Note"); note != "备注" {
+		t.Errorf("X-Note = %q", note)
+	}
+	if got := h.Get("In-Reply-To"); got != "<orig@example.com>" {
+		t.Errorf("In-Reply-To = %q", got)
+	}
+	if refs, _ := h.MsgIDList("References"); len(refs) != 2 || refs[0] != "first@example.com" {
+		t.Errorf("References = %v", refs)
+	}
+	if id, _ := h.MessageID(); id == "" {
+		t.Error("missing Message-ID")
+	}
+	if len(parts) != 1 || parts[0].contentType != "text/plain" || parts[0].body != "正文" {
+		t.Errorf("parts = %+v", parts)
+	}
+}
+
+func TestBuildMessageStructure(t *testing.T) {
+	alternative, err := buildMessage(testFrom, nil, nil, OutgoingMessage{Text: "plain", HTML: "<p>html</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, parts := readSent(t, alternative)
+	if mediaType, _, _ := h.ContentType(); mediaType != "multipart/alternative" {
+		t.Errorf("text and html: %s", mediaType)
+	}
+	if len(parts) != 2 || parts[0].contentType != "text/plain" || parts[1].contentType != "text/html" || parts[1].body != "<p>html</p>" {
+		t.Errorf("alternative parts = %+v", parts)
+	}
+
+	mixed, err := buildMessage(testFrom, nil, nil, OutgoingMessage{
+		Text: "plain",
+		HTML: "<p>html</p>",
+		Attachments: []OutgoingAttachment{
+			{Filename: "报告.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")},
+			{Filename: "data.bin", Data: []byte{0, 1, 2, 0xff}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, parts = readSent(t, mixed)
+	if mediaType, _, _ := h.ContentType(); mediaType != "multipart/mixed" {
+		t.Errorf("with attachments: %s", mediaType)
+	}
+	want := []testPart{
+		{contentType: "text/plain", body: "plain"},
+		{contentType: "text/html", body: "<p>html</p>"},
+		{contentType: "application/pdf", filename: "报告.pdf", body: "%PDF-1.4"},
+		{contentType: "application/octet-stream", filename: "data.bin", body: "\x00\x01\x02\xff"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("mixed parts = %+v", parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
+
+func TestBuildMessageRejectsInjection(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  OutgoingMessage
+	}{
+		{"no body", OutgoingMessage{Subject: "empty"}},
+		{"subject line break", OutgoingMessage{Subject: "hi\r\nBcc: evil@example.com", Text: "x"}},
+		{"header value line break", OutgoingMessage{Text: "x", Headers: map[string]string{"X-Note": "a\r\nBcc: evil@example.com"}}},
+		{"header name", OutgoingMessage{Text: "x", Headers: map[string]string{"X-Note: a\r\nBcc": "evil@example.com"}}},
+		{"header name with colon", OutgoingMessage{Text: "x", Headers: map[string]string{"Bcc:": "evil@example.com"}}},
+		{"reserved header", OutgoingMessage{Text: "x", Headers: map[string]string{"bcc": "evil@example.com"}}},
+		{"reserved content type", OutgoingMessage{Text: "x", Headers: map[string]string{"Content-Type": "text/html"}}},
+		{"in-reply-to", OutgoingMessage{Text: "x", InReplyTo: "a@b>\r\nBcc: evil@example.com"}},
+		{"references", OutgoingMessage{Text: "x", References: []string{"a@b> <c@d"}}},
+		{"attachment content type", OutgoingMessage{Text: "x", Attachments: []OutgoingAttachment{
+			{Filename: "a.txt", ContentType: "text/plain\r\nBcc: evil@example.com", Data: []byte("x")},
+		}}},
+		{"attachments too large", OutgoingMessage{Text: "x", Attachments: []OutgoingAttachment{
+			{Filename: "a.bin", Data: make([]byte, MaxAttachmentsSize/2+1)},
+			{Filename: "b.bin", Data: make([]byte, MaxAttachmentsSize/2)},
+		}}},
+	}
+	for _, tt := range tests {
+		if _, err := buildMessage(testFrom, nil, nil, tt.msg); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	// 附件文件名中的换行被编码，不会产生新的头部
+	raw, err := buildMessage(testFrom, nil, nil, OutgoingMessage{Text: "x", Attachments: []OutgoingAttachment{
+		{Filename: "a\r\nBcc: evil.txt", Data: []byte("x")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "\r\nBcc:") {
+		t.Fatalf("filename injected a header:\n%s", raw)
+	}
+
+	if _, err := parseAddresses([]string{"\"Evil\r\nBcc: x@example.com\" <a@example.com>"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("address with line break: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/logger"
+)
+
+const (
+	webhookName    = "EmailMonitor"
+	webhookChannel = "feishu"
+)
+
+// ErrWebhookDisabled 表示未启用 webhook，新邮件不会推送
+var ErrWebhookDisabled = errors.New("webhook is disabled")
+
+// WebhookClient 把新邮件通知推送到 mail.webhook.url
+type WebhookClient struct {
+	cfg        config.WebhookConfig
+	httpClient *http.Client
+}
+
+type webhookPayload struct {
+	Message    string `json:"message"`
+	Name       string `json:"name"`
+	Deliver    bool   `json:"deliver"`
+	Channel    string `json:"channel"`
+	To         string `json:"to,omitempty"`
+	SessionKey string `json:"session_key,omitempty"`
+}
+
+func NewWebhookClient(cfg config.WebhookConfig) *WebhookClient {
+	return &WebhookClient{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled 判断是否启用了 webhook 并配置了地址
+func (w *WebhookClient) Enabled() bool {
+	return w.cfg.Enable && w.cfg.URL != ""
+}
+
+// Send 推送一条通知；配置了合法的 custom_payload 时原样发送该 JSON，否则发送默认格式
+func (w *WebhookClient) Send(ctx context.Context, message string) error {
+	if !w.Enabled() {
+		return ErrWebhookDisabled
+	}
+
+	var body []byte
+	if custom := strings.TrimSpace(w.cfg.CustomPayload); custom != "" {
+		if json.Valid([]byte(custom)) {
+			body = []byte(custom)
+		} else {
+			logger.Get().Warn().Msg("invalid custom webhook payload, fallback to default")
+		}
+	}
+	if len(body) == 0 {
+		var err error
+		body, err = json.Marshal(webhookPayload{
+			Message:    message,
+			Name:       webhookName,
+			Deliver:    true,
+			Channel:    webhookChannel,
+			To:         w.cfg.To,
+			SessionKey: w.cfg.SessionKey,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal webhook payload failed: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.cfg.Token)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// FormatNotification 生成新邮件通知的 Markdown 文本
+func FormatNotification(account string, email ParsedEmail) string {
+	lines := []string{
+		"## \U0001F4E7 新邮件通知",
+		"",
+		fmt.Sprintf("**账户：** %s", account),
+		fmt.Sprintf("**发件人：** %s", email.From),
+		fmt.Sprintf("**收件人：** %s", email.To),
+		fmt.Sprintf("**主题：** %s", email.Subject),
+		fmt.Sprintf("**时间：** %s", email.Date.Format("2006-01-02 15:04:05")),
+		"",
+		"---",
+		"",
+		"### 邮件摘要",
+		"",
+		email.Summary,
+		"",
+		"---",
+		"*来自 claw-pliers*",
+	}
+
+	return strings.Join(lines, "\n")
+}
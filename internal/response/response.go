@@ -13,6 +13,9 @@ const (
 	CodeNotFound      = 10002
 	CodeGone          = 10003
 	CodeInvalidParam  = 10004
+	CodeForbidden     = 10005
+	CodeQuotaExceeded = 10012
+	CodeRateLimited   = 10013
 	CodeInternalError = 19999
 )
 
@@ -34,8 +37,12 @@ func SuccessWithMessage(c *gin.Context, message string, data interface{}) {
 	})
 }
 
+// ErrorMessageKey 为 Error 在请求上下文中保存错误消息所用的键，供审计日志记录失败原因
+const ErrorMessageKey = "response_error"
+
 // Error 返回错误响应
 func Error(c *gin.Context, status int, code int, message string) {
+	c.Set(ErrorMessageKey, message)
 	c.JSON(status, gin.H{
 		"code":    code,
 		"message": message,
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// 用户角色：admin 不受文件夹授权限制并可管理用户；editor 可在授权范围内读写；viewer 在授权范围内只读
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permission 为对文件夹的访问级别，按 none < read < write 递增
+type Permission string
+
+const (
+	PermNone  Permission = "none"
+	PermRead  Permission = "read"
+	PermWrite Permission = "write"
+)
+
+var (
+	ErrForbidden    = errors.New("permission denied")
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserDisabled = errors.New("user is disabled")
+)
+
+// Principal 为发起请求的用户。通过 API 密钥认证时 KeyID 非空，
+// 访问范围在用户自身权限之内再受密钥的 Scopes 和 Paths 限制
+type Principal struct {
+	Name   string
+	Role   string
+	KeyID  string
+	Scopes []string
+	Paths  []string
+}
+
+// LocalPrincipal 为通过 X-Local-Key 认证的请求所使用的身份，拥有管理员权限
+var LocalPrincipal = Principal{Name: "local", Role: RoleAdmin}
+
+func (p Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+// AtLeast 判断用户角色是否不低于 role
+func (p Principal) AtLeast(role string) bool {
+	return roleRank(p.Role) >= roleRank(role)
+}
+
+// HasScope 判断请求是否具有 scope；非 API 密钥认证的请求不受 scope 限制
+func (p Principal) HasScope(scope string) bool {
+	if p.KeyID == "" {
+		return true
+	}
+	return scopeAllows(p.Scopes, scope)
+}
+
+// AccessService 根据用户角色和文件夹授权计算访问权限。
+// 授权沿目录树向下继承，子文件夹上的授权覆盖上级授权（包括用 none 收回）；没有任何授权的位置不可访问
+type AccessService struct {
+	db     *database.DB
+	logger *zerolog.Logger
+}
+
+func NewAccessService(db *database.DB) *AccessService {
+	l := logger.Get()
+	return &AccessService{
+		db:     db,
+		logger: l,
+	}
+}
+
+// Resolve 加载用户并返回其身份，用户不存在或已禁用时返回错误
+func (s *AccessService) Resolve(ctx context.Context, username string) (Principal, error) {
+	user, err := s.db.GetUser(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Principal{}, ErrUserNotFound
+		}
+		return Principal{}, err
+	}
+	if user.Disabled {
+		return Principal{}, ErrUserDisabled
+	}
+	return Principal{Name: user.Username, Role: user.Role}, nil
+}
+
+// Permission 返回用户对文件夹（nil 表示根目录）的有效权限
+func (s *AccessService) Permission(ctx context.Context, p Principal, folderID *string) (Permission, error) {
+	if len(p.Paths) > 0 {
+		path, err := s.folderPath(folderID)
+		if err != nil {
+			return PermNone, err
+		}
+		if !withinPaths(path, p.Paths) {
+			return PermNone, nil
+		}
+	}
+	if p.IsAdmin() {
+		return PermWrite, nil
+	}
+
+	grants, err := s.userGrants(p.Name)
+	if err != nil {
+		return PermNone, err
+	}
+
+	perm, err := s.inherited(grants, folderID)
+	if err != nil {
+		return PermNone, err
+	}
+	return capPermission(perm, p.Role), nil
+}
+
+// Require 检查用户对文件夹是否具有 need 权限，不足时返回 ErrForbidden
+func (s *AccessService) Require(ctx context.Context, p Principal, folderID *string, need Permission) error {
+	perm, err := s.Permission(ctx, p, folderID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user", p.Name).Msg("failed to check permission")
+		return err
+	}
+	if permRank(perm) < permRank(need) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanReadContent 判断用户能否读取至少一个当前内容为 contentHash 的未删除文件。
+// 按哈希秒传只复用这样的内容，以免仅凭哈希复制出无权读取的文件
+func (s *AccessService) CanReadContent(ctx context.Context, p Principal, contentHash string) (bool, error) {
+	files, err := s.db.ListFileFoldersByHash(contentHash)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		err := s.Require(ctx, p, f.FolderID, PermRead)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ErrForbidden) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// RequireTree 检查用户对文件夹及其全部子文件夹是否具有 need 权限，用于复制、递归删除等作用于整棵子树的操作
+func (s *AccessService) RequireTree(ctx context.Context, p Principal, folderID string, need Permission) error {
+	if err := s.Require(ctx, p, &folderID, need); err != nil || p.IsAdmin() {
+		return err
+	}
+
+	grants, err := s.userGrants(p.Name)
+	if err != nil {
+		return err
+	}
+	for grantFolder, perm := range grants {
+		if grantFolder == "" || grantFolder == folderID || permRank(capPermission(perm, p.Role)) >= permRank(need) {
+			continue
+		}
+		within, err := s.db.IsFolderWithin(&grantFolder, folderID)
+		if err != nil {
+			return err
+		}
+		if within {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// VisibleFolders 从 parentID 下的子文件夹中筛选出用户可见的：可读的文件夹，
+// 以及虽不可读但其下有授权、需要经过它才能到达的文件夹。API 密钥限制了路径时只保留路径范围内及通往该范围的文件夹
+func (s *AccessService) VisibleFolders(ctx context.Context, p Principal, parentID *string, folderIDs []string) (map[string]bool, error) {
+	visible, err := s.visibleByGrants(p, parentID, folderIDs)
+	if err != nil || len(p.Paths) == 0 {
+		return visible, err
+	}
+
+	for id := range visible {
+		path, err := s.db.GetFolderPath(id)
+		if err != nil {
+			return nil, err
+		}
+		if !withinPaths(path, p.Paths) && !leadsToPaths(path, p.Paths) {
+			delete(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+func (s *AccessService) visibleByGrants(p Principal, parentID *string, folderIDs []string) (map[string]bool, error) {
+	visible := make(map[string]bool, len(folderIDs))
+	if p.IsAdmin() {
+		for _, id := range folderIDs {
+			visible[id] = true
+		}
+		return visible, nil
+	}
+
+	grants, err := s.userGrants(p.Name)
+	if err != nil {
+		return nil, err
+	}
+	parentPerm, err := s.inherited(grants, parentID)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := s.grantAncestors(grants)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range folderIDs {
+		perm := parentPerm
+		if g, ok := grants[id]; ok {
+			perm = g
+		}
+		if permRank(capPermission(perm, p.Role)) >= permRank(PermRead) || paths[id] {
+			visible[id] = true
+		}
+	}
+	return visible, nil
+}
+
+// userGrants 返回用户的全部授权，键为文件夹 ID，根目录为空串
+func (s *AccessService) userGrants(username string) (map[string]Permission, error) {
+	records, err := s.db.ListUserGrants(username)
+	if err != nil {
+		return nil, err
+	}
+	grants := make(map[string]Permission, len(records))
+	for _, g := range records {
+		grants[g.FolderID] = Permission(g.Permission)
+	}
+	return grants, nil
+}
+
+// inherited 自 folderID 向上查找最近一级授权
+func (s *AccessService) inherited(grants map[string]Permission, folderID *string) (Permission, error) {
+	if len(grants) == 0 {
+		return PermNone, nil
+	}
+
+	id := folderID
+	for {
+		key := ""
+		if id != nil {
+			key = *id
+		}
+		if perm, ok := grants[key]; ok {
+			return perm, nil
+		}
+		if id == nil {
+			return PermNone, nil
+		}
+
+		folder, err := s.db.GetFolderWithTrashed(*id)
+		if err != nil {
+			return PermNone, err
+		}
+		id = folder.ParentID
+	}
+}
+
+// grantAncestors 返回所有非 none 授权所在文件夹的上级文件夹
+func (s *AccessService) grantAncestors(grants map[string]Permission) (map[string]bool, error) {
+	ancestors := map[string]bool{}
+	for folderID, perm := range grants {
+		if folderID == "" || perm == PermNone {
+			continue
+		}
+
+		folder, err := s.db.GetFolder(folderID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 授权所在的文件夹已在回收站中
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for folder.ParentID != nil && !ancestors[*folder.ParentID] {
+			ancestors[*folder.ParentID] = true
+			if folder, err = s.db.GetFolder(*folder.ParentID); err != nil {
+				break
+			}
+		}
+	}
+	return ancestors, nil
+}
+
+func (s *AccessService) folderPath(folderID *string) (string, error) {
+	if folderID == nil {
+		return "/", nil
+	}
+	return s.db.GetFolderPathWithTrashed(*folderID)
+}
+
+// withinPaths 判断 path 是否位于任一路径前缀之下（含前缀本身）
+func withinPaths(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// leadsToPaths 判断 path 是否为某个路径前缀的上级目录
+func leadsToPaths(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == "/" || strings.HasPrefix(prefix, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole 判断角色名是否有效
+func ValidRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// ValidPermission 判断权限名是否有效
+func ValidPermission(perm string) bool {
+	switch Permission(perm) {
+	case PermNone, PermRead, PermWrite:
+		return true
+	}
+	return false
+}
+
+func roleRank(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+func permRank(perm Permission) int {
+	switch perm {
+	case PermRead:
+		return 1
+	case PermWrite:
+		return 2
+	}
+	return 0
+}
+
+// capPermission 按角色限制权限上限：viewer 最多只读
+func capPermission(perm Permission, role string) Permission {
+	switch role {
+	case RoleAdmin, RoleEditor:
+		return perm
+	case RoleViewer:
+		if perm == PermWrite {
+			return PermRead
+		}
+		return perm
+	}
+	return PermNone
+}
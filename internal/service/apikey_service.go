@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix 为 API 密钥的固定前缀，完整格式为 cpk_<key_id>_<secret>
+const apiKeyPrefix = "cpk_"
+
+// apiKeyTouchInterval 内重复使用同一密钥不再更新 last_used_at，避免每个请求都写库
+const apiKeyTouchInterval = time.Minute
+
+// API 密钥的权限范围；<模块>:* 匹配该模块的全部权限，* 匹配全部权限
+const (
+	ScopeFileRead     = "file:read"
+	ScopeFileWrite    = "file:write"
+	ScopeMailRead     = "mail:read"
+	ScopeMailSend     = "mail:send"
+	ScopeImageConvert = "image:convert"
+	ScopeImageOCR     = "image:ocr"
+	ScopeAdmin        = "admin"
+)
+
+var knownScopes = []string{
+	ScopeFileRead, ScopeFileWrite,
+	ScopeMailRead, ScopeMailSend,
+	ScopeImageConvert, ScopeImageOCR,
+	ScopeAdmin,
+}
+
+var (
+	ErrInvalidAPIKey    = errors.New("invalid, expired or revoked api key")
+	ErrAPIKeyNotFound   = errors.New("api key not found")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrScopeRequired    = errors.New("at least one scope is required")
+	ErrInvalidKeyPath   = errors.New("path prefixes must be absolute and must not contain commas")
+	ErrInvalidKeyExpiry = errors.New("expiry must be in the future")
+)
+
+// APIKeyService 管理具名 API 密钥：密钥只在创建时返回一次，数据库中仅保存其 SHA-256
+type APIKeyService struct {
+	db     *database.DB
+	access *AccessService
+	logger *zerolog.Logger
+}
+
+func NewAPIKeyService(db *database.DB, access *AccessService) *APIKeyService {
+	l := logger.Get()
+	return &APIKeyService{
+		db:     db,
+		access: access,
+		logger: l,
+	}
+}
+
+type APIKeyInfo struct {
+	KeyID      string
+	Name       string
+	Owner      string
+	Scopes     []string
+	Paths      []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// APIKeyRequest 为创建密钥的参数，Paths 为空表示不限制路径，ExpiresAt 为 nil 表示永不过期
+type APIKeyRequest struct {
+	Name      string
+	Scopes    []string
+	Paths     []string
+	ExpiresAt *time.Time
+}
+
+// Create 为 owner 创建密钥并返回明文密钥；密钥的权限不会超过 owner 自身的角色和授权
+func (s *APIKeyService) Create(ctx context.Context, owner Principal, req APIKeyRequest) (APIKeyInfo, string, error) {
+	if len(req.Scopes) == 0 {
+		return APIKeyInfo{}, "", ErrScopeRequired
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return APIKeyInfo{}, "", ErrInvalidScope
+		}
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		if !strings.HasPrefix(p, "/") || strings.Contains(p, ",") {
+			return APIKeyInfo{}, "", ErrInvalidKeyPath
+		}
+		paths = append(paths, path.Clean(p))
+	}
+
+	now := time.Now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return APIKeyInfo{}, "", ErrInvalidKeyExpiry
+	}
+
+	keyID := utils.GenerateID(12)
+	secret := apiKeyPrefix + keyID + "_" + utils.GenerateToken()
+	record := &database.APIKey{
+		KeyID:        keyID,
+		Name:         req.Name,
+		KeyHash:      hashToken(secret),
+		Owner:        owner.Name,
+		Scopes:       strings.Join(req.Scopes, ","),
+		PathPrefixes: strings.Join(paths, ","),
+		ExpiresAt:    req.ExpiresAt,
+		CreatedAt:    now,
+	}
+	if err := s.db.CreateAPIKey(record); err != nil {
+		s.logger.Error().Err(err).Str("owner", owner.Name).Msg("failed to create api key")
+		return APIKeyInfo{}, "", err
+	}
+
+	s.logger.Info().Str("key_id", keyID).Str("owner", owner.Name).Str("scopes", record.Scopes).Msg("api key created")
+	return apiKeyInfo(*record), secret, nil
+}
+
+// List 返回当前用户的密钥，管理员返回全部密钥
+func (s *APIKeyService) List(ctx context.Context, p Principal) ([]APIKeyInfo, error) {
+	var owner *string
+	if !p.IsAdmin() {
+		owner = &p.Name
+	}
+
+	records, err := s.db.ListAPIKeys(owner)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list api keys")
+		return nil, err
+	}
+
+	keys := make([]APIKeyInfo, 0, len(records))
+	for _, r := range records {
+		keys = append(keys, apiKeyInfo(r))
+	}
+	return keys, nil
+}
+
+// Revoke 吊销密钥；非管理员只能吊销自己的密钥，他人的密钥视为不存在
+func (s *APIKeyService) Revoke(ctx context.Context, p Principal, keyID string) error {
+	record, err := s.db.GetAPIKey(keyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	if record.Owner != p.Name && !p.IsAdmin() {
+		return ErrAPIKeyNotFound
+	}
+
+	if err := s.db.RevokeAPIKey(keyID, time.Now().UTC()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		s.logger.Error().Err(err).Str("key_id", keyID).Msg("failed to revoke api key")
+		return err
+	}
+
+	s.logger.Info().Str("key_id", keyID).Str("by", p.Name).Msg("api key revoked")
+	return nil
+}
+
+// Authenticate 校验密钥并返回其身份：以 Owner 的角色和授权为上限，附加密钥的 scope 和路径限制。
+// 密钥哈希以常量时间比较；密钥不存在、已过期、已吊销或所属用户不可用时均返回 ErrInvalidAPIKey
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (Principal, error) {
+	keyID, ok := parseAPIKeyID(key)
+	if !ok {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	record, err := s.db.GetAPIKey(keyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Principal{}, ErrInvalidAPIKey
+		}
+		return Principal{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(key)), []byte(record.KeyHash)) != 1 {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	now := time.Now().UTC()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	principal := LocalPrincipal
+	if record.Owner != LocalPrincipal.Name {
+		if principal, err = s.access.Resolve(ctx, record.Owner); err != nil {
+			return Principal{}, ErrInvalidAPIKey
+		}
+	}
+	principal.KeyID = record.KeyID
+	principal.Scopes = splitList(record.Scopes)
+	principal.Paths = splitList(record.PathPrefixes)
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.db.TouchAPIKey(record.KeyID, now); err != nil {
+			s.logger.Warn().Err(err).Str("key_id", record.KeyID).Msg("failed to update api key last used time")
+		}
+	}
+	return principal, nil
+}
+
+func parseAPIKeyID(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+	keyID, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || keyID == "" || secret == "" {
+		return "", false
+	}
+	return keyID, true
+}
+
+// scopeAllows 判断 scopes 中是否有项匹配 need，支持 * 和 <模块>:* 通配
+func scopeAllows(scopes []string, need string) bool {
+	module, _, _ := strings.Cut(need, ":")
+	for _, scope := range scopes {
+		if scope == "*" || scope == need || scope == module+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	for _, known := range knownScopes {
+		if scope == known {
+			return true
+		}
+		if module, _, ok := strings.Cut(known, ":"); ok && scope == module+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func apiKeyInfo(r database.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		KeyID:      r.KeyID,
+		Name:       r.Name,
+		Owner:      r.Owner,
+		Scopes:     splitList(r.Scopes),
+		Paths:      splitList(r.PathPrefixes),
+		ExpiresAt:  r.ExpiresAt,
+		LastUsedAt: r.LastUsedAt,
+		RevokedAt:  r.RevokedAt,
+		CreatedAt:  r.CreatedAt,
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+// 审计日志的操作类型
+const (
+	AuditAuthLogin        = "auth_login"
+	AuditAuthRefresh      = "auth_refresh"
+	AuditAuthLogout       = "auth_logout"
+	AuditAuthLockout      = "auth_lockout"
+	AuditFileUpload       = "file_upload"
+	AuditFileDelete       = "file_delete"
+	AuditFileMove         = "file_move"
+	AuditFileCopy         = "file_copy"
+	AuditVersionPromote   = "version_promote"
+	AuditUploadStart      = "upload_start"
+	AuditUploadComplete   = "upload_complete"
+	AuditUploadAbort      = "upload_abort"
+	AuditFolderCreate     = "folder_create"
+	AuditFolderDelete     = "folder_delete"
+	AuditFolderMove       = "folder_move"
+	AuditFolderCopy       = "folder_copy"
+	AuditShareCreate      = "share_create"
+	AuditShareRevoke      = "share_revoke"
+	AuditShareUpload      = "share_upload"
+	AuditTrashRestore     = "trash_restore"
+	AuditTrashPurge       = "trash_purge"
+	AuditTrashEmpty       = "trash_empty"
+	AuditUserCreate       = "user_create"
+	AuditUserUpdate       = "user_update"
+	AuditUserDelete       = "user_delete"
+	AuditGrantSet         = "grant_set"
+	AuditGrantDelete      = "grant_delete"
+	AuditKeyCreate        = "key_create"
+	AuditKeyRevoke        = "key_revoke"
+	AuditMailSend         = "mail_send"
+	AuditMailMonitorStart = "mail_monitor_start"
+	AuditMailMonitorStop  = "mail_monitor_stop"
+	AuditMailAttachment   = "mail_attachment_save"
+	AuditAdminFsck        = "admin_fsck"
+	AuditAdminRotateKey   = "admin_rotate_key"
+)
+
+// 审计日志的操作结果
+const (
+	AuditSuccess = "success"
+	AuditFailed  = "failed"
+)
+
+// auditBatchSize 为导出时每次从数据库读取的条数
+const auditBatchSize = 500
+
+// AuditService 记录和查询审计日志；写入失败只记录到服务日志，不影响被审计的操作
+type AuditService struct {
+	db     *database.DB
+	logger *zerolog.Logger
+}
+
+func NewAuditService(db *database.DB) *AuditService {
+	l := logger.Get()
+	return &AuditService{
+		db:     db,
+		logger: l,
+	}
+}
+
+type AuditEntry struct {
+	ID        uint
+	Action    string
+	Actor     string
+	IP        string
+	Path      string
+	FileID    string
+	Status    string
+	Message   string
+	CreatedAt time.Time
+}
+
+// AuditQuery 为审计日志的查询条件，零值字段不参与筛选；PathPrefix 匹配该路径本身及其下的全部路径，
+// Since 包含、Until 不包含
+type AuditQuery struct {
+	Actor      string
+	Action     string
+	PathPrefix string
+	Status     string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) {
+	record := &database.AuditLog{
+		Action:  entry.Action,
+		Path:    entry.Path,
+		Actor:   entry.Actor,
+		Status:  entry.Status,
+		Message: entry.Message,
+	}
+	if entry.FileID != "" {
+		record.FileID = &entry.FileID
+	}
+	if entry.IP != "" {
+		record.IPAddress = &entry.IP
+	}
+
+	if err := s.db.AddAuditLog(record); err != nil {
+		s.logger.Warn().Err(err).Str("action", entry.Action).Str("actor", entry.Actor).Msg("failed to write audit log")
+	}
+}
+
+// Query 按时间倒序分页返回审计日志及符合条件的总数
+func (s *AuditService) Query(ctx context.Context, q AuditQuery, limit, offset int) ([]AuditEntry, int64, error) {
+	logs, total, err := s.db.ListAuditLogs(auditFilter(q), limit, offset)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to query audit logs")
+		return nil, 0, err
+	}
+
+	entries := make([]AuditEntry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, auditEntry(l))
+	}
+	return entries, total, nil
+}
+
+// Each 按时间顺序对全部符合条件的审计日志调用 fn，分批读取，导出大量记录时内存占用固定；fn 返回错误时停止
+func (s *AuditService) Each(ctx context.Context, q AuditQuery, fn func(AuditEntry) error) error {
+	filter := auditFilter(q)
+	var afterID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		logs, err := s.db.ScanAuditLogs(filter, afterID, auditBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, l := range logs {
+			if err := fn(auditEntry(l)); err != nil {
+				return err
+			}
+		}
+		if len(logs) < auditBatchSize {
+			return nil
+		}
+		afterID = logs[len(logs)-1].ID
+	}
+}
+
+func auditFilter(q AuditQuery) database.AuditFilter {
+	return database.AuditFilter{
+		Actor:      q.Actor,
+		Action:     q.Action,
+		PathPrefix: q.PathPrefix,
+		Status:     q.Status,
+		Since:      q.Since,
+		Until:      q.Until,
+	}
+}
+
+func auditEntry(l database.AuditLog) AuditEntry {
+	entry := AuditEntry{
+		ID:        l.ID,
+		Action:    l.Action,
+		Actor:     l.Actor,
+		Path:      l.Path,
+		Status:    l.Status,
+		Message:   l.Message,
+		CreatedAt: l.CreatedAt,
+	}
+	if l.FileID != nil {
+		entry.FileID = *l.FileID
+	}
+	if l.IPAddress != nil {
+		entry.IP = *l.IPAddress
+	}
+	return entry
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const tokenIssuer = "claw-pliers"
+
+var (
+	ErrAuthDisabled       = errors.New("token authentication is not configured")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrTokenReused        = errors.New("refresh token reused, session revoked")
+)
+
+// AuthService 负责登录和令牌签发：访问令牌为 HS256 签名的 JWT，刷新令牌每次使用后轮换
+type AuthService struct {
+	cfg    config.AuthConfig
+	db     *database.DB
+	users  *UserService
+	logger *zerolog.Logger
+}
+
+func NewAuthService(cfg config.AuthConfig, db *database.DB, users *UserService) *AuthService {
+	l := logger.Get()
+	return &AuthService{
+		cfg:    cfg,
+		db:     db,
+		users:  users,
+		logger: l,
+	}
+}
+
+// TokenPair 为一次登录或刷新签发的令牌
+type TokenPair struct {
+	AccessToken      string
+	ExpiresIn        int64
+	RefreshToken     string
+	RefreshExpiresIn int64
+}
+
+// Enabled 表示是否配置了 JWT 密钥，未配置时只能使用 X-Local-Key 认证
+func (s *AuthService) Enabled() bool {
+	return s.cfg.JWTSecret != ""
+}
+
+// Login 校验用户名和密码并签发新的令牌族
+func (s *AuthService) Login(ctx context.Context, username, password string) (TokenPair, error) {
+	if !s.Enabled() {
+		return TokenPair{}, ErrAuthDisabled
+	}
+
+	if _, err := s.users.Authenticate(ctx, username, password); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			s.logger.Warn().Str("username", username).Msg("login failed")
+		}
+		return TokenPair{}, err
+	}
+
+	pair, record, err := s.issue(username, utils.GenerateToken())
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.db.CreateRefreshToken(record); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Msg("failed to store refresh token")
+		return TokenPair{}, err
+	}
+
+	s.logger.Info().Str("username", username).Msg("user logged in")
+	return pair, nil
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧刷新令牌随即失效；已轮换过的令牌再次出现时吊销整个令牌族
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	if !s.Enabled() {
+		return TokenPair{}, ErrAuthDisabled
+	}
+
+	current, err := s.db.GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return TokenPair{}, ErrInvalidToken
+		}
+		return TokenPair{}, err
+	}
+	if current.IsRevoked {
+		return TokenPair{}, s.revokeReused(current)
+	}
+	if time.Now().UTC().After(current.ExpiresAt) {
+		return TokenPair{}, ErrInvalidToken
+	}
+	if user, err := s.users.Get(ctx, current.Subject); err != nil || user.Disabled {
+		// 用户已被删除或禁用
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	pair, next, err := s.issue(current.Subject, current.Family)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	rotated, err := s.db.RotateRefreshToken(current.Token, next)
+	if err != nil {
+		s.logger.Error().Err(err).Str("subject", current.Subject).Msg("failed to rotate refresh token")
+		return TokenPair{}, err
+	}
+	if !rotated {
+		// 并发请求已抢先使用了同一个令牌
+		return TokenPair{}, s.revokeReused(current)
+	}
+
+	return pair, nil
+}
+
+// Logout 吊销刷新令牌所在的整个令牌族，令牌无效时视为已登出
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	current, err := s.db.GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.db.RevokeRefreshTokenFamily(current.Family); err != nil {
+		s.logger.Error().Err(err).Str("subject", current.Subject).Msg("failed to revoke refresh tokens")
+		return err
+	}
+
+	s.logger.Info().Str("subject", current.Subject).Msg("user logged out")
+	return nil
+}
+
+// ParseAccessToken 校验访问令牌的签名和有效期，返回令牌中的用户名
+func (s *AuthService) ParseAccessToken(tokenString string) (string, error) {
+	if !s.Enabled() {
+		return "", ErrAuthDisabled
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+	return claims.Subject, nil
+}
+
+// CleanupExpiredTokens 删除已过期的刷新令牌
+func (s *AuthService) CleanupExpiredTokens(ctx context.Context) (int64, error) {
+	return s.db.DeleteExpiredRefreshTokens(time.Now().UTC())
+}
+
+func (s *AuthService) revokeReused(record database.RefreshToken) error {
+	if err := s.db.RevokeRefreshTokenFamily(record.Family); err != nil {
+		s.logger.Error().Err(err).Str("subject", record.Subject).Msg("failed to revoke refresh tokens")
+		return err
+	}
+	s.logger.Warn().Str("subject", record.Subject).Msg("refresh token reused, token family revoked")
+	return ErrTokenReused
+}
+
+// issue 签发访问令牌和属于 family 的新刷新令牌，返回待登记的刷新令牌记录
+func (s *AuthService) issue(subject, family string) (TokenPair, *database.RefreshToken, error) {
+	now := time.Now().UTC()
+	accessTTL := time.Duration(s.cfg.JWTExpireHours) * time.Hour
+	refreshTTL := time.Duration(s.cfg.RefreshExpireDays) * 24 * time.Hour
+
+	claims := jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    tokenIssuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(accessTTL)),
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.JWTSecret))
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+
+	refreshToken := utils.GenerateToken()
+	record := &database.RefreshToken{
+		Token:     hashToken(refreshToken),
+		Family:    family,
+		Subject:   subject,
+		ExpiresAt: now.Add(refreshTTL),
+		CreatedAt: now,
+	}
+
+	return TokenPair{
+		AccessToken:      accessToken,
+		ExpiresIn:        int64(accessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(refreshTTL.Seconds()),
+	}, record, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+var ErrEncryptionDisabled = errors.New("storage encryption is not enabled")
+
+// EncryptionService 报告存储加密状态并轮换主密钥
+type EncryptionService struct {
+	db      *database.DB
+	storage file.Storage
+	logger  *zerolog.Logger
+}
+
+func NewEncryptionService(db *database.DB, storage file.Storage) *EncryptionService {
+	l := logger.Get()
+	return &EncryptionService{
+		db:      db,
+		storage: storage,
+		logger:  l,
+	}
+}
+
+// EncryptionStatus 为加密状态，Keys 为各主密钥加密的数据密钥数量
+type EncryptionStatus struct {
+	Enabled      bool
+	CurrentKeyID string
+	Keys         map[string]int64
+}
+
+func (s *EncryptionService) Status(ctx context.Context) (EncryptionStatus, error) {
+	keys, err := s.db.CountDataKeysByKeyID()
+	if err != nil {
+		return EncryptionStatus{}, err
+	}
+
+	status := EncryptionStatus{Keys: keys}
+	if encrypted, ok := s.storage.(*file.EncryptedStorage); ok {
+		status.Enabled = true
+		status.CurrentKeyID = encrypted.CurrentKeyID()
+	}
+	return status, nil
+}
+
+// Rotate 用当前主密钥重新加密由旧主密钥加密的全部数据密钥，不重写对象；完成后即可从配置中删除旧主密钥
+func (s *EncryptionService) Rotate(ctx context.Context) (int, error) {
+	encrypted, ok := s.storage.(*file.EncryptedStorage)
+	if !ok {
+		return 0, ErrEncryptionDisabled
+	}
+
+	rewrapped, err := encrypted.RewrapKeys(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Int("rewrapped", rewrapped).Msg("failed to rotate data keys")
+		return rewrapped, err
+	}
+	s.logger.Info().Int("rewrapped", rewrapped).Str("key_id", encrypted.CurrentKeyID()).Msg("data keys rotated")
+	return rewrapped, nil
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"time"
 
@@ -11,19 +14,24 @@ import (
 	"github.com/kiry163/claw-pliers/internal/utils"
 
 	"github.com/rs/zerolog"
+	"gorm.io/gorm"
 )
 
+var ErrContentNotFound = errors.New("content not found")
+
 type FileService struct {
 	db      *database.DB
 	storage file.Storage
+	quotas  *QuotaService
 	logger  *zerolog.Logger
 }
 
-func NewFileService(db *database.DB, storage file.Storage) *FileService {
+func NewFileService(db *database.DB, storage file.Storage, quotas *QuotaService) *FileService {
 	l := logger.Get()
 	return &FileService{
 		db:      db,
 		storage: storage,
+		quotas:  quotas,
 		logger:  l,
 	}
 }
@@ -34,6 +42,9 @@ type FileMetadata struct {
 	ObjectKey    string
 	Size         int64
 	MimeType     string
+	SHA256       string
+	Deduplicated bool
+	Version      int
 	FolderID     *string
 	CreatedBy    string
 	CreatedAt    time.Time
@@ -45,50 +56,175 @@ type ListFilesResult struct {
 	Items []FileMetadata
 }
 
+// CreateFile 写入内容并创建文件记录，写入前检查配额，超出时返回包装 ErrQuotaExceeded 的错误
 func (s *FileService) CreateFile(ctx context.Context, reader io.Reader, size int64, fileID, originalName, folderID, createdBy string) (FileMetadata, error) {
-	saveResult, err := s.storage.Save(ctx, reader, size, fileID, originalName)
+	if err := s.quotas.Check(ctx, createdBy, folderIDPtr(folderID), 1, size); err != nil {
+		s.logger.Warn().Err(err).Str("file_id", fileID).Str("user", createdBy).Msg("upload rejected by quota")
+		return FileMetadata{}, err
+	}
+
+	hasher := sha256.New()
+	saveResult, err := s.storage.Save(ctx, io.TeeReader(reader, hasher), size, fileID, originalName)
 	if err != nil {
 		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to save file to storage")
 		return FileMetadata{}, err
 	}
 
-	record := &database.File{
-		FileID:       fileID,
-		OriginalName: originalName,
-		ObjectKey:    saveResult.ObjectKey,
-		Size:         size,
-		MimeType:     saveResult.MimeType,
-		CreatedBy:    createdBy,
-		CreatedAt:    time.Now().UTC(),
-		UpdatedAt:    time.Now().UTC(),
+	metadata, err := s.createFileRecord(ctx, saveResult, hex.EncodeToString(hasher.Sum(nil)), fileID, originalName, folderID, createdBy)
+	if err != nil {
+		s.deleteObject(ctx, saveResult.ObjectKey)
 	}
+	return metadata, err
+}
 
-	if folderID != "" {
-		record.FolderID = &folderID
+// CreateFileFromObject 为已写入存储的对象（如分片合并结果）创建文件记录，哈希通过回读对象计算；
+// 失败时对象保留，由调用方决定重试或删除
+func (s *FileService) CreateFileFromObject(ctx context.Context, saveResult file.SaveResult, fileID, originalName, folderID, createdBy string) (FileMetadata, error) {
+	contentHash, err := hashObject(ctx, s.storage, saveResult.ObjectKey)
+	if err != nil {
+		s.logger.Error().Err(err).Str("object_key", saveResult.ObjectKey).Msg("failed to hash object")
+		return FileMetadata{}, err
+	}
+
+	return s.createFileRecord(ctx, saveResult, contentHash, fileID, originalName, folderID, createdBy)
+}
+
+// hashObject 回读对象计算 SHA-256
+func hashObject(ctx context.Context, storage file.Storage, objectKey string) (string, error) {
+	reader, _, err := storage.Get(ctx, objectKey, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// CreateFileFromHash 复用已存储的相同内容创建文件，无需再次上传；内容不存在时返回 ErrContentNotFound
+func (s *FileService) CreateFileFromHash(ctx context.Context, contentHash, fileID, originalName, folderID, createdBy string) (FileMetadata, error) {
+	object, err := s.db.GetStorageObjectByHash(contentHash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileMetadata{}, ErrContentNotFound
+		}
+		return FileMetadata{}, err
 	}
+	if err := s.quotas.Check(ctx, createdBy, folderIDPtr(folderID), 1, object.Size); err != nil {
+		return FileMetadata{}, err
+	}
+
+	record := s.newFileRecord(fileID, originalName, folderID, createdBy)
+	record.SHA256 = contentHash
+
+	if err := s.db.CreateFileFromHash(record); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileMetadata{}, ErrContentNotFound
+		}
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to create file record from hash")
+		return FileMetadata{}, err
+	}
+
+	s.logger.Info().
+		Str("file_id", fileID).
+		Str("original_name", originalName).
+		Str("sha256", contentHash).
+		Msg("file created from existing content")
+
+	metadata := toFileMetadata(*record)
+	metadata.Deduplicated = true
+	return metadata, nil
+}
+
+// createFileRecord 登记文件记录；相同内容已存在于其他对象时复用旧对象并删除刚写入的副本
+func (s *FileService) createFileRecord(ctx context.Context, saveResult file.SaveResult, contentHash, fileID, originalName, folderID, createdBy string) (FileMetadata, error) {
+	record := s.newFileRecord(fileID, originalName, folderID, createdBy)
+	record.ObjectKey = saveResult.ObjectKey
+	record.Size = saveResult.Size
+	record.MimeType = saveResult.MimeType
+	record.SHA256 = contentHash
 
-	if err := s.db.CreateFile(record); err != nil {
+	now := time.Now().UTC()
+	reused, err := s.db.CreateFileWithObject(record, database.StorageObject{
+		SHA256:    contentHash,
+		ObjectKey: saveResult.ObjectKey,
+		Size:      saveResult.Size,
+		MimeType:  saveResult.MimeType,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
 		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to create file record")
 		return FileMetadata{}, err
 	}
+	if reused && record.ObjectKey != saveResult.ObjectKey {
+		s.deleteObject(ctx, saveResult.ObjectKey)
+	}
 
 	s.logger.Info().
 		Str("file_id", fileID).
 		Str("original_name", originalName).
-		Int64("size", size).
+		Int64("size", record.Size).
+		Bool("deduplicated", reused).
 		Msg("file created successfully")
 
+	metadata := toFileMetadata(*record)
+	metadata.Deduplicated = reused
+	return metadata, nil
+}
+
+func (s *FileService) newFileRecord(fileID, originalName, folderID, createdBy string) *database.File {
+	now := time.Now().UTC()
+	record := &database.File{
+		FileID:       fileID,
+		OriginalName: originalName,
+		Version:      1,
+		CreatedBy:    createdBy,
+		UpdatedBy:    createdBy,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if folderID != "" {
+		record.FolderID = &folderID
+	}
+	return record
+}
+
+// CheckQuota 检查 user 在 folderID 下新增文件是否超出配额，供内容写入前调用
+func (s *FileService) CheckQuota(ctx context.Context, user, folderID string, files, bytes int64) error {
+	return s.quotas.Check(ctx, user, folderIDPtr(folderID), files, bytes)
+}
+
+func folderIDPtr(folderID string) *string {
+	if folderID == "" {
+		return nil
+	}
+	return &folderID
+}
+
+func (s *FileService) deleteObject(ctx context.Context, objectKey string) {
+	if err := s.storage.Delete(ctx, objectKey); err != nil {
+		s.logger.Error().Err(err).Str("object_key", objectKey).Msg("failed to clean up orphaned object")
+	}
+}
+
+func toFileMetadata(record database.File) FileMetadata {
 	return FileMetadata{
 		FileID:       record.FileID,
 		OriginalName: record.OriginalName,
 		ObjectKey:    record.ObjectKey,
 		Size:         record.Size,
 		MimeType:     record.MimeType,
+		SHA256:       record.SHA256,
+		Version:      record.Version,
 		FolderID:     record.FolderID,
 		CreatedBy:    record.CreatedBy,
 		CreatedAt:    record.CreatedAt,
 		UpdatedAt:    record.UpdatedAt,
-	}, nil
+	}
 }
 
 func (s *FileService) GetFile(ctx context.Context, fileID string) (FileMetadata, error) {
@@ -98,17 +234,7 @@ func (s *FileService) GetFile(ctx context.Context, fileID string) (FileMetadata,
 		return FileMetadata{}, err
 	}
 
-	return FileMetadata{
-		FileID:       record.FileID,
-		OriginalName: record.OriginalName,
-		ObjectKey:    record.ObjectKey,
-		Size:         record.Size,
-		MimeType:     record.MimeType,
-		FolderID:     record.FolderID,
-		CreatedBy:    record.CreatedBy,
-		CreatedAt:    record.CreatedAt,
-		UpdatedAt:    record.UpdatedAt,
-	}, nil
+	return toFileMetadata(record), nil
 }
 
 func (s *FileService) ListFiles(ctx context.Context, folderID *string, limit, offset int, order, keyword string) (ListFilesResult, error) {
@@ -134,6 +260,9 @@ func (s *FileService) ListFiles(ctx context.Context, folderID *string, limit, of
 			OriginalName: r.OriginalName,
 			Size:         r.Size,
 			MimeType:     r.MimeType,
+			SHA256:       r.SHA256,
+			Version:      r.Version,
+			FolderID:     r.FolderID,
 			CreatedAt:    r.CreatedAt,
 		})
 	}
@@ -144,19 +273,40 @@ func (s *FileService) ListFiles(ctx context.Context, folderID *string, limit, of
 	}, nil
 }
 
+// DeleteFile 将文件移入回收站，对象保留到文件被彻底删除
 func (s *FileService) DeleteFile(ctx context.Context, fileID string) error {
-	record, err := s.db.DeleteFile(fileID)
+	path, err := s.db.GetFilePath(fileID)
 	if err != nil {
-		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to delete file record")
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to get file")
 		return err
 	}
 
-	if err := s.storage.Delete(ctx, record.ObjectKey); err != nil {
-		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to delete file from storage")
+	if err := s.db.TrashFile(fileID, path); err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to move file to trash")
 		return err
 	}
 
-	s.logger.Info().Str("file_id", fileID).Msg("file deleted successfully")
+	s.logger.Info().Str("file_id", fileID).Str("path", path).Msg("file moved to trash")
+	return nil
+}
+
+// PurgeFile 彻底删除文件（包括回收站中的）及其历史版本，最后一个引用消失的对象随之删除
+func (s *FileService) PurgeFile(ctx context.Context, fileID string) error {
+	_, released, err := s.db.PurgeFile(fileID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to delete file record")
+		return err
+	}
+
+	// 仍有其他文件或版本引用同一内容时保留对象
+	for _, objectKey := range released {
+		if err := s.storage.Delete(ctx, objectKey); err != nil {
+			s.logger.Error().Err(err).Str("file_id", fileID).Str("object_key", objectKey).Msg("failed to delete file from storage")
+			return err
+		}
+	}
+
+	s.logger.Info().Str("file_id", fileID).Int("objects_deleted", len(released)).Msg("file purged successfully")
 	return nil
 }
 
@@ -186,39 +336,3 @@ func (s *FileService) GetFileContent(ctx context.Context, fileID string) (io.Rea
 func (s *FileService) GenerateFileID() string {
 	return utils.GenerateFileID()
 }
-
-func (s *FileService) GenerateShareToken() string {
-	return utils.GenerateShareToken()
-}
-
-func (s *FileService) CreateShareLink(ctx context.Context, fileID, createdBy, publicURL string) (string, string, error) {
-	now := time.Now().UTC()
-	expiresAt := now.Add(7 * 24 * time.Hour)
-	token := s.GenerateShareToken()
-
-	shareLink := &database.ShareLink{
-		Token:     token,
-		FileID:    fileID,
-		ExpiresAt: expiresAt,
-		CreatedAt: now,
-		CreatedBy: createdBy,
-		Status:    "active",
-	}
-
-	if err := s.db.CreateShareLink(shareLink); err != nil {
-		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to create share link")
-		return "", "", err
-	}
-
-	downloadLink := publicURL + "/s/" + token
-	s.logger.Info().Str("file_id", fileID).Str("token", token).Msg("share link created")
-	return token, downloadLink, nil
-}
-
-func (s *FileService) GetShareLink(ctx context.Context, token string) (database.ShareLink, error) {
-	return s.db.GetShareLink(token)
-}
-
-func (s *FileService) GetActiveShareLink(ctx context.Context, fileID string, now time.Time) (database.ShareLink, error) {
-	return s.db.GetActiveShareLink(fileID, now)
-}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/kiry163/claw-pliers/internal/database"
@@ -9,6 +11,7 @@ import (
 	"github.com/kiry163/claw-pliers/internal/utils"
 
 	"github.com/rs/zerolog"
+	"gorm.io/gorm"
 )
 
 type FolderService struct {
@@ -106,16 +109,58 @@ func (s *FolderService) ListFolders(ctx context.Context, parentID *string) ([]Fo
 	return items, nil
 }
 
+// DeleteFolder 将文件夹移入回收站
 func (s *FolderService) DeleteFolder(ctx context.Context, folderID string) error {
-	if err := s.db.DeleteFolder(folderID); err != nil {
-		s.logger.Error().Err(err).Str("folder_id", folderID).Msg("failed to delete folder")
+	path, err := s.db.GetFolderPath(folderID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("folder_id", folderID).Msg("failed to get folder")
+		return err
+	}
+
+	if err := s.db.TrashFolder(folderID, path); err != nil {
+		s.logger.Error().Err(err).Str("folder_id", folderID).Msg("failed to move folder to trash")
 		return err
 	}
 
-	s.logger.Info().Str("folder_id", folderID).Msg("folder deleted successfully")
+	s.logger.Info().Str("folder_id", folderID).Str("path", path).Msg("folder moved to trash")
 	return nil
 }
 
+// EnsureFolderPath 逐级查找路径上的文件夹，不存在的自动创建，返回最末一级的 ID；根目录返回 nil
+func (s *FolderService) EnsureFolderPath(ctx context.Context, path, createdBy string) (*string, error) {
+	var parentID *string
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		folder, err := s.db.GetFolderByName(name, parentID)
+		if err == nil {
+			parentID = &folder.FolderID
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		record := &database.Folder{
+			FolderID:  utils.GenerateFolderID(),
+			Name:      name,
+			ParentID:  parentID,
+			CreatedBy: createdBy,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.db.CreateFolder(record); err != nil {
+			s.logger.Error().Err(err).Str("name", name).Msg("failed to create folder")
+			return nil, err
+		}
+		parentID = &record.FolderID
+	}
+	return parentID, nil
+}
+
 func (s *FolderService) RenameFolder(ctx context.Context, folderID, newName string) error {
 	if err := s.db.UpdateFolder(folderID, newName); err != nil {
 		s.logger.Error().Err(err).Str("folder_id", folderID).Str("new_name", newName).Msg("failed to rename folder")
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	FsckMissingObject    = "missing_object"
+	FsckSizeMismatch     = "size_mismatch"
+	FsckChecksumMismatch = "checksum_mismatch"
+	FsckOrphanObject     = "orphan_object"
+	FsckRefCountMismatch = "ref_count_mismatch"
+)
+
+// orphanGracePeriod 内新写入的对象可能尚未登记文件记录，不视为孤儿
+const orphanGracePeriod = time.Hour
+
+const fsckBatchSize = 200
+
+type FsckService struct {
+	db      *database.DB
+	storage file.Storage
+	logger  *zerolog.Logger
+}
+
+func NewFsckService(db *database.DB, storage file.Storage) *FsckService {
+	l := logger.Get()
+	return &FsckService{
+		db:      db,
+		storage: storage,
+		logger:  l,
+	}
+}
+
+type FsckOptions struct {
+	// VerifyChecksum 为 true 时读取每个对象重新计算 SHA-256
+	VerifyChecksum bool
+	// Repair 为 true 时隔离孤儿对象、标记损坏的文件记录并修正引用计数
+	Repair bool
+}
+
+type FsckIssue struct {
+	Kind      string
+	FileID    string
+	ObjectKey string
+	Expected  string
+	Actual    string
+	Action    string
+}
+
+type FsckReport struct {
+	CheckedFiles   int
+	CheckedObjects int
+	Issues         []FsckIssue
+	Repaired       int
+	StartedAt      time.Time
+	FinishedAt     time.Time
+}
+
+// Run 核对文件记录与存储后端：逐条 Stat 文件对象并比对大小和校验和，再遍历存储找出文件和历史版本都未引用的对象
+func (s *FsckService) Run(ctx context.Context, opts FsckOptions) (FsckReport, error) {
+	report := FsckReport{StartedAt: time.Now().UTC()}
+	refs := make(map[string]int64)
+
+	err := s.db.EachFile(fsckBatchSize, func(files []database.File) error {
+		for _, record := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			refs[record.ObjectKey]++
+			report.CheckedFiles++
+
+			issue, err := s.checkFile(ctx, record, opts.VerifyChecksum)
+			if err != nil {
+				return err
+			}
+			if issue == nil {
+				if opts.Repair && record.IntegrityError != "" {
+					if err := s.db.SetFileIntegrityError(record.FileID, ""); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if opts.Repair {
+				if err := s.db.SetFileIntegrityError(record.FileID, issue.Kind); err != nil {
+					return err
+				}
+				issue.Action = "marked"
+				report.Repaired++
+			}
+			report.Issues = append(report.Issues, *issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// 历史版本同样持有对象引用
+	versionKeys, err := s.db.ListFileVersionObjectKeys()
+	if err != nil {
+		return report, err
+	}
+	for _, key := range versionKeys {
+		refs[key]++
+	}
+
+	if err := s.checkRefCounts(refs, opts.Repair, &report); err != nil {
+		return report, err
+	}
+
+	var orphans []file.ObjectEntry
+	err = s.storage.Walk(ctx, func(entry file.ObjectEntry) error {
+		report.CheckedObjects++
+		if refs[entry.Key] == 0 && time.Since(entry.ModTime) > orphanGracePeriod {
+			orphans = append(orphans, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// 遍历结束后再隔离，避免在遍历过程中修改存储
+	for _, entry := range orphans {
+		issue := FsckIssue{Kind: FsckOrphanObject, ObjectKey: entry.Key, Actual: fmt.Sprintf("%d", entry.Size)}
+		if opts.Repair {
+			target, err := s.storage.Quarantine(ctx, entry.Key)
+			if err != nil {
+				s.logger.Error().Err(err).Str("object_key", entry.Key).Msg("failed to quarantine orphan object")
+				issue.Action = "quarantine_failed"
+			} else {
+				issue.Action = "quarantined:" + target
+				report.Repaired++
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	s.logger.Info().
+		Int("files", report.CheckedFiles).
+		Int("objects", report.CheckedObjects).
+		Int("issues", len(report.Issues)).
+		Int("repaired", report.Repaired).
+		Bool("repair", opts.Repair).
+		Msg("fsck finished")
+
+	return report, nil
+}
+
+func (s *FsckService) checkFile(ctx context.Context, record database.File, verifyChecksum bool) (*FsckIssue, error) {
+	info, err := s.storage.Stat(ctx, record.ObjectKey)
+	if err != nil {
+		// 后端整体不可用时中止检查，避免把所有文件都判定为缺失
+		if ctx.Err() != nil || errors.Is(err, file.ErrStorageUnavailable) {
+			return nil, err
+		}
+		return &FsckIssue{Kind: FsckMissingObject, FileID: record.FileID, ObjectKey: record.ObjectKey, Actual: err.Error()}, nil
+	}
+
+	if info.Size != record.Size {
+		return &FsckIssue{
+			Kind:      FsckSizeMismatch,
+			FileID:    record.FileID,
+			ObjectKey: record.ObjectKey,
+			Expected:  fmt.Sprintf("%d", record.Size),
+			Actual:    fmt.Sprintf("%d", info.Size),
+		}, nil
+	}
+
+	// 早期文件没有记录哈希，只能比对大小
+	if !verifyChecksum || record.SHA256 == "" {
+		return nil, nil
+	}
+
+	reader, _, err := s.storage.Get(ctx, record.ObjectKey, nil, nil)
+	if err != nil {
+		return &FsckIssue{Kind: FsckMissingObject, FileID: record.FileID, ObjectKey: record.ObjectKey, Actual: err.Error()}, nil
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// 加密对象被篡改或截断时无法通过认证，与哈希不符同样处理
+		if errors.Is(err, file.ErrCorruptObject) {
+			return &FsckIssue{Kind: FsckChecksumMismatch, FileID: record.FileID, ObjectKey: record.ObjectKey, Expected: record.SHA256, Actual: err.Error()}, nil
+		}
+		return nil, fmt.Errorf("failed to read object %s: %w", record.ObjectKey, err)
+	}
+
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if actual != record.SHA256 {
+		return &FsckIssue{
+			Kind:      FsckChecksumMismatch,
+			FileID:    record.FileID,
+			ObjectKey: record.ObjectKey,
+			Expected:  record.SHA256,
+			Actual:    actual,
+		}, nil
+	}
+	return nil, nil
+}
+
+// checkRefCounts 比对去重对象登记的引用计数与实际引用它的文件数
+func (s *FsckService) checkRefCounts(refs map[string]int64, repair bool, report *FsckReport) error {
+	objects, err := s.db.ListStorageObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		actual := refs[object.ObjectKey]
+		if actual == object.RefCount {
+			continue
+		}
+
+		issue := FsckIssue{
+			Kind:      FsckRefCountMismatch,
+			ObjectKey: object.ObjectKey,
+			Expected:  fmt.Sprintf("%d", object.RefCount),
+			Actual:    fmt.Sprintf("%d", actual),
+		}
+		if repair {
+			// 已无文件引用时删除登记，避免后续上传复用该对象；对象本身交给孤儿检查隔离
+			if actual == 0 {
+				err = s.db.DeleteStorageObject(object.ObjectKey)
+				issue.Action = "unregistered"
+			} else {
+				err = s.db.SetStorageObjectRefCount(object.ObjectKey, actual)
+				issue.Action = "ref_count_fixed"
+			}
+			if err != nil {
+				return err
+			}
+			report.Repaired++
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	return nil
+}
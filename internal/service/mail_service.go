@@ -1,7 +1,13 @@
 package service
 
 import (
-	"github.com/kiry163/claw-pliers/internal/config"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
 	"github.com/kiry163/claw-pliers/internal/logger"
 	"github.com/kiry163/claw-pliers/internal/mail"
 
@@ -9,13 +15,19 @@ import (
 )
 
 type MailService struct {
-	logger *zerolog.Logger
+	db       *database.DB
+	files    *FileService
+	versions *VersionService
+	logger   *zerolog.Logger
 }
 
-func NewMailService() *MailService {
+func NewMailService(db *database.DB, files *FileService, versions *VersionService) *MailService {
 	l := logger.Get()
 	return &MailService{
-		logger: l,
+		db:       db,
+		files:    files,
+		versions: versions,
+		logger:   l,
 	}
 }
 
@@ -30,17 +42,58 @@ func (s *MailService) TestConnection(email string) (int64, error) {
 	return latency, nil
 }
 
-func (s *MailService) SendMail(from, to, subject, body string) error {
-	err := mail.SendMail(from, to, subject, body)
-	if err != nil {
-		s.logger.Error().Err(err).Str("from", from).Str("to", to).Msg("failed to send mail")
+// SendMail 发送邮件；replyToUID 非 0 时按发件账户 INBOX 中的原邮件补全 In-Reply-To 和 References，
+// 未指定主题和收件人时使用 "Re: " 原主题并回复给原发件人
+func (s *MailService) SendMail(msg mail.OutgoingMessage, replyToUID uint32) error {
+	if replyToUID != 0 {
+		reply, err := mail.GetReplyContext(msg.From, replyToUID)
+		if err != nil {
+			s.logger.Error().Err(err).Str("from", msg.From).Uint32("uid", replyToUID).Msg("failed to load replied email")
+			return err
+		}
+		if msg.InReplyTo == "" {
+			msg.InReplyTo = reply.MessageID
+		}
+		if len(msg.References) == 0 {
+			msg.References = reply.References
+		}
+		if msg.Subject == "" {
+			msg.Subject = reply.Subject
+		}
+		if len(msg.To) == 0 && len(msg.Cc) == 0 && len(msg.Bcc) == 0 && reply.To != "" {
+			msg.To = []string{reply.To}
+		}
+	}
+
+	to := strings.Join(msg.To, ", ")
+	if err := mail.Send(msg); err != nil {
+		s.logger.Error().Err(err).Str("from", msg.From).Str("to", to).Msg("failed to send mail")
 		return err
 	}
 
-	s.logger.Info().Str("from", from).Str("to", to).Str("subject", subject).Msg("mail sent successfully")
+	s.logger.Info().Str("from", msg.From).Str("to", to).Str("subject", msg.Subject).Int("attachments", len(msg.Attachments)).Msg("mail sent successfully")
 	return nil
 }
 
+// ReadAttachmentFile 读取文件模块中的文件作为待发送邮件的附件
+func (s *MailService) ReadAttachmentFile(ctx context.Context, fileID string) (mail.OutgoingAttachment, error) {
+	reader, metadata, err := s.files.GetFileContent(ctx, fileID)
+	if err != nil {
+		return mail.OutgoingAttachment{}, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return mail.OutgoingAttachment{}, err
+	}
+	return mail.OutgoingAttachment{
+		Filename:    metadata.OriginalName,
+		ContentType: metadata.MimeType,
+		Data:        data,
+	}, nil
+}
+
 func (s *MailService) GetLatestEmails(email string, count int) ([]mail.EmailSummary, error) {
 	emails, err := mail.GetLatestEmails(email, count)
 	if err != nil {
@@ -52,6 +105,102 @@ func (s *MailService) GetLatestEmails(email string, count int) ([]mail.EmailSumm
 	return emails, nil
 }
 
-func (s *MailService) ListAccounts() []config.AccountConfig {
-	return mail.ListAccounts()
+// GetMessage 按 UID 取回账户 INBOX 中的完整邮件
+func (s *MailService) GetMessage(email string, uid uint32) (*mail.Message, error) {
+	msg, err := mail.GetMessage(email, uid)
+	if err != nil {
+		s.logger.Error().Err(err).Str("email", email).Uint32("uid", uid).Msg("failed to get email")
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetAttachment 取回邮件中序号为 index 的附件
+func (s *MailService) GetAttachment(email string, uid uint32, index int) (*mail.Attachment, error) {
+	attachment, err := mail.GetAttachment(email, uid, index)
+	if err != nil {
+		s.logger.Error().Err(err).Str("email", email).Uint32("uid", uid).Int("index", index).Msg("failed to get email attachment")
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// GetFolder 按路径查找附件要保存到的文件夹
+func (s *MailService) GetFolder(path string) (database.Folder, error) {
+	return s.db.GetFolderByPath(path)
+}
+
+// SaveAttachment 把附件保存为文件夹 folderID 下名为 name 的文件；同名文件已存在时写为新版本
+func (s *MailService) SaveAttachment(ctx context.Context, attachment *mail.Attachment, folderID, name, user string) (FileMetadata, error) {
+	size := int64(len(attachment.Data))
+	if existing, err := s.db.GetFileByName(name, folderIDPtr(folderID)); err == nil {
+		return s.versions.Overwrite(ctx, existing.FileID, bytes.NewReader(attachment.Data), size, "", user)
+	}
+
+	metadata, err := s.files.CreateFile(ctx, bytes.NewReader(attachment.Data), size, s.files.GenerateFileID(), name, folderID, user)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	s.logger.Info().Str("file_id", metadata.FileID).Str("name", name).Msg("email attachment saved")
+	return metadata, nil
+}
+
+// ListAccounts 返回全部账户的展示信息，不含凭据
+func (s *MailService) ListAccounts() []mail.AccountInfo {
+	return mail.ListAccountInfo()
+}
+
+// MonitorStatus 返回所有账户的监听状态
+func (s *MailService) MonitorStatus() []mail.MonitorStatus {
+	return mail.GetMonitor().Status()
+}
+
+// WebhookEnabled 判断监听到的新邮件是否会推送到 webhook
+func (s *MailService) WebhookEnabled() bool {
+	return mail.GetMonitor().WebhookEnabled()
+}
+
+// StartMonitor 开始监听 email 对应的账户，email 为空时监听所有启用的账户；返回新启动的账户数
+func (s *MailService) StartMonitor(email string) (int, error) {
+	monitor := mail.GetMonitor()
+	if email == "" {
+		return monitor.StartAll(), nil
+	}
+	if monitor.IsRunning(email) {
+		return 0, nil
+	}
+	if err := monitor.Start(email); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// StopMonitor 停止监听 email 对应的账户，email 为空时停止所有账户；返回停止的账户数
+func (s *MailService) StopMonitor(email string) (int, error) {
+	monitor := mail.GetMonitor()
+	if email == "" {
+		return monitor.StopAll(), nil
+	}
+	if !monitor.IsRunning(email) {
+		// 仍需校验账户是否存在
+		return 0, monitor.Stop(email)
+	}
+	if err := monitor.Stop(email); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// ListEvents 按处理时间倒序分页返回邮件监听处理过的邮件，同时返回符合条件的总数
+func (s *MailService) ListEvents(filter database.MailEventFilter, limit, offset int) ([]database.MailEvent, int64, error) {
+	return s.db.ListMailEvents(filter, limit, offset)
+}
+
+// PruneEvents 删除处理时间早于保留期的邮件事件
+func (s *MailService) PruneEvents(retention time.Duration) (int64, error) {
+	deleted, err := s.db.DeleteMailEventsBefore(time.Now().UTC().Add(-retention))
+	if deleted > 0 {
+		s.logger.Info().Int64("count", deleted).Msg("expired mail events pruned")
+	}
+	return deleted, err
 }
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaService 按配置限制每个用户及每个顶层文件夹的文件数和总大小。
+// 用户用量按创建者统计，包含回收站中的文件；文件夹用量只统计其下未删除的文件。两者都包括文件保留的历史版本
+type QuotaService struct {
+	cfg    config.QuotaConfig
+	db     *database.DB
+	logger *zerolog.Logger
+}
+
+func NewQuotaService(cfg config.QuotaConfig, db *database.DB) *QuotaService {
+	l := logger.Get()
+	return &QuotaService{
+		cfg:    cfg,
+		db:     db,
+		logger: l,
+	}
+}
+
+// Usage 为一个用户或顶层文件夹的用量及配额，Max* 为 0 表示不限制
+type Usage struct {
+	Name     string
+	Path     string
+	Files    int64
+	Bytes    int64
+	MaxFiles int64
+	MaxBytes int64
+}
+
+// UsageReport 汇总当前用户及全部顶层文件夹的用量
+type UsageReport struct {
+	User    Usage
+	Folders []Usage
+}
+
+// FolderUsage 为一个目录递归统计的文件数和总大小
+type FolderUsage struct {
+	Path  string
+	Files int64
+	Bytes int64
+}
+
+// Check 检查 user 在 folderID 下新增 files 个文件、共 bytes 字节后是否超出配额，超出时返回包装 ErrQuotaExceeded 的错误。
+// user 为空时只检查文件夹配额；folderID 为 nil 表示根目录，根目录下的文件只受用户配额限制
+func (s *QuotaService) Check(ctx context.Context, user string, folderID *string, files, bytes int64) error {
+	if files <= 0 && bytes <= 0 {
+		return nil
+	}
+
+	if user != "" && s.userLimit(user) != (quotaLimit{}) {
+		usage, err := s.UserUsage(ctx, user)
+		if err != nil {
+			return err
+		}
+		if err := exceeds("user "+user, usage, files, bytes); err != nil {
+			return err
+		}
+	}
+
+	if folderID != nil && s.hasFolderLimits() {
+		root, err := s.db.GetRootFolder(*folderID)
+		if err != nil {
+			return err
+		}
+		usage, err := s.rootUsage(root)
+		if err != nil {
+			return err
+		}
+		if err := exceeds("folder "+usage.Path, usage, files, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckMove 检查将 files 个文件、共 bytes 字节从 from 移到 to 下是否超出目标顶层文件夹的配额，同一顶层文件夹内移动不受限制
+func (s *QuotaService) CheckMove(ctx context.Context, from, to *string, files, bytes int64) error {
+	if to == nil {
+		return nil
+	}
+	if from != nil {
+		same, err := s.sameRoot(*from, *to)
+		if err != nil || same {
+			return err
+		}
+	}
+	return s.Check(ctx, "", to, files, bytes)
+}
+
+// CheckFolderMove 检查将文件夹移到 parentID 下并命名为 name 是否超出配额；
+// 移到根目录时它成为新的顶层文件夹，按新名称对应的配额检查其自身用量
+func (s *QuotaService) CheckFolderMove(ctx context.Context, folder database.Folder, parentID *string, name string) error {
+	files, bytes, err := s.db.GetFolderStats(folder.FolderID)
+	if err != nil {
+		return err
+	}
+
+	if parentID == nil {
+		limit := s.folderLimit(name)
+		return exceeds("folder /"+name, Usage{MaxFiles: limit.MaxFiles, MaxBytes: limit.MaxBytes}, files, bytes)
+	}
+	if folder.ParentID == nil {
+		// 顶层文件夹移入其他文件夹后，其用量全部计入新的顶层文件夹
+		return s.Check(ctx, "", parentID, files, bytes)
+	}
+	return s.CheckMove(ctx, folder.ParentID, parentID, files, bytes)
+}
+
+func (s *QuotaService) sameRoot(a, b string) (bool, error) {
+	rootA, err := s.db.GetRootFolder(a)
+	if err != nil {
+		return false, err
+	}
+	rootB, err := s.db.GetRootFolder(b)
+	if err != nil {
+		return false, err
+	}
+	return rootA.FolderID == rootB.FolderID, nil
+}
+
+// UserUsage 返回用户的用量及配额
+func (s *QuotaService) UserUsage(ctx context.Context, user string) (Usage, error) {
+	files, bytes, err := s.db.GetUserStats(user)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user", user).Msg("failed to get user usage")
+		return Usage{}, err
+	}
+
+	limit := s.userLimit(user)
+	return Usage{
+		Name:     user,
+		Files:    files,
+		Bytes:    bytes,
+		MaxFiles: limit.MaxFiles,
+		MaxBytes: limit.MaxBytes,
+	}, nil
+}
+
+// Report 返回 user 的用量及全部顶层文件夹的用量
+func (s *QuotaService) Report(ctx context.Context, user string) (UsageReport, error) {
+	userUsage, err := s.UserUsage(ctx, user)
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	roots, err := s.db.ListFolders(nil)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list folders")
+		return UsageReport{}, err
+	}
+
+	report := UsageReport{User: userUsage, Folders: make([]Usage, 0, len(roots))}
+	for _, root := range roots {
+		usage, err := s.rootUsage(root)
+		if err != nil {
+			return UsageReport{}, err
+		}
+		report.Folders = append(report.Folders, usage)
+	}
+	return report, nil
+}
+
+// DiskUsage 返回目录（folderID 为 nil 表示根目录）及其直接子文件夹各自递归统计的用量
+func (s *QuotaService) DiskUsage(ctx context.Context, folderID *string) (FolderUsage, []FolderUsage, error) {
+	path := ""
+	if folderID != nil {
+		var err error
+		if path, err = s.db.GetFolderPath(*folderID); err != nil {
+			return FolderUsage{}, nil, err
+		}
+	}
+
+	files, bytes, err := s.db.GetFileStats(folderID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("path", path).Msg("failed to get folder usage")
+		return FolderUsage{}, nil, err
+	}
+	total := FolderUsage{Path: path, Files: files, Bytes: bytes}
+	if total.Path == "" {
+		total.Path = "/"
+	}
+
+	folders, err := s.db.ListFolders(folderID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("path", path).Msg("failed to list folders")
+		return FolderUsage{}, nil, err
+	}
+
+	children := make([]FolderUsage, 0, len(folders))
+	for _, f := range folders {
+		files, bytes, err := s.db.GetFolderStats(f.FolderID)
+		if err != nil {
+			s.logger.Error().Err(err).Str("folder_id", f.FolderID).Msg("failed to get folder usage")
+			return FolderUsage{}, nil, err
+		}
+		children = append(children, FolderUsage{Path: path + "/" + f.Name, Files: files, Bytes: bytes})
+		total.Files += files
+		total.Bytes += bytes
+	}
+	return total, children, nil
+}
+
+func (s *QuotaService) rootUsage(root database.Folder) (Usage, error) {
+	files, bytes, err := s.db.GetFolderStats(root.FolderID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("folder_id", root.FolderID).Msg("failed to get folder usage")
+		return Usage{}, err
+	}
+
+	limit := s.folderLimit(root.Name)
+	return Usage{
+		Name:     root.Name,
+		Path:     "/" + root.Name,
+		Files:    files,
+		Bytes:    bytes,
+		MaxFiles: limit.MaxFiles,
+		MaxBytes: limit.MaxBytes,
+	}, nil
+}
+
+type quotaLimit struct {
+	MaxFiles int64
+	MaxBytes int64
+}
+
+func (s *QuotaService) userLimit(name string) quotaLimit {
+	return findLimit(s.cfg.Users, name, s.cfg.DefaultUser)
+}
+
+func (s *QuotaService) folderLimit(name string) quotaLimit {
+	return findLimit(s.cfg.Folders, name, s.cfg.DefaultFolder)
+}
+
+func (s *QuotaService) hasFolderLimits() bool {
+	return len(s.cfg.Folders) > 0 || s.cfg.DefaultFolder != (config.QuotaLimit{})
+}
+
+func findLimit(rules []config.QuotaRule, name string, fallback config.QuotaLimit) quotaLimit {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return quotaLimit{MaxFiles: rule.MaxFiles, MaxBytes: rule.MaxSizeMB * 1024 * 1024}
+		}
+	}
+	return quotaLimit{MaxFiles: fallback.MaxFiles, MaxBytes: fallback.MaxSizeMB * 1024 * 1024}
+}
+
+func exceeds(subject string, usage Usage, files, bytes int64) error {
+	if usage.MaxFiles > 0 && files > 0 && usage.Files+files > usage.MaxFiles {
+		return fmt.Errorf("%w: %s is limited to %d files", ErrQuotaExceeded, subject, usage.MaxFiles)
+	}
+	if usage.MaxBytes > 0 && bytes > 0 && usage.Bytes+bytes > usage.MaxBytes {
+		return fmt.Errorf("%w: %s is limited to %d MB", ErrQuotaExceeded, subject, usage.MaxBytes/(1024*1024))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+// 限流范围：RateLimitIP 按客户端 IP，RateLimitKey 按 API 密钥或登录用户，其他名称为路由组
+const (
+	RateLimitIP    = "ip"
+	RateLimitKey   = "key"
+	RateGroupAuth  = "auth"
+	RateGroupShare = "share"
+)
+
+// rateLimitSweepInterval 为清理空闲令牌桶和过期失败记录的间隔
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitService 在内存中按令牌桶限流，并在同一客户端连续认证失败后将其锁定一段时间；
+// 状态不持久化，服务重启后清空
+type RateLimitService struct {
+	cfg    config.RateLimitConfig
+	audit  *AuditService
+	logger *zerolog.Logger
+
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+	failures     map[string]*authFailures
+	throttled    map[string]int64
+	authFailures int64
+	lockouts     int64
+	lastSweep    time.Time
+}
+
+func NewRateLimitService(cfg config.RateLimitConfig, audit *AuditService) *RateLimitService {
+	l := logger.Get()
+	return &RateLimitService{
+		cfg:       cfg,
+		audit:     audit,
+		logger:    l,
+		buckets:   make(map[string]*tokenBucket),
+		failures:  make(map[string]*authFailures),
+		throttled: make(map[string]int64),
+		lastSweep: time.Now(),
+	}
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// limited 在桶耗尽后置位，同一轮限流只记录一条日志
+	limited bool
+}
+
+type authFailures struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// RateLimitStats 为限流计数，从服务启动时开始累计
+type RateLimitStats struct {
+	Enabled      bool
+	Throttled    map[string]int64
+	AuthFailures int64
+	Lockouts     int64
+	Locked       []LockedClient
+}
+
+// LockedClient 为当前因认证失败被锁定的客户端
+type LockedClient struct {
+	Client string
+	Until  time.Time
+}
+
+// Allow 从 scope 中 client 的令牌桶取出一个令牌；被限流时返回 false 及令牌补充前需要等待的时间
+func (s *RateLimitService) Allow(scope, client string) (bool, time.Duration) {
+	rule, ok := s.rule(scope)
+	if !ok {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	burst := float64(max(rule.Burst, 1))
+	rate := float64(rule.PerMinute) / 60
+	key := scope + "|" + client
+	bucket, exists := s.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: burst, updatedAt: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.limited = false
+		return true, 0
+	}
+
+	s.throttled[scope]++
+	if !bucket.limited {
+		bucket.limited = true
+		s.logger.Warn().Str("scope", scope).Str("client", client).
+			Int("per_minute", rule.PerMinute).Int("burst", rule.Burst).Msg("request rate limited")
+	}
+	return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+}
+
+// LockedOut 返回 client 因认证失败被锁定的剩余时间，未锁定时返回 0
+func (s *RateLimitService) LockedOut(client string) time.Duration {
+	if !s.lockoutEnabled() {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.failures[client]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(record.lockedUntil), 0)
+}
+
+// RecordFailure 记录 client 的一次认证失败；窗口内失败次数达到上限时锁定该客户端，写入审计日志，
+// 并返回锁定时长，否则返回 0
+func (s *RateLimitService) RecordFailure(ctx context.Context, client string) time.Duration {
+	if !s.lockoutEnabled() {
+		return 0
+	}
+
+	lockout := s.cfg.Lockout
+	window := time.Duration(lockout.WindowMinutes) * time.Minute
+	duration := time.Duration(lockout.DurationMinutes) * time.Minute
+
+	s.mu.Lock()
+	now := time.Now()
+	s.sweep(now)
+	s.authFailures++
+
+	record, ok := s.failures[client]
+	if !ok || now.Sub(record.windowStart) > window {
+		record = &authFailures{windowStart: now}
+		s.failures[client] = record
+	}
+	record.count++
+	if record.count < lockout.MaxFailures || now.Before(record.lockedUntil) {
+		s.mu.Unlock()
+		return 0
+	}
+
+	record.lockedUntil = now.Add(duration)
+	record.count = 0
+	record.windowStart = now
+	s.lockouts++
+	s.mu.Unlock()
+
+	message := fmt.Sprintf("locked out for %s after %d failed attempts", duration, lockout.MaxFailures)
+	s.logger.Warn().Str("client", client).Int("failures", lockout.MaxFailures).Dur("duration", duration).Msg("client locked out after repeated auth failures")
+	s.audit.Record(ctx, AuditEntry{
+		Action:  AuditAuthLockout,
+		Actor:   "unknown",
+		IP:      client,
+		Status:  AuditFailed,
+		Message: message,
+	})
+	return duration
+}
+
+// Stats 返回累计的限流计数和当前被锁定的客户端
+func (s *RateLimitService) Stats() RateLimitStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := RateLimitStats{
+		Enabled:      s.cfg.Enabled,
+		Throttled:    make(map[string]int64, len(s.throttled)),
+		AuthFailures: s.authFailures,
+		Lockouts:     s.lockouts,
+		Locked:       []LockedClient{},
+	}
+	for scope, n := range s.throttled {
+		stats.Throttled[scope] = n
+	}
+
+	now := time.Now()
+	for client, record := range s.failures {
+		if now.Before(record.lockedUntil) {
+			stats.Locked = append(stats.Locked, LockedClient{Client: client, Until: record.lockedUntil})
+		}
+	}
+	sort.Slice(stats.Locked, func(i, j int) bool { return stats.Locked[i].Until.Before(stats.Locked[j].Until) })
+	return stats
+}
+
+func (s *RateLimitService) rule(scope string) (config.RateLimitRule, bool) {
+	if !s.cfg.Enabled {
+		return config.RateLimitRule{}, false
+	}
+
+	var rule config.RateLimitRule
+	switch scope {
+	case RateLimitIP:
+		rule = s.cfg.IP
+	case RateLimitKey:
+		rule = s.cfg.Key
+	default:
+		rule = s.cfg.Groups[scope]
+	}
+	return rule, rule.PerMinute > 0
+}
+
+func (s *RateLimitService) lockoutEnabled() bool {
+	return s.cfg.Enabled && s.cfg.Lockout.MaxFailures > 0 && s.cfg.Lockout.DurationMinutes > 0
+}
+
+// sweep 清理已补满的令牌桶和过期的失败记录，避免大量一次性客户端占用内存；调用方须持有 mu
+func (s *RateLimitService) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	// 空闲时间超过最长补满时间的桶必然已满，删除后重建的效果相同
+	idle := s.refillTime()
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updatedAt) > idle {
+			delete(s.buckets, key)
+		}
+	}
+
+	window := time.Duration(s.cfg.Lockout.WindowMinutes) * time.Minute
+	for client, record := range s.failures {
+		if now.After(record.lockedUntil) && now.Sub(record.windowStart) > window {
+			delete(s.failures, client)
+		}
+	}
+}
+
+// refillTime 返回所有规则中令牌桶从空到满所需的最长时间
+func (s *RateLimitService) refillTime() time.Duration {
+	longest := rateLimitSweepInterval
+	rules := []config.RateLimitRule{s.cfg.IP, s.cfg.Key}
+	for _, rule := range s.cfg.Groups {
+		rules = append(rules, rule)
+	}
+	for _, rule := range rules {
+		if rule.PerMinute <= 0 {
+			continue
+		}
+		refill := time.Duration(float64(max(rule.Burst, 1)) / float64(rule.PerMinute) * float64(time.Minute))
+		longest = max(longest, refill)
+	}
+	return longest
+}
@@ -0,0 +1,639 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 分享链接的展示状态，只有 active 状态的链接可以下载
+const (
+	ShareActive    = "active"
+	ShareRevoked   = "revoked"
+	ShareExpired   = "expired"
+	ShareExhausted = "exhausted"
+)
+
+var (
+	ErrShareNotFound         = errors.New("link not found")
+	ErrShareRevoked          = errors.New("link has been revoked")
+	ErrShareExpired          = errors.New("link has expired")
+	ErrShareExhausted        = errors.New("link has reached its download limit")
+	ErrSharePasswordRequired = errors.New("password required")
+	ErrSharePasswordInvalid  = errors.New("invalid password")
+	ErrInvalidShareTTL       = errors.New("ttl exceeds the maximum allowed for share links")
+	ErrInvalidShareOptions   = errors.New("max_downloads must not be negative and disposition must be inline or attachment")
+	ErrSharePathNotFound     = errors.New("path not found in shared folder")
+	ErrNotFolderShare        = errors.New("link does not point to a folder")
+	ErrUploadShareTarget     = errors.New("upload links must point to a folder")
+	ErrInvalidShareTypes     = errors.New("allowed types must be MIME types such as image/png or image/*")
+	ErrNotUploadShare        = errors.New("link does not accept uploads")
+	ErrShareFileTooLarge     = errors.New("file exceeds the size limit of this link")
+	ErrShareTypeNotAllowed   = errors.New("file type is not allowed by this link")
+	ErrInvalidShareFileName  = errors.New("invalid file name")
+)
+
+// 分享链接指向的对象类型
+const (
+	ShareTypeFile   = "file"
+	ShareTypeFolder = "folder"
+	ShareTypeUpload = "upload"
+)
+
+// ShareService 管理文件和文件夹的公开链接；文件夹链接可以浏览其下的子树、下载单个文件或打包下载，
+// 收集链接只能向目标文件夹上传文件
+type ShareService struct {
+	cfg     config.ShareConfig
+	db      *database.DB
+	storage file.Storage
+	files   *FileService
+	audit   *AuditService
+	logger  *zerolog.Logger
+}
+
+func NewShareService(cfg config.ShareConfig, db *database.DB, storage file.Storage, files *FileService, audit *AuditService) *ShareService {
+	l := logger.Get()
+	return &ShareService{
+		cfg:     cfg,
+		db:      db,
+		storage: storage,
+		files:   files,
+		audit:   audit,
+		logger:  l,
+	}
+}
+
+// ShareTarget 为链接指向的文件或文件夹，只设置其一；用于筛选时空字段表示不按该项筛选
+type ShareTarget struct {
+	FileID   string
+	FolderID string
+}
+
+// ShareOptions 为创建链接的参数。TTL 为 nil 时使用默认有效期，指向 0 时永不过期；
+// MaxDownloads 为 0 表示不限制；Disposition 为空时按 attachment 下载。
+// Upload 为 true 时创建收集链接，MaxDownloads 限制上传次数，MaxSize 和 AllowedTypes 限制单个文件的大小和类型
+type ShareOptions struct {
+	TTL          *time.Duration
+	Password     string
+	MaxDownloads int
+	Disposition  string
+	Upload       bool
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+type ShareInfo struct {
+	Token          string
+	Type           string
+	FileID         string
+	FolderID       string
+	Path           string
+	Status         string
+	ExpiresAt      *time.Time
+	HasPassword    bool
+	MaxDownloads   int
+	DownloadCount  int
+	Disposition    string
+	MaxSize        int64
+	AllowedTypes   []string
+	LastAccessedAt *time.Time
+	CreatedBy      string
+	CreatedAt      time.Time
+}
+
+func (s *ShareService) Create(ctx context.Context, target ShareTarget, createdBy string, opts ShareOptions) (ShareInfo, error) {
+	if opts.MaxDownloads < 0 || (opts.Disposition != "" && opts.Disposition != "inline" && opts.Disposition != "attachment") {
+		return ShareInfo{}, ErrInvalidShareOptions
+	}
+	if opts.Upload && target.FolderID == "" {
+		return ShareInfo{}, ErrUploadShareTarget
+	}
+	if opts.MaxSize < 0 || (!opts.Upload && (opts.MaxSize > 0 || len(opts.AllowedTypes) > 0)) {
+		return ShareInfo{}, ErrInvalidShareOptions
+	}
+	for i, t := range opts.AllowedTypes {
+		if !validMediaPattern(t) {
+			return ShareInfo{}, fmt.Errorf("%w: %s", ErrInvalidShareTypes, t)
+		}
+		opts.AllowedTypes[i] = strings.ToLower(t)
+	}
+
+	ttl := time.Duration(s.cfg.DefaultTTLHours) * time.Hour
+	if opts.TTL != nil {
+		ttl = *opts.TTL
+	}
+	maxTTL := time.Duration(s.cfg.MaxTTLHours) * time.Hour
+	if ttl < 0 || (maxTTL > 0 && (ttl == 0 || ttl > maxTTL)) {
+		return ShareInfo{}, ErrInvalidShareTTL
+	}
+
+	now := time.Now().UTC()
+	link := &database.ShareLink{
+		Token:        utils.GenerateShareToken(),
+		FileID:       target.FileID,
+		FolderID:     target.FolderID,
+		MaxDownloads: opts.MaxDownloads,
+		Disposition:  opts.Disposition,
+		Upload:       opts.Upload,
+		MaxSizeBytes: opts.MaxSize,
+		AllowedTypes: strings.Join(opts.AllowedTypes, ","),
+		CreatedAt:    now,
+		CreatedBy:    createdBy,
+		Status:       ShareActive,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		link.ExpiresAt = &expiresAt
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return ShareInfo{}, err
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	if err := s.db.CreateShareLink(link); err != nil {
+		s.logger.Error().Err(err).Str("file_id", target.FileID).Str("folder_id", target.FolderID).Msg("failed to create share link")
+		return ShareInfo{}, err
+	}
+
+	s.logger.Info().Str("file_id", target.FileID).Str("folder_id", target.FolderID).Str("token", link.Token).Msg("share link created")
+	return s.shareInfo(*link, now), nil
+}
+
+func (s *ShareService) Get(ctx context.Context, token string) (ShareInfo, error) {
+	link, err := s.db.GetShareLink(token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ShareInfo{}, ErrShareNotFound
+		}
+		return ShareInfo{}, err
+	}
+	return s.shareInfo(link, time.Now().UTC()), nil
+}
+
+// Active 返回文件最新的可用链接，没有时返回 ErrShareNotFound
+func (s *ShareService) Active(ctx context.Context, fileID string) (ShareInfo, error) {
+	now := time.Now().UTC()
+	link, err := s.db.GetActiveShareLink(fileID, now)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ShareInfo{}, ErrShareNotFound
+		}
+		return ShareInfo{}, err
+	}
+	return s.shareInfo(link, now), nil
+}
+
+// List 按目标和创建者筛选链接，createdBy 为 nil 时不按创建者筛选
+func (s *ShareService) List(ctx context.Context, target ShareTarget, createdBy *string) ([]ShareInfo, error) {
+	var fileID, folderID *string
+	if target.FileID != "" {
+		fileID = &target.FileID
+	}
+	if target.FolderID != "" {
+		folderID = &target.FolderID
+	}
+
+	links, err := s.db.ListShareLinks(fileID, folderID, createdBy)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list share links")
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	infos := make([]ShareInfo, 0, len(links))
+	for _, link := range links {
+		infos = append(infos, s.shareInfo(link, now))
+	}
+	return infos, nil
+}
+
+func (s *ShareService) Revoke(ctx context.Context, token string) error {
+	if err := s.db.RevokeShareLink(token); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareNotFound
+		}
+		s.logger.Error().Err(err).Str("token", token).Msg("failed to revoke share link")
+		return err
+	}
+
+	s.logger.Info().Str("token", token).Msg("share link revoked")
+	return nil
+}
+
+// shareResumeWindow 为链接用尽后仍接受续传请求的时长，自最近一次访问起算，每次续传都会延长
+const shareResumeWindow = 10 * time.Minute
+
+// Open 校验链接状态和密码。resume 为 true 表示请求续传已开始的下载（Range 不从第 0 字节开始），
+// 这样的请求不计数，用尽链接的那次下载在最近一次访问后的 shareResumeWindow 内仍可取得剩余部分
+func (s *ShareService) Open(ctx context.Context, token, password string, resume bool) (ShareInfo, error) {
+	link, err := s.db.GetShareLink(token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ShareInfo{}, ErrShareNotFound
+		}
+		return ShareInfo{}, err
+	}
+
+	now := time.Now().UTC()
+	switch s.status(link, now) {
+	case ShareRevoked:
+		return ShareInfo{}, ErrShareRevoked
+	case ShareExpired:
+		return ShareInfo{}, ErrShareExpired
+	case ShareExhausted:
+		if !resume || link.LastAccessedAt == nil || now.Sub(*link.LastAccessedAt) >= shareResumeWindow {
+			return ShareInfo{}, ErrShareExhausted
+		}
+	}
+
+	if link.PasswordHash != "" {
+		if password == "" {
+			return ShareInfo{}, ErrSharePasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return ShareInfo{}, ErrSharePasswordInvalid
+		}
+	}
+
+	info := s.shareInfo(link, now)
+	if err := s.db.TouchShareLink(token, now); err != nil {
+		s.logger.Warn().Err(err).Str("token", token).Msg("failed to record share link access")
+	}
+	return info, nil
+}
+
+// Count 为已通过 Open 校验的链接计入一次下载，达到上限时返回 ErrShareExhausted；
+// 计数与下载次数上限的检查在同一条更新语句中完成，并发下载不会超出上限。
+// 文件夹链接在确认请求的路径存在后再计数，浏览目录不计入下载次数
+func (s *ShareService) Count(ctx context.Context, link ShareInfo) (ShareInfo, error) {
+	now := time.Now().UTC()
+	counted, err := s.db.CountShareDownload(link.Token, now)
+	if err != nil {
+		return ShareInfo{}, err
+	}
+	if !counted {
+		return ShareInfo{}, ErrShareExhausted
+	}
+	link.DownloadCount++
+	link.LastAccessedAt = &now
+	return link, nil
+}
+
+func (s *ShareService) status(link database.ShareLink, now time.Time) string {
+	switch {
+	case link.Status != ShareActive:
+		return ShareRevoked
+	case link.ExpiresAt != nil && !now.Before(*link.ExpiresAt):
+		return ShareExpired
+	case link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads:
+		return ShareExhausted
+	}
+	return ShareActive
+}
+
+func (s *ShareService) shareInfo(link database.ShareLink, now time.Time) ShareInfo {
+	// 文件或文件夹已被删除时路径为空
+	shareType, path := ShareTypeFile, ""
+	if link.FolderID != "" {
+		shareType = ShareTypeFolder
+		if link.Upload {
+			shareType = ShareTypeUpload
+		}
+		path, _ = s.db.GetFolderPath(link.FolderID)
+	} else {
+		path, _ = s.db.GetFilePath(link.FileID)
+	}
+	disposition := link.Disposition
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	return ShareInfo{
+		Token:          link.Token,
+		Type:           shareType,
+		FileID:         link.FileID,
+		FolderID:       link.FolderID,
+		Path:           path,
+		Status:         s.status(link, now),
+		ExpiresAt:      link.ExpiresAt,
+		HasPassword:    link.PasswordHash != "",
+		MaxDownloads:   link.MaxDownloads,
+		DownloadCount:  link.DownloadCount,
+		Disposition:    disposition,
+		MaxSize:        link.MaxSizeBytes,
+		AllowedTypes:   splitList(link.AllowedTypes),
+		LastAccessedAt: link.LastAccessedAt,
+		CreatedBy:      link.CreatedBy,
+		CreatedAt:      link.CreatedAt,
+	}
+}
+
+// ShareEntry 为文件夹链接中的一项，Path 为相对于分享文件夹的路径
+type ShareEntry struct {
+	Name      string
+	Path      string
+	Size      int64
+	MimeType  string
+	UpdatedAt time.Time
+}
+
+// ShareListing 为文件夹链接中某个目录的内容
+type ShareListing struct {
+	Name    string
+	Path    string
+	Folders []ShareEntry
+	Files   []ShareEntry
+}
+
+// Browse 列出文件夹链接中 rel 目录下的子文件夹和文件
+func (s *ShareService) Browse(ctx context.Context, link ShareInfo, rel string) (ShareListing, error) {
+	folder, clean, err := s.resolveFolder(link, rel)
+	if err != nil {
+		return ShareListing{}, err
+	}
+
+	listing := ShareListing{Name: folder.Name, Path: clean, Folders: []ShareEntry{}, Files: []ShareEntry{}}
+	folders, err := s.db.ListFolders(&folder.FolderID)
+	if err != nil {
+		return ShareListing{}, err
+	}
+	for _, f := range folders {
+		listing.Folders = append(listing.Folders, ShareEntry{Name: f.Name, Path: path.Join(clean, f.Name), UpdatedAt: f.UpdatedAt})
+	}
+
+	files, _, err := s.db.ListFilesByFolder(&folder.FolderID, -1, -1, "asc", "")
+	if err != nil {
+		return ShareListing{}, err
+	}
+	for _, f := range files {
+		listing.Files = append(listing.Files, ShareEntry{
+			Name:      f.OriginalName,
+			Path:      path.Join(clean, f.OriginalName),
+			Size:      f.Size,
+			MimeType:  f.MimeType,
+			UpdatedAt: f.UpdatedAt,
+		})
+	}
+	return listing, nil
+}
+
+// FileAt 返回文件夹链接中 rel 指向的文件
+func (s *ShareService) FileAt(ctx context.Context, link ShareInfo, rel string) (database.File, error) {
+	dir, name := path.Split(cleanSharePath(rel))
+	if name == "" {
+		return database.File{}, ErrSharePathNotFound
+	}
+
+	folder, _, err := s.resolveFolder(link, dir)
+	if err != nil {
+		return database.File{}, err
+	}
+	record, err := s.db.GetFileByName(name, &folder.FolderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return database.File{}, ErrSharePathNotFound
+		}
+		return database.File{}, err
+	}
+	return record, nil
+}
+
+// FolderName 返回文件夹链接中 rel 目录的名称，用作打包下载的文件名
+func (s *ShareService) FolderName(ctx context.Context, link ShareInfo, rel string) (string, error) {
+	folder, _, err := s.resolveFolder(link, rel)
+	if err != nil {
+		return "", err
+	}
+	return folder.Name, nil
+}
+
+// WriteZip 将文件夹链接中 rel 目录下的全部内容以 zip 格式流式写入 w，不在内存或磁盘中缓存整个压缩包；
+// 写入开始后出错时压缩包不完整，调用方只能中断响应
+func (s *ShareService) WriteZip(ctx context.Context, link ShareInfo, rel string, w io.Writer) error {
+	folder, _, err := s.resolveFolder(link, rel)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := s.zipFolder(ctx, zw, folder.FolderID, ""); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s *ShareService) zipFolder(ctx context.Context, zw *zip.Writer, folderID, prefix string) error {
+	files, _, err := s.db.ListFilesByFolder(&folderID, -1, -1, "asc", "")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := s.zipFile(ctx, zw, f, prefix+f.OriginalName); err != nil {
+			return err
+		}
+	}
+
+	folders, err := s.db.ListFolders(&folderID)
+	if err != nil {
+		return err
+	}
+	for _, f := range folders {
+		dir := prefix + f.Name + "/"
+		if _, err := zw.CreateHeader(&zip.FileHeader{Name: dir, Modified: f.UpdatedAt}); err != nil {
+			return err
+		}
+		if err := s.zipFolder(ctx, zw, f.FolderID, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ShareService) zipFile(ctx context.Context, zw *zip.Writer, record database.File, name string) error {
+	reader, _, err := s.storage.Get(ctx, record.ObjectKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: record.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, reader)
+	return err
+}
+
+// resolveFolder 在文件夹链接中按名称逐级查找 rel 目录，返回文件夹及规范化后的相对路径
+func (s *ShareService) resolveFolder(link ShareInfo, rel string) (database.Folder, string, error) {
+	// 收集链接同样指向文件夹，但不允许查看其内容
+	if link.Type != ShareTypeFolder {
+		return database.Folder{}, "", ErrNotFolderShare
+	}
+
+	folder, err := s.db.GetFolder(link.FolderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return database.Folder{}, "", ErrSharePathNotFound
+		}
+		return database.Folder{}, "", err
+	}
+
+	clean := cleanSharePath(rel)
+	for _, name := range strings.Split(strings.Trim(clean, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if folder, err = s.db.GetFolderByName(name, &folder.FolderID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.Folder{}, "", ErrSharePathNotFound
+			}
+			return database.Folder{}, "", err
+		}
+	}
+	return folder, clean, nil
+}
+
+// cleanSharePath 将相对路径规范化为以 / 开头的形式，.. 不会越过分享文件夹
+func cleanSharePath(rel string) string {
+	return path.Clean("/" + rel)
+}
+
+// ShareUpload 为通过收集链接上传的文件，IP 为上传者地址，记录在审计日志中
+type ShareUpload struct {
+	Name   string
+	Size   int64
+	Reader io.Reader
+	IP     string
+}
+
+// Receive 将文件写入收集链接的目标文件夹。文件类型按内容识别而非信任客户端声明；
+// 同名文件已存在时自动改名，不覆盖已有内容。文件归属于链接的创建者并计入其配额。
+// 写入前先占用一次上传次数，并发上传不会超出上限，写入失败时退还；无论成功与否都会写入审计日志
+func (s *ShareService) Receive(ctx context.Context, link ShareInfo, upload ShareUpload) (FileMetadata, error) {
+	metadata, err := s.receive(ctx, link, upload)
+
+	entry := AuditEntry{
+		Action:  AuditShareUpload,
+		Actor:   shareActor(link.Token),
+		IP:      upload.IP,
+		Path:    path.Join(link.Path, metadata.OriginalName),
+		FileID:  metadata.FileID,
+		Status:  AuditSuccess,
+		Message: fmt.Sprintf("uploaded %s (%d bytes)", metadata.OriginalName, metadata.Size),
+	}
+	if err != nil {
+		entry.Path = link.Path
+		entry.Status, entry.Message = AuditFailed, fmt.Sprintf("upload of %s rejected: %v", upload.Name, err)
+	}
+	s.audit.Record(ctx, entry)
+	return metadata, err
+}
+
+func (s *ShareService) receive(ctx context.Context, link ShareInfo, upload ShareUpload) (FileMetadata, error) {
+	if link.Type != ShareTypeUpload {
+		return FileMetadata{}, ErrNotUploadShare
+	}
+	name := path.Base(strings.ReplaceAll(upload.Name, "\\", "/"))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return FileMetadata{}, ErrInvalidShareFileName
+	}
+	if link.MaxSize > 0 && upload.Size > link.MaxSize {
+		return FileMetadata{}, ErrShareFileTooLarge
+	}
+
+	reader := bufio.NewReaderSize(upload.Reader, 512)
+	head, err := reader.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return FileMetadata{}, err
+	}
+	if !mediaTypeAllowed(http.DetectContentType(head), link.AllowedTypes) {
+		return FileMetadata{}, ErrShareTypeNotAllowed
+	}
+
+	if _, err := s.db.GetFolder(link.FolderID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileMetadata{}, ErrShareNotFound
+		}
+		return FileMetadata{}, err
+	}
+	name = s.freeFileName(name, link.FolderID)
+
+	if _, err := s.Count(ctx, link); err != nil {
+		return FileMetadata{}, err
+	}
+
+	metadata, err := s.files.CreateFile(ctx, reader, upload.Size, s.files.GenerateFileID(), name, link.FolderID, link.CreatedBy)
+	if err != nil {
+		if refundErr := s.db.RefundShareDownload(link.Token); refundErr != nil {
+			s.logger.Error().Err(refundErr).Str("token", link.Token).Msg("failed to refund upload link use")
+		}
+		return FileMetadata{}, err
+	}
+	s.logger.Info().Str("token", link.Token).Str("file_id", metadata.FileID).Str("ip", upload.IP).Msg("file received through upload link")
+	return metadata, nil
+}
+
+// freeFileName 在文件夹中已有同名文件时依次尝试 name (2).ext、name (3).ext ……
+func (s *ShareService) freeFileName(name, folderID string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := s.db.GetFileByName(candidate, &folderID); err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// shareActor 为审计日志中匿名访问者的标识，只保留令牌前缀以免日志泄露完整链接
+func shareActor(token string) string {
+	if len(token) > 8 {
+		token = token[:8]
+	}
+	return "share:" + token
+}
+
+// validMediaPattern 检查允许类型的写法：type/subtype 或 type/*
+func validMediaPattern(pattern string) bool {
+	major, minor, ok := strings.Cut(pattern, "/")
+	return ok && major != "" && major != "*" && minor != "" && !strings.ContainsAny(pattern, " ,;")
+}
+
+// mediaTypeAllowed 检查识别出的类型是否匹配允许列表，列表为空时不限制
+func mediaTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, pattern := range allowed {
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const (
+	TrashItemFile   = "file"
+	TrashItemFolder = "folder"
+)
+
+// 恢复时原路径已被占用的处理方式
+const (
+	RestoreConflictFail      = "fail"
+	RestoreConflictRename    = "rename"
+	RestoreConflictOverwrite = "overwrite"
+)
+
+var (
+	ErrTrashItemNotFound = errors.New("trash item not found")
+	ErrRestoreConflict   = errors.New("restore target already exists")
+)
+
+type TrashService struct {
+	db      *database.DB
+	files   *FileService
+	folders *FolderService
+	logger  *zerolog.Logger
+}
+
+func NewTrashService(db *database.DB, files *FileService, folders *FolderService) *TrashService {
+	l := logger.Get()
+	return &TrashService{
+		db:      db,
+		files:   files,
+		folders: folders,
+		logger:  l,
+	}
+}
+
+type TrashItem struct {
+	Type string
+	ID   string
+	Name string
+	Path string
+	// FolderID 为删除前文件所在的文件夹（nil 表示根目录），对文件夹项则为其自身
+	FolderID  *string
+	Size      int64
+	DeletedAt time.Time
+}
+
+func (s *TrashService) List(ctx context.Context) ([]TrashItem, error) {
+	folders, err := s.db.ListTrashedFolders()
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.db.ListTrashedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]TrashItem, 0, len(folders)+len(files))
+	for _, f := range folders {
+		items = append(items, folderTrashItem(f))
+	}
+	for _, f := range files {
+		items = append(items, fileTrashItem(f))
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// Get 返回回收站中的一项
+func (s *TrashService) Get(ctx context.Context, id string) (TrashItem, error) {
+	if record, err := s.db.GetTrashedFile(id); err == nil {
+		return fileTrashItem(record), nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, err
+	}
+
+	if record, err := s.db.GetTrashedFolder(id); err == nil {
+		return folderTrashItem(record), nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, err
+	}
+
+	return TrashItem{}, ErrTrashItemNotFound
+}
+
+// Restore 将回收站中的文件或文件夹恢复到原路径，缺失的上级文件夹会被重新创建
+func (s *TrashService) Restore(ctx context.Context, id, onConflict, user string) (TrashItem, error) {
+	if onConflict == "" {
+		onConflict = RestoreConflictFail
+	}
+
+	if record, err := s.db.GetTrashedFile(id); err == nil {
+		return s.restoreFile(ctx, record, onConflict, user)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, err
+	}
+
+	if record, err := s.db.GetTrashedFolder(id); err == nil {
+		return s.restoreFolder(ctx, record, onConflict, user)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, err
+	}
+
+	return TrashItem{}, ErrTrashItemNotFound
+}
+
+func (s *TrashService) restoreFile(ctx context.Context, record database.File, onConflict, user string) (TrashItem, error) {
+	dir, name := splitTrashPath(record.TrashPath, record.OriginalName)
+	parentID, err := s.folders.EnsureFolderPath(ctx, dir, user)
+	if err != nil {
+		return TrashItem{}, err
+	}
+
+	if existing, err := s.db.GetFileByName(name, parentID); err == nil {
+		switch onConflict {
+		case RestoreConflictRename:
+			name = s.freeName(name, func(candidate string) bool {
+				_, err := s.db.GetFileByName(candidate, parentID)
+				return err == nil
+			})
+		case RestoreConflictOverwrite:
+			if err := s.files.DeleteFile(ctx, existing.FileID); err != nil {
+				return TrashItem{}, err
+			}
+		default:
+			return TrashItem{}, fmt.Errorf("%w: %s", ErrRestoreConflict, path.Join(dir, name))
+		}
+	}
+
+	if err := s.db.RestoreFile(record.FileID, parentID, name); err != nil {
+		s.logger.Error().Err(err).Str("file_id", record.FileID).Msg("failed to restore file")
+		return TrashItem{}, err
+	}
+
+	restored := fileTrashItem(record)
+	restored.Name = name
+	restored.Path = path.Join(dir, name)
+	s.logger.Info().Str("file_id", record.FileID).Str("path", restored.Path).Msg("file restored from trash")
+	return restored, nil
+}
+
+func (s *TrashService) restoreFolder(ctx context.Context, record database.Folder, onConflict, user string) (TrashItem, error) {
+	dir, name := splitTrashPath(record.TrashPath, record.Name)
+	parentID, err := s.folders.EnsureFolderPath(ctx, dir, user)
+	if err != nil {
+		return TrashItem{}, err
+	}
+
+	if _, err := s.db.GetFolderByName(name, parentID); err == nil {
+		// 文件夹不支持覆盖，只能改名恢复
+		if onConflict != RestoreConflictRename {
+			return TrashItem{}, fmt.Errorf("%w: %s", ErrRestoreConflict, path.Join(dir, name))
+		}
+		name = s.freeName(name, func(candidate string) bool {
+			_, err := s.db.GetFolderByName(candidate, parentID)
+			return err == nil
+		})
+	}
+
+	if err := s.db.RestoreFolder(record.FolderID, parentID, name); err != nil {
+		s.logger.Error().Err(err).Str("folder_id", record.FolderID).Msg("failed to restore folder")
+		return TrashItem{}, err
+	}
+
+	restored := folderTrashItem(record)
+	restored.Name = name
+	restored.Path = path.Join(dir, name)
+	s.logger.Info().Str("folder_id", record.FolderID).Str("path", restored.Path).Msg("folder restored from trash")
+	return restored, nil
+}
+
+// Purge 彻底删除回收站中的一项，文件夹会连同其下的全部内容一起删除
+func (s *TrashService) Purge(ctx context.Context, id string) error {
+	if _, err := s.db.GetTrashedFile(id); err == nil {
+		return s.files.PurgeFile(ctx, id)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if _, err := s.db.GetTrashedFolder(id); err == nil {
+		return s.purgeFolder(ctx, id)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return ErrTrashItemNotFound
+}
+
+func (s *TrashService) purgeFolder(ctx context.Context, folderID string) error {
+	fileIDs, folderIDs, err := s.db.ListAllChildren(folderID)
+	if err != nil {
+		return err
+	}
+	for _, id := range fileIDs {
+		if err := s.files.PurgeFile(ctx, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range folderIDs {
+		if err := s.purgeFolder(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.PurgeFolder(folderID); err != nil {
+		s.logger.Error().Err(err).Str("folder_id", folderID).Msg("failed to purge folder")
+		return err
+	}
+	s.logger.Info().Str("folder_id", folderID).Msg("folder purged")
+	return nil
+}
+
+// Empty 清空回收站，返回删除的项数
+func (s *TrashService) Empty(ctx context.Context) (int, error) {
+	return s.purgeWhere(ctx, func(TrashItem) bool { return true })
+}
+
+// PurgeExpired 删除在回收站中超过保留期的项
+func (s *TrashService) PurgeExpired(ctx context.Context, retention time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	purged, err := s.purgeWhere(ctx, func(item TrashItem) bool { return item.DeletedAt.Before(cutoff) })
+	if purged > 0 {
+		s.logger.Info().Int("count", purged).Msg("expired trash items purged")
+	}
+	return purged, err
+}
+
+func (s *TrashService) purgeWhere(ctx context.Context, match func(TrashItem) bool) (int, error) {
+	items, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		if !match(item) {
+			continue
+		}
+		// 文件夹可能已连同其中的项一起删除
+		if err := s.Purge(ctx, item.ID); err != nil {
+			if errors.Is(err, ErrTrashItemNotFound) {
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// freeName 为重名项生成新名称，如 report (restored).pdf、report (restored 2).pdf
+func (s *TrashService) freeName(name string, exists func(string) bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := base + " (restored)" + ext
+	for i := 2; exists(candidate); i++ {
+		candidate = fmt.Sprintf("%s (restored %d)%s", base, i, ext)
+	}
+	return candidate
+}
+
+// splitTrashPath 拆分删除时记录的路径，旧记录没有路径时恢复到根目录
+func splitTrashPath(trashPath, fallbackName string) (string, string) {
+	if trashPath == "" {
+		return "/", fallbackName
+	}
+	return path.Dir(trashPath), path.Base(trashPath)
+}
+
+func fileTrashItem(f database.File) TrashItem {
+	return TrashItem{
+		Type:      TrashItemFile,
+		ID:        f.FileID,
+		Name:      f.OriginalName,
+		Path:      f.TrashPath,
+		FolderID:  f.FolderID,
+		Size:      f.Size,
+		DeletedAt: f.DeletedAt.Time,
+	}
+}
+
+func folderTrashItem(f database.Folder) TrashItem {
+	return TrashItem{
+		Type:      TrashItemFolder,
+		ID:        f.FolderID,
+		Name:      f.Name,
+		Path:      f.TrashPath,
+		FolderID:  &f.FolderID,
+		DeletedAt: f.DeletedAt.Time,
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTargetExists = errors.New("target already exists")
+	ErrFolderCycle  = errors.New("cannot move or copy a folder into itself")
+)
+
+// TreeService 负责文件与文件夹的复制、移动等跨目录操作，元数据变更都在单个事务中完成
+type TreeService struct {
+	db      *database.DB
+	storage file.Storage
+	quotas  *QuotaService
+	logger  *zerolog.Logger
+}
+
+func NewTreeService(db *database.DB, storage file.Storage, quotas *QuotaService) *TreeService {
+	l := logger.Get()
+	return &TreeService{
+		db:      db,
+		storage: storage,
+		quotas:  quotas,
+		logger:  l,
+	}
+}
+
+// CopyResult 汇总一次复制创建的文件夹数、文件数和总大小
+type CopyResult struct {
+	ID      string
+	Folders int
+	Files   int
+	Bytes   int64
+}
+
+// MoveFolder 将文件夹移到 parentID 下并改名为 name，不允许移入自身或其子孙
+func (s *TreeService) MoveFolder(ctx context.Context, folderID string, parentID *string, name string) error {
+	folder, err := s.db.GetFolder(folderID)
+	if err != nil {
+		return err
+	}
+	if err := s.quotas.CheckFolderMove(ctx, folder, parentID, name); err != nil {
+		return err
+	}
+
+	if err := mapTreeError(s.db.RelocateFolder(folderID, parentID, name)); err != nil {
+		s.logger.Error().Err(err).Str("folder_id", folderID).Msg("failed to move folder")
+		return err
+	}
+
+	s.logger.Info().Str("folder_id", folderID).Str("name", name).Msg("folder moved successfully")
+	return nil
+}
+
+// MoveFile 将文件移到 folderID 下并改名为 name
+func (s *TreeService) MoveFile(ctx context.Context, fileID string, folderID *string, name string) error {
+	record, err := s.db.GetFile(fileID)
+	if err != nil {
+		return err
+	}
+	if err := s.quotas.CheckMove(ctx, record.FolderID, folderID, 1, record.Size); err != nil {
+		return err
+	}
+
+	if err := mapTreeError(s.db.RelocateFile(fileID, folderID, name)); err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to move file")
+		return err
+	}
+
+	s.logger.Info().Str("file_id", fileID).Str("name", name).Msg("file moved successfully")
+	return nil
+}
+
+// CopyFile 复制单个文件到 folderID 下并命名为 name，只复制当前版本
+func (s *TreeService) CopyFile(ctx context.Context, fileID string, folderID *string, name, createdBy string) (CopyResult, error) {
+	source, err := s.db.GetFile(fileID)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	plan := &copyPlan{createdBy: createdBy, now: time.Now().UTC()}
+	record := plan.addFile(source, folderID)
+	record.OriginalName = name
+
+	return s.execute(ctx, plan, name, folderID, record.FileID)
+}
+
+// CopyFolder 递归复制文件夹到 parentID 下并命名为 name，不允许复制到自身或其子孙中
+func (s *TreeService) CopyFolder(ctx context.Context, folderID string, parentID *string, name, createdBy string) (CopyResult, error) {
+	source, err := s.db.GetFolder(folderID)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	within, err := s.db.IsFolderWithin(parentID, folderID)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	if within {
+		return CopyResult{}, ErrFolderCycle
+	}
+
+	plan := &copyPlan{createdBy: createdBy, now: time.Now().UTC()}
+	root := plan.addFolder(source, parentID)
+	root.Name = name
+	if err := s.collect(plan, source.FolderID, root.FolderID); err != nil {
+		return CopyResult{}, err
+	}
+
+	return s.execute(ctx, plan, name, parentID, root.FolderID)
+}
+
+// collect 按层级把 sourceID 下的内容加入复制计划，挂到新文件夹 targetID 下
+func (s *TreeService) collect(plan *copyPlan, sourceID, targetID string) error {
+	files, _, err := s.db.ListFilesByFolder(&sourceID, -1, -1, "asc", "")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		plan.addFile(f, &targetID)
+	}
+
+	folders, err := s.db.ListFolders(&sourceID)
+	if err != nil {
+		return err
+	}
+	for _, f := range folders {
+		child := plan.addFolder(f, &targetID)
+		if err := s.collect(plan, f.FolderID, child.FolderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute 先为无法共享对象的文件写入副本，再在一个事务中创建全部记录；事务失败时删除已写入的副本
+func (s *TreeService) execute(ctx context.Context, plan *copyPlan, rootName string, rootParentID *string, rootID string) (CopyResult, error) {
+	var written []string
+	cleanup := func(keys []string) {
+		for _, key := range keys {
+			if err := s.storage.Delete(ctx, key); err != nil {
+				s.logger.Error().Err(err).Str("object_key", key).Msg("failed to clean up copied object")
+			}
+		}
+	}
+
+	result := CopyResult{ID: rootID, Folders: len(plan.folders), Files: len(plan.files)}
+	for _, pf := range plan.files {
+		result.Bytes += pf.Record.Size
+	}
+	if err := s.quotas.Check(ctx, plan.createdBy, rootParentID, int64(result.Files), result.Bytes); err != nil {
+		return CopyResult{}, err
+	}
+
+	for i := range plan.files {
+		pf := &plan.files[i]
+		if pf.Record.SHA256 != "" {
+			if _, err := s.db.GetStorageObjectByHash(pf.Record.SHA256); err == nil {
+				continue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				cleanup(written)
+				return CopyResult{}, err
+			}
+		}
+
+		object, err := s.copyObject(ctx, pf.Record, pf.source)
+		if err != nil {
+			cleanup(written)
+			return CopyResult{}, err
+		}
+		written = append(written, object.ObjectKey)
+		pf.Object = object
+	}
+
+	copies := make([]database.FileCopy, 0, len(plan.files))
+	for _, f := range plan.files {
+		copies = append(copies, f.FileCopy)
+	}
+
+	redundant, err := s.db.CopyTree(rootName, rootParentID, plan.folders, copies)
+	if err != nil {
+		cleanup(written)
+		return CopyResult{}, mapTreeError(err)
+	}
+	cleanup(redundant)
+
+	s.logger.Info().
+		Str("id", rootID).
+		Int("folders", result.Folders).
+		Int("files", result.Files).
+		Int("objects_copied", len(written)-len(redundant)).
+		Msg("copy completed")
+	return result, nil
+}
+
+// copyObject 为早期未登记去重信息的文件复制一份对象，同时补算 SHA-256
+func (s *TreeService) copyObject(ctx context.Context, record *database.File, sourceKey string) (*database.StorageObject, error) {
+	reader, _, err := s.storage.Get(ctx, sourceKey, nil, nil)
+	if err != nil {
+		s.logger.Error().Err(err).Str("object_key", sourceKey).Msg("failed to read object for copy")
+		return nil, err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	saveResult, err := s.storage.Save(ctx, io.TeeReader(reader, hasher), record.Size, record.FileID, record.OriginalName)
+	if err != nil {
+		s.logger.Error().Err(err).Str("object_key", sourceKey).Msg("failed to copy object")
+		return nil, err
+	}
+
+	return &database.StorageObject{
+		SHA256:    hex.EncodeToString(hasher.Sum(nil)),
+		ObjectKey: saveResult.ObjectKey,
+		Size:      saveResult.Size,
+		MimeType:  saveResult.MimeType,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.CreatedAt,
+	}, nil
+}
+
+type copyPlan struct {
+	createdBy string
+	now       time.Time
+	folders   []*database.Folder
+	files     []plannedFile
+}
+
+type plannedFile struct {
+	database.FileCopy
+	source string
+}
+
+func (p *copyPlan) addFolder(source database.Folder, parentID *string) *database.Folder {
+	folder := &database.Folder{
+		FolderID:  utils.GenerateFolderID(),
+		Name:      source.Name,
+		ParentID:  parentID,
+		CreatedBy: p.createdBy,
+		CreatedAt: p.now,
+		UpdatedAt: p.now,
+	}
+	p.folders = append(p.folders, folder)
+	return folder
+}
+
+func (p *copyPlan) addFile(source database.File, folderID *string) *database.File {
+	record := &database.File{
+		FileID:       utils.GenerateFileID(),
+		OriginalName: source.OriginalName,
+		Size:         source.Size,
+		MimeType:     source.MimeType,
+		SHA256:       source.SHA256,
+		FolderID:     folderID,
+		Version:      1,
+		CreatedBy:    p.createdBy,
+		UpdatedBy:    p.createdBy,
+		CreatedAt:    p.now,
+		UpdatedAt:    p.now,
+	}
+	p.files = append(p.files, plannedFile{FileCopy: database.FileCopy{Record: record}, source: source.ObjectKey})
+	return record
+}
+
+func mapTreeError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNameTaken):
+		return ErrTargetExists
+	case errors.Is(err, database.ErrFolderCycle):
+		return ErrFolderCycle
+	}
+	return err
+}
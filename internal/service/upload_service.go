@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const (
+	// MinChunkSize 为 MinIO 分片上传要求的最小分片（最后一片除外）
+	MinChunkSize = 5 * 1024 * 1024
+	// MaxChunkSize 限制单片大小，分片失败后须整片重传，单片不宜过大
+	MaxChunkSize   = 512 * 1024 * 1024
+	maxUploadParts = 10000
+)
+
+// 上传会话状态。completing 表示正有请求在完成会话；assembled 表示分片已合并为对象但文件记录未写入，
+// 再次完成时直接使用该对象
+const (
+	UploadStatusActive     = "active"
+	UploadStatusCompleting = "completing"
+	UploadStatusAssembled  = "assembled"
+	UploadStatusCompleted  = "completed"
+	UploadStatusAborted    = "aborted"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadSessionClosed   = errors.New("upload session is not active")
+	ErrUploadSessionBusy     = errors.New("upload session is being completed")
+	ErrInvalidChunk          = errors.New("invalid chunk")
+	ErrUploadIncomplete      = errors.New("upload is incomplete")
+)
+
+type UploadService struct {
+	db       *database.DB
+	storage  file.Storage
+	files    *FileService
+	versions *VersionService
+	cfg      config.UploadConfig
+	logger   *zerolog.Logger
+}
+
+func NewUploadService(cfg config.UploadConfig, db *database.DB, storage file.Storage, files *FileService, versions *VersionService) *UploadService {
+	l := logger.Get()
+	return &UploadService{
+		db:       db,
+		storage:  storage,
+		files:    files,
+		versions: versions,
+		cfg:      cfg,
+		logger:   l,
+	}
+}
+
+type CreateUploadRequest struct {
+	FileName  string
+	FolderID  string
+	Path      string
+	Size      int64
+	ChunkSize int64
+	CreatedBy string
+}
+
+type ReceivedChunk struct {
+	Index  int
+	Offset int64
+	Size   int64
+}
+
+type UploadSessionInfo struct {
+	SessionID     string
+	FileName      string
+	FolderID      *string
+	Path          string
+	Size          int64
+	ChunkSize     int64
+	TotalChunks   int
+	Status        string
+	CreatedBy     string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	Received      []ReceivedChunk
+	ReceivedBytes int64
+}
+
+func (s *UploadService) CreateSession(ctx context.Context, req CreateUploadRequest) (UploadSessionInfo, error) {
+	if req.Size <= 0 {
+		return UploadSessionInfo{}, fmt.Errorf("%w: size must be positive", ErrInvalidChunk)
+	}
+
+	chunkSize := req.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = s.cfg.ChunkSizeMB * 1024 * 1024
+	}
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return UploadSessionInfo{}, fmt.Errorf("%w: chunk size must be between %d and %d bytes", ErrInvalidChunk, MinChunkSize, MaxChunkSize)
+	}
+	// 加密存储按分段加密分片，分片边界须与分段对齐
+	if _, ok := s.storage.(*file.EncryptedStorage); ok && chunkSize%file.EncryptionSegmentSize != 0 {
+		return UploadSessionInfo{}, fmt.Errorf("%w: chunk size must be a multiple of %d bytes", ErrInvalidChunk, file.EncryptionSegmentSize)
+	}
+	if chunkCount(req.Size, chunkSize) > maxUploadParts {
+		return UploadSessionInfo{}, fmt.Errorf("%w: too many chunks, use a larger chunk size", ErrInvalidChunk)
+	}
+
+	// 配额在会话创建时检查，避免分片传完才被拒绝；目标已有文件时按覆盖检查
+	if existing, err := s.db.GetFileByName(req.FileName, folderIDPtr(req.FolderID)); err == nil {
+		if err := s.versions.CheckOverwriteQuota(ctx, existing, req.Size); err != nil {
+			return UploadSessionInfo{}, err
+		}
+	} else if err := s.files.CheckQuota(ctx, req.CreatedBy, req.FolderID, 1, req.Size); err != nil {
+		return UploadSessionInfo{}, err
+	}
+
+	fileID := utils.GenerateFileID()
+	upload, err := s.storage.CreateMultipart(ctx, fileID, req.FileName)
+	if err != nil {
+		s.logger.Error().Err(err).Str("path", req.Path).Msg("failed to create multipart upload")
+		return UploadSessionInfo{}, err
+	}
+
+	now := time.Now().UTC()
+	record := &database.UploadSession{
+		SessionID: utils.GenerateToken(),
+		UploadID:  upload.UploadID,
+		ObjectKey: upload.ObjectKey,
+		FileID:    fileID,
+		FileName:  req.FileName,
+		Path:      req.Path,
+		Size:      req.Size,
+		ChunkSize: chunkSize,
+		Status:    UploadStatusActive,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL()),
+	}
+	if req.FolderID != "" {
+		record.FolderID = &req.FolderID
+	}
+
+	if err := s.db.CreateUploadSession(record); err != nil {
+		s.logger.Error().Err(err).Str("path", req.Path).Msg("failed to create upload session")
+		s.storage.AbortMultipart(ctx, upload)
+		return UploadSessionInfo{}, err
+	}
+
+	s.logger.Info().
+		Str("session_id", record.SessionID).
+		Str("path", req.Path).
+		Int64("size", req.Size).
+		Int64("chunk_size", chunkSize).
+		Msg("upload session created")
+
+	return toUploadSessionInfo(*record, nil), nil
+}
+
+func (s *UploadService) GetSession(ctx context.Context, sessionID string) (UploadSessionInfo, error) {
+	record, err := s.getSession(sessionID)
+	if err != nil {
+		return UploadSessionInfo{}, err
+	}
+
+	parts, err := s.db.ListUploadParts(sessionID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("session_id", sessionID).Msg("failed to list upload parts")
+		return UploadSessionInfo{}, err
+	}
+
+	return toUploadSessionInfo(record, parts), nil
+}
+
+// UploadChunk 写入第 index 个分片（从 0 开始），分片长度必须与会话切分一致
+func (s *UploadService) UploadChunk(ctx context.Context, sessionID string, index int, reader io.Reader, size int64) (ReceivedChunk, error) {
+	record, err := s.getActiveSession(sessionID)
+	if err != nil {
+		return ReceivedChunk{}, err
+	}
+
+	total := chunkCount(record.Size, record.ChunkSize)
+	if index < 0 || index >= total {
+		return ReceivedChunk{}, fmt.Errorf("%w: index %d out of range [0, %d)", ErrInvalidChunk, index, total)
+	}
+
+	offset := int64(index) * record.ChunkSize
+	expected := record.ChunkSize
+	if index == total-1 {
+		expected = record.Size - offset
+	}
+	if size != expected {
+		return ReceivedChunk{}, fmt.Errorf("%w: chunk %d must be %d bytes, got %d", ErrInvalidChunk, index, expected, size)
+	}
+
+	part, err := s.storage.UploadPart(ctx, file.MultipartUpload{UploadID: record.UploadID, ObjectKey: record.ObjectKey}, file.PartInput{
+		PartNumber: index + 1,
+		Offset:     offset,
+		Size:       size,
+		Reader:     reader,
+		Last:       index == total-1,
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Str("session_id", sessionID).Int("index", index).Msg("failed to upload part")
+		return ReceivedChunk{}, err
+	}
+
+	if err := s.db.SaveUploadPart(&database.UploadPart{
+		SessionID:  sessionID,
+		PartNumber: part.PartNumber,
+		Size:       part.Size,
+		ETag:       part.ETag,
+		CreatedAt:  time.Now().UTC(),
+	}); err != nil {
+		s.logger.Error().Err(err).Str("session_id", sessionID).Int("index", index).Msg("failed to record upload part")
+		return ReceivedChunk{}, err
+	}
+
+	// 每收到一个分片就顺延过期时间，长时间的慢速上传不会被回收
+	if err := s.db.TouchUploadSession(sessionID, time.Now().UTC().Add(s.sessionTTL())); err != nil {
+		s.logger.Warn().Err(err).Str("session_id", sessionID).Msg("failed to extend upload session")
+	}
+
+	return ReceivedChunk{Index: index, Offset: offset, Size: part.Size}, nil
+}
+
+// CompleteSession 合并分片并写入文件记录。会话先被置为 completing，同时到达的重复请求返回 ErrUploadSessionBusy；
+// 分片合并后失败时会话转为 assembled，重试时复用已合并的对象
+func (s *UploadService) CompleteSession(ctx context.Context, sessionID string) (FileMetadata, error) {
+	record, err := s.getSession(sessionID)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if record.Status == UploadStatusCompleting {
+		return FileMetadata{}, ErrUploadSessionBusy
+	}
+	if (record.Status != UploadStatusActive && record.Status != UploadStatusAssembled) || time.Now().UTC().After(record.ExpiresAt) {
+		return FileMetadata{}, ErrUploadSessionClosed
+	}
+
+	claimed, err := s.db.TransitionUploadSession(sessionID, record.Status, UploadStatusCompleting)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if !claimed {
+		return FileMetadata{}, ErrUploadSessionBusy
+	}
+
+	saveResult := file.SaveResult{ObjectKey: record.ObjectKey, Size: record.Size, MimeType: record.MimeType}
+	if record.Status == UploadStatusActive {
+		if saveResult, err = s.assemble(ctx, record); err != nil {
+			s.release(sessionID, UploadStatusActive)
+			return FileMetadata{}, err
+		}
+	}
+
+	// 目标路径已有文件时作为新版本写入
+	var metadata FileMetadata
+	if existing, findErr := s.db.GetFileByName(record.FileName, record.FolderID); findErr == nil {
+		metadata, err = s.versions.OverwriteFromObject(ctx, existing.FileID, saveResult, record.CreatedBy)
+	} else {
+		folderID := ""
+		if record.FolderID != nil {
+			folderID = *record.FolderID
+		}
+		metadata, err = s.files.CreateFileFromObject(ctx, saveResult, record.FileID, record.FileName, folderID, record.CreatedBy)
+	}
+	if err != nil {
+		s.release(sessionID, UploadStatusAssembled)
+		return FileMetadata{}, err
+	}
+
+	if err := s.db.UpdateUploadSessionStatus(sessionID, UploadStatusCompleted); err != nil {
+		s.logger.Warn().Err(err).Str("session_id", sessionID).Msg("failed to mark upload session completed")
+	}
+	if err := s.db.DeleteUploadParts(sessionID); err != nil {
+		s.logger.Warn().Err(err).Str("session_id", sessionID).Msg("failed to delete upload parts")
+	}
+
+	s.logger.Info().Str("session_id", sessionID).Str("file_id", metadata.FileID).Msg("upload session completed")
+	return metadata, nil
+}
+
+// assemble 检查分片齐全后合并为对象，并记录对象的 MIME 类型供重试使用
+func (s *UploadService) assemble(ctx context.Context, record database.UploadSession) (file.SaveResult, error) {
+	parts, err := s.db.ListUploadParts(record.SessionID)
+	if err != nil {
+		return file.SaveResult{}, err
+	}
+	if len(parts) != chunkCount(record.Size, record.ChunkSize) {
+		return file.SaveResult{}, fmt.Errorf("%w: received %d of %d chunks", ErrUploadIncomplete, len(parts), chunkCount(record.Size, record.ChunkSize))
+	}
+
+	partInfos := make([]file.PartInfo, 0, len(parts))
+	for _, p := range parts {
+		partInfos = append(partInfos, file.PartInfo{PartNumber: p.PartNumber, ETag: p.ETag, Size: p.Size})
+	}
+
+	saveResult, err := s.storage.CompleteMultipart(ctx, file.MultipartUpload{UploadID: record.UploadID, ObjectKey: record.ObjectKey}, partInfos)
+	if err != nil {
+		s.logger.Error().Err(err).Str("session_id", record.SessionID).Msg("failed to complete multipart upload")
+		return file.SaveResult{}, err
+	}
+	if err := s.db.SetUploadSessionMimeType(record.SessionID, saveResult.MimeType); err != nil {
+		s.logger.Warn().Err(err).Str("session_id", record.SessionID).Msg("failed to record upload mime type")
+	}
+	return saveResult, nil
+}
+
+// release 在完成失败后把会话从 completing 改回 status，允许重试
+func (s *UploadService) release(sessionID, status string) {
+	if _, err := s.db.TransitionUploadSession(sessionID, UploadStatusCompleting, status); err != nil {
+		s.logger.Error().Err(err).Str("session_id", sessionID).Str("status", status).Msg("failed to release upload session")
+	}
+}
+
+func (s *UploadService) AbortSession(ctx context.Context, sessionID string) error {
+	record, err := s.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+	switch record.Status {
+	case UploadStatusActive, UploadStatusAssembled:
+		return s.abort(ctx, record)
+	case UploadStatusCompleting:
+		return ErrUploadSessionBusy
+	default:
+		return ErrUploadSessionClosed
+	}
+}
+
+// CleanupExpiredSessions 回收超过有效期仍未完成的上传会话
+func (s *UploadService) CleanupExpiredSessions(ctx context.Context) (int, error) {
+	sessions, err := s.db.ListExpiredUploadSessions(time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := 0
+	for _, session := range sessions {
+		if err := s.abort(ctx, session); err != nil {
+			s.logger.Error().Err(err).Str("session_id", session.SessionID).Msg("failed to clean up expired upload session")
+			continue
+		}
+		cleaned++
+	}
+
+	if cleaned > 0 {
+		s.logger.Info().Int("count", cleaned).Msg("expired upload sessions cleaned up")
+	}
+	return cleaned, nil
+}
+
+// abort 先把会话置为 aborted，避免与完成请求同时操作分片；已合并的会话删除合并出的对象，
+// 该对象尚未被任何文件记录引用
+func (s *UploadService) abort(ctx context.Context, record database.UploadSession) error {
+	claimed, err := s.db.TransitionUploadSession(record.SessionID, record.Status, UploadStatusAborted)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrUploadSessionBusy
+	}
+
+	if record.Status == UploadStatusAssembled {
+		err = s.storage.Delete(ctx, record.ObjectKey)
+	} else {
+		err = s.storage.AbortMultipart(ctx, file.MultipartUpload{UploadID: record.UploadID, ObjectKey: record.ObjectKey})
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("session_id", record.SessionID).Msg("failed to abort multipart upload")
+		if _, restoreErr := s.db.TransitionUploadSession(record.SessionID, UploadStatusAborted, record.Status); restoreErr != nil {
+			s.logger.Error().Err(restoreErr).Str("session_id", record.SessionID).Msg("failed to restore upload session status")
+		}
+		return err
+	}
+	if err := s.db.DeleteUploadParts(record.SessionID); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("session_id", record.SessionID).Msg("upload session aborted")
+	return nil
+}
+
+func (s *UploadService) getSession(sessionID string) (database.UploadSession, error) {
+	record, err := s.db.GetUploadSession(sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrUploadSessionNotFound
+	}
+	return record, err
+}
+
+func (s *UploadService) getActiveSession(sessionID string) (database.UploadSession, error) {
+	record, err := s.getSession(sessionID)
+	if err != nil {
+		return record, err
+	}
+	if record.Status != UploadStatusActive || time.Now().UTC().After(record.ExpiresAt) {
+		return record, ErrUploadSessionClosed
+	}
+	return record, nil
+}
+
+func (s *UploadService) sessionTTL() time.Duration {
+	hours := s.cfg.SessionTTLHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func chunkCount(size, chunkSize int64) int {
+	return int((size + chunkSize - 1) / chunkSize)
+}
+
+func toUploadSessionInfo(record database.UploadSession, parts []database.UploadPart) UploadSessionInfo {
+	info := UploadSessionInfo{
+		SessionID:   record.SessionID,
+		FileName:    record.FileName,
+		FolderID:    record.FolderID,
+		Path:        record.Path,
+		Size:        record.Size,
+		ChunkSize:   record.ChunkSize,
+		TotalChunks: chunkCount(record.Size, record.ChunkSize),
+		Status:      record.Status,
+		CreatedBy:   record.CreatedBy,
+		CreatedAt:   record.CreatedAt,
+		ExpiresAt:   record.ExpiresAt,
+		Received:    make([]ReceivedChunk, 0, len(parts)),
+	}
+
+	for _, p := range parts {
+		index := p.PartNumber - 1
+		info.Received = append(info.Received, ReceivedChunk{
+			Index:  index,
+			Offset: int64(index) * record.ChunkSize,
+			Size:   p.Size,
+		})
+		info.ReceivedBytes += p.Size
+	}
+	return info
+}
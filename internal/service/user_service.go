@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/logger"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserExists        = errors.New("user already exists")
+	ErrInvalidUsername   = errors.New("invalid username")
+	ErrInvalidRole       = errors.New("role must be admin, editor or viewer")
+	ErrInvalidPermission = errors.New("permission must be none, read or write")
+	ErrPasswordRequired  = errors.New("password is required")
+	ErrLastAdmin         = errors.New("cannot remove or demote the last admin")
+	ErrGrantNotFound     = errors.New("grant not found")
+)
+
+// dummyPasswordHash 用于用户不存在时仍执行一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("claw-pliers"), bcrypt.DefaultCost)
+
+// UserService 管理用户账号及其文件夹授权
+type UserService struct {
+	db     *database.DB
+	logger *zerolog.Logger
+}
+
+func NewUserService(db *database.DB) *UserService {
+	l := logger.Get()
+	return &UserService{
+		db:     db,
+		logger: l,
+	}
+}
+
+type UserInfo struct {
+	Username  string
+	Role      string
+	Disabled  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// UserUpdate 为需要修改的用户字段，nil 表示不修改
+type UserUpdate struct {
+	Password *string
+	Role     *string
+	Disabled *bool
+}
+
+// GrantInfo 为一条文件夹授权，Path 为文件夹当前路径
+type GrantInfo struct {
+	Path       string
+	FolderID   string
+	Username   string
+	Permission string
+	CreatedBy  string
+	CreatedAt  time.Time
+}
+
+func (s *UserService) Create(ctx context.Context, username, password, role string) (UserInfo, error) {
+	if !validUsername(username) {
+		return UserInfo{}, ErrInvalidUsername
+	}
+	if !ValidRole(role) {
+		return UserInfo{}, ErrInvalidRole
+	}
+	if password == "" {
+		return UserInfo{}, ErrPasswordRequired
+	}
+
+	if _, err := s.db.GetUser(username); err == nil {
+		return UserInfo{}, ErrUserExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return UserInfo{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	now := time.Now().UTC()
+	record := &database.User{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.db.CreateUser(record); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Msg("failed to create user")
+		return UserInfo{}, err
+	}
+
+	s.logger.Info().Str("username", username).Str("role", role).Msg("user created")
+	return userInfo(*record), nil
+}
+
+func (s *UserService) List(ctx context.Context) ([]UserInfo, error) {
+	records, err := s.db.ListUsers()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list users")
+		return nil, err
+	}
+
+	users := make([]UserInfo, 0, len(records))
+	for _, r := range records {
+		users = append(users, userInfo(r))
+	}
+	return users, nil
+}
+
+func (s *UserService) Get(ctx context.Context, username string) (UserInfo, error) {
+	record, err := s.db.GetUser(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserInfo{}, ErrUserNotFound
+		}
+		return UserInfo{}, err
+	}
+	return userInfo(record), nil
+}
+
+// Update 修改用户的密码、角色或禁用状态；修改密码或禁用后吊销该用户已签发的刷新令牌
+func (s *UserService) Update(ctx context.Context, username string, update UserUpdate) (UserInfo, error) {
+	current, err := s.db.GetUser(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserInfo{}, ErrUserNotFound
+		}
+		return UserInfo{}, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Role != nil {
+		if !ValidRole(*update.Role) {
+			return UserInfo{}, ErrInvalidRole
+		}
+		updates["role"] = *update.Role
+	}
+	if update.Disabled != nil {
+		updates["disabled"] = *update.Disabled
+	}
+	if update.Password != nil {
+		if *update.Password == "" {
+			return UserInfo{}, ErrPasswordRequired
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return UserInfo{}, err
+		}
+		updates["password_hash"] = string(hash)
+	}
+	if len(updates) == 0 {
+		return userInfo(current), nil
+	}
+
+	demoted := update.Role != nil && *update.Role != RoleAdmin
+	disabled := update.Disabled != nil && *update.Disabled
+	if current.Role == RoleAdmin && !current.Disabled && (demoted || disabled) {
+		if err := s.ensureOtherAdmin(); err != nil {
+			return UserInfo{}, err
+		}
+	}
+
+	if err := s.db.UpdateUser(username, updates); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Msg("failed to update user")
+		return UserInfo{}, err
+	}
+	if update.Password != nil || disabled {
+		if err := s.db.RevokeUserRefreshTokens(username); err != nil {
+			s.logger.Error().Err(err).Str("username", username).Msg("failed to revoke refresh tokens")
+			return UserInfo{}, err
+		}
+	}
+
+	s.logger.Info().Str("username", username).Msg("user updated")
+	return s.Get(ctx, username)
+}
+
+// Delete 删除用户及其授权，并吊销其刷新令牌
+func (s *UserService) Delete(ctx context.Context, username string) error {
+	current, err := s.db.GetUser(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if current.Role == RoleAdmin && !current.Disabled {
+		if err := s.ensureOtherAdmin(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.DeleteUser(username); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Msg("failed to delete user")
+		return err
+	}
+	if err := s.db.RevokeUserRefreshTokens(username); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Msg("failed to revoke refresh tokens")
+		return err
+	}
+
+	s.logger.Info().Str("username", username).Msg("user deleted")
+	return nil
+}
+
+// Authenticate 校验用户名和密码，用户不存在、已禁用或密码错误时均返回 ErrInvalidCredentials
+func (s *UserService) Authenticate(ctx context.Context, username, password string) (UserInfo, error) {
+	record, err := s.db.GetUser(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return UserInfo{}, ErrInvalidCredentials
+		}
+		return UserInfo{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(record.PasswordHash), []byte(password)); err != nil {
+		return UserInfo{}, ErrInvalidCredentials
+	}
+	if record.Disabled {
+		return UserInfo{}, ErrInvalidCredentials
+	}
+	return userInfo(record), nil
+}
+
+// EnsureAdmin 在用户不存在时以配置中的管理员账号密码创建管理员，已存在时不做修改
+func (s *UserService) EnsureAdmin(ctx context.Context, username, password string) error {
+	if username == "" || password == "" {
+		return nil
+	}
+	if _, err := s.db.GetUser(username); err == nil {
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	_, err := s.Create(ctx, username, password, RoleAdmin)
+	return err
+}
+
+// Grant 设置用户对文件夹（nil 表示根目录）的权限
+func (s *UserService) Grant(ctx context.Context, folderID *string, username, permission, grantedBy string) error {
+	if !ValidPermission(permission) {
+		return ErrInvalidPermission
+	}
+	if _, err := s.Get(ctx, username); err != nil {
+		return err
+	}
+
+	record := &database.FolderGrant{
+		FolderID:   grantKey(folderID),
+		Username:   username,
+		Permission: permission,
+		CreatedBy:  grantedBy,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.db.SetFolderGrant(record); err != nil {
+		s.logger.Error().Err(err).Str("username", username).Str("folder_id", record.FolderID).Msg("failed to set folder grant")
+		return err
+	}
+
+	s.logger.Info().Str("username", username).Str("folder_id", record.FolderID).Str("permission", permission).Msg("folder grant set")
+	return nil
+}
+
+// Revoke 删除用户在文件夹上的授权，之后该文件夹沿用上级的授权
+func (s *UserService) Revoke(ctx context.Context, folderID *string, username string) error {
+	if err := s.db.DeleteFolderGrant(grantKey(folderID), username); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGrantNotFound
+		}
+		return err
+	}
+
+	s.logger.Info().Str("username", username).Str("folder_id", grantKey(folderID)).Msg("folder grant revoked")
+	return nil
+}
+
+// ListGrants 返回文件夹上的授权，all 为 true 时返回全部授权
+func (s *UserService) ListGrants(ctx context.Context, folderID *string, all bool) ([]GrantInfo, error) {
+	var filter *string
+	if !all {
+		key := grantKey(folderID)
+		filter = &key
+	}
+
+	records, err := s.db.ListFolderGrants(filter)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list folder grants")
+		return nil, err
+	}
+
+	grants := make([]GrantInfo, 0, len(records))
+	for _, g := range records {
+		path := "/"
+		if g.FolderID != "" {
+			if path, err = s.db.GetFolderPath(g.FolderID); err != nil {
+				// 文件夹已在回收站中，授权在恢复后继续生效
+				continue
+			}
+		}
+		grants = append(grants, GrantInfo{
+			Path:       path,
+			FolderID:   g.FolderID,
+			Username:   g.Username,
+			Permission: g.Permission,
+			CreatedBy:  g.CreatedBy,
+			CreatedAt:  g.CreatedAt,
+		})
+	}
+	return grants, nil
+}
+
+func (s *UserService) ensureOtherAdmin() error {
+	count, err := s.db.CountActiveAdmins()
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func userInfo(r database.User) UserInfo {
+	return UserInfo{
+		Username:  r.Username,
+		Role:      r.Role,
+		Disabled:  r.Disabled,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+// validUsername 限制用户名不含空白和斜杠，并保留 local 给 X-Local-Key 使用
+func validUsername(name string) bool {
+	if name == "" || len(name) > 64 || name == LocalPrincipal.Name {
+		return false
+	}
+	return !strings.ContainsAny(name, " \t\r\n/\\:")
+}
+
+func grantKey(folderID *string) string {
+	if folderID == nil {
+		return ""
+	}
+	return *folderID
+}
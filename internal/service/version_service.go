@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kiry163/claw-pliers/internal/config"
+	"github.com/kiry163/claw-pliers/internal/database"
+	"github.com/kiry163/claw-pliers/internal/file"
+	"github.com/kiry163/claw-pliers/internal/logger"
+	"github.com/kiry163/claw-pliers/internal/utils"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileNotFound        = errors.New("file not found")
+	ErrVersionNotFound     = errors.New("version not found")
+	ErrContentHashMismatch = errors.New("content hash mismatch")
+)
+
+type VersionService struct {
+	cfg     config.VersionConfig
+	db      *database.DB
+	storage file.Storage
+	quotas  *QuotaService
+	logger  *zerolog.Logger
+}
+
+func NewVersionService(cfg config.VersionConfig, db *database.DB, storage file.Storage, quotas *QuotaService) *VersionService {
+	l := logger.Get()
+	return &VersionService{
+		cfg:     cfg,
+		db:      db,
+		storage: storage,
+		quotas:  quotas,
+		logger:  l,
+	}
+}
+
+// FileVersionInfo 描述文件的一个版本，Current 为 true 时表示当前版本
+type FileVersionInfo struct {
+	FileID     string
+	Version    int
+	Current    bool
+	Name       string
+	ObjectKey  string
+	Size       int64
+	MimeType   string
+	SHA256     string
+	CreatedBy  string
+	CreatedAt  time.Time
+	ArchivedAt time.Time
+}
+
+// Overwrite 以新内容覆盖文件，原内容保存为历史版本；expectedHash 非空时内容不一致会放弃覆盖并返回 ErrContentHashMismatch
+func (s *VersionService) Overwrite(ctx context.Context, fileID string, reader io.Reader, size int64, expectedHash, updatedBy string) (FileMetadata, error) {
+	record, err := s.getFile(fileID)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if err := s.CheckOverwriteQuota(ctx, record, size); err != nil {
+		return FileMetadata{}, err
+	}
+
+	// 新内容使用独立的对象键，避免覆盖历史版本引用的对象
+	hasher := sha256.New()
+	saveResult, err := s.storage.Save(ctx, io.TeeReader(reader, hasher), size, utils.GenerateFileID(), record.OriginalName)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to save file to storage")
+		return FileMetadata{}, err
+	}
+
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	if expectedHash != "" && contentHash != expectedHash {
+		s.deleteObject(ctx, saveResult.ObjectKey)
+		return FileMetadata{}, ErrContentHashMismatch
+	}
+
+	metadata, err := s.replace(ctx, fileID, saveResult, contentHash, updatedBy)
+	if err != nil {
+		s.deleteObject(ctx, saveResult.ObjectKey)
+	}
+	return metadata, err
+}
+
+// OverwriteFromObject 以已写入存储的对象（如分片合并结果）覆盖文件，失败时对象保留，由调用方决定重试或删除
+func (s *VersionService) OverwriteFromObject(ctx context.Context, fileID string, saveResult file.SaveResult, updatedBy string) (FileMetadata, error) {
+	contentHash, err := hashObject(ctx, s.storage, saveResult.ObjectKey)
+	if err != nil {
+		s.logger.Error().Err(err).Str("object_key", saveResult.ObjectKey).Msg("failed to hash object")
+		return FileMetadata{}, err
+	}
+
+	return s.replace(ctx, fileID, saveResult, contentHash, updatedBy)
+}
+
+// OverwriteFromHash 复用已存储的相同内容覆盖文件；内容不存在时返回 ErrContentNotFound
+func (s *VersionService) OverwriteFromHash(ctx context.Context, fileID, contentHash, updatedBy string) (FileMetadata, error) {
+	current, err := s.getFile(fileID)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	object, err := s.db.GetStorageObjectByHash(contentHash)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileMetadata{}, ErrContentNotFound
+		}
+		return FileMetadata{}, err
+	}
+	if err := s.CheckOverwriteQuota(ctx, current, object.Size); err != nil {
+		return FileMetadata{}, err
+	}
+
+	record, _, err := s.db.ReplaceFileContent(fileID, database.StorageObject{SHA256: contentHash}, updatedBy)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileMetadata{}, ErrContentNotFound
+		}
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to overwrite file from hash")
+		return FileMetadata{}, err
+	}
+
+	s.logger.Info().Str("file_id", fileID).Int("version", record.Version).Msg("file overwritten from existing content")
+	s.Prune(ctx, fileID)
+
+	metadata := toFileMetadata(record)
+	metadata.Deduplicated = true
+	return metadata, nil
+}
+
+// CheckOverwriteQuota 检查以 size 字节的新内容覆盖文件是否超出配额，记在文件创建者名下。
+// 原内容成为历史版本后仍占用配额，因此按新内容的全部大小计入，扣除覆盖后按保留策略将被清理的历史版本
+func (s *VersionService) CheckOverwriteQuota(ctx context.Context, record database.File, size int64) error {
+	versions, err := s.db.ListFileVersions(record.FileID)
+	if err != nil {
+		return err
+	}
+
+	var released int64
+	cutoff := s.cutoff()
+	for i, v := range versions {
+		// 覆盖后原内容成为最新的历史版本，已有历史版本的序号后移一位
+		if s.expired(i+1, v, cutoff) {
+			released += v.Size
+		}
+	}
+	return s.quotas.Check(ctx, record.CreatedBy, record.FolderID, 0, size-released)
+}
+
+// replace 登记新内容为当前版本；相同内容已存在于其他对象时删除刚写入的副本
+func (s *VersionService) replace(ctx context.Context, fileID string, saveResult file.SaveResult, contentHash, updatedBy string) (FileMetadata, error) {
+	now := time.Now().UTC()
+	record, reused, err := s.db.ReplaceFileContent(fileID, database.StorageObject{
+		SHA256:    contentHash,
+		ObjectKey: saveResult.ObjectKey,
+		Size:      saveResult.Size,
+		MimeType:  saveResult.MimeType,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, updatedBy)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to overwrite file")
+		return FileMetadata{}, err
+	}
+	if reused && record.ObjectKey != saveResult.ObjectKey {
+		s.deleteObject(ctx, saveResult.ObjectKey)
+	}
+
+	s.logger.Info().
+		Str("file_id", fileID).
+		Int("version", record.Version).
+		Int64("size", record.Size).
+		Bool("deduplicated", reused).
+		Msg("file overwritten")
+	s.Prune(ctx, fileID)
+
+	metadata := toFileMetadata(record)
+	metadata.Deduplicated = reused
+	return metadata, nil
+}
+
+// List 返回文件的全部版本，当前版本在前，历史版本按版本号倒序
+func (s *VersionService) List(ctx context.Context, fileID string) ([]FileVersionInfo, error) {
+	record, err := s.getFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.db.ListFileVersions(fileID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to list file versions")
+		return nil, err
+	}
+
+	items := make([]FileVersionInfo, 0, len(versions)+1)
+	items = append(items, currentVersionInfo(record))
+	for _, v := range versions {
+		items = append(items, versionInfo(record, v))
+	}
+	return items, nil
+}
+
+// Get 返回指定版本，版本号为当前版本时返回文件本身
+func (s *VersionService) Get(ctx context.Context, fileID string, version int) (FileVersionInfo, error) {
+	record, err := s.getFile(fileID)
+	if err != nil {
+		return FileVersionInfo{}, err
+	}
+	if version == record.Version {
+		return currentVersionInfo(record), nil
+	}
+
+	v, err := s.db.GetFileVersion(fileID, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FileVersionInfo{}, ErrVersionNotFound
+		}
+		return FileVersionInfo{}, err
+	}
+	return versionInfo(record, v), nil
+}
+
+// Promote 以历史版本的内容生成新的当前版本，原当前版本保存为历史版本
+func (s *VersionService) Promote(ctx context.Context, fileID string, version int, promotedBy string) (FileMetadata, error) {
+	target, err := s.Get(ctx, fileID, version)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if target.Current {
+		return s.currentMetadata(fileID)
+	}
+
+	if target.SHA256 != "" {
+		metadata, err := s.OverwriteFromHash(ctx, fileID, target.SHA256, promotedBy)
+		if !errors.Is(err, ErrContentNotFound) {
+			return metadata, err
+		}
+	}
+
+	// 早期内容没有登记去重信息，无法共享对象，复制一份后再覆盖
+	reader, _, err := s.storage.Get(ctx, target.ObjectKey, nil, nil)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Int("version", version).Msg("failed to read version content")
+		return FileMetadata{}, err
+	}
+	defer reader.Close()
+
+	return s.Overwrite(ctx, fileID, reader, target.Size, "", promotedBy)
+}
+
+func (s *VersionService) getFile(fileID string) (database.File, error) {
+	record, err := s.db.GetFile(fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrFileNotFound
+	}
+	return record, err
+}
+
+func (s *VersionService) currentMetadata(fileID string) (FileMetadata, error) {
+	record, err := s.getFile(fileID)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	return toFileMetadata(record), nil
+}
+
+// Prune 按保留策略清理单个文件的历史版本
+func (s *VersionService) Prune(ctx context.Context, fileID string) {
+	if s.cfg.KeepVersions <= 0 && s.cfg.KeepDays <= 0 {
+		return
+	}
+
+	versions, err := s.db.ListFileVersions(fileID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", fileID).Msg("failed to list file versions")
+		return
+	}
+
+	cutoff := s.cutoff()
+	for i, v := range versions {
+		if s.expired(i, v, cutoff) {
+			s.deleteVersion(ctx, v)
+		}
+	}
+}
+
+// expired 判断按版本号倒序排在第 index 位的历史版本是否超出保留策略
+func (s *VersionService) expired(index int, v database.FileVersion, cutoff time.Time) bool {
+	tooMany := s.cfg.KeepVersions > 0 && index >= s.cfg.KeepVersions
+	tooOld := s.cfg.KeepDays > 0 && v.ArchivedAt.Before(cutoff)
+	return tooMany || tooOld
+}
+
+// PruneExpired 删除超过保留天数的历史版本
+func (s *VersionService) PruneExpired(ctx context.Context) (int, error) {
+	if s.cfg.KeepDays <= 0 {
+		return 0, nil
+	}
+
+	versions, err := s.db.ListFileVersionsArchivedBefore(s.cutoff())
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, v := range versions {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+		if s.deleteVersion(ctx, v) {
+			pruned++
+		}
+	}
+
+	if pruned > 0 {
+		s.logger.Info().Int("count", pruned).Msg("expired file versions pruned")
+	}
+	return pruned, nil
+}
+
+func (s *VersionService) cutoff() time.Time {
+	return time.Now().UTC().Add(-time.Duration(s.cfg.KeepDays) * 24 * time.Hour)
+}
+
+func (s *VersionService) deleteVersion(ctx context.Context, v database.FileVersion) bool {
+	_, released, err := s.db.DeleteFileVersion(v.ID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("file_id", v.FileID).Int("version", v.Version).Msg("failed to delete file version")
+		return false
+	}
+	if released {
+		s.deleteObject(ctx, v.ObjectKey)
+	}
+	return true
+}
+
+func (s *VersionService) deleteObject(ctx context.Context, objectKey string) {
+	if err := s.storage.Delete(ctx, objectKey); err != nil {
+		s.logger.Error().Err(err).Str("object_key", objectKey).Msg("failed to delete version object")
+	}
+}
+
+func currentVersionInfo(record database.File) FileVersionInfo {
+	createdBy := record.UpdatedBy
+	if createdBy == "" {
+		createdBy = record.CreatedBy
+	}
+	return FileVersionInfo{
+		FileID:    record.FileID,
+		Version:   record.Version,
+		Current:   true,
+		Name:      record.OriginalName,
+		ObjectKey: record.ObjectKey,
+		Size:      record.Size,
+		MimeType:  record.MimeType,
+		SHA256:    record.SHA256,
+		CreatedBy: createdBy,
+		CreatedAt: record.UpdatedAt,
+	}
+}
+
+func versionInfo(record database.File, v database.FileVersion) FileVersionInfo {
+	return FileVersionInfo{
+		FileID:     v.FileID,
+		Version:    v.Version,
+		Name:       record.OriginalName,
+		ObjectKey:  v.ObjectKey,
+		Size:       v.Size,
+		MimeType:   v.MimeType,
+		SHA256:     v.SHA256,
+		CreatedBy:  v.CreatedBy,
+		CreatedAt:  v.CreatedAt,
+		ArchivedAt: v.ArchivedAt,
+	}
+}